@@ -0,0 +1,225 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultBackupAgentImage = "jsanda/cassandra-backup-agent:latest"
+
+	// StorageAccessKeyIDKey and StorageSecretAccessKeyKey are the keys of the
+	// credentials in the storage secret
+	StorageAccessKeyIDKey     = "access-key-id"
+	StorageSecretAccessKeyKey = "secret-access-key"
+)
+
+// BackupSpec configures where the backups of a cluster are stored. A backup
+// agent sidecar that uploads the snapshots is added to the Cassandra pods.
+type BackupSpec struct {
+	Storage StorageSpec `json:"storage"`
+
+	// AgentImage is the image of the backup agent sidecar. Defaults to
+	// jsanda/cassandra-backup-agent:latest.
+	AgentImage string `json:"agentImage,omitempty"`
+
+	AgentResources corev1.ResourceRequirements `json:"agentResources,omitempty"`
+
+	// CommitLogArchiving makes the nodes archive their commitlog segments, which
+	// the backup agent ships to the object storage, so that restores can replay
+	// the writes made after a backup up to a point in time
+	CommitLogArchiving bool `json:"commitLogArchiving,omitempty"`
+
+	// IncrementalBackups sets incremental_backups in cassandra.yaml, which makes
+	// the nodes hard link every SSTable they flush into the backups directory of
+	// its table. Incremental CassandraBackups upload these SSTables instead of a
+	// snapshot. The SSTables of all backups of the cluster are then stored in a
+	// prefix shared by the backups of a node, where each SSTable is only stored
+	// once.
+	IncrementalBackups bool `json:"incrementalBackups,omitempty"`
+}
+
+// StorageSpec is an S3 compatible bucket, e.g. in AWS S3 or MinIO
+type StorageSpec struct {
+	Bucket string `json:"bucket"`
+
+	// Prefix is prepended to the keys of all objects
+	Prefix string `json:"prefix,omitempty"`
+
+	// Endpoint is the host and port of the object storage. Defaults to
+	// s3.amazonaws.com.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	Region string `json:"region,omitempty"`
+
+	// Insecure connects to the endpoint over http instead of https
+	Insecure bool `json:"insecure,omitempty"`
+
+	// CredentialsSecretName is the secret holding the access key in the
+	// access-key-id and secret-access-key keys
+	CredentialsSecretName string `json:"credentialsSecretName"`
+}
+
+// CassandraBackupSpec defines the desired state of CassandraBackup
+type CassandraBackupSpec struct {
+	// ClusterRef references the CassandraCluster, in the same namespace, that is
+	// backed up. The cluster has to have backups configured.
+	ClusterRef corev1.LocalObjectReference `json:"clusterRef"`
+
+	// Keyspaces are the keyspaces to back up. Defaults to all keyspaces.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+
+	// Incremental uploads the SSTables that the nodes have flushed since the
+	// previous backup of the cluster, which the backup builds on, instead of
+	// taking a snapshot. Data that has not been flushed yet is not included. The
+	// cluster has to have incrementalBackups enabled and a completed backup that
+	// was taken with incrementalBackups enabled.
+	Incremental bool `json:"incremental,omitempty"`
+
+	// Cancel stops the backup if it has not finished. The uploads are canceled
+	// and the backup fails. The files it has uploaded stay in the object storage
+	// until the backup is deleted by the retention of its schedule.
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+type BackupPhase string
+
+const (
+	BackupPhaseSnapshotting BackupPhase = "Snapshotting"
+	BackupPhaseUploading    BackupPhase = "Uploading"
+	BackupPhaseCompleted    BackupPhase = "Completed"
+	BackupPhaseFailed       BackupPhase = "Failed"
+)
+
+type NodeBackupPhase string
+
+const (
+	NodeBackupPhaseSnapshotted NodeBackupPhase = "Snapshotted"
+	NodeBackupPhaseUploading   NodeBackupPhase = "Uploading"
+	NodeBackupPhaseCompleted   NodeBackupPhase = "Completed"
+	NodeBackupPhaseFailed      NodeBackupPhase = "Failed"
+)
+
+// NodeBackupStatus is the backup of one node
+type NodeBackupStatus struct {
+	Pod        string          `json:"pod"`
+	Datacenter string          `json:"datacenter,omitempty"`
+	Rack       string          `json:"rack,omitempty"`
+	Phase      NodeBackupPhase `json:"phase"`
+
+	// ManifestKey is the object listing the files of the node
+	ManifestKey string `json:"manifestKey,omitempty"`
+
+	// CommitLogSegmentID is the oldest commitlog segment of the node when its
+	// snapshot was taken, if commitlog archiving is enabled
+	CommitLogSegmentID int64 `json:"commitLogSegmentId,omitempty"`
+
+	// Files is the number of files that have been uploaded
+	Files int32 `json:"files,omitempty"`
+
+	// Size is the number of bytes that have been uploaded
+	Size int64 `json:"size,omitempty"`
+
+	// SkippedFiles is the number of SSTables of an incremental backup that were
+	// uploaded by an earlier backup
+	SkippedFiles int32 `json:"skippedFiles,omitempty"`
+
+	// Duration is the time the upload took
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// CassandraBackupStatus defines the observed state of CassandraBackup
+type CassandraBackupStatus struct {
+	Phase BackupPhase `json:"phase,omitempty"`
+
+	// SnapshotName is the name of the snapshot taken on every node
+	SnapshotName string `json:"snapshotName,omitempty"`
+
+	// BaseBackup is the backup an incremental backup builds on
+	BaseBackup string `json:"baseBackup,omitempty"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Size is the total number of bytes uploaded
+	Size int64 `json:"size,omitempty"`
+
+	Nodes []NodeBackupStatus `json:"nodes,omitempty"`
+
+	// Error is the reason the backup failed or could not be reconciled
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterRef.name`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.status.size`
+// +kubebuilder:printcolumn:name="Completed",type=date,JSONPath=`.status.completionTime`
+
+// CassandraBackup is the Schema for the cassandrabackups API. A backup takes a
+// snapshot on every node of the cluster and uploads it to the object storage
+// configured in the cluster.
+type CassandraBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraBackupSpec   `json:"spec,omitempty"`
+	Status CassandraBackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CassandraBackupList contains a list of CassandraBackup
+type CassandraBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CassandraBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CassandraBackup{}, &CassandraBackupList{})
+}
+
+// IsFinished returns true if the backup has completed or failed
+func (b *CassandraBackup) IsFinished() bool {
+	return b.Status.Phase == BackupPhaseCompleted || b.Status.Phase == BackupPhaseFailed
+}
+
+func (c *CassandraCluster) IsBackupEnabled() bool {
+	return c.Spec.Backup != nil
+}
+
+func (c *CassandraCluster) IsCommitLogArchivingEnabled() bool {
+	return c.Spec.Backup != nil && c.Spec.Backup.CommitLogArchiving
+}
+
+func (c *CassandraCluster) IsIncrementalBackupsEnabled() bool {
+	return c.Spec.Backup != nil && c.Spec.Backup.IncrementalBackups
+}
+
+func (c *CassandraCluster) GetBackupAgentImage() string {
+	if c.Spec.Backup == nil || c.Spec.Backup.AgentImage == "" {
+		return defaultBackupAgentImage
+	}
+	return c.Spec.Backup.AgentImage
+}
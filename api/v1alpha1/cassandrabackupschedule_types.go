@@ -0,0 +1,147 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupScheduleLabel is the label of the backups created by a
+// CassandraBackupSchedule
+const BackupScheduleLabel = "cassandra.apache.org/backup-schedule"
+
+// CassandraBackupScheduleSpec defines the desired state of CassandraBackupSchedule
+type CassandraBackupScheduleSpec struct {
+	// ClusterRef references the CassandraCluster, in the same namespace, that is
+	// backed up. The cluster has to have backups configured.
+	ClusterRef corev1.LocalObjectReference `json:"clusterRef"`
+
+	// Schedule is the cron expression, in UTC, for creating backups
+	Schedule string `json:"schedule"`
+
+	// Keyspaces are the keyspaces to back up. Defaults to all keyspaces.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+
+	// Incremental makes the backups upload the SSTables that the nodes have
+	// flushed since the previous backup instead of taking snapshots. See
+	// CassandraBackupSpec.Incremental.
+	Incremental bool `json:"incremental,omitempty"`
+
+	// ConcurrencyPolicy decides what happens when a backup is due while an
+	// earlier one is still running. Defaults to Forbid.
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// Retention decides which completed backups are kept. Backups that are not
+	// kept are deleted along with their files in the object storage. Defaults to
+	// keeping all backups.
+	Retention BackupRetention `json:"retention,omitempty"`
+
+	// Suspend keeps new backups from being created. Running backups are not
+	// affected.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// ConcurrencyPolicy is how overlapping backups are handled
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent starts the new backup alongside the running ones
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+
+	// ForbidConcurrent skips the new backup
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+
+	// ReplaceConcurrent cancels the running backups and starts the new one. The
+	// canceled backups fail and are deleted by the retention of the schedule.
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+// BackupRetention keeps a backup if any of its rules keeps it
+type BackupRetention struct {
+	// KeepLast is the number of most recent backups to keep
+	// +kubebuilder:validation:Minimum=0
+	KeepLast int32 `json:"keepLast,omitempty"`
+
+	// KeepDaily keeps the most recent backup of each of the last days that have
+	// a backup
+	// +kubebuilder:validation:Minimum=0
+	KeepDaily int32 `json:"keepDaily,omitempty"`
+
+	// KeepWeekly keeps the most recent backup of each of the last weeks that
+	// have a backup
+	// +kubebuilder:validation:Minimum=0
+	KeepWeekly int32 `json:"keepWeekly,omitempty"`
+
+	// KeepMonthly keeps the most recent backup of each of the last months that
+	// have a backup
+	// +kubebuilder:validation:Minimum=0
+	KeepMonthly int32 `json:"keepMonthly,omitempty"`
+}
+
+// CassandraBackupScheduleStatus defines the observed state of CassandraBackupSchedule
+type CassandraBackupScheduleStatus struct {
+	// LastScheduleTime is the last time a backup was due
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulBackup is the most recent backup that completed
+	LastSuccessfulBackup string `json:"lastSuccessfulBackup,omitempty"`
+
+	// Active are the backups that are running
+	Active []string `json:"active,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterRef.name`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+
+// CassandraBackupSchedule is the Schema for the cassandrabackupschedules API. It
+// creates CassandraBackups on a cron schedule and deletes the ones that the
+// retention policy no longer keeps.
+type CassandraBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraBackupScheduleSpec   `json:"spec,omitempty"`
+	Status CassandraBackupScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CassandraBackupScheduleList contains a list of CassandraBackupSchedule
+type CassandraBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CassandraBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CassandraBackupSchedule{}, &CassandraBackupScheduleList{})
+}
+
+func (s *CassandraBackupSchedule) GetConcurrencyPolicy() ConcurrencyPolicy {
+	if s.Spec.ConcurrencyPolicy == "" {
+		return ForbidConcurrent
+	}
+	return s.Spec.ConcurrencyPolicy
+}
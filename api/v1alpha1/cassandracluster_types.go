@@ -18,12 +18,16 @@ package v1alpha1
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/Jeffail/gabs"
 	"github.com/jsanda/cassandra-operator/pkg/serverconfig"
 
 	//"github.com/datastax/cass-operator/operator/pkg/serverconfig"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sort"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -37,11 +41,73 @@ const (
 
 	ManagedByLabelValue = "cassandra-operator"
 
+	// DatacenterLabel is the operator's label for the datacenter name
+	DatacenterLabel = "cassandra.apache.org/datacenter"
+
+	// RackLabel is the operator's label for the rack name
+	RackLabel = "cassandra.apache.org/rack"
+
 	// SeedNodeLabel is the operator's label for the seed node state
 	SeedNodeLabel = "cassandra.apache.org/seed-node"
 
+	// ReaperLabel is the operator's label for the Reaper instance of a cluster.
+	// Reaper pods do not carry the cluster label since the anti-affinity of the
+	// Cassandra pods matches on it.
+	ReaperLabel = "cassandra.apache.org/reaper"
+
+	// BroadcastRPCAddressAnnotation is the pod annotation holding the address
+	// that is advertised to clients as broadcast_rpc_address
+	BroadcastRPCAddressAnnotation = "cassandra.apache.org/broadcast-rpc-address"
+
+	// ConfigHashAnnotation is the pod annotation holding the hash of the
+	// rendered configuration the pod was created with
+	ConfigHashAnnotation = "cassandra.apache.org/config-hash"
+
+	// AllowDeletionAnnotation has to be set to "true" on a cluster with deletion
+	// protection before its deletion proceeds
+	AllowDeletionAnnotation = "cassandra.apache.org/allow-deletion"
+
+	// ClusterUIDAnnotation is the annotation holding the UID of the cluster
+	// that the final backup was taken for
+	ClusterUIDAnnotation = "cassandra.apache.org/cluster-uid"
+
+	// ClusterFinalizer makes sure that the deletion policy of the cluster is
+	// applied before the CassandraCluster is deleted
+	ClusterFinalizer = "cassandra.apache.org/cluster"
+
 	defaultConfigBuilderImage = "datastax/cass-config-builder:1.0.1"
 
+	defaultCassandraImage = "jsanda/cassandra:operator-3.11.6-latest"
+
+	// defaultRackName matches the rack of the StatefulSets created before racks
+	// could be declared, so that they keep being managed
+	defaultRackName = "rack-1"
+
+	defaultReaperImage = "thelastpickle/cassandra-reaper:2.0.5"
+
+	defaultReaperKeyspace = "reaper_db"
+
+	defaultRepairScheduleDaysBetween int32 = 7
+
+	// DefaultReaperPort is the port of the REST API of Reaper
+	DefaultReaperPort int32 = 8080
+
+	defaultMetricsExporterImage = "criteord/cassandra_exporter:2.3.4"
+
+	// DefaultMetricsPort is the port the metrics exporter serves metrics on
+	DefaultMetricsPort int32 = 9500
+
+	// MetricsServiceLabel marks the service that the ServiceMonitor of a cluster
+	// selects
+	MetricsServiceLabel = "cassandra.apache.org/metrics"
+
+	defaultLogTailerImage = "busybox:1.32"
+
+	// RootLogger is the name of the root logger in Spec.Logging.Loggers
+	RootLogger = "ROOT"
+
+	defaultSystemReplicationFactor = 3
+
 	DefaultLivenessProbeInitialDelay int32 = 120
 	DefaultLivenessProbeTimeout      int32 = 20
 	DefaultLivenessProbePeriod       int32 = 10
@@ -49,18 +115,226 @@ const (
 	DefaultReadinessProbeInitialDelay int32 = 60
 	DefaultReadinessProbeTimeout      int32 = 10
 	DefaultReadinessProbePeriod       int32 = 10
+
+	DefaultCQLPort     int32 = 9042
+	DefaultStoragePort int32 = 7000
+	DefaultJMXPort     int32 = 7199
+
+	DefaultSSLStoragePort int32 = 7001
+
+	DefaultNodesPerRack int32 = 1
+
+	// KeystorePasswordPlaceholder is written to cassandra.yaml in place of the
+	// keystore and truststore passwords. The keystore init container replaces it
+	// so that the password does not end up in the pod spec.
+	KeystorePasswordPlaceholder = "KEYSTORE_PASSWORD_PLACEHOLDER"
+
+	// InternodeKeystoreDir is where the keystore init container writes the
+	// keystore and truststore used for internode encryption
+	InternodeKeystoreDir = "/keystores/internode"
+
+	// ClientKeystoreDir is where the keystore init container writes the keystore
+	// and truststore used for client encryption
+	ClientKeystoreDir = "/keystores/client"
+
+	// DefaultTerminationGracePeriod leaves time for nodetool drain to finish
+	// before the cassandra container is killed.
+	DefaultTerminationGracePeriod int64 = 120
 )
 
 type Rack struct {
 	Name string `json:"name,omitempty"`
+
+	// Config is deep-merged over the cluster and datacenter configuration for
+	// the nodes in this rack.
+	// +kubebuilder:validation:PreserveUnknownFields=true
+	Config json.RawMessage `json:"config,omitempty"`
 }
 
 type Datacenter struct {
 	Name string `json:"name,omitempty"`
 
+	// NodesPerRack is the number of nodes in each rack. It defaults to 1.
+	// +kubebuilder:validation:Minimum=1
 	NodesPerRack int32 `json:"nodesPerRack,omitempty"`
 
+	// Racks are the racks of the datacenter. A datacenter without racks gets a
+	// single rack named rack-1.
 	Racks []Rack `json:"racks,omitempty"`
+
+	// Config is deep-merged over the cluster configuration for the nodes in
+	// this datacenter.
+	// +kubebuilder:validation:PreserveUnknownFields=true
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// Expose creates an additional service that makes the native transport port
+	// of the datacenter reachable from outside of the Kubernetes cluster.
+	Expose *ExposeSpec `json:"expose,omitempty"`
+
+	// RebuildFrom is the datacenter that the nodes stream their data from when
+	// the datacenter is added to a running cluster. Defaults to the first
+	// datacenter of the cluster.
+	RebuildFrom string `json:"rebuildFrom,omitempty"`
+}
+
+// ExposeSpec configures a NodePort or LoadBalancer service for CQL clients
+type ExposeSpec struct {
+	// +kubebuilder:validation:Enum=NodePort;LoadBalancer
+	Type corev1.ServiceType `json:"type"`
+
+	// Annotations are added to the service, e.g. to configure a cloud load balancer.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicyType `json:"externalTrafficPolicy,omitempty"`
+
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+}
+
+// GetRacks returns the racks of the datacenter. A datacenter that does not
+// declare any racks gets a single default rack.
+func (dc *Datacenter) GetRacks() []Rack {
+	if len(dc.Racks) == 0 {
+		return []Rack{{Name: defaultRackName}}
+	}
+	return dc.Racks
+}
+
+// GetNodesPerRack returns the number of nodes in each rack of the datacenter
+func (dc *Datacenter) GetNodesPerRack() int32 {
+	if dc.NodesPerRack == 0 {
+		return DefaultNodesPerRack
+	}
+	return dc.NodesPerRack
+}
+
+// GetSize returns the number of nodes in the datacenter
+func (dc *Datacenter) GetSize() int32 {
+	return dc.GetNodesPerRack() * int32(len(dc.GetRacks()))
+}
+
+// Ports configures the ports that Cassandra listens on. Ports that are not set
+// use the Cassandra defaults.
+type Ports struct {
+	// CQL is the native transport port.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	CQL int32 `json:"cql,omitempty"`
+
+	// Storage is the port used for internode communication.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Storage int32 `json:"storage,omitempty"`
+
+	// JMX is the port nodetool connects to.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	JMX int32 `json:"jmx,omitempty"`
+
+	// SSLStorage is the port used for internode communication when internode
+	// encryption is enabled.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	SSLStorage int32 `json:"sslStorage,omitempty"`
+
+	// CQLSSL is the encrypted native transport port when client encryption is
+	// enabled. When it is set, unencrypted connections are still accepted on the
+	// CQL port. Otherwise the CQL port only accepts encrypted connections.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	CQLSSL int32 `json:"cqlSSL,omitempty"`
+}
+
+// SecuritySpec configures authentication and encryption for the cluster
+type SecuritySpec struct {
+	Authentication AuthenticationSpec `json:"authentication,omitempty"`
+
+	InternodeEncryption *InternodeEncryptionSpec `json:"internodeEncryption,omitempty"`
+
+	ClientEncryption *ClientEncryptionSpec `json:"clientEncryption,omitempty"`
+}
+
+// AuthenticationSpec configures the superuser of the cluster. Nodes always run
+// with PasswordAuthenticator and CassandraAuthorizer. Once the cluster is up the
+// operator creates the superuser and disables login for the default cassandra role.
+type AuthenticationSpec struct {
+	// SuperuserSecretName is the name of an existing secret with username and
+	// password keys. When it is not set, the operator generates a secret with a
+	// random password. Changes to the secret are applied to the superuser role.
+	SuperuserSecretName string `json:"superuserSecretName,omitempty"`
+}
+
+// CertificateSource is where the certificate for encryption comes from. It
+// either comes from a cert-manager issuer, in which case the operator creates a
+// Certificate for the cluster, or from an existing secret. Either way the secret
+// has to contain tls.crt, tls.key and ca.crt.
+type CertificateSource struct {
+	// IssuerRef references the cert-manager Issuer or ClusterIssuer that signs
+	// the certificate of the cluster.
+	IssuerRef *IssuerReference `json:"issuerRef,omitempty"`
+
+	// SecretName is the name of an existing secret holding the certificate. It
+	// is ignored when IssuerRef is set.
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// InternodeEncryptionSpec configures server_encryption_options
+type InternodeEncryptionSpec struct {
+	// Mode is the internode_encryption setting. Defaults to all.
+	// +kubebuilder:validation:Enum=all;dc;rack
+	Mode string `json:"mode,omitempty"`
+
+	CertificateSource `json:",inline"`
+
+	// RequireClientAuth requires nodes to present their certificate to each other.
+	RequireClientAuth bool `json:"requireClientAuth,omitempty"`
+}
+
+// ClientEncryptionSpec configures client_encryption_options. The CA certificate
+// is published in a separate secret that applications can mount.
+type ClientEncryptionSpec struct {
+	CertificateSource `json:",inline"`
+
+	// RequireClientAuth requires clients to present a certificate signed by the
+	// CA of the cluster.
+	RequireClientAuth bool `json:"requireClientAuth,omitempty"`
+}
+
+// IssuerReference references a cert-manager issuer
+type IssuerReference struct {
+	Name string `json:"name"`
+
+	// Kind is either Issuer or ClusterIssuer. Defaults to Issuer.
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+}
+
+// NetworkingSpec configures how Cassandra nodes are addressed
+type NetworkingSpec struct {
+	// HostNetwork runs the Cassandra pods in the network namespace of the
+	// Kubernetes node.
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+
+	// UseHostIPForBroadcast advertises the IP of the Kubernetes node as
+	// broadcast_address and broadcast_rpc_address instead of the pod IP.
+	UseHostIPForBroadcast bool `json:"useHostIPForBroadcast,omitempty"`
+
+	// NodeServices creates a service per pod so that every node can be reached
+	// by clients running outside of Kubernetes. The address of the service is
+	// advertised to clients as broadcast_rpc_address.
+	NodeServices *NodeServicesSpec `json:"nodeServices,omitempty"`
+}
+
+// NodeServicesSpec configures the services that are created for each pod
+type NodeServicesSpec struct {
+	// Type is the type of the per-pod services. With LoadBalancer the ingress
+	// address of the load balancer is advertised. With NodePort the IP of the
+	// Kubernetes node is advertised, which requires the driver to translate
+	// addresses to the node port of each service.
+	// +kubebuilder:validation:Enum=NodePort;LoadBalancer
+	Type corev1.ServiceType `json:"type"`
+
+	// Annotations are added to each service, e.g. to configure a cloud load balancer.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // CassandraClusterSpec defines the desired state of CassandraCluster
@@ -70,16 +344,435 @@ type CassandraClusterSpec struct {
 
 	Name string `json:"name"`
 
+	// Datacenters are the datacenters of the cluster. Clusters created before
+	// datacenters could be declared run a single StatefulSet with 3 nodes. They
+	// keep it by declaring a datacenter named dc1 with nodesPerRack set to 3 and
+	// no racks.
 	Datacenters []Datacenter `json:"datacenters,omitempty"`
 
 	// +kubebuilder:validation:PreserveUnknownFields=true
 	Config json.RawMessage `json:"config,omitempty"`
+
+	Ports Ports `json:"ports,omitempty"`
+
+	Networking NetworkingSpec `json:"networking,omitempty"`
+
+	Security SecuritySpec `json:"security,omitempty"`
+
+	// ReplaceNodes are pods whose node has died and has to be replaced. The data
+	// of these pods is deleted and they start with replace_address_first_boot set
+	// to the address of the dead node. Remove a pod from the list once its
+	// replacement has completed.
+	ReplaceNodes []string `json:"replaceNodes,omitempty"`
+
+	// Reaper deploys Cassandra Reaper to run repairs of the cluster. Reaper
+	// stores its state in the cluster itself, logging in with a role that is
+	// limited to its keyspace. Removing the section removes Reaper, its role and
+	// its credentials but keeps the keyspace.
+	Reaper *ReaperSpec `json:"reaper,omitempty"`
+
+	// Backup configures the object storage CassandraBackups are uploaded to
+	Backup *BackupSpec `json:"backup,omitempty"`
+
+	// RestoreFrom references the CassandraRestore that bootstraps the nodes of a
+	// new cluster from a backup. Pods do not start until the restore has
+	// assigned a backed up node to each of them. Backup has to point to the
+	// object storage the backup is stored in.
+	RestoreFrom *corev1.LocalObjectReference `json:"restoreFrom,omitempty"`
+
+	// DeletionPolicy determines what happens to the data volumes, the secrets
+	// created by the operator and the Reaper registration of the cluster when
+	// it is deleted. Defaults to Retain.
+	// +kubebuilder:validation:Enum=Retain;Delete;Snapshot-then-Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// DeletionProtection makes the validating webhook refuse to delete the
+	// cluster until the cassandra.apache.org/allow-deletion annotation is set
+	// to "true"
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// Metrics adds a metrics exporter sidecar to the Cassandra pods and a
+	// ServiceMonitor that has Prometheus scrape it
+	Metrics *MetricsSpec `json:"metrics,omitempty"`
+
+	// Logging configures the logs of the Cassandra pods
+	Logging LoggingSpec `json:"logging,omitempty"`
+
+	// DisruptionBudget configures the PodDisruptionBudget that is created for
+	// each datacenter, which limits how many of its nodes voluntary disruptions
+	// like node drains can take down at once
+	DisruptionBudget DisruptionBudgetSpec `json:"disruptionBudget,omitempty"`
+}
+
+// DeletionPolicy determines what is removed along with a cluster
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyRetain keeps the data volumes and the secrets, so that the
+	// cluster can be recreated with its data. Reaper is left as is.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+
+	// DeletionPolicyDelete deletes the data volumes and the secrets, and
+	// unregisters the cluster from Reaper
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+
+	// DeletionPolicySnapshotThenDelete backs up the cluster to the object storage
+	// configured in Spec.Backup before deleting it like DeletionPolicyDelete
+	DeletionPolicySnapshotThenDelete DeletionPolicy = "Snapshot-then-Delete"
+)
+
+// DisruptionBudgetSpec configures the PodDisruptionBudgets of the datacenters
+type DisruptionBudgetSpec struct {
+	// MaxUnavailable is the number or percentage of the nodes of a datacenter
+	// that can be unavailable during a voluntary disruption. Defaults to 1.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// ReaperSpec configures the Reaper instance of a cluster
+type ReaperSpec struct {
+	// Image is the Reaper image. Defaults to thelastpickle/cassandra-reaper:2.0.5.
+	Image string `json:"image,omitempty"`
+
+	// Keyspace is the keyspace Reaper stores its state in. Defaults to reaper_db.
+	Keyspace string `json:"keyspace,omitempty"`
+
+	// ScheduleDaysBetween is the number of days between the repairs of a
+	// keyspace. Defaults to 7.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=31
+	ScheduleDaysBetween int32 `json:"scheduleDaysBetween,omitempty"`
+
+	// Intensity controls the share of time Reaper spends repairing, between 0.1
+	// and 1.0. Defaults to 1.0.
+	// +kubebuilder:validation:Pattern=`^(0\.[1-9][0-9]*|1(\.0+)?)$`
+	Intensity string `json:"intensity,omitempty"`
+
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// MetricsSpec configures the metrics exporter of the Cassandra pods
+type MetricsSpec struct {
+	// ExporterImage is the image of the exporter sidecar, which reads the metrics
+	// of the node over JMX and serves them in the Prometheus format. Defaults to
+	// criteord/cassandra_exporter:2.3.4.
+	ExporterImage string `json:"exporterImage,omitempty"`
+
+	ExporterResources corev1.ResourceRequirements `json:"exporterResources,omitempty"`
+
+	// Port is the port the exporter serves metrics on. Defaults to 9500.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+
+	// ServiceMonitorLabels are added to the ServiceMonitor so that it matches the
+	// serviceMonitorSelector of the Prometheus instance
+	ServiceMonitorLabels map[string]string `json:"serviceMonitorLabels,omitempty"`
+
+	// ScrapeInterval is how often Prometheus scrapes the nodes, e.g. 30s.
+	// Defaults to the scrape interval of the Prometheus instance.
+	ScrapeInterval string `json:"scrapeInterval,omitempty"`
+}
+
+// LoggingSpec configures the logs of the Cassandra pods. Cassandra writes
+// system.log and debug.log to /var/log/cassandra, which survives restarts of the
+// cassandra container.
+type LoggingSpec struct {
+	// Tailer adds a sidecar that tails system.log to its stdout, so that the log
+	// is picked up by the log collector of the Kubernetes cluster
+	Tailer *LogTailerSpec `json:"tailer,omitempty"`
+
+	// Loggers sets the levels of loggers in logback.xml. Use ROOT to set the
+	// level of the root logger. Changes are applied with a rolling restart.
+	Loggers []LoggerSpec `json:"loggers,omitempty"`
+}
+
+// LogTailerSpec configures the sidecar that tails system.log
+type LogTailerSpec struct {
+	// Image is the image of the sidecar, which has to provide tail. Defaults to
+	// busybox:1.32.
+	Image string `json:"image,omitempty"`
+
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// LogLevel is the level of a logback logger
+// +kubebuilder:validation:Enum=TRACE;DEBUG;INFO;WARN;ERROR;OFF
+type LogLevel string
+
+// LoggerSpec sets the level of a logger
+type LoggerSpec struct {
+	// Name is the name of the logger, e.g. org.apache.cassandra.db.compaction
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_.$]+$`
+	Name string `json:"name"`
+
+	Level LogLevel `json:"level"`
+}
+
+// DatacenterStatus defines the observed state of a datacenter
+type DatacenterStatus struct {
+	// ConfigHash is the hash of the rendered configuration that every node in
+	// the datacenter is running with.
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// RollingRestart is true while the operator is restarting nodes to apply a
+	// new configuration.
+	RollingRestart bool `json:"rollingRestart,omitempty"`
+
+	// UpdatedNodes are the pods running with the current configuration.
+	UpdatedNodes []string `json:"updatedNodes,omitempty"`
+
+	// OutdatedNodes are the pods still running with a previous configuration.
+	OutdatedNodes []string `json:"outdatedNodes,omitempty"`
+
+	// Rebuild is set when the datacenter has been added to a running cluster
+	Rebuild *RebuildStatus `json:"rebuild,omitempty"`
+
+	// Decommission is set when the datacenter has been removed from the spec
+	Decommission *DecommissionStatus `json:"decommission,omitempty"`
+
+	// NodeAddresses maps pods to the broadcast address they last had when they
+	// were ready. The address is needed to replace a node after its pod is gone.
+	NodeAddresses map[string]string `json:"nodeAddresses,omitempty"`
+}
+
+// RebuildPhase is the progress of adding a datacenter to a running cluster
+type RebuildPhase string
+
+const (
+	// RebuildPhaseWaitingForNodes means that the nodes of the new datacenter
+	// are joining the cluster without bootstrapping
+	RebuildPhaseWaitingForNodes RebuildPhase = "WaitingForNodes"
+
+	// RebuildPhaseRunning means that the nodes are streaming their data from
+	// the source datacenter, one at a time
+	RebuildPhaseRunning RebuildPhase = "Running"
+
+	RebuildPhaseCompleted RebuildPhase = "Completed"
+)
+
+// SystemKeyspacesRepairStatus tracks the repair that streams the system
+// keyspaces to the replicas that raising their replication has added. The nodes
+// repair the keyspaces one at a time.
+type SystemKeyspacesRepairStatus struct {
+	// Keyspaces are the keyspaces that are repaired
+	Keyspaces []string `json:"keyspaces"`
+
+	// CurrentNode is the pod that is being repaired
+	CurrentNode string `json:"currentNode,omitempty"`
+
+	// CurrentKeyspace is the keyspace that is being repaired on CurrentNode
+	CurrentKeyspace string `json:"currentKeyspace,omitempty"`
+
+	// JobID identifies the repair running on CurrentNode in the management API
+	JobID string `json:"jobId,omitempty"`
+
+	// RepairedNodes are the pods that have repaired all of the keyspaces
+	RepairedNodes []string `json:"repairedNodes,omitempty"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// Error is the reason the last repair of CurrentKeyspace failed. The repair
+	// is retried.
+	Error string `json:"error,omitempty"`
+}
+
+// RebuildStatus tracks the rebuild of a datacenter that has been added to a
+// running cluster
+type RebuildStatus struct {
+	// SourceDatacenter is the datacenter the data is streamed from
+	SourceDatacenter string `json:"sourceDatacenter"`
+
+	Phase RebuildPhase `json:"phase"`
+
+	// CurrentNode is the pod that is being rebuilt
+	CurrentNode string `json:"currentNode,omitempty"`
+
+	// JobID identifies the rebuild running on CurrentNode in the management API
+	JobID string `json:"jobId,omitempty"`
+
+	// RebuiltNodes are the pods that have finished rebuilding
+	RebuiltNodes []string `json:"rebuiltNodes,omitempty"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Error is the reason the last rebuild of CurrentNode failed. The rebuild is
+	// retried.
+	Error string `json:"error,omitempty"`
+}
+
+// DecommissionPhase is the progress of removing a datacenter
+type DecommissionPhase string
+
+const (
+	// DecommissionPhaseBlocked means that keyspaces still replicate to the
+	// datacenter. Nothing is removed until their replication is changed.
+	DecommissionPhaseBlocked DecommissionPhase = "Blocked"
+
+	// DecommissionPhaseRunning means that the nodes are being decommissioned,
+	// one at a time
+	DecommissionPhaseRunning DecommissionPhase = "Running"
+
+	// DecommissionPhaseDeletingResources means that the StatefulSets, services
+	// and PVCs of the datacenter are being deleted
+	DecommissionPhaseDeletingResources DecommissionPhase = "DeletingResources"
+)
+
+// DecommissionStatus tracks the removal of a datacenter
+type DecommissionStatus struct {
+	Phase DecommissionPhase `json:"phase"`
+
+	// CurrentNode is the pod that is being decommissioned
+	CurrentNode string `json:"currentNode,omitempty"`
+
+	// JobID identifies the decommission running on CurrentNode in the
+	// management API
+	JobID string `json:"jobId,omitempty"`
+
+	// DecommissionedNodes are the pods that have left the cluster
+	DecommissionedNodes []string `json:"decommissionedNodes,omitempty"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// Error is the reason the last step of the removal failed. It is retried.
+	Error string `json:"error,omitempty"`
+}
+
+// ReplacementPhase is the progress of replacing a dead node
+type ReplacementPhase string
+
+const (
+	// ReplacementPhasePending means that the data of the pod is about to be
+	// deleted and the pod restarted
+	ReplacementPhasePending ReplacementPhase = "Pending"
+
+	// ReplacementPhaseRunning means that the new node is streaming the data of
+	// the dead node
+	ReplacementPhaseRunning ReplacementPhase = "Running"
+
+	ReplacementPhaseCompleted ReplacementPhase = "Completed"
+
+	// ReplacementPhaseFailed means that the node cannot be replaced because its
+	// address is not known. The replacement starts once the address is known.
+	ReplacementPhaseFailed ReplacementPhase = "Failed"
+)
+
+// NodeReplacementStatus tracks the replacement of a dead node
+type NodeReplacementStatus struct {
+	Pod string `json:"pod"`
+
+	// Address is the broadcast address of the dead node
+	Address string `json:"address,omitempty"`
+
+	Phase ReplacementPhase `json:"phase"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	Message string `json:"message,omitempty"`
+}
+
+// ReaperStatus is the state of the Reaper integration
+type ReaperStatus struct {
+	// KeyspaceCreated is true once the keyspace Reaper stores its state in has
+	// been created
+	KeyspaceCreated bool `json:"keyspaceCreated,omitempty"`
+
+	// RoleCreated is true once the role Reaper logs in to Cassandra with has
+	// been created and granted access to the Reaper keyspace
+	RoleCreated bool `json:"roleCreated,omitempty"`
+
+	// ClusterRegistered is true once the cluster has been added to Reaper
+	ClusterRegistered bool `json:"clusterRegistered,omitempty"`
+
+	// Schedules maps keyspaces to the IDs of their repair schedules in Reaper
+	Schedules map[string]string `json:"schedules,omitempty"`
+}
+
+type ClusterConditionType string
+
+const (
+	// ClusterConditionDatacenterRemovalBlocked is true when a datacenter has
+	// been removed from the spec but keyspaces still replicate to it
+	ClusterConditionDatacenterRemovalBlocked ClusterConditionType = "DatacenterRemovalBlocked"
+
+	// ClusterConditionDeletionBlocked is true when the cluster has been deleted
+	// but the final backup of the Snapshot-then-Delete policy holds off the
+	// deletion
+	ClusterConditionDeletionBlocked ClusterConditionType = "DeletionBlocked"
+)
+
+type ClusterCondition struct {
+	Type ClusterConditionType `json:"type"`
+
+	Status corev1.ConditionStatus `json:"status"`
+
+	Reason string `json:"reason,omitempty"`
+
+	Message string `json:"message,omitempty"`
+
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
 // CassandraClusterStatus defines the observed state of CassandraCluster
 type CassandraClusterStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	Datacenters map[string]DatacenterStatus `json:"datacenters,omitempty"`
+
+	// SuperuserCreated is true once the superuser role has been created and
+	// login has been disabled for the default cassandra role.
+	SuperuserCreated bool `json:"superuserCreated,omitempty"`
+
+	// SuperuserCredentialsHash is the hash of the superuser credentials that have
+	// been applied to the cluster. The credentials are applied again when the
+	// superuser secret changes.
+	SuperuserCredentialsHash string `json:"superuserCredentialsHash,omitempty"`
+
+	// SystemReplication is the replication that has been applied to the
+	// system_auth, system_distributed and system_traces keyspaces.
+	SystemReplication map[string]int32 `json:"systemReplication,omitempty"`
+
+	// SystemKeyspacesRepair tracks the repair of the system keyspaces whose
+	// replication has been raised. It is removed once the repair has finished.
+	SystemKeyspacesRepair *SystemKeyspacesRepairStatus `json:"systemKeyspacesRepair,omitempty"`
+
+	// NodeReplacements are the replacements of the pods in Spec.ReplaceNodes
+	NodeReplacements []NodeReplacementStatus `json:"nodeReplacements,omitempty"`
+
+	Reaper *ReaperStatus `json:"reaper,omitempty"`
+
+	Conditions []ClusterCondition `json:"conditions,omitempty"`
+}
+
+// GetCondition returns the condition of the given type or nil if it is not set
+func (s *CassandraClusterStatus) GetCondition(conditionType ClusterConditionType) *ClusterCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the same type. The transition
+// time is only updated when the status of the condition changes.
+func (s *CassandraClusterStatus) SetCondition(condition ClusterCondition) {
+	current := s.GetCondition(condition.Type)
+	if current == nil {
+		condition.LastTransitionTime = metav1.Now()
+		s.Conditions = append(s.Conditions, condition)
+		return
+	}
+	if current.Status != condition.Status {
+		condition.LastTransitionTime = metav1.Now()
+	} else {
+		condition.LastTransitionTime = current.LastTransitionTime
+	}
+	*current = condition
 }
 
 // +kubebuilder:object:root=true
@@ -109,14 +802,378 @@ func (c *CassandraCluster) GetClusterLabels() map[string]string {
 	}
 }
 
+func (c *CassandraCluster) GetDatacenterLabels(dcName string) map[string]string {
+	labels := c.GetClusterLabels()
+	labels[DatacenterLabel] = dcName
+	return labels
+}
+
+func (c *CassandraCluster) GetRackLabels(dcName, rackName string) map[string]string {
+	labels := c.GetDatacenterLabels(dcName)
+	labels[RackLabel] = rackName
+	return labels
+}
+
 func (c *CassandraCluster) GetAllPodsServiceName() string {
 	return c.Spec.Name + "-all-pods-service"
 }
 
+// GetGoverningServiceName returns the name of the headless service that governs
+// the StatefulSets of the cluster. The pods get their DNS names,
+// <pod>.<service>.<namespace>.svc, from it.
+func (c *CassandraCluster) GetGoverningServiceName() string {
+	return c.GetAllPodsServiceName()
+}
+
 func (c *CassandraCluster) GetSeedsServiceName() string {
 	return c.Spec.Name + "-seed-service"
 }
 
+// GetDatacenterServiceName returns the name of the ClusterIP service CQL clients
+// use to connect to the datacenter
+func (c *CassandraCluster) GetDatacenterServiceName(dcName string) string {
+	return c.Spec.Name + "-" + dcName + "-service"
+}
+
+func (c *CassandraCluster) GetDatacenterExternalServiceName(dcName string) string {
+	return c.Spec.Name + "-" + dcName + "-external-service"
+}
+
+func (c *CassandraCluster) GetDeletionPolicy() DeletionPolicy {
+	if c.Spec.DeletionPolicy == "" {
+		return DeletionPolicyRetain
+	}
+	return c.Spec.DeletionPolicy
+}
+
+// IsDeletionAllowed returns false if deletion protection holds off the
+// deletion of the cluster
+func (c *CassandraCluster) IsDeletionAllowed() bool {
+	return !c.Spec.DeletionProtection || c.Annotations[AllowDeletionAnnotation] == "true"
+}
+
+// GetFinalBackupName returns the name of the CassandraBackup taken before the
+// cluster is deleted with the Snapshot-then-Delete policy. The backup outlives
+// the cluster, so the name includes the UID to tell it apart from the final
+// backup of a previous cluster with the same name.
+func (c *CassandraCluster) GetFinalBackupName() string {
+	return c.Name + "-final-" + string(c.UID)
+}
+
+func (c *CassandraCluster) GetDatacenterPodDisruptionBudgetName(dcName string) string {
+	return c.Spec.Name + "-" + dcName + "-pdb"
+}
+
+// GetNetworkPolicyName returns the name of the NetworkPolicy that restricts
+// access to the management API of the nodes
+func (c *CassandraCluster) GetNetworkPolicyName() string {
+	return c.Spec.Name + "-network-policy"
+}
+
+// GetMaxUnavailable returns the number or percentage of the nodes of a
+// datacenter that voluntary disruptions can take down at once
+func (c *CassandraCluster) GetMaxUnavailable() intstr.IntOrString {
+	if c.Spec.DisruptionBudget.MaxUnavailable == nil {
+		return intstr.FromInt(1)
+	}
+	return *c.Spec.DisruptionBudget.MaxUnavailable
+}
+
+func (c *CassandraCluster) GetCQLPort() int32 {
+	if c.Spec.Ports.CQL == 0 {
+		return DefaultCQLPort
+	}
+	return c.Spec.Ports.CQL
+}
+
+func (c *CassandraCluster) GetStoragePort() int32 {
+	if c.Spec.Ports.Storage == 0 {
+		return DefaultStoragePort
+	}
+	return c.Spec.Ports.Storage
+}
+
+func (c *CassandraCluster) GetJMXPort() int32 {
+	if c.Spec.Ports.JMX == 0 {
+		return DefaultJMXPort
+	}
+	return c.Spec.Ports.JMX
+}
+
+func (c *CassandraCluster) GetSSLStoragePort() int32 {
+	if c.Spec.Ports.SSLStorage == 0 {
+		return DefaultSSLStoragePort
+	}
+	return c.Spec.Ports.SSLStorage
+}
+
+// GetCQLSSLPort returns the port for encrypted CQL connections. Unless a
+// separate port is configured, it is the same as the CQL port.
+func (c *CassandraCluster) GetCQLSSLPort() int32 {
+	if c.Spec.Ports.CQLSSL == 0 {
+		return c.GetCQLPort()
+	}
+	return c.Spec.Ports.CQLSSL
+}
+
+// HasSeparateCQLSSLPort returns true when encrypted and unencrypted CQL
+// connections are accepted on different ports.
+func (c *CassandraCluster) HasSeparateCQLSSLPort() bool {
+	return c.IsClientEncryptionEnabled() && c.GetCQLSSLPort() != c.GetCQLPort()
+}
+
+func (c *CassandraCluster) IsInternodeEncryptionEnabled() bool {
+	return c.Spec.Security.InternodeEncryption != nil
+}
+
+// GetInternodeCertificateName returns the name of the cert-manager Certificate
+// created for internode encryption
+func (c *CassandraCluster) GetInternodeCertificateName() string {
+	return c.Spec.Name + "-internode"
+}
+
+// GetInternodeSecretName returns the name of the secret holding the certificate
+// used for internode encryption
+func (c *CassandraCluster) GetInternodeSecretName() string {
+	enc := c.Spec.Security.InternodeEncryption
+	if enc.IssuerRef == nil && enc.SecretName != "" {
+		return enc.SecretName
+	}
+	return c.Spec.Name + "-internode-tls"
+}
+
+func (c *CassandraCluster) IsClientEncryptionEnabled() bool {
+	return c.Spec.Security.ClientEncryption != nil
+}
+
+// GetClientCertificateName returns the name of the cert-manager Certificate
+// created for client encryption
+func (c *CassandraCluster) GetClientCertificateName() string {
+	return c.Spec.Name + "-client"
+}
+
+// GetClientSecretName returns the name of the secret holding the certificate
+// used for client encryption
+func (c *CassandraCluster) GetClientSecretName() string {
+	enc := c.Spec.Security.ClientEncryption
+	if enc.IssuerRef == nil && enc.SecretName != "" {
+		return enc.SecretName
+	}
+	return c.Spec.Name + "-client-tls"
+}
+
+// GetClientCASecretName returns the name of the secret, published by the
+// operator, that holds the CA certificate clients use to verify the nodes
+func (c *CassandraCluster) GetClientCASecretName() string {
+	return c.Spec.Name + "-client-ca"
+}
+
+// GetKeystorePasswordSecretName returns the name of the secret the operator
+// generates to hold the keystore and truststore password
+func (c *CassandraCluster) GetKeystorePasswordSecretName() string {
+	return c.Spec.Name + "-keystore-password"
+}
+
+// GetJMXSecretName returns the name of the secret the operator generates to
+// hold the JMX credentials of the nodes
+func (c *CassandraCluster) GetJMXSecretName() string {
+	return c.Spec.Name + "-jmx"
+}
+
+// GetReaperAuthSecretName returns the name of the secret the operator generates
+// to hold the credentials of the Reaper web UI and REST API
+func (c *CassandraCluster) GetReaperAuthSecretName() string {
+	return c.Spec.Name + "-reaper-auth"
+}
+
+// GetReaperCQLSecretName returns the name of the secret the operator generates
+// to hold the credentials of the role Reaper stores its state with
+func (c *CassandraCluster) GetReaperCQLSecretName() string {
+	return c.Spec.Name + "-reaper-cql"
+}
+
+// GetMgmtAPISecretName returns the name of the secret the operator generates to
+// hold the certificates that secure the management API of the nodes
+func (c *CassandraCluster) GetMgmtAPISecretName() string {
+	return c.Spec.Name + "-mgmt-api-tls"
+}
+
+// GetBackupAgentSecretName returns the name of the secret the operator generates
+// to hold the token that the backup agents require
+func (c *CassandraCluster) GetBackupAgentSecretName() string {
+	return c.Spec.Name + "-backup-agent"
+}
+
+// GetDatacenter returns the datacenter with the given name or nil if the
+// cluster has no such datacenter
+func (c *CassandraCluster) GetDatacenter(name string) *Datacenter {
+	for i := range c.Spec.Datacenters {
+		if c.Spec.Datacenters[i].Name == name {
+			return &c.Spec.Datacenters[i]
+		}
+	}
+	return nil
+}
+
+// ValidateReplication checks that every datacenter of a NetworkTopologyStrategy
+// replication exists and has enough nodes for its replication factor
+func (c *CassandraCluster) ValidateReplication(replication map[string]int32) error {
+	for dcName, rf := range replication {
+		dc := c.GetDatacenter(dcName)
+		if dc == nil {
+			return fmt.Errorf("datacenter %s does not exist in cluster %s", dcName, c.Spec.Name)
+		}
+		if rf < 1 {
+			return fmt.Errorf("replication factor for datacenter %s must be at least 1", dcName)
+		}
+		if rf > dc.GetSize() {
+			return fmt.Errorf("replication factor %d for datacenter %s exceeds its %d nodes", rf, dcName, dc.GetSize())
+		}
+	}
+	return nil
+}
+
+// GetSystemReplication returns the replication for the system_auth,
+// system_distributed and system_traces keyspaces. Each datacenter gets a
+// replication factor of 3, or less when it has fewer nodes.
+func (c *CassandraCluster) GetSystemReplication() map[string]int32 {
+	replication := make(map[string]int32)
+	for i := range c.Spec.Datacenters {
+		dc := &c.Spec.Datacenters[i]
+		rf := dc.GetSize()
+		if rf > defaultSystemReplicationFactor {
+			rf = defaultSystemReplicationFactor
+		}
+		if rf > 0 {
+			replication[dc.Name] = rf
+		}
+	}
+	return replication
+}
+
+// IsRebuildPending returns true when the datacenter has been added to a running
+// cluster and its nodes have not finished streaming their data yet. Until then
+// the nodes start without bootstrapping.
+func (c *CassandraCluster) IsRebuildPending(dcName string) bool {
+	dcStatus, found := c.Status.Datacenters[dcName]
+	return found && dcStatus.Rebuild != nil && dcStatus.Rebuild.Phase != RebuildPhaseCompleted
+}
+
+// GetRestoreConfigMapName returns the name of the config map that maps the pods
+// of a restored cluster to the manifests of the nodes they are restored from
+func (c *CassandraCluster) GetRestoreConfigMapName() string {
+	return c.Spec.Name + "-restore"
+}
+
+// GetReplaceAddressesConfigMapName returns the name of the config map that maps
+// the pods being replaced to the addresses of the nodes they replace
+func (c *CassandraCluster) GetReplaceAddressesConfigMapName() string {
+	return c.Spec.Name + "-replace-addresses"
+}
+
+// GetReaperName returns the name of the Reaper deployment and service
+func (c *CassandraCluster) GetReaperName() string {
+	return c.Spec.Name + "-reaper"
+}
+
+// GetReaperLabels returns the labels of the Reaper pods
+func (c *CassandraCluster) GetReaperLabels() map[string]string {
+	return map[string]string{
+		ReaperLabel: c.GetReaperName(),
+	}
+}
+
+func (c *CassandraCluster) IsMetricsEnabled() bool {
+	return c.Spec.Metrics != nil
+}
+
+func (c *CassandraCluster) GetMetricsExporterImage() string {
+	if c.Spec.Metrics == nil || c.Spec.Metrics.ExporterImage == "" {
+		return defaultMetricsExporterImage
+	}
+	return c.Spec.Metrics.ExporterImage
+}
+
+func (c *CassandraCluster) GetMetricsPort() int32 {
+	if c.Spec.Metrics == nil || c.Spec.Metrics.Port == 0 {
+		return DefaultMetricsPort
+	}
+	return c.Spec.Metrics.Port
+}
+
+func (c *CassandraCluster) GetMetricsServiceName() string {
+	return c.Spec.Name + "-metrics-service"
+}
+
+func (c *CassandraCluster) GetServiceMonitorName() string {
+	return c.Spec.Name + "-service-monitor"
+}
+
+func (c *CassandraCluster) IsLogTailerEnabled() bool {
+	return c.Spec.Logging.Tailer != nil
+}
+
+func (c *CassandraCluster) GetLogTailerImage() string {
+	if c.Spec.Logging.Tailer == nil || c.Spec.Logging.Tailer.Image == "" {
+		return defaultLogTailerImage
+	}
+	return c.Spec.Logging.Tailer.Image
+}
+
+// GetLoggers returns the logger levels of Spec.Logging.Loggers sorted by name.
+// When a logger is listed more than once, the last level wins.
+func (c *CassandraCluster) GetLoggers() []LoggerSpec {
+	levels := make(map[string]LogLevel)
+	for _, logger := range c.Spec.Logging.Loggers {
+		levels[logger.Name] = logger.Level
+	}
+	loggers := make([]LoggerSpec, 0, len(levels))
+	for name, level := range levels {
+		loggers = append(loggers, LoggerSpec{Name: name, Level: level})
+	}
+	sort.Slice(loggers, func(i, j int) bool {
+		return loggers[i].Name < loggers[j].Name
+	})
+	return loggers
+}
+
+func (c *CassandraCluster) GetReaperImage() string {
+	if c.Spec.Reaper == nil || c.Spec.Reaper.Image == "" {
+		return defaultReaperImage
+	}
+	return c.Spec.Reaper.Image
+}
+
+func (c *CassandraCluster) GetReaperKeyspace() string {
+	if c.Spec.Reaper == nil || c.Spec.Reaper.Keyspace == "" {
+		return defaultReaperKeyspace
+	}
+	return c.Spec.Reaper.Keyspace
+}
+
+func (c *CassandraCluster) GetRepairScheduleDaysBetween() int32 {
+	if c.Spec.Reaper == nil || c.Spec.Reaper.ScheduleDaysBetween == 0 {
+		return defaultRepairScheduleDaysBetween
+	}
+	return c.Spec.Reaper.ScheduleDaysBetween
+}
+
+// GetSuperuserSecretName returns the name of the secret holding the credentials
+// of the superuser
+func (c *CassandraCluster) GetSuperuserSecretName() string {
+	if c.Spec.Security.Authentication.SuperuserSecretName != "" {
+		return c.Spec.Security.Authentication.SuperuserSecretName
+	}
+	return c.Spec.Name + "-superuser"
+}
+
+// GetAppliedSuperuserSecretName returns the name of the secret the operator
+// keeps the superuser credentials that have been applied to the cluster in. They
+// are needed to log in when the superuser secret changes.
+func (c *CassandraCluster) GetAppliedSuperuserSecretName() string {
+	return c.Spec.Name + "-superuser-applied"
+}
+
 func AddManagedByLabel(m map[string]string) {
 	m[ManagedByLabel] = ManagedByLabelValue
 }
@@ -130,21 +1187,39 @@ func (c *CassandraCluster) GetConfigBuilderImage() string {
 	return defaultConfigBuilderImage
 }
 
-// GetConfigAsJSON gets a JSON-encoded string suitable for passing to configBuilder
+func (c *CassandraCluster) GetCassandraImage() string {
+	return defaultCassandraImage
+}
+
+// GetNodeServiceName returns the name of the per-pod service for the given pod
+func (c *CassandraCluster) GetNodeServiceName(podName string) string {
+	return podName + "-service"
+}
+
+// GetConfigAsJSON gets a JSON-encoded string suitable for passing to configBuilder.
+// The cluster-level Spec.Config is deep-merged with the datacenter Config and
+// then the rack Config, with the more specific value winning on collisions.
 //
 // Source: http://github.com/jsanda/cass-operator/blob/master/operator/pkg/apis/cassandra/v1beta1/cassandradatacenter_types.go#L538-L538
-func (c *CassandraCluster) GetConfigAsJSON() (string, error) {
+func (c *CassandraCluster) GetConfigAsJSON(dc *Datacenter, rack *Rack) (string, error) {
 	// We use the cluster seed-service name here for the seed list as it will
 	// resolve to the seed nodes. This obviates the need to update the
 	// cassandra.yaml whenever the seed nodes change.
 	seeds := []string{c.GetSeedsServiceName()}
 
-	cql := 0
+	cql := int(c.GetCQLPort())
 	cqlSSL := 0
-	broadcast := 0
+	broadcast := int(c.GetStoragePort())
 	broadcastSSL := 0
+	if c.IsInternodeEncryptionEnabled() {
+		broadcastSSL = int(c.GetSSLStoragePort())
+	}
+	if c.IsClientEncryptionEnabled() {
+		cqlSSL = int(c.GetCQLSSLPort())
+	}
+	jmx := int(c.GetJMXPort())
 
-	modelValues := serverconfig.GetModelValues(seeds, c.Spec.Name, c.Spec.Name, 0, 0, 0, cql, cqlSSL, broadcast, broadcastSSL)
+	modelValues := serverconfig.GetModelValues(seeds, c.Spec.Name, dc.Name, 0, 0, 0, cql, cqlSSL, broadcast, broadcastSSL, jmx)
 
 	var modelBytes []byte
 
@@ -160,20 +1235,102 @@ func (c *CassandraCluster) GetConfigAsJSON() (string, error) {
 		return "", errors.Wrap(err, "Model information for CassandraCluster resource was not properly configured")
 	}
 
-	if c.Spec.Config != nil {
-		configParsed, err := gabs.ParseJSON([]byte(c.Spec.Config))
-		if err != nil {
-			return "", errors.Wrap(err, "Error parsing Spec.Config for CassandraCluster resource")
+	if _, err := modelParsed.Set("PasswordAuthenticator", "cassandra-yaml", "authenticator"); err != nil {
+		return "", errors.Wrap(err, "Error setting authenticator")
+	}
+
+	if _, err := modelParsed.Set("CassandraAuthorizer", "cassandra-yaml", "authorizer"); err != nil {
+		return "", errors.Wrap(err, "Error setting authorizer")
+	}
+
+	if c.IsRebuildPending(dc.Name) {
+		if _, err := modelParsed.Set(false, "cassandra-yaml", "auto_bootstrap"); err != nil {
+			return "", errors.Wrap(err, "Error setting auto_bootstrap")
+		}
+	}
+
+	if c.IsIncrementalBackupsEnabled() {
+		if _, err := modelParsed.Set(true, "cassandra-yaml", "incremental_backups"); err != nil {
+			return "", errors.Wrap(err, "Error setting incremental_backups")
+		}
+	}
+
+	if c.IsInternodeEncryptionEnabled() {
+		if _, err := modelParsed.Set(c.getServerEncryptionOptions(), "cassandra-yaml", "server_encryption_options"); err != nil {
+			return "", errors.Wrap(err, "Error setting server_encryption_options")
 		}
+	}
 
-		if err := modelParsed.Merge(configParsed); err != nil {
-			return "", errors.Wrap(err, "Error merging Spec.Config for CassandraDatacenter resource")
+	if c.IsClientEncryptionEnabled() {
+		if _, err := modelParsed.Set(c.getClientEncryptionOptions(), "cassandra-yaml", "client_encryption_options"); err != nil {
+			return "", errors.Wrap(err, "Error setting client_encryption_options")
 		}
 	}
 
+	if err := mergeConfig(modelParsed, c.Spec.Config); err != nil {
+		return "", errors.Wrap(err, "Error merging Spec.Config for CassandraCluster resource")
+	}
+
+	if err := mergeConfig(modelParsed, dc.Config); err != nil {
+		return "", errors.Wrapf(err, "Error merging Config for datacenter %s", dc.Name)
+	}
+
+	if err := mergeConfig(modelParsed, rack.Config); err != nil {
+		return "", errors.Wrapf(err, "Error merging Config for rack %s in datacenter %s", rack.Name, dc.Name)
+	}
+
 	return modelParsed.String(), nil
 }
 
+func (c *CassandraCluster) getServerEncryptionOptions() map[string]interface{} {
+	enc := c.Spec.Security.InternodeEncryption
+	mode := enc.Mode
+	if mode == "" {
+		mode = "all"
+	}
+
+	return map[string]interface{}{
+		"internode_encryption": mode,
+		"keystore":             InternodeKeystoreDir + "/keystore.jks",
+		"keystore_password":    KeystorePasswordPlaceholder,
+		"truststore":           InternodeKeystoreDir + "/truststore.jks",
+		"truststore_password":  KeystorePasswordPlaceholder,
+		"require_client_auth":  enc.RequireClientAuth,
+	}
+}
+
+func (c *CassandraCluster) getClientEncryptionOptions() map[string]interface{} {
+	enc := c.Spec.Security.ClientEncryption
+
+	return map[string]interface{}{
+		"enabled":             true,
+		"optional":            false,
+		"keystore":            ClientKeystoreDir + "/keystore.jks",
+		"keystore_password":   KeystorePasswordPlaceholder,
+		"truststore":          ClientKeystoreDir + "/truststore.jks",
+		"truststore_password": KeystorePasswordPlaceholder,
+		"require_client_auth": enc.RequireClientAuth,
+	}
+}
+
+// mergeConfig deep-merges config into dest. Unlike gabs.Container.Merge,
+// colliding values from config replace the existing ones instead of being
+// combined into an array.
+func mergeConfig(dest *gabs.Container, config json.RawMessage) error {
+	if config == nil {
+		return nil
+	}
+
+	configParsed, err := gabs.ParseJSON([]byte(config))
+	if err != nil {
+		return err
+	}
+
+	return dest.MergeFn(configParsed, func(destination, source interface{}) interface{} {
+		return source
+	})
+}
+
 func init() {
 	SchemeBuilder.Register(&CassandraCluster{}, &CassandraClusterList{})
 }
@@ -0,0 +1,286 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGetConfigAsJSON(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{
+		Spec: CassandraClusterSpec{
+			Name:   "test",
+			Config: json.RawMessage(`{"cassandra-yaml": {"concurrent_writes": 32, "num_tokens": 16}, "jvm-options": {"max_heap_size": "1024M"}}`),
+			Datacenters: []Datacenter{
+				{
+					Name:   "dc1",
+					Config: json.RawMessage(`{"cassandra-yaml": {"concurrent_writes": 64}, "jvm-options": {"max_heap_size": "4096M"}}`),
+					Racks: []Rack{
+						{
+							Name:   "rack1",
+							Config: json.RawMessage(`{"jvm-options": {"max_heap_size": "8192M"}}`),
+						},
+						{
+							Name: "rack2",
+						},
+					},
+				},
+			},
+		},
+	}
+	dc := &cluster.Spec.Datacenters[0]
+
+	config, err := cluster.GetConfigAsJSON(dc, &dc.Racks[0])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).To(MatchJSON(`{
+		"cluster-info": {"name": "test", "seeds": "test-seed-service"},
+		"datacenter-info": {"name": "dc1", "graph-enabled": 0, "solr-enabled": 0, "spark-enabled": 0},
+		"cassandra-yaml": {"authenticator": "PasswordAuthenticator", "authorizer": "CassandraAuthorizer", "concurrent_writes": 64, "num_tokens": 16, "native_transport_port": 9042, "storage_port": 7000},
+		"cassandra-env-sh": {"jmx-port": 7199},
+		"jvm-options": {"max_heap_size": "8192M"}
+	}`))
+
+	config, err = cluster.GetConfigAsJSON(dc, &dc.Racks[1])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).To(MatchJSON(`{
+		"cluster-info": {"name": "test", "seeds": "test-seed-service"},
+		"datacenter-info": {"name": "dc1", "graph-enabled": 0, "solr-enabled": 0, "spark-enabled": 0},
+		"cassandra-yaml": {"authenticator": "PasswordAuthenticator", "authorizer": "CassandraAuthorizer", "concurrent_writes": 64, "num_tokens": 16, "native_transport_port": 9042, "storage_port": 7000},
+		"cassandra-env-sh": {"jmx-port": 7199},
+		"jvm-options": {"max_heap_size": "4096M"}
+	}`))
+}
+
+func TestGetConfigAsJSONWithPorts(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{
+		Spec: CassandraClusterSpec{
+			Name: "test",
+			Ports: Ports{
+				CQL:     19042,
+				Storage: 17000,
+				JMX:     17199,
+			},
+			Datacenters: []Datacenter{{Name: "dc1"}},
+		},
+	}
+	dc := &cluster.Spec.Datacenters[0]
+
+	config, err := cluster.GetConfigAsJSON(dc, &dc.GetRacks()[0])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).To(MatchJSON(`{
+		"cluster-info": {"name": "test", "seeds": "test-seed-service"},
+		"datacenter-info": {"name": "dc1", "graph-enabled": 0, "solr-enabled": 0, "spark-enabled": 0},
+		"cassandra-yaml": {"authenticator": "PasswordAuthenticator", "authorizer": "CassandraAuthorizer", "native_transport_port": 19042, "storage_port": 17000},
+		"cassandra-env-sh": {"jmx-port": 17199}
+	}`))
+}
+
+func TestGetConfigAsJSONWithEncryption(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{
+		Spec: CassandraClusterSpec{
+			Name: "test",
+			Security: SecuritySpec{
+				InternodeEncryption: &InternodeEncryptionSpec{
+					CertificateSource: CertificateSource{SecretName: "internode-tls"},
+				},
+				ClientEncryption: &ClientEncryptionSpec{
+					CertificateSource: CertificateSource{SecretName: "client-tls"},
+					RequireClientAuth: true,
+				},
+			},
+			Datacenters: []Datacenter{{Name: "dc1"}},
+		},
+	}
+	dc := &cluster.Spec.Datacenters[0]
+
+	config, err := cluster.GetConfigAsJSON(dc, &dc.GetRacks()[0])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).To(MatchJSON(`{
+		"cluster-info": {"name": "test", "seeds": "test-seed-service"},
+		"datacenter-info": {"name": "dc1", "graph-enabled": 0, "solr-enabled": 0, "spark-enabled": 0},
+		"cassandra-yaml": {
+			"authenticator": "PasswordAuthenticator",
+			"authorizer": "CassandraAuthorizer",
+			"native_transport_port": 9042,
+			"native_transport_port_ssl": 9042,
+			"storage_port": 7000,
+			"ssl_storage_port": 7001,
+			"server_encryption_options": {
+				"internode_encryption": "all",
+				"keystore": "/keystores/internode/keystore.jks",
+				"keystore_password": "KEYSTORE_PASSWORD_PLACEHOLDER",
+				"truststore": "/keystores/internode/truststore.jks",
+				"truststore_password": "KEYSTORE_PASSWORD_PLACEHOLDER",
+				"require_client_auth": false
+			},
+			"client_encryption_options": {
+				"enabled": true,
+				"optional": false,
+				"keystore": "/keystores/client/keystore.jks",
+				"keystore_password": "KEYSTORE_PASSWORD_PLACEHOLDER",
+				"truststore": "/keystores/client/truststore.jks",
+				"truststore_password": "KEYSTORE_PASSWORD_PLACEHOLDER",
+				"require_client_auth": true
+			}
+		},
+		"cassandra-env-sh": {"jmx-port": 7199}
+	}`))
+	g.Expect(cluster.HasSeparateCQLSSLPort()).To(BeFalse())
+}
+
+func TestValidateReplication(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{
+		Spec: CassandraClusterSpec{
+			Name: "test",
+			Datacenters: []Datacenter{
+				{Name: "dc1", NodesPerRack: 1, Racks: []Rack{{Name: "rack1"}, {Name: "rack2"}, {Name: "rack3"}}},
+				{Name: "dc2", NodesPerRack: 2},
+			},
+		},
+	}
+
+	g.Expect(cluster.ValidateReplication(map[string]int32{"dc1": 3, "dc2": 2})).To(Succeed())
+	g.Expect(cluster.ValidateReplication(map[string]int32{"dc1": 4})).ToNot(Succeed())
+	g.Expect(cluster.ValidateReplication(map[string]int32{"dc1": 0})).ToNot(Succeed())
+	g.Expect(cluster.ValidateReplication(map[string]int32{"dc3": 1})).ToNot(Succeed())
+
+	g.Expect(cluster.GetSystemReplication()).To(Equal(map[string]int32{"dc1": 3, "dc2": 2}))
+}
+
+func TestGetConfigAsJSONWithPendingRebuild(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{
+		Spec: CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []Datacenter{{Name: "dc1"}, {Name: "dc2"}},
+		},
+		Status: CassandraClusterStatus{
+			Datacenters: map[string]DatacenterStatus{
+				"dc1": {},
+				"dc2": {Rebuild: &RebuildStatus{SourceDatacenter: "dc1", Phase: RebuildPhaseRunning}},
+			},
+		},
+	}
+
+	config, err := cluster.GetConfigAsJSON(&cluster.Spec.Datacenters[1], &Rack{Name: "rack1"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).To(ContainSubstring(`"auto_bootstrap":false`))
+
+	config, err = cluster.GetConfigAsJSON(&cluster.Spec.Datacenters[0], &Rack{Name: "rack1"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).ToNot(ContainSubstring("auto_bootstrap"))
+
+	cluster.Status.Datacenters["dc2"].Rebuild.Phase = RebuildPhaseCompleted
+	config, err = cluster.GetConfigAsJSON(&cluster.Spec.Datacenters[1], &Rack{Name: "rack1"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).ToNot(ContainSubstring("auto_bootstrap"))
+}
+
+func TestSetCondition(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	status := &CassandraClusterStatus{}
+	status.SetCondition(ClusterCondition{Type: ClusterConditionDatacenterRemovalBlocked, Status: corev1.ConditionTrue, Message: "blocked"})
+	g.Expect(status.Conditions).To(HaveLen(1))
+	transitionTime := status.Conditions[0].LastTransitionTime
+	g.Expect(transitionTime.IsZero()).To(BeFalse())
+
+	status.SetCondition(ClusterCondition{Type: ClusterConditionDatacenterRemovalBlocked, Status: corev1.ConditionTrue, Message: "still blocked"})
+	g.Expect(status.Conditions).To(HaveLen(1))
+	g.Expect(status.Conditions[0].Message).To(Equal("still blocked"))
+	g.Expect(status.Conditions[0].LastTransitionTime).To(Equal(transitionTime))
+
+	status.SetCondition(ClusterCondition{Type: ClusterConditionDatacenterRemovalBlocked, Status: corev1.ConditionFalse})
+	g.Expect(status.GetCondition(ClusterConditionDatacenterRemovalBlocked).Status).To(Equal(corev1.ConditionFalse))
+}
+
+func TestGetMaxUnavailable(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{}
+	g.Expect(cluster.GetMaxUnavailable()).To(Equal(intstr.FromInt(1)))
+
+	maxUnavailable := intstr.FromString("25%")
+	cluster.Spec.DisruptionBudget.MaxUnavailable = &maxUnavailable
+	g.Expect(cluster.GetMaxUnavailable()).To(Equal(intstr.FromString("25%")))
+}
+
+func TestIsDeletionAllowed(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{}
+	g.Expect(cluster.GetDeletionPolicy()).To(Equal(DeletionPolicyRetain))
+	g.Expect(cluster.IsDeletionAllowed()).To(BeTrue())
+
+	g.Expect(cluster.ValidateDelete()).To(Succeed())
+
+	cluster.Spec.DeletionProtection = true
+	g.Expect(cluster.IsDeletionAllowed()).To(BeFalse())
+	g.Expect(cluster.ValidateDelete()).ToNot(Succeed())
+
+	cluster.Annotations = map[string]string{AllowDeletionAnnotation: "true"}
+	g.Expect(cluster.IsDeletionAllowed()).To(BeTrue())
+	g.Expect(cluster.ValidateDelete()).To(Succeed())
+}
+
+func TestGetLoggers(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{}
+	g.Expect(cluster.GetLoggers()).To(BeEmpty())
+
+	cluster.Spec.Logging.Loggers = []LoggerSpec{
+		{Name: "org.apache.cassandra.db.compaction", Level: "DEBUG"},
+		{Name: RootLogger, Level: "WARN"},
+		{Name: "org.apache.cassandra.db.compaction", Level: "TRACE"},
+	}
+	g.Expect(cluster.GetLoggers()).To(Equal([]LoggerSpec{
+		{Name: RootLogger, Level: "WARN"},
+		{Name: "org.apache.cassandra.db.compaction", Level: "TRACE"},
+	}))
+}
+
+func TestGetConfigAsJSONWithIncrementalBackups(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &CassandraCluster{
+		Spec: CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []Datacenter{{Name: "dc1"}},
+			Backup:      &BackupSpec{},
+		},
+	}
+
+	config, err := cluster.GetConfigAsJSON(&cluster.Spec.Datacenters[0], &Rack{Name: "rack1"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).ToNot(ContainSubstring("incremental_backups"))
+
+	cluster.Spec.Backup.IncrementalBackups = true
+	config, err = cluster.GetConfigAsJSON(&cluster.Spec.Datacenters[0], &Rack{Name: "rack1"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(config).To(ContainSubstring(`"incremental_backups":true`))
+}
+
+func TestGetNodesPerRack(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dc := &Datacenter{Name: "dc1", Racks: []Rack{{Name: "rack1"}, {Name: "rack2"}}}
+	g.Expect(dc.GetNodesPerRack()).To(Equal(DefaultNodesPerRack))
+	g.Expect(dc.GetSize()).To(Equal(int32(2)))
+
+	dc.NodesPerRack = 3
+	g.Expect(dc.GetNodesPerRack()).To(Equal(int32(3)))
+	g.Expect(dc.GetSize()).To(Equal(int32(6)))
+}
@@ -0,0 +1,37 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (c *CassandraCluster) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(c).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=delete,path=/validate-cassandra-apache-org-v1alpha1-cassandracluster,mutating=false,failurePolicy=fail,groups=cassandra.apache.org,resources=cassandraclusters,versions=v1alpha1,name=vcassandracluster.kb.io
+
+var _ webhook.Validator = &CassandraCluster{}
+
+// ValidateCreate implements webhook.Validator. Only deletions are validated.
+func (c *CassandraCluster) ValidateCreate() error {
+	return nil
+}
+
+// ValidateUpdate implements webhook.Validator. Only deletions are validated.
+func (c *CassandraCluster) ValidateUpdate(old runtime.Object) error {
+	return nil
+}
+
+// ValidateDelete refuses to delete a cluster with deletion protection unless
+// the deletion has been allowed with the allow-deletion annotation
+func (c *CassandraCluster) ValidateDelete() error {
+	if !c.IsDeletionAllowed() {
+		return fmt.Errorf("CassandraCluster %s has deletion protection, set the %s annotation to true to delete it", c.Name, AllowDeletionAnnotation)
+	}
+	return nil
+}
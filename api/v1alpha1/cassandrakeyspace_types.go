@@ -0,0 +1,88 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CassandraKeyspaceSpec defines the desired state of CassandraKeyspace
+type CassandraKeyspaceSpec struct {
+	// ClusterRef references the CassandraCluster, in the same namespace, that the
+	// keyspace is created in.
+	ClusterRef corev1.LocalObjectReference `json:"clusterRef"`
+
+	// KeyspaceName is the name of the keyspace in Cassandra. Defaults to the name
+	// of the CassandraKeyspace. It cannot be changed once the keyspace has been
+	// created.
+	KeyspaceName string `json:"keyspaceName,omitempty"`
+
+	// Replication maps datacenter names to replication factors for
+	// NetworkTopologyStrategy. A replication factor cannot be greater than the
+	// number of nodes in the datacenter.
+	// +kubebuilder:validation:MinProperties=1
+	Replication map[string]int32 `json:"replication"`
+}
+
+// CassandraKeyspaceStatus defines the observed state of CassandraKeyspace
+type CassandraKeyspaceStatus struct {
+	// Created is true when the keyspace exists in the cluster
+	Created bool `json:"created,omitempty"`
+
+	// Replication is the replication that has been applied to the keyspace
+	Replication map[string]int32 `json:"replication,omitempty"`
+
+	// Error is the reason the keyspace could not be reconciled
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterRef.name`
+// +kubebuilder:printcolumn:name="Created",type=boolean,JSONPath=`.status.created`
+
+// CassandraKeyspace is the Schema for the cassandrakeyspaces API. Deleting a
+// CassandraKeyspace does not drop the keyspace.
+type CassandraKeyspace struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraKeyspaceSpec   `json:"spec,omitempty"`
+	Status CassandraKeyspaceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CassandraKeyspaceList contains a list of CassandraKeyspace
+type CassandraKeyspaceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CassandraKeyspace `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CassandraKeyspace{}, &CassandraKeyspaceList{})
+}
+
+// GetKeyspaceName returns the name of the keyspace in Cassandra
+func (k *CassandraKeyspace) GetKeyspaceName() string {
+	if k.Spec.KeyspaceName != "" {
+		return k.Spec.KeyspaceName
+	}
+	return k.Name
+}
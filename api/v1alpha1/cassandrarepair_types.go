@@ -0,0 +1,197 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+)
+
+const defaultRepairHistoryLimit int32 = 3
+
+// CassandraRepairSpec defines the desired state of CassandraRepair
+type CassandraRepairSpec struct {
+	// ClusterRef references the CassandraCluster, in the same namespace, that is
+	// repaired.
+	ClusterRef corev1.LocalObjectReference `json:"clusterRef"`
+
+	// Schedule is the cron expression, in UTC, for starting repair runs. A new
+	// run is not started while the previous one is still in progress.
+	Schedule string `json:"schedule"`
+
+	// Keyspaces are the keyspaces to repair. Defaults to all keyspaces except the
+	// system keyspaces.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+
+	// Subranges is the number of segments each primary token range of a node is
+	// split into. Smaller segments stream less data at a time. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	Subranges int32 `json:"subranges,omitempty"`
+
+	// Intensity is the share of time spent repairing, between 0.1 and 1.0. With
+	// an intensity of 0.5 the operator waits as long as a segment took before it
+	// starts the next one. Defaults to 1.0.
+	// +kubebuilder:validation:Pattern=`^(0\.[1-9][0-9]*|1(\.0+)?)$`
+	Intensity string `json:"intensity,omitempty"`
+
+	// Incremental runs incremental instead of full repairs
+	Incremental bool `json:"incremental,omitempty"`
+
+	// Suspend pauses the current run after its running segment and keeps new
+	// runs from starting. Setting it back to false resumes the run where it
+	// stopped.
+	Suspend bool `json:"suspend,omitempty"`
+
+	// HistoryLimit is the number of finished runs kept in the status. Defaults
+	// to 3.
+	// +kubebuilder:validation:Minimum=0
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+}
+
+// RepairRunPhase is the state of a repair run
+type RepairRunPhase string
+
+const (
+	RepairRunPhaseRunning RepairRunPhase = "Running"
+
+	// RepairRunPhasePaused means that the run is suspended
+	RepairRunPhasePaused RepairRunPhase = "Paused"
+
+	// RepairRunPhaseWaiting means that the run waits for the cluster to be
+	// healthy before it repairs the next segment
+	RepairRunPhaseWaiting RepairRunPhase = "Waiting"
+
+	RepairRunPhaseCompleted RepairRunPhase = "Completed"
+
+	// RepairRunPhaseFailed means that the run finished but at least one segment
+	// could not be repaired
+	RepairRunPhaseFailed RepairRunPhase = "Failed"
+)
+
+// RepairRun is a repair of all keyspaces on all nodes. The keyspaces are
+// repaired one after the other, and for each keyspace the primary ranges of one
+// node at a time.
+type RepairRun struct {
+	Phase RepairRunPhase `json:"phase"`
+
+	// ScheduledTime is the time the run was scheduled for by the cron expression
+	ScheduledTime *metav1.Time `json:"scheduledTime,omitempty"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Keyspaces are the keyspaces that are repaired by the run
+	Keyspaces []string `json:"keyspaces,omitempty"`
+
+	// KeyspaceIndex, NodeIndex and SegmentIndex are the position of the segment
+	// that is repaired next
+	KeyspaceIndex int32 `json:"keyspaceIndex,omitempty"`
+	NodeIndex     int32 `json:"nodeIndex,omitempty"`
+	SegmentIndex  int32 `json:"segmentIndex,omitempty"`
+
+	// CurrentNode is the pod that repairs the current segment
+	CurrentNode string `json:"currentNode,omitempty"`
+
+	// JobID is the management API job of the current segment
+	JobID string `json:"jobId,omitempty"`
+
+	SegmentStartTime *metav1.Time `json:"segmentStartTime,omitempty"`
+
+	// NextSegmentTime is the earliest time the next segment is started at, as
+	// determined by the intensity
+	NextSegmentTime *metav1.Time `json:"nextSegmentTime,omitempty"`
+
+	RepairedSegments int32 `json:"repairedSegments,omitempty"`
+
+	FailedSegments int32 `json:"failedSegments,omitempty"`
+
+	// Message explains why the run is waiting or the error of the last failed
+	// segment
+	Message string `json:"message,omitempty"`
+}
+
+// CassandraRepairStatus defines the observed state of CassandraRepair
+type CassandraRepairStatus struct {
+	// LastScheduleTime is the time the last run was scheduled for
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// CurrentRun is the run in progress
+	CurrentRun *RepairRun `json:"currentRun,omitempty"`
+
+	// History are the finished runs, the most recent first
+	History []RepairRun `json:"history,omitempty"`
+
+	// Error is the reason the repair could not be reconciled
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterRef.name`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.currentRun.phase`
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+
+// CassandraRepair is the Schema for the cassandrarepairs API. The operator runs
+// the repairs itself through the management API, which is an alternative to
+// Reaper for smaller clusters.
+type CassandraRepair struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraRepairSpec   `json:"spec,omitempty"`
+	Status CassandraRepairStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CassandraRepairList contains a list of CassandraRepair
+type CassandraRepairList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CassandraRepair `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CassandraRepair{}, &CassandraRepairList{})
+}
+
+func (r *CassandraRepair) GetSubranges() int {
+	if r.Spec.Subranges < 1 {
+		return 1
+	}
+	return int(r.Spec.Subranges)
+}
+
+func (r *CassandraRepair) GetHistoryLimit() int {
+	if r.Spec.HistoryLimit == nil {
+		return int(defaultRepairHistoryLimit)
+	}
+	return int(*r.Spec.HistoryLimit)
+}
+
+// GetIntensity returns the intensity as a number between 0.1 and 1.0
+func (r *CassandraRepair) GetIntensity() float64 {
+	intensity, err := strconv.ParseFloat(r.Spec.Intensity, 64)
+	if err != nil || intensity <= 0 || intensity > 1 {
+		return 1
+	}
+	return intensity
+}
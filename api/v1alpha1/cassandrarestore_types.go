@@ -0,0 +1,153 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CassandraRestoreSpec defines the desired state of CassandraRestore
+type CassandraRestoreSpec struct {
+	// Backup is the name of the completed CassandraBackup, in the same namespace,
+	// that is restored
+	Backup string `json:"backup"`
+
+	// ClusterRef references the CassandraCluster that is restored into. Unless
+	// InPlace is set, it has to be a new cluster whose RestoreFrom references
+	// this restore.
+	ClusterRef corev1.LocalObjectReference `json:"clusterRef"`
+
+	// InPlace restores tables of a running cluster rather than bootstrapping a
+	// new one. The backed up SSTables are moved into the directories of the
+	// tables and loaded with nodetool refresh, so they are merged with the
+	// existing data. The tables have to exist.
+	InPlace bool `json:"inPlace,omitempty"`
+
+	// Keyspaces are the keyspaces restored in place. Defaults to all keyspaces
+	// except the system keyspaces when no tables are given either.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+
+	// Tables are the tables, in the form <keyspace>.<table>, restored in place
+	Tables []string `json:"tables,omitempty"`
+
+	// Truncate truncates the tables that are restored in place before loading
+	// the backed up data, so that the tables end up with the data of the backup
+	Truncate bool `json:"truncate,omitempty"`
+
+	// RestorePointInTime replays the archived commitlog segments of the backed
+	// up nodes up to this time, so that the cluster ends up with the writes made
+	// until then rather than only those in the backup. The cluster has to have
+	// commitlog archiving enabled when the backup is taken. Only supported when
+	// restoring into a new cluster.
+	RestorePointInTime *metav1.Time `json:"restorePointInTime,omitempty"`
+}
+
+type RestorePhase string
+
+const (
+	RestorePhaseRunning   RestorePhase = "Running"
+	RestorePhaseCompleted RestorePhase = "Completed"
+	RestorePhaseFailed    RestorePhase = "Failed"
+)
+
+type NodeRestorePhase string
+
+const (
+	NodeRestorePhasePending     NodeRestorePhase = "Pending"
+	NodeRestorePhaseDownloading NodeRestorePhase = "Downloading"
+	NodeRestorePhaseCompleted   NodeRestorePhase = "Completed"
+	NodeRestorePhaseFailed      NodeRestorePhase = "Failed"
+)
+
+// NodeRestoreStatus is the restore of one node
+type NodeRestoreStatus struct {
+	Pod string `json:"pod"`
+
+	// SourcePod is the backed up pod that the node is restored from. It is in the
+	// same datacenter and rack and has the same ordinal.
+	SourcePod string `json:"sourcePod"`
+
+	// ManifestKey is the manifest of the backup of the source pod
+	ManifestKey string `json:"manifestKey"`
+
+	Phase NodeRestorePhase `json:"phase"`
+
+	// Files is the number of files that have been restored in place
+	Files int32 `json:"files,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// CassandraRestoreStatus defines the observed state of CassandraRestore
+type CassandraRestoreStatus struct {
+	Phase RestorePhase `json:"phase,omitempty"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Truncated is true once the tables that are restored in place have been
+	// truncated
+	Truncated bool `json:"truncated,omitempty"`
+
+	Nodes []NodeRestoreStatus `json:"nodes,omitempty"`
+
+	// Error is the reason the restore failed or could not be reconciled
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterRef.name`
+// +kubebuilder:printcolumn:name="Backup",type=string,JSONPath=`.spec.backup`
+// +kubebuilder:printcolumn:name="In Place",type=boolean,JSONPath=`.spec.inPlace`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+
+// CassandraRestore is the Schema for the cassandrarestores API. It restores a
+// CassandraBackup either into a new cluster or into the tables of a running one.
+type CassandraRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraRestoreSpec   `json:"spec,omitempty"`
+	Status CassandraRestoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CassandraRestoreList contains a list of CassandraRestore
+type CassandraRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CassandraRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CassandraRestore{}, &CassandraRestoreList{})
+}
+
+// IsFinished returns true if the restore has completed or failed
+func (r *CassandraRestore) IsFinished() bool {
+	return r.Status.Phase == RestorePhaseCompleted || r.Status.Phase == RestorePhaseFailed
+}
+
+// IsRestoredFromBackup returns true if the nodes of the cluster are bootstrapped
+// from a backup
+func (c *CassandraCluster) IsRestoredFromBackup() bool {
+	return c.Spec.RestoreFrom != nil && c.IsBackupEnabled()
+}
@@ -0,0 +1,119 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RoleFinalizer makes sure that the role is dropped before the CassandraRole
+	// is deleted
+	RoleFinalizer = "cassandra.apache.org/role"
+)
+
+// Permission is a CQL permission that can be granted on keyspaces and tables
+// +kubebuilder:validation:Enum=ALL;ALTER;AUTHORIZE;CREATE;DROP;MODIFY;SELECT
+type Permission string
+
+// RolePermission grants permissions on a keyspace or a table
+type RolePermission struct {
+	// +kubebuilder:validation:MinItems=1
+	Permissions []Permission `json:"permissions"`
+
+	// Keyspace the permissions are granted on. The permissions are granted on all
+	// keyspaces when it is not set.
+	Keyspace string `json:"keyspace,omitempty"`
+
+	// Table the permissions are granted on. Requires Keyspace to be set.
+	Table string `json:"table,omitempty"`
+}
+
+// CassandraRoleSpec defines the desired state of CassandraRole
+type CassandraRoleSpec struct {
+	// ClusterRef references the CassandraCluster, in the same namespace, that the
+	// role is created in.
+	ClusterRef corev1.LocalObjectReference `json:"clusterRef"`
+
+	// RoleName is the name of the role in Cassandra. Defaults to the name of the
+	// CassandraRole. It cannot be changed once the role has been created.
+	RoleName string `json:"roleName,omitempty"`
+
+	Login bool `json:"login,omitempty"`
+
+	Superuser bool `json:"superuser,omitempty"`
+
+	// PasswordSecretRef selects the key of a secret, in the same namespace, that
+	// holds the password of the role.
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+
+	// Permissions are granted to the role. Permissions that the role has been
+	// granted otherwise are revoked.
+	Permissions []RolePermission `json:"permissions,omitempty"`
+}
+
+// CassandraRoleStatus defines the observed state of CassandraRole
+type CassandraRoleStatus struct {
+	// Created is true when the role exists in the cluster
+	Created bool `json:"created,omitempty"`
+
+	// Permissions are the permissions that have been granted to the role
+	Permissions []RolePermission `json:"permissions,omitempty"`
+
+	// PasswordSecretVersion is the resource version of the password secret that
+	// was last applied
+	PasswordSecretVersion string `json:"passwordSecretVersion,omitempty"`
+
+	// Error is the reason the role could not be reconciled
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterRef.name`
+// +kubebuilder:printcolumn:name="Created",type=boolean,JSONPath=`.status.created`
+
+// CassandraRole is the Schema for the cassandraroles API
+type CassandraRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraRoleSpec   `json:"spec,omitempty"`
+	Status CassandraRoleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CassandraRoleList contains a list of CassandraRole
+type CassandraRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CassandraRole `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CassandraRole{}, &CassandraRoleList{})
+}
+
+// GetRoleName returns the name of the role in Cassandra
+func (r *CassandraRole) GetRoleName() string {
+	if r.Spec.RoleName != "" {
+		return r.Spec.RoleName
+	}
+	return r.Name
+}
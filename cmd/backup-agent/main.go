@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/jsanda/cassandra-operator/pkg/backup"
+)
+
+// The backup agent runs as a sidecar of the cassandra container and uploads
+// snapshots to object storage on behalf of the operator. With the restore
+// command it runs as an init container that restores a new node from a backup.
+func main() {
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	log := ctrl.Log.WithName("backup-agent")
+
+	store, err := backup.NewS3Store(backup.StorageConfigFromEnv())
+	if err != nil {
+		log.Error(err, "unable to configure object storage")
+		os.Exit(1)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err = restore(store, log, os.Args[2:]); err != nil {
+			log.Error(err, "restore failed")
+			os.Exit(1)
+		}
+		return
+	}
+
+	var dataDir, commitLogDir, commitLogPrefix string
+	var port int
+	flag.StringVar(&dataDir, "data-dir", "/var/lib/cassandra/data", "The Cassandra data directory.")
+	flag.IntVar(&port, "port", int(backup.DefaultAgentPort), "The port the agent listens on.")
+	flag.StringVar(&commitLogDir, "commitlog-dir", "", "The directory Cassandra archives commitlog segments to. Archiving is disabled if empty.")
+	flag.StringVar(&commitLogPrefix, "commitlog-prefix", "", "The prefix the archived commitlog segments are uploaded to.")
+	flag.Parse()
+
+	token := os.Getenv(backup.TokenEnvVar)
+	if token == "" {
+		log.Error(fmt.Errorf("%s is not set", backup.TokenEnvVar), "unable to start backup agent")
+		os.Exit(1)
+	}
+
+	agent := backup.NewAgent(dataDir, store, log)
+
+	if commitLogDir != "" {
+		shipper := backup.NewCommitLogShipper(commitLogDir, commitLogPrefix, store, log.WithName("commitlogs"))
+		log.Info("shipping archived commitlog segments", "Dir", commitLogDir, "Prefix", commitLogPrefix)
+		go shipper.Run(context.Background(), 10*time.Second)
+	}
+
+	log.Info("starting backup agent", "Port", port, "DataDir", dataDir)
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), backup.RequireToken(token, agent.Handler())); err != nil {
+		log.Error(err, "backup agent stopped")
+		os.Exit(1)
+	}
+}
+
+// restore restores the node of the pod from the manifest that the operator has
+// published for it, and adds the JVM options for its first start. A pod that
+// replaces a dead node is not restored. If a point in
+// time is published as well, the archived commitlog segments of the node are
+// downloaded and Cassandra is configured to replay them up to that time.
+func restore(store backup.ObjectStore, log logr.Logger, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dataDir := flags.String("data-dir", "/var/lib/cassandra/data", "The Cassandra data directory.")
+	manifestsDir := flags.String("manifests-dir", "/restore-nodes", "The directory with the manifest key of each pod.")
+	jvmOptions := flags.String("jvm-options", "/config/jvm.options", "The jvm.options file to add the options of the restored node to.")
+	commitLogProperties := flags.String("commitlog-properties", "/config/commitlog_archiving.properties", "The commitlog_archiving.properties file to add the restore options to.")
+	replaceAddressesDir := flags.String("replace-addresses-dir", "", "The directory with the address of the dead node each replacing pod takes over.")
+	flags.Parse(args)
+
+	pod := os.Getenv("POD_NAME")
+	if *replaceAddressesDir != "" {
+		if _, err := os.Stat(filepath.Join(*replaceAddressesDir, pod)); err == nil {
+			// The node streams the data of the dead node from its replicas
+			log.Info("pod replaces a dead node, skipping restore", "Pod", pod)
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(*manifestsDir, pod))
+	if os.IsNotExist(err) {
+		log.Info("pod is not restored from a backup", "Pod", pod)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	manifestKey := strings.TrimSpace(string(data))
+
+	log.Info("restoring node", "Pod", pod, "Manifest", manifestKey)
+	manifest, err := backup.RestoreNode(context.Background(), store, manifestKey, *dataDir)
+	if err != nil {
+		return err
+	}
+
+	if err = appendLines(*jvmOptions, backup.JVMOptions(manifest)); err != nil {
+		return err
+	}
+
+	pointInTime, err := ioutil.ReadFile(filepath.Join(*manifestsDir, backup.RestorePointInTimeKey))
+	if os.IsNotExist(err) {
+		pointInTime = nil
+	} else if err != nil {
+		return err
+	}
+	if len(pointInTime) > 0 {
+		replay, err := backup.RestoreCommitLogs(context.Background(), store, manifest, *dataDir, backup.CommitLogRestoreDir)
+		if err != nil {
+			return err
+		}
+		if replay {
+			log.Info("replaying commitlogs", "Pod", pod, "PointInTime", string(pointInTime))
+			if err = appendLines(*commitLogProperties, backup.CommitLogRestoreProperties(strings.TrimSpace(string(pointInTime)))); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Info("restored node", "Pod", pod, "Backup", manifest.Backup, "SourcePod", manifest.Pod)
+	return nil
+}
+
+// appendLines appends lines to the file, creating it if needed
+func appendLines(fileName string, lines []string) error {
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err = fmt.Fprintln(f, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
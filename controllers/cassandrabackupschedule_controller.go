@@ -0,0 +1,53 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/reconciliation"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CassandraBackupScheduleReconciler reconciles a CassandraBackupSchedule object
+type CassandraBackupScheduleReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+func (r *CassandraBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.CassandraBackupSchedule{}).
+		Owns(&api.CassandraBackup{}).
+		Complete(r)
+}
+
+// +kubebuilder:rbac:groups=cassandra.apache.org,namespace="cassandra-operator",resources=cassandrabackupschedules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cassandra.apache.org,namespace="cassandra-operator",resources=cassandrabackupschedules/status,verbs=get;update;patch
+
+func (r *CassandraBackupScheduleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("cassandrabackupschedule", req.NamespacedName)
+
+	requestHandler := reconciliation.NewBackupScheduleRequestHandler(&req, r.Client, r.Scheme, logger)
+
+	return requestHandler.HandleRequest(ctx)
+}
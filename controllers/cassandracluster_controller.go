@@ -21,9 +21,17 @@ import (
 	"github.com/go-logr/logr"
 	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
 	"github.com/jsanda/cassandra-operator/pkg/reconciliation"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // CassandraClusterReconciler reconciles a CassandraCluster object
@@ -31,30 +39,68 @@ type CassandraClusterReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	// FeatureGates turns steps of the reconciliation off
+	FeatureGates reconciliation.FeatureGates
 }
 
 func (r *CassandraClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&api.CassandraCluster{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.clustersForSecret),
+		}).
 		Complete(r)
 }
 
+// clustersForSecret maps a secret to the clusters that use it for encryption or
+// for the superuser credentials, so that a renewed certificate is rolled out and
+// a referenced superuser secret is picked up without waiting for another event.
+func (r *CassandraClusterReconciler) clustersForSecret(obj handler.MapObject) []reconcile.Request {
+	clusters := &api.CassandraClusterList{}
+	if err := r.List(context.Background(), clusters, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list clusters", "Namespace", obj.Meta.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cluster := range clusters.Items {
+		if (cluster.IsInternodeEncryptionEnabled() && cluster.GetInternodeSecretName() == obj.Meta.GetName()) ||
+			(cluster.IsClientEncryptionEnabled() && cluster.GetClientSecretName() == obj.Meta.GetName()) ||
+			cluster.GetSuperuserSecretName() == obj.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			})
+		}
+	}
+
+	return requests
+}
+
 // +kubebuilder:rbac:groups=cassandra.apache.org,namespace="cassandra-operator",resources=cassandraclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cassandra.apache.org,namespace="cassandra-operator",resources=cassandraclusters/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups="",namespace="cassandra-operator",resources=services,verbs=get;list;watch;create
-// +kubebuilder:rbac:groups="apps",namespace="cassandra-operator",resources=statefulsets,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups="",namespace="cassandra-operator",resources=services,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",namespace="cassandra-operator",resources=pods,verbs=get;list;watch;patch;delete
+// +kubebuilder:rbac:groups="",namespace="cassandra-operator",resources=persistentvolumeclaims,verbs=get;list;watch;patch;delete
+// +kubebuilder:rbac:groups="",namespace="cassandra-operator",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",namespace="cassandra-operator",resources=configmaps,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="cert-manager.io",namespace="cassandra-operator",resources=certificates,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="apps",namespace="cassandra-operator",resources=statefulsets,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="apps",namespace="cassandra-operator",resources=deployments,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="monitoring.coreos.com",namespace="cassandra-operator",resources=servicemonitors,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="policy",namespace="cassandra-operator",resources=poddisruptionbudgets,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="networking.k8s.io",namespace="cassandra-operator",resources=networkpolicies,verbs=get;list;watch;create;update
 
 func (r *CassandraClusterReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	logger := r.Log.WithValues("cassandracluster", req.NamespacedName)
 
-	handler := reconciliation.NewRequestHandler(&req, r.Client, r.Scheme, logger)
-
-	return handler.HandleRequest(ctx)
-
-	//status := cluster.Status.DeepCopy()
-
-	//r.CheckHeadlessServices(cluster)
+	requestHandler := reconciliation.NewRequestHandler(&req, r.Client, r.Scheme, logger, r.FeatureGates)
 
-	return ctrl.Result{}, nil
+	return requestHandler.HandleRequest(ctx)
 }
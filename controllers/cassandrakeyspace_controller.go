@@ -0,0 +1,80 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/reconciliation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// CassandraKeyspaceReconciler reconciles a CassandraKeyspace object
+type CassandraKeyspaceReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+func (r *CassandraKeyspaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.CassandraKeyspace{}).
+		Watches(&source.Kind{Type: &api.CassandraCluster{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.keyspacesForCluster),
+		}).
+		Complete(r)
+}
+
+// keyspacesForCluster maps a cluster to its keyspaces so that the replication
+// is validated again when the topology of the cluster changes.
+func (r *CassandraKeyspaceReconciler) keyspacesForCluster(obj handler.MapObject) []reconcile.Request {
+	keyspaces := &api.CassandraKeyspaceList{}
+	if err := r.List(context.Background(), keyspaces, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list keyspaces", "Namespace", obj.Meta.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, keyspace := range keyspaces.Items {
+		if keyspace.Spec.ClusterRef.Name == obj.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: keyspace.Namespace, Name: keyspace.Name},
+			})
+		}
+	}
+
+	return requests
+}
+
+// +kubebuilder:rbac:groups=cassandra.apache.org,namespace="cassandra-operator",resources=cassandrakeyspaces,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cassandra.apache.org,namespace="cassandra-operator",resources=cassandrakeyspaces/status,verbs=get;update;patch
+
+func (r *CassandraKeyspaceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("cassandrakeyspace", req.NamespacedName)
+
+	requestHandler := reconciliation.NewKeyspaceRequestHandler(&req, r.Client, r.Scheme, logger)
+
+	return requestHandler.HandleRequest(ctx)
+}
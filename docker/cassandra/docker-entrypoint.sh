@@ -7,6 +7,34 @@ if [ -d "/config" ] && ! [ "/config" -ef "$CASSANDRA_CONF" ]; then
     cp -R /config/* "${CASSANDRA_CONF:-/etc/cassandra}"
 fi
 
-mv /tmp/datastax-mgmtapi-agent-0.1.0-SNAPSHOT.jar $CASSANDRA_HOME/lib
+if [ -f /tmp/datastax-mgmtapi-agent.jar ]; then
+    mv /tmp/datastax-mgmtapi-agent.jar $CASSANDRA_HOME/lib
+fi
+
+# The management API agent runs inside of Cassandra and listens on a unix socket.
+# The server translates the HTTP requests from the operator into calls over the socket.
+export JVM_EXTRA_OPTS="$JVM_EXTRA_OPTS -javaagent:$CASSANDRA_HOME/lib/datastax-mgmtapi-agent.jar -Dcassandra.unix_socket_file=/tmp/cassandra.sock"
+
+# The management API can create roles and decommission the node, so it is only
+# reachable from outside of the pod with TLS, and it then requires clients to
+# present a certificate signed by the CA. The operator mounts the certificates.
+MGMT_API_TLS_DIR=${MGMT_API_TLS_DIR:-/etc/mgmt-api-tls}
+if [ -f "$MGMT_API_TLS_DIR/tls.crt" ]; then
+    MGMT_API_ARGS="--host tcp://0.0.0.0:${MGMT_API_PORT:-8080} \
+        --tlscacert $MGMT_API_TLS_DIR/ca.crt \
+        --tlscert $MGMT_API_TLS_DIR/tls.crt \
+        --tlskey $MGMT_API_TLS_DIR/tls.key"
+else
+    MGMT_API_ARGS="--host tcp://127.0.0.1:${MGMT_API_PORT:-8080}"
+fi
+
+if [ "$1" = "cassandra" ]; then
+    java -Xms128m -Xmx128m -jar /opt/mgmtapi/datastax-mgmtapi-server.jar \
+        --cassandra-socket /tmp/cassandra.sock \
+        $MGMT_API_ARGS \
+        --host file:///tmp/oss-mgmt.sock \
+        --explicit-start true \
+        --cassandra-home $CASSANDRA_HOME &
+fi
 
-exec "$@"
\ No newline at end of file
+exec "$@"
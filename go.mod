@@ -5,9 +5,14 @@ go 1.13
 require (
 	github.com/Jeffail/gabs v1.4.0
 	github.com/go-logr/logr v0.1.0
+	github.com/gocql/gocql v0.0.0-20200624222514-34081eda590e
+	github.com/minio/minio-go/v6 v6.0.55
 	github.com/onsi/ginkgo v1.11.0
 	github.com/onsi/gomega v1.8.1
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.0.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/robfig/cron/v3 v3.0.1
 	k8s.io/api v0.18.6
 	k8s.io/apimachinery v0.18.6
 	k8s.io/client-go v12.0.0+incompatible
@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -30,6 +31,7 @@ import (
 
 	cassandrav1alpha1 "github.com/jsanda/cassandra-operator/api/v1alpha1"
 	"github.com/jsanda/cassandra-operator/controllers"
+	"github.com/jsanda/cassandra-operator/pkg/reconciliation"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -48,10 +50,14 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var featureGates string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&featureGates, "feature-gates", "",
+		"A comma-separated list of feature=bool pairs that turn features off, e.g. Reaper=false. "+
+			"Known features are "+strings.Join(reconciliation.KnownFeatures(), ", ")+".")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -75,14 +81,77 @@ func main() {
 		os.Exit(1)
 	}
 
+	gates, err := reconciliation.ParseFeatureGates(featureGates)
+	if err != nil {
+		setupLog.Error(err, "invalid feature gates")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.CassandraClusterReconciler{
+		Client:       mgr.GetClient(),
+		Log:          ctrl.Log.WithName("controllers").WithName("CassandraCluster"),
+		Scheme:       mgr.GetScheme(),
+		FeatureGates: gates,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CassandraCluster")
+		os.Exit(1)
+	}
+	if err = (&controllers.CassandraRoleReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CassandraCluster"),
+		Log:    ctrl.Log.WithName("controllers").WithName("CassandraRole"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "CassandraCluster")
+		setupLog.Error(err, "unable to create controller", "controller", "CassandraRole")
 		os.Exit(1)
 	}
+	if err = (&controllers.CassandraKeyspaceReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CassandraKeyspace"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CassandraKeyspace")
+		os.Exit(1)
+	}
+	if err = (&controllers.CassandraRepairReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CassandraRepair"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CassandraRepair")
+		os.Exit(1)
+	}
+	if err = (&controllers.CassandraBackupReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CassandraBackup"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CassandraBackup")
+		os.Exit(1)
+	}
+	if err = (&controllers.CassandraBackupScheduleReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CassandraBackupSchedule"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CassandraBackupSchedule")
+		os.Exit(1)
+	}
+	if err = (&controllers.CassandraRestoreReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CassandraRestore"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CassandraRestore")
+		os.Exit(1)
+	}
+	// The webhook enforces deletion protection. It can be turned off when the
+	// operator runs outside of the cluster, e.g. with make run.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&cassandrav1alpha1.CassandraCluster{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CassandraCluster")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
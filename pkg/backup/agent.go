@@ -0,0 +1,544 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAgentPort is the port the backup agent listens on
+const DefaultAgentPort int32 = 8090
+
+// TokenEnvVar is the environment variable the agent reads the token from that
+// clients have to present as a bearer token
+const TokenEnvVar = "BACKUP_AGENT_TOKEN"
+
+const uploadsPath = "/api/v1/uploads"
+
+var errUploadCanceled = errors.New("upload canceled")
+
+// UploadRequest asks the agent to upload a snapshot of the node
+type UploadRequest struct {
+	// Snapshot is the name of the snapshot to upload
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// Incremental uploads the SSTables in the backups directories of the tables
+	// instead of a snapshot. Cassandra hard links every SSTable it flushes into
+	// the backups directory of its table when incremental_backups is enabled.
+	// The SSTables are removed from the backups directories once the manifest
+	// has been uploaded. Requires SharedPrefix.
+	Incremental bool `json:"incremental,omitempty"`
+
+	// Keyspaces limits an incremental upload to these keyspaces. Defaults to all
+	// keyspaces.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+
+	// BaseManifestKey is the manifest of the backup of the node that an
+	// incremental upload builds on. Its files are carried over to the manifest
+	// of the upload, so that the node can be restored from that manifest alone.
+	BaseManifestKey string `json:"baseManifestKey,omitempty"`
+
+	// Prefix is the prefix of the objects the files are uploaded to
+	Prefix string `json:"prefix"`
+
+	// SharedPrefix makes the upload incremental. SSTables are uploaded to this
+	// prefix, which is shared by the backups of the node, and SSTables that are
+	// already there with the same checksum are not uploaded again.
+	SharedPrefix string `json:"sharedPrefix,omitempty"`
+
+	// Manifest holds the information about the node that is stored with the
+	// files. The files, sizes and times are filled in by the agent, except for
+	// the start time if it is set.
+	Manifest Manifest `json:"manifest"`
+}
+
+// TransferStatus is the state of an upload or a download
+type TransferStatus string
+
+const (
+	TransferStatusRunning   TransferStatus = "Running"
+	TransferStatusCompleted TransferStatus = "Completed"
+	TransferStatusFailed    TransferStatus = "Failed"
+)
+
+// Upload is the state of the upload of a backup
+type Upload struct {
+	Backup string         `json:"backup"`
+	Status TransferStatus `json:"status"`
+
+	// ManifestKey is the object the manifest has been uploaded to
+	ManifestKey string `json:"manifestKey,omitempty"`
+
+	// Files is the number of files that have been uploaded
+	Files int `json:"files"`
+
+	// Size is the number of bytes that have been uploaded
+	Size int64 `json:"size"`
+
+	// Skipped is the number of files of an incremental upload that were
+	// already in the object storage
+	Skipped int `json:"skipped,omitempty"`
+
+	StartTime      time.Time  `json:"startTime"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+
+	Error string `json:"error,omitempty"`
+
+	// cancel stops the upload while it is running
+	cancel context.CancelFunc
+}
+
+// Agent runs in a sidecar of the cassandra container and uploads snapshots from
+// the data directory to the object storage. The operator takes the snapshots
+// through the management API and then asks the agent to upload them. For
+// restores, the agent downloads files into the restore directory, next to the
+// data directory, from where the operator imports them.
+type Agent struct {
+	dataDir      string
+	restoreDir   string
+	commitLogDir string
+	store        ObjectStore
+	log          logr.Logger
+
+	mu        sync.Mutex
+	uploads   map[string]*Upload
+	downloads map[string]*Download
+}
+
+// NewAgent returns an agent that uploads the snapshots in dataDir, which is the
+// directory with a subdirectory per keyspace, to store
+func NewAgent(dataDir string, store ObjectStore, log logr.Logger) *Agent {
+	return &Agent{
+		dataDir:      dataDir,
+		restoreDir:   filepath.Join(filepath.Dir(dataDir), RestoreDir),
+		commitLogDir: filepath.Join(filepath.Dir(dataDir), commitLogDir),
+		store:        store,
+		log:          log,
+		uploads:      make(map[string]*Upload),
+		downloads:    make(map[string]*Download),
+	}
+}
+
+// Handler returns the HTTP API of the agent
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(uploadsPath, a.handleStartUpload)
+	mux.HandleFunc(uploadsPath+"/", a.handleUpload)
+	mux.HandleFunc(downloadsPath, a.handleStartDownload)
+	mux.HandleFunc(downloadsPath+"/", a.handleDownload)
+	mux.HandleFunc(commitLogsPath, a.handleGetCommitLogPosition)
+	return mux
+}
+
+// RequireToken returns a handler that rejects requests to handler that do not
+// present token as a bearer token
+func RequireToken(token string, handler http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (a *Agent) handleStartUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := UploadRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (request.Snapshot == "" && !request.Incremental) || request.Manifest.Backup == "" {
+		http.Error(w, "snapshot and backup are required", http.StatusBadRequest)
+		return
+	}
+	if request.Incremental && (request.SharedPrefix == "" || request.BaseManifestKey == "") {
+		http.Error(w, "incremental uploads require a shared prefix and a base manifest", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	upload, found := a.uploads[request.Manifest.Backup]
+	if !found || upload.Status == TransferStatusFailed {
+		ctx, cancel := context.WithCancel(context.Background())
+		upload = &Upload{Backup: request.Manifest.Backup, Status: TransferStatusRunning, StartTime: time.Now(), cancel: cancel}
+		a.uploads[request.Manifest.Backup] = upload
+		go a.upload(ctx, request)
+	}
+	status := *upload
+	a.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (a *Agent) handleGetCommitLogPosition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := OldestCommitLogSegment(a.commitLogDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, CommitLogPosition{SegmentID: id})
+}
+
+// handleUpload returns the state of an upload. DELETE cancels the upload if it
+// is running. The upload is still running when the response is sent, and fails
+// once it has stopped.
+func (a *Agent) handleUpload(w http.ResponseWriter, r *http.Request) {
+	backup := strings.TrimPrefix(r.URL.Path, uploadsPath+"/")
+
+	var upload *Upload
+	switch r.Method {
+	case http.MethodGet:
+		upload = a.getUpload(backup)
+	case http.MethodDelete:
+		upload = a.cancelUpload(backup)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if upload == nil {
+		http.Error(w, fmt.Sprintf("upload %s not found", backup), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, upload)
+}
+
+func (a *Agent) getUpload(backup string) *Upload {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if upload, found := a.uploads[backup]; found {
+		status := *upload
+		return &status
+	}
+	return nil
+}
+
+func (a *Agent) cancelUpload(backup string) *Upload {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	upload, found := a.uploads[backup]
+	if !found {
+		return nil
+	}
+	if upload.Status == TransferStatusRunning {
+		a.log.Info("canceling upload", "Backup", backup)
+		upload.cancel()
+	}
+	status := *upload
+	return &status
+}
+
+// upload uploads the files of the snapshot, or of the backups directories for
+// incremental uploads, followed by the manifest
+func (a *Agent) upload(ctx context.Context, request UploadRequest) {
+	backup := request.Manifest.Backup
+	log := a.log.WithValues("Backup", backup, "Snapshot", request.Snapshot, "Incremental", request.Incremental)
+	log.Info("uploading files")
+
+	manifest := request.Manifest
+	// The operator sets the start time to when the snapshot was taken
+	if manifest.StartTime.IsZero() {
+		manifest.StartTime = time.Now()
+	}
+	manifest.Files = nil
+	manifest.Size = 0
+
+	var existing map[string]int64
+	if request.SharedPrefix != "" {
+		objects, err := a.store.List(ctx, request.SharedPrefix+"/")
+		if err != nil {
+			a.finishUpload(backup, "", fmt.Errorf("failed to list %s: %s", request.SharedPrefix, err))
+			return
+		}
+		existing = make(map[string]int64, len(objects))
+		for _, object := range objects {
+			existing[object.Key] = object.Size
+		}
+	}
+
+	// files are the files of the manifest by path
+	files := make(map[string]FileInfo)
+	if request.Incremental {
+		base, err := a.getBaseFiles(ctx, request)
+		if err != nil {
+			a.finishUpload(backup, "", err)
+			return
+		}
+		for _, file := range base {
+			files[file.Path] = file
+			manifest.Files = append(manifest.Files, file)
+			manifest.Size += file.Size
+		}
+	}
+
+	var uploaded []string
+	walk := func(fn func(file FileInfo, localPath string) error) error {
+		return a.walkSnapshot(request.Snapshot, fn)
+	}
+	if request.Incremental {
+		walk = func(fn func(file FileInfo, localPath string) error) error {
+			return a.walkBackups(request.Keyspaces, fn)
+		}
+	}
+
+	err := walk(func(file FileInfo, localPath string) error {
+		if ctx.Err() != nil {
+			return errUploadCanceled
+		}
+
+		file.Key = path.Join(request.Prefix, "data", file.Path)
+		if request.SharedPrefix != "" && IsSSTableComponent(file.Path) {
+			checksum, err := fileChecksum(localPath)
+			if err != nil {
+				return fmt.Errorf("failed to compute checksum of %s: %s", file.Path, err)
+			}
+			file.Checksum = checksum
+			file.Key = SharedFileKey(request.SharedPrefix, file)
+			uploaded = append(uploaded, localPath)
+
+			if baseFile, found := files[file.Path]; found {
+				// A restore downloads the files of the manifest by path, so two
+				// SSTables with the same path would overwrite each other. Paths
+				// only clash when the node has started over with new
+				// generations, e.g. after it was replaced.
+				if baseFile.Key != file.Key {
+					return fmt.Errorf("%s differs from the file in the base backup, a full backup is required", file.Path)
+				}
+				return nil
+			}
+
+			if size, found := existing[file.Key]; found && size == file.Size {
+				files[file.Path] = file
+				manifest.Files = append(manifest.Files, file)
+				manifest.Size += size
+				a.mu.Lock()
+				a.uploads[backup].Skipped++
+				a.mu.Unlock()
+				return nil
+			}
+		}
+
+		size, err := a.store.PutFile(ctx, file.Key, localPath)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %s", file.Path, err)
+		}
+		file.Size = size
+		files[file.Path] = file
+		manifest.Files = append(manifest.Files, file)
+		manifest.Size += size
+
+		a.mu.Lock()
+		a.uploads[backup].Files++
+		a.uploads[backup].Size += size
+		a.mu.Unlock()
+		return nil
+	})
+
+	manifestKey := path.Join(request.Prefix, ManifestFile)
+	if err == nil && ctx.Err() != nil {
+		err = errUploadCanceled
+	}
+	if err == nil {
+		manifest.CompletionTime = time.Now()
+		var data []byte
+		if data, err = json.Marshal(manifest); err == nil {
+			err = a.store.Put(ctx, manifestKey, data)
+		}
+	}
+
+	if err == nil && request.Incremental {
+		// Removing the hard links keeps later incremental uploads from going over
+		// the SSTables again and frees the space of SSTables that have been
+		// compacted away. Later incremental backups still include them through
+		// the manifest.
+		for _, localPath := range uploaded {
+			if removeErr := os.Remove(localPath); removeErr != nil {
+				log.Error(removeErr, "failed to remove uploaded file", "Path", localPath)
+			}
+		}
+	}
+
+	a.finishUpload(backup, manifestKey, err)
+}
+
+// getBaseFiles returns the files of the base manifest of an incremental
+// upload. The files have to be shared, since the files of a backup are deleted
+// along with it while the incremental upload keeps referencing them.
+func (a *Agent) getBaseFiles(ctx context.Context, request UploadRequest) ([]FileInfo, error) {
+	data, err := a.store.Get(ctx, request.BaseManifestKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base manifest %s: %s", request.BaseManifestKey, err)
+	}
+	base := Manifest{}
+	if err = json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse base manifest %s: %s", request.BaseManifestKey, err)
+	}
+
+	var files []FileInfo
+	for _, file := range base.Files {
+		if !IsSSTableComponent(file.Path) {
+			continue
+		}
+		if !strings.HasPrefix(file.Key, request.SharedPrefix+"/") {
+			return nil, fmt.Errorf("backup %s was taken without incremental backups enabled, a full backup is required", base.Backup)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (a *Agent) finishUpload(backup, manifestKey string, err error) {
+	log := a.log.WithValues("Backup", backup)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	upload := a.uploads[backup]
+	upload.cancel()
+	now := time.Now()
+	upload.CompletionTime = &now
+	if err != nil {
+		log.Error(err, "failed to upload snapshot")
+		upload.Status = TransferStatusFailed
+		upload.Error = err.Error()
+		return
+	}
+	log.Info("uploaded snapshot", "Files", upload.Files, "Skipped", upload.Skipped, "Size", upload.Size)
+	upload.Status = TransferStatusCompleted
+	upload.ManifestKey = manifestKey
+}
+
+// sstableComponent matches the files of SSTables, e.g. md-1-big-Data.db or
+// nb-1-big-TOC.txt
+var sstableComponent = regexp.MustCompile(`^[a-z]{2}-\d+-(big|bti)-`)
+
+// IsSSTableComponent returns true for the files of a snapshot that are SSTables.
+// SSTables are immutable so they can be shared between backups, unlike the
+// schema.cql and manifest.json files Cassandra writes with every snapshot.
+func IsSSTableComponent(file string) bool {
+	return sstableComponent.MatchString(path.Base(file))
+}
+
+// walkSnapshot calls fn for every file of the snapshot. Snapshots are stored in
+// <keyspace>/<table>-<id>/snapshots/<snapshot> in the data directory.
+func (a *Agent) walkSnapshot(snapshot string, fn func(file FileInfo, localPath string) error) error {
+	snapshotDirs, err := filepath.Glob(filepath.Join(a.dataDir, "*", "*", "snapshots", snapshot))
+	if err != nil {
+		return err
+	}
+	if len(snapshotDirs) == 0 {
+		return fmt.Errorf("snapshot %s not found", snapshot)
+	}
+
+	for _, snapshotDir := range snapshotDirs {
+		tableDir := filepath.Dir(filepath.Dir(snapshotDir))
+		table, err := filepath.Rel(a.dataDir, tableDir)
+		if err != nil {
+			return err
+		}
+
+		err = filepath.Walk(snapshotDir, func(localPath string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(snapshotDir, localPath)
+			if err != nil {
+				return err
+			}
+			return fn(FileInfo{Path: filepath.ToSlash(filepath.Join(table, rel)), Size: info.Size()}, localPath)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkBackups calls fn for every file in the backups directories of the tables
+// of the keyspaces, or of all keyspaces if none are given. The backups
+// directories are <keyspace>/<table>-<id>/backups in the data directory.
+func (a *Agent) walkBackups(keyspaces []string, fn func(file FileInfo, localPath string) error) error {
+	backupDirs, err := filepath.Glob(filepath.Join(a.dataDir, "*", "*", "backups"))
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[string]bool)
+	for _, keyspace := range keyspaces {
+		selected[keyspace] = true
+	}
+
+	for _, backupDir := range backupDirs {
+		tableDir := filepath.Dir(backupDir)
+		table, err := filepath.Rel(a.dataDir, tableDir)
+		if err != nil {
+			return err
+		}
+		if len(selected) > 0 && !selected[filepath.Dir(table)] {
+			continue
+		}
+
+		err = filepath.Walk(backupDir, func(localPath string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(backupDir, localPath)
+			if err != nil {
+				return err
+			}
+			return fn(FileInfo{Path: filepath.ToSlash(filepath.Join(table, rel)), Size: info.Size()}, localPath)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileChecksum returns the SHA-256 of the content of the file in hex
+func fileChecksum(localPath string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,419 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// memoryStore is an ObjectStore that keeps the objects in memory
+type memoryStore struct {
+	sync.Mutex
+	objects  map[string][]byte
+	modified map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: make(map[string][]byte), modified: make(map[string]time.Time)}
+}
+
+func (s *memoryStore) PutFile(ctx context.Context, key, path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), s.Put(ctx, key, data)
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	s.objects[key] = data
+	s.modified[key] = time.Now()
+	return nil
+}
+
+func (s *memoryStore) GetFile(ctx context.Context, key, path string) error {
+	data, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	data, found := s.objects[key]
+	if !found {
+		return nil, fmt.Errorf("object %s not found", key)
+	}
+	return data, nil
+}
+
+func (s *memoryStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s.Lock()
+	defer s.Unlock()
+	var objects []ObjectInfo
+	for key, data := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key, Size: int64(len(data)), LastModified: s.modified[key]})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func writeFile(g *WithT, path, content string) {
+	g.Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+}
+
+func TestUpload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b1", "md-1-big-Data.db"), "data")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b1", "schema.cql"), "CREATE TABLE")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "other", "md-2-big-Data.db"), "other")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "md-3-big-Data.db"), "live")
+
+	store := newMemoryStore()
+	server := httptest.NewServer(NewAgent(dataDir, store, log.NullLogger{}).Handler())
+	defer server.Close()
+
+	client := NewClient()
+	ctx := context.Background()
+
+	upload, err := client.GetUpload(ctx, server.URL, "b1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(upload).To(BeNil())
+
+	prefix := NodePrefix("backups", "test", "b1", "test-dc1-rack1-sts-0")
+	upload, err = client.StartUpload(ctx, server.URL, UploadRequest{
+		Snapshot: "b1",
+		Prefix:   prefix,
+		Manifest: Manifest{Backup: "b1", Cluster: "test", Pod: "test-dc1-rack1-sts-0", Tokens: []string{"-100"}},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(upload.Status).To(Equal(TransferStatusRunning))
+
+	g.Eventually(func() TransferStatus {
+		upload, err = client.GetUpload(ctx, server.URL, "b1")
+		g.Expect(err).ToNot(HaveOccurred())
+		return upload.Status
+	}, 5*time.Second, 10*time.Millisecond).Should(Equal(TransferStatusCompleted))
+	g.Expect(upload.Files).To(Equal(2))
+	g.Expect(upload.Size).To(Equal(int64(16)))
+	g.Expect(upload.ManifestKey).To(Equal(prefix + "/" + ManifestFile))
+
+	g.Expect(store.objects).To(HaveKey(prefix + "/data/ks1/t1-1234/md-1-big-Data.db"))
+	g.Expect(store.objects).To(HaveKey(prefix + "/data/ks1/t1-1234/schema.cql"))
+	g.Expect(store.objects).To(HaveLen(3))
+
+	manifest := Manifest{}
+	g.Expect(json.Unmarshal(store.objects[upload.ManifestKey], &manifest)).To(Succeed())
+	g.Expect(manifest.Tokens).To(Equal([]string{"-100"}))
+	g.Expect(manifest.Files).To(HaveLen(2))
+	g.Expect(manifest.Size).To(Equal(int64(16)))
+}
+
+func TestUploadMissingSnapshot(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	server := httptest.NewServer(NewAgent(dataDir, newMemoryStore(), log.NullLogger{}).Handler())
+	defer server.Close()
+
+	client := NewClient()
+	_, err = client.StartUpload(context.Background(), server.URL, UploadRequest{Snapshot: "b1", Prefix: "b1", Manifest: Manifest{Backup: "b1"}})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Eventually(func() TransferStatus {
+		upload, err := client.GetUpload(context.Background(), server.URL, "b1")
+		g.Expect(err).ToNot(HaveOccurred())
+		return upload.Status
+	}, 5*time.Second, 10*time.Millisecond).Should(Equal(TransferStatusFailed))
+}
+
+// blockingStore is a memoryStore whose uploads of files only return once their
+// context is canceled
+type blockingStore struct {
+	*memoryStore
+	started chan struct{}
+}
+
+func (s *blockingStore) PutFile(ctx context.Context, key, path string) (int64, error) {
+	s.started <- struct{}{}
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestCancelUpload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b1", "md-1-big-Data.db"), "data")
+
+	store := &blockingStore{memoryStore: newMemoryStore(), started: make(chan struct{}, 1)}
+	server := httptest.NewServer(NewAgent(dataDir, store, log.NullLogger{}).Handler())
+	defer server.Close()
+
+	client := NewClient()
+	ctx := context.Background()
+
+	upload, err := client.CancelUpload(ctx, server.URL, "b1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(upload).To(BeNil())
+
+	_, err = client.StartUpload(ctx, server.URL, UploadRequest{Snapshot: "b1", Prefix: "b1", Manifest: Manifest{Backup: "b1"}})
+	g.Expect(err).ToNot(HaveOccurred())
+	<-store.started
+
+	upload, err = client.CancelUpload(ctx, server.URL, "b1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(upload).ToNot(BeNil())
+
+	g.Eventually(func() TransferStatus {
+		upload, err = client.GetUpload(ctx, server.URL, "b1")
+		g.Expect(err).ToNot(HaveOccurred())
+		return upload.Status
+	}, 5*time.Second, 10*time.Millisecond).Should(Equal(TransferStatusFailed))
+	g.Expect(upload.Error).To(ContainSubstring("canceled"))
+	// No manifest references the files of a canceled upload
+	g.Expect(store.objects).To(BeEmpty())
+
+	// Canceling an upload that has stopped has no effect
+	upload, err = client.CancelUpload(ctx, server.URL, "b1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(upload.Status).To(Equal(TransferStatusFailed))
+}
+
+func TestIncrementalUpload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b1", "md-1-big-Data.db"), "data")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b1", "md-1-big-TOC.txt"), "Data.db")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b1", "schema.cql"), "CREATE TABLE")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b2", "md-1-big-Data.db"), "data")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b2", "md-1-big-TOC.txt"), "TOC.txt")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b2", "md-2-big-Data.db"), "more data")
+	writeFile(g, filepath.Join(dataDir, "ks1", "t1-1234", "snapshots", "b2", "schema.cql"), "CREATE TABLE")
+
+	store := newMemoryStore()
+	server := httptest.NewServer(NewAgent(dataDir, store, log.NullLogger{}).Handler())
+	defer server.Close()
+
+	client := NewClient()
+	ctx := context.Background()
+	pod := "test-dc1-rack1-sts-0"
+	shared := SharedPrefix("backups", "test", pod)
+
+	upload := func(backup string) *Upload {
+		_, err := client.StartUpload(ctx, server.URL, UploadRequest{
+			Snapshot:     backup,
+			Prefix:       NodePrefix("backups", "test", backup, pod),
+			SharedPrefix: shared,
+			Manifest:     Manifest{Backup: backup, Cluster: "test", Pod: pod},
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var upload *Upload
+		g.Eventually(func() TransferStatus {
+			upload, err = client.GetUpload(ctx, server.URL, backup)
+			g.Expect(err).ToNot(HaveOccurred())
+			return upload.Status
+		}, 5*time.Second, 10*time.Millisecond).Should(Equal(TransferStatusCompleted))
+		return upload
+	}
+
+	sharedKey := func(file, content string) string {
+		hash := sha256.Sum256([]byte(content))
+		return SharedFileKey(shared, FileInfo{Path: "ks1/t1-1234/" + file, Checksum: hex.EncodeToString(hash[:])})
+	}
+
+	b1 := upload("b1")
+	g.Expect(b1.Files).To(Equal(3))
+	g.Expect(b1.Skipped).To(Equal(0))
+	g.Expect(store.objects).To(HaveKey(sharedKey("md-1-big-Data.db", "data")))
+	g.Expect(store.objects).To(HaveKey(sharedKey("md-1-big-TOC.txt", "Data.db")))
+	g.Expect(store.objects).To(HaveKey(NodePrefix("backups", "test", "b1", pod) + "/data/ks1/t1-1234/schema.cql"))
+
+	// md-1-big-TOC.txt has the same name and size in b2 but a different content,
+	// as it would after the node has been replaced, so it is uploaded again
+	b2 := upload("b2")
+	g.Expect(b2.Files).To(Equal(3))
+	g.Expect(b2.Skipped).To(Equal(1))
+	g.Expect(b2.Size).To(Equal(int64(28)))
+	g.Expect(store.objects).To(HaveKey(sharedKey("md-1-big-TOC.txt", "TOC.txt")))
+
+	manifest := Manifest{}
+	g.Expect(json.Unmarshal(store.objects[b2.ManifestKey], &manifest)).To(Succeed())
+	g.Expect(manifest.Files).To(HaveLen(4))
+	g.Expect(manifest.Size).To(Equal(int64(32)))
+
+	// md-1 is still referenced by b2 while md-2 is only referenced by b2
+	g.Expect(DeleteBackup(ctx, store, "backups", "test", "b1")).To(Succeed())
+	g.Expect(store.objects).ToNot(HaveKey(b1.ManifestKey))
+	g.Expect(store.objects).To(HaveKey(sharedKey("md-1-big-Data.db", "data")))
+	g.Expect(store.objects).To(HaveKey(sharedKey("md-2-big-Data.db", "more data")))
+	g.Expect(store.objects).ToNot(HaveKey(sharedKey("md-1-big-TOC.txt", "Data.db")))
+
+	g.Expect(DeleteBackup(ctx, store, "backups", "test", "b2")).To(Succeed())
+	g.Expect(store.objects).To(BeEmpty())
+}
+
+func TestIncrementalBackupsUpload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	tableDir := filepath.Join(dataDir, "ks1", "t1-1234")
+	writeFile(g, filepath.Join(tableDir, "snapshots", "b1", "md-1-big-Data.db"), "data")
+	writeFile(g, filepath.Join(tableDir, "backups", "md-1-big-Data.db"), "data")
+	writeFile(g, filepath.Join(tableDir, "backups", "md-2-big-Data.db"), "more data")
+	writeFile(g, filepath.Join(dataDir, "ks2", "t2-5678", "backups", "md-1-big-Data.db"), "other keyspace")
+
+	store := newMemoryStore()
+	server := httptest.NewServer(NewAgent(dataDir, store, log.NullLogger{}).Handler())
+	defer server.Close()
+
+	client := NewClient()
+	ctx := context.Background()
+	pod := "test-dc1-rack1-sts-0"
+	shared := SharedPrefix("backups", "test", pod)
+
+	upload := func(request UploadRequest) *Upload {
+		_, err := client.StartUpload(ctx, server.URL, request)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var upload *Upload
+		g.Eventually(func() bool {
+			upload, err = client.GetUpload(ctx, server.URL, request.Manifest.Backup)
+			g.Expect(err).ToNot(HaveOccurred())
+			return upload.Status != TransferStatusRunning
+		}, 5*time.Second, 10*time.Millisecond).Should(BeTrue())
+		return upload
+	}
+
+	// An incremental upload needs a base backup with shared files
+	_, err = client.StartUpload(ctx, server.URL, UploadRequest{
+		Incremental:  true,
+		Prefix:       NodePrefix("backups", "test", "b2", pod),
+		SharedPrefix: shared,
+		Manifest:     Manifest{Backup: "b2", Cluster: "test", Pod: pod},
+	})
+	g.Expect(err).To(HaveOccurred())
+
+	b1 := upload(UploadRequest{
+		Snapshot:     "b1",
+		Prefix:       NodePrefix("backups", "test", "b1", pod),
+		SharedPrefix: shared,
+		Manifest:     Manifest{Backup: "b1", Cluster: "test", Pod: pod},
+	})
+	g.Expect(b1.Status).To(Equal(TransferStatusCompleted))
+
+	b2 := upload(UploadRequest{
+		Incremental:     true,
+		Keyspaces:       []string{"ks1"},
+		BaseManifestKey: b1.ManifestKey,
+		Prefix:          NodePrefix("backups", "test", "b2", pod),
+		SharedPrefix:    shared,
+		Manifest:        Manifest{Backup: "b2", Cluster: "test", Pod: pod},
+	})
+	g.Expect(b2.Status).To(Equal(TransferStatusCompleted))
+	g.Expect(b2.Files).To(Equal(1))
+
+	manifest := Manifest{}
+	g.Expect(json.Unmarshal(store.objects[b2.ManifestKey], &manifest)).To(Succeed())
+	var paths []string
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+	}
+	g.Expect(paths).To(ConsistOf("ks1/t1-1234/md-1-big-Data.db", "ks1/t1-1234/md-2-big-Data.db"))
+	g.Expect(manifest.Size).To(Equal(int64(13)))
+
+	// The uploaded files are removed from the backups directory while the other
+	// keyspace is left alone
+	g.Expect(filepath.Join(tableDir, "backups", "md-2-big-Data.db")).ToNot(BeAnExistingFile())
+	g.Expect(filepath.Join(dataDir, "ks2", "t2-5678", "backups", "md-1-big-Data.db")).To(BeAnExistingFile())
+
+	// The node has started over with new generations, so md-1 clashes with the
+	// file of the base backup
+	writeFile(g, filepath.Join(tableDir, "backups", "md-1-big-Data.db"), "new data")
+	b3 := upload(UploadRequest{
+		Incremental:     true,
+		Keyspaces:       []string{"ks1"},
+		BaseManifestKey: b2.ManifestKey,
+		Prefix:          NodePrefix("backups", "test", "b3", pod),
+		SharedPrefix:    shared,
+		Manifest:        Manifest{Backup: "b3", Cluster: "test", Pod: pod},
+	})
+	g.Expect(b3.Status).To(Equal(TransferStatusFailed))
+	g.Expect(b3.Error).To(ContainSubstring("a full backup is required"))
+}
+
+func TestRequireToken(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	server := httptest.NewServer(RequireToken("secret", NewAgent(dataDir, newMemoryStore(), log.NullLogger{}).Handler()))
+	defer server.Close()
+
+	client := NewClient()
+	ctx := context.Background()
+
+	_, err = client.GetUpload(ctx, server.URL, "b1")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.(*RequestError).StatusCode).To(Equal(http.StatusUnauthorized))
+
+	client.SetToken("wrong")
+	_, err = client.GetUpload(ctx, server.URL, "b1")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.(*RequestError).StatusCode).To(Equal(http.StatusUnauthorized))
+
+	client.SetToken("secret")
+	upload, err := client.GetUpload(ctx, server.URL, "b1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(upload).To(BeNil())
+}
@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Client for the HTTP API of the backup agents
+type Client struct {
+	httpClient *http.Client
+	token      string
+}
+
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// NewClientWithHTTPClient returns a Client that sends its requests with
+// httpClient
+func NewClientWithHTTPClient(httpClient *http.Client) *Client {
+	return &Client{httpClient: httpClient}
+}
+
+// SetToken sets the token the client presents to the agents
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// PodEndpoint returns the base URL of the backup agent running in pod
+func PodEndpoint(pod *corev1.Pod) string {
+	return fmt.Sprintf("http://%s:%d", pod.Status.PodIP, DefaultAgentPort)
+}
+
+// RequestError is returned when the agent responds with an unexpected status
+// code
+type RequestError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s %s failed with status code %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// StartUpload asks the agent at endpoint to upload a snapshot. Starting an upload
+// that is already running or has completed has no effect.
+func (c *Client) StartUpload(ctx context.Context, endpoint string, request UploadRequest) (*Upload, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	upload := &Upload{}
+	if err = c.do(ctx, http.MethodPost, endpoint, uploadsPath, body, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetUpload returns the upload of the backup, or nil if the agent does not know
+// about it, e.g. because it has been restarted
+func (c *Client) GetUpload(ctx context.Context, endpoint, backup string) (*Upload, error) {
+	upload := &Upload{}
+	err := c.do(ctx, http.MethodGet, endpoint, uploadsPath+"/"+url.PathEscape(backup), nil, upload)
+	if err != nil {
+		if requestErr, ok := err.(*RequestError); ok && requestErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return upload, nil
+}
+
+// CancelUpload asks the agent at endpoint to cancel the upload of the backup,
+// and returns the upload or nil if the agent does not know about it. The upload
+// is only canceled once GetUpload no longer reports it as running.
+func (c *Client) CancelUpload(ctx context.Context, endpoint, backup string) (*Upload, error) {
+	upload := &Upload{}
+	err := c.do(ctx, http.MethodDelete, endpoint, uploadsPath+"/"+url.PathEscape(backup), nil, upload)
+	if err != nil {
+		if requestErr, ok := err.(*RequestError); ok && requestErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetCommitLogPosition returns the position of the commitlog of the node of the
+// agent at endpoint
+func (c *Client) GetCommitLogPosition(ctx context.Context, endpoint string) (*CommitLogPosition, error) {
+	position := &CommitLogPosition{}
+	if err := c.do(ctx, http.MethodGet, endpoint, commitLogsPath, nil, position); err != nil {
+		return nil, err
+	}
+	return position, nil
+}
+
+// StartDownload asks the agent at endpoint to download files into the restore
+// directory. Starting a download that is already running or has completed has
+// no effect.
+func (c *Client) StartDownload(ctx context.Context, endpoint string, request DownloadRequest) (*Download, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	download := &Download{}
+	if err = c.do(ctx, http.MethodPost, endpoint, downloadsPath, body, download); err != nil {
+		return nil, err
+	}
+	return download, nil
+}
+
+// GetDownload returns the download with the given name, or nil if the agent does
+// not know about it
+func (c *Client) GetDownload(ctx context.Context, endpoint, name string) (*Download, error) {
+	download := &Download{}
+	err := c.do(ctx, http.MethodGet, endpoint, downloadsPath+"/"+url.PathEscape(name), nil, download)
+	if err != nil {
+		if requestErr, ok := err.(*RequestError); ok && requestErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return download, nil
+}
+
+// DeleteDownload removes the files that are left over from a download
+func (c *Client) DeleteDownload(ctx context.Context, endpoint, name string) error {
+	return c.do(ctx, http.MethodDelete, endpoint, downloadsPath+"/"+url.PathEscape(name), nil, &struct{}{})
+}
+
+// do sends a request to the agent and decodes the response body into v
+func (c *Client) do(ctx context.Context, method, endpoint, path string, body []byte, v interface{}) error {
+	req, err := http.NewRequest(method, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &RequestError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return json.Unmarshal(respBody, v)
+}
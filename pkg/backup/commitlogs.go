@@ -0,0 +1,237 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// CommitLogArchiveDir is where Cassandra links the commitlog segments it
+	// archives to, on the data volume so that the link is not a copy
+	CommitLogArchiveDir = "/var/lib/cassandra/commitlog_archive"
+
+	// CommitLogRestoreDir is where the segments that are replayed by a point in
+	// time restore are downloaded to
+	CommitLogRestoreDir = "/var/lib/cassandra/commitlog_restore"
+
+	// RestorePointInTimeFormat is the format of restore_point_in_time
+	RestorePointInTimeFormat = "2006:01:02 15:04:05"
+
+	// RestorePointInTimeKey is the key of the point in time in the config map of
+	// a restore. Pod names cannot contain underscores, so it cannot clash with
+	// the manifest keys of the pods.
+	RestorePointInTimeKey = "restore_point_in_time"
+
+	// commitLogDir is the directory, next to the data directory, that Cassandra
+	// writes the commitlog segments to
+	commitLogDir = "commitlog"
+)
+
+const commitLogsPath = "/api/v1/commitlogs"
+
+// CommitLogPosition is the position of the commitlog of a node
+type CommitLogPosition struct {
+	// SegmentID is the ID of the oldest segment in the commitlog directory, or 0
+	// if there is none. Older segments have been archived, so their writes have
+	// all been flushed to SSTables.
+	SegmentID int64 `json:"segmentId"`
+}
+
+// commitLogSegmentPattern matches the names of commitlog segments, i.e.
+// CommitLog-<version>-<id>.log. Cassandra assigns increasing IDs to the segments
+// of a node, so unlike the times the segments are uploaded at, they order the
+// segments regardless of clock skew.
+var commitLogSegmentPattern = regexp.MustCompile(`^CommitLog-\d+-(\d+)\.log$`)
+
+// CommitLogSegmentID returns the ID of the segment with the given file name, or
+// false if the name is not the name of a segment
+func CommitLogSegmentID(name string) (int64, bool) {
+	match := commitLogSegmentPattern.FindStringSubmatch(name)
+	if match == nil {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// OldestCommitLogSegment returns the ID of the oldest segment in dir, or 0 if
+// there is none
+func OldestCommitLogSegment(dir string) (int64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var oldest int64
+	for _, file := range files {
+		if id, ok := CommitLogSegmentID(file.Name()); ok && (oldest == 0 || id < oldest) {
+			oldest = id
+		}
+	}
+	return oldest, nil
+}
+
+// CommitLogArchivingProperties returns the lines of commitlog_archiving.properties
+// that make Cassandra link the segments it archives into CommitLogArchiveDir
+func CommitLogArchivingProperties() []string {
+	return []string{"archive_command=/bin/ln %path " + CommitLogArchiveDir + "/%name"}
+}
+
+// CommitLogRestoreProperties returns the lines of commitlog_archiving.properties
+// that make Cassandra replay the segments in CommitLogRestoreDir up to
+// pointInTime, which is in RestorePointInTimeFormat and UTC
+func CommitLogRestoreProperties(pointInTime string) []string {
+	return []string{
+		"restore_command=/bin/cp -f %from %to",
+		"restore_directories=" + CommitLogRestoreDir,
+		"restore_point_in_time=" + pointInTime,
+	}
+}
+
+// CommitLogShipper uploads the commitlog segments that Cassandra archives and
+// removes them from the archive directory once they are uploaded
+type CommitLogShipper struct {
+	archiveDir string
+	prefix     string
+	store      ObjectStore
+	log        logr.Logger
+}
+
+// NewCommitLogShipper returns a shipper that uploads the segments in archiveDir
+// to prefix
+func NewCommitLogShipper(archiveDir, prefix string, store ObjectStore, log logr.Logger) *CommitLogShipper {
+	return &CommitLogShipper{archiveDir: archiveDir, prefix: prefix, store: store, log: log}
+}
+
+// Run ships segments every interval until ctx is done
+func (s *CommitLogShipper) Run(ctx context.Context, interval time.Duration) {
+	if err := os.MkdirAll(s.archiveDir, 0755); err != nil {
+		s.log.Error(err, "failed to create commitlog archive directory", "Dir", s.archiveDir)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Ship(ctx); err != nil {
+			s.log.Error(err, "failed to ship commitlog segments")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ship uploads the segments that are in the archive directory
+func (s *CommitLogShipper) Ship(ctx context.Context) error {
+	files, err := ioutil.ReadDir(s.archiveDir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		localPath := filepath.Join(s.archiveDir, file.Name())
+		key := path.Join(s.prefix, file.Name())
+		if _, err = s.store.PutFile(ctx, key, localPath); err != nil {
+			return fmt.Errorf("failed to upload %s: %s", file.Name(), err)
+		}
+		if err = os.Remove(localPath); err != nil {
+			return err
+		}
+		s.log.Info("shipped commitlog segment", "Segment", file.Name())
+	}
+	return nil
+}
+
+// commitLogsMarkerFile is written to the data directory once the segments of a
+// restored node have been downloaded, so that they are only replayed on the
+// first start of the node
+const commitLogsMarkerFile = ".commitlogs-restored"
+
+// RestoreCommitLogs downloads the segments of the backed up node, starting with
+// the oldest segment it had when its snapshot was taken, into restoreDir so that
+// Cassandra replays them on its first start. Older segments only hold writes
+// that the snapshot already has. All segments are downloaded if the manifest
+// does not record a segment. It returns false if there is nothing to replay, in
+// which case restoreDir is emptied since the node has already been restored.
+func RestoreCommitLogs(ctx context.Context, store ObjectStore, manifest *Manifest, dataDir, restoreDir string) (bool, error) {
+	if manifest.CommitLogPrefix == "" {
+		return false, nil
+	}
+
+	markerPath := filepath.Join(dataDir, commitLogsMarkerFile)
+	if _, err := os.Stat(markerPath); err == nil {
+		if err = os.RemoveAll(restoreDir); err != nil {
+			return false, err
+		}
+		return false, os.MkdirAll(restoreDir, 0755)
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	objects, err := store.List(ctx, manifest.CommitLogPrefix+"/")
+	if err != nil {
+		return false, err
+	}
+	if err = os.MkdirAll(restoreDir, 0755); err != nil {
+		return false, err
+	}
+	for _, object := range objects {
+		id, ok := CommitLogSegmentID(path.Base(object.Key))
+		if !ok || id < manifest.CommitLogSegmentID {
+			continue
+		}
+		localPath := filepath.Join(restoreDir, path.Base(object.Key))
+		if err = store.GetFile(ctx, object.Key, localPath); err != nil {
+			return false, fmt.Errorf("failed to download %s: %s", object.Key, err)
+		}
+	}
+
+	if err = ioutil.WriteFile(markerPath, nil, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteCommitLogs deletes the archived segments of the nodes of the cluster
+// that no backup can replay. oldest maps the pods to the oldest segment that a
+// backup of the pod replays. The segments of pods that are not in oldest are
+// all deleted, since no backup of them remains.
+func DeleteCommitLogs(ctx context.Context, store ObjectStore, storagePrefix, cluster string, oldest map[string]int64) error {
+	objects, err := store.List(ctx, CommitLogPrefix(storagePrefix, cluster, "")+"/")
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		id, ok := CommitLogSegmentID(path.Base(object.Key))
+		if !ok {
+			continue
+		}
+		if keep, found := oldest[path.Base(path.Dir(object.Key))]; found && id >= keep {
+			continue
+		}
+		if err = store.Delete(ctx, object.Key); err != nil {
+			return fmt.Errorf("failed to delete %s: %s", object.Key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestCommitLogShipper(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	archiveDir, err := ioutil.TempDir("", "commitlog_archive")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(archiveDir)
+
+	segment := filepath.Join(archiveDir, "CommitLog-6-1.log")
+	g.Expect(ioutil.WriteFile(segment, []byte("segment"), 0644)).To(Succeed())
+
+	ctx := context.Background()
+	store := newMemoryStore()
+	shipper := NewCommitLogShipper(archiveDir, "backups/test/.commitlogs/test-dc1-rack1-sts-0", store, log.NullLogger{})
+	g.Expect(shipper.Ship(ctx)).To(Succeed())
+
+	data, err := store.Get(ctx, "backups/test/.commitlogs/test-dc1-rack1-sts-0/CommitLog-6-1.log")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal("segment"))
+	g.Expect(segment).ToNot(BeAnExistingFile())
+
+}
+
+func TestDeleteCommitLogs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ctx := context.Background()
+	store := newMemoryStore()
+	for _, key := range []string{
+		"backups/test/.commitlogs/test-dc1-rack1-sts-0/CommitLog-6-1.log",
+		"backups/test/.commitlogs/test-dc1-rack1-sts-0/CommitLog-6-2.log",
+		"backups/test/.commitlogs/test-dc1-rack1-sts-1/CommitLog-6-1.log",
+		"backups/test/.commitlogs/test-dc1-rack1-sts-2/CommitLog-6-1.log",
+	} {
+		g.Expect(store.Put(ctx, key, []byte("segment"))).To(Succeed())
+	}
+	// Upload times do not matter, only the IDs of the segments do
+	store.modified["backups/test/.commitlogs/test-dc1-rack1-sts-0/CommitLog-6-2.log"] = time.Now().Add(-time.Hour)
+
+	oldest := map[string]int64{"test-dc1-rack1-sts-0": 2, "test-dc1-rack1-sts-1": 0}
+	g.Expect(DeleteCommitLogs(ctx, store, "backups", "test", oldest)).To(Succeed())
+	g.Expect(store.objects).To(HaveLen(2))
+	g.Expect(store.objects).To(HaveKey("backups/test/.commitlogs/test-dc1-rack1-sts-0/CommitLog-6-2.log"))
+	g.Expect(store.objects).To(HaveKey("backups/test/.commitlogs/test-dc1-rack1-sts-1/CommitLog-6-1.log"))
+}
+
+func TestOldestCommitLogSegment(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	commitLogDir, err := ioutil.TempDir("", "commitlog")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(commitLogDir)
+
+	id, err := OldestCommitLogSegment(commitLogDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(id).To(BeZero())
+
+	for _, name := range []string{"CommitLog-7-1599134923412.log", "CommitLog-7-1599134923411.log", "CommitLog-7-1599134923413.log", "other.log"} {
+		g.Expect(ioutil.WriteFile(filepath.Join(commitLogDir, name), nil, 0644)).To(Succeed())
+	}
+	id, err = OldestCommitLogSegment(commitLogDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(id).To(Equal(int64(1599134923411)))
+}
+
+func TestRestoreCommitLogs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+	restoreDir := filepath.Join(dataDir, "commitlog_restore")
+
+	ctx := context.Background()
+	store := newMemoryStore()
+	startTime := time.Now()
+	prefix := "backups/test/.commitlogs/test-dc1-rack1-sts-0"
+	g.Expect(store.Put(ctx, prefix+"/CommitLog-6-1.log", []byte("before"))).To(Succeed())
+	g.Expect(store.Put(ctx, prefix+"/CommitLog-6-2.log", []byte("after"))).To(Succeed())
+	// The segment is selected by its ID even if the clock of the object storage
+	// is behind the one of the node
+	store.modified[prefix+"/CommitLog-6-2.log"] = startTime.Add(-time.Minute)
+
+	manifest := &Manifest{Backup: "b1", CommitLogPrefix: prefix, CommitLogSegmentID: 2, StartTime: startTime}
+	replay, err := RestoreCommitLogs(ctx, store, manifest, dataDir, restoreDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(replay).To(BeTrue())
+	g.Expect(filepath.Join(restoreDir, "CommitLog-6-1.log")).ToNot(BeAnExistingFile())
+	g.Expect(filepath.Join(restoreDir, "CommitLog-6-2.log")).To(BeAnExistingFile())
+
+	// The segments are only replayed on the first start of the node
+	replay, err = RestoreCommitLogs(ctx, store, manifest, dataDir, restoreDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(replay).To(BeFalse())
+	g.Expect(filepath.Join(restoreDir, "CommitLog-6-2.log")).ToNot(BeAnExistingFile())
+
+	g.Expect(CommitLogRestoreProperties("2020:09:01 12:00:00")).To(ContainElement("restore_point_in_time=2020:09:01 12:00:00"))
+}
@@ -0,0 +1,249 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RestoreDir is the directory, next to the data directory, that the agent
+// downloads files into
+const RestoreDir = "restore"
+
+const downloadsPath = "/api/v1/downloads"
+
+// DownloadRequest asks the agent to download files from the object storage
+type DownloadRequest struct {
+	// Name identifies the download. The files are downloaded into the Name
+	// subdirectory of the restore directory.
+	Name string `json:"name"`
+
+	Files []DownloadFile `json:"files"`
+
+	// Tables maps directories of the download, i.e. <keyspace>/<table>, to the
+	// directories of the tables in the data directory, i.e.
+	// <keyspace>/<table>-<id>. The SSTables of these directories are moved into
+	// the tables once they have been downloaded, from where nodetool refresh
+	// loads them.
+	Tables map[string]string `json:"tables,omitempty"`
+}
+
+// DownloadFile is an object to download
+type DownloadFile struct {
+	Key string `json:"key"`
+
+	// Path is the path of the file relative to the directory of the download
+	Path string `json:"path"`
+}
+
+// Download is the state of a download
+type Download struct {
+	Name   string         `json:"name"`
+	Status TransferStatus `json:"status"`
+
+	// Files is the number of files that have been downloaded
+	Files int `json:"files"`
+
+	StartTime      time.Time  `json:"startTime"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+func (a *Agent) handleStartDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := DownloadRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !isRelativePath(request.Name) {
+		http.Error(w, fmt.Sprintf("invalid name %q", request.Name), http.StatusBadRequest)
+		return
+	}
+	for _, file := range request.Files {
+		if !isRelativePath(file.Path) {
+			http.Error(w, fmt.Sprintf("invalid path %q", file.Path), http.StatusBadRequest)
+			return
+		}
+	}
+	for dir, tableDir := range request.Tables {
+		if !isRelativePath(dir) || !isRelativePath(tableDir) {
+			http.Error(w, fmt.Sprintf("invalid table directory %q", tableDir), http.StatusBadRequest)
+			return
+		}
+	}
+
+	a.mu.Lock()
+	download, found := a.downloads[request.Name]
+	if !found || download.Status == TransferStatusFailed {
+		download = &Download{Name: request.Name, Status: TransferStatusRunning, StartTime: time.Now()}
+		a.downloads[request.Name] = download
+		go a.download(context.Background(), request)
+	}
+	status := *download
+	a.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// handleDownload returns the state of a download for GET and removes the
+// directory of the download for DELETE
+func (a *Agent) handleDownload(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, downloadsPath+"/")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	download, found := a.downloads[name]
+
+	switch r.Method {
+	case http.MethodGet:
+		if !found {
+			http.Error(w, fmt.Sprintf("download %s not found", name), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, download)
+	case http.MethodDelete:
+		if found && download.Status == TransferStatusRunning {
+			http.Error(w, fmt.Sprintf("download %s is running", name), http.StatusConflict)
+			return
+		}
+		if !isRelativePath(name) {
+			http.Error(w, fmt.Sprintf("invalid name %q", name), http.StatusBadRequest)
+			return
+		}
+		if err := os.RemoveAll(filepath.Join(a.restoreDir, name)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		delete(a.downloads, name)
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *Agent) download(ctx context.Context, request DownloadRequest) {
+	log := a.log.WithValues("Download", request.Name)
+	log.Info("downloading files", "Files", len(request.Files))
+
+	var err error
+	for _, file := range request.Files {
+		localPath := filepath.Join(a.restoreDir, request.Name, filepath.FromSlash(file.Path))
+		if err = os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			break
+		}
+		if err = a.store.GetFile(ctx, file.Key, localPath); err != nil {
+			err = fmt.Errorf("failed to download %s: %s", file.Key, err)
+			break
+		}
+		a.mu.Lock()
+		a.downloads[request.Name].Files++
+		a.mu.Unlock()
+	}
+
+	if err == nil {
+		for dir, tableDir := range request.Tables {
+			srcDir := filepath.Join(a.restoreDir, request.Name, filepath.FromSlash(dir))
+			if err = moveSSTables(srcDir, filepath.Join(a.dataDir, filepath.FromSlash(tableDir))); err != nil {
+				err = fmt.Errorf("failed to move SSTables into %s: %s", tableDir, err)
+				break
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	download := a.downloads[request.Name]
+	now := time.Now()
+	download.CompletionTime = &now
+	if err != nil {
+		log.Error(err, "failed to download files")
+		download.Status = TransferStatusFailed
+		download.Error = err.Error()
+		return
+	}
+	log.Info("downloaded files", "Files", download.Files)
+	download.Status = TransferStatusCompleted
+}
+
+// sstableDescriptor matches the files of SSTables and captures the version, the
+// generation and the component, e.g. md, 1 and Data.db for md-1-big-Data.db
+var sstableDescriptor = regexp.MustCompile(`^([a-z]{2})-(\d+)-(big|bti)-(.+)$`)
+
+// generationGap is added to the highest generation in a table directory when
+// SSTables are moved into it. Cassandra hands out generations for flushes and
+// compactions from a counter that is at least the highest generation on disk,
+// so the gap keeps the moved SSTables clear of the SSTables written before
+// nodetool refresh renames them.
+const generationGap = 100000
+
+// moveSSTables moves the SSTables in srcDir into tableDir. The SSTables of a
+// backup have the generations they had on the backed up node, which can clash
+// with the SSTables of the table, so they are given new generations above the
+// ones in tableDir. The components of an SSTable keep sharing a generation.
+func moveSSTables(srcDir, tableDir string) error {
+	if _, err := os.Stat(tableDir); err != nil {
+		return err
+	}
+
+	maxGeneration := 0
+	existing, err := ioutil.ReadDir(tableDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range existing {
+		if match := sstableDescriptor.FindStringSubmatch(file.Name()); match != nil {
+			if generation, _ := strconv.Atoi(match[2]); generation > maxGeneration {
+				maxGeneration = generation
+			}
+		}
+	}
+
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	generations := make(map[string]int)
+	next := maxGeneration + generationGap
+	for _, file := range files {
+		match := sstableDescriptor.FindStringSubmatch(file.Name())
+		if match == nil || file.IsDir() {
+			continue
+		}
+		generation, found := generations[match[2]]
+		if !found {
+			next++
+			generation = next
+			generations[match[2]] = generation
+		}
+		name := fmt.Sprintf("%s-%d-%s-%s", match[1], generation, match[3], match[4])
+		if err = os.Rename(filepath.Join(srcDir, file.Name()), filepath.Join(tableDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRelativePath returns true if p is a non-empty path that stays within the
+// directory it is relative to
+func isRelativePath(p string) bool {
+	if p == "" || path.IsAbs(p) {
+		return false
+	}
+	cleaned := path.Clean(p)
+	return cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DeleteBackup deletes the objects of a backup. SSTables that incremental
+// backups share are deleted once the manifest of no other backup of the cluster
+// references them. Backups of the cluster must not be uploading while this
+// runs, as the SSTables they have uploaded are not referenced by a manifest yet.
+func DeleteBackup(ctx context.Context, store ObjectStore, storagePrefix, cluster, backup string) error {
+	backupPrefix := BackupPrefix(storagePrefix, cluster, backup)
+	objects, err := store.List(ctx, ClusterPrefix(storagePrefix, cluster))
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool)
+	var shared []string
+	for _, object := range objects {
+		switch {
+		case strings.HasPrefix(object.Key, backupPrefix):
+			if err = store.Delete(ctx, object.Key); err != nil {
+				return fmt.Errorf("failed to delete %s: %s", object.Key, err)
+			}
+		case isSharedKey(storagePrefix, cluster, object.Key):
+			shared = append(shared, object.Key)
+		case isManifestKey(storagePrefix, cluster, object.Key):
+			data, err := store.Get(ctx, object.Key)
+			if err != nil {
+				return fmt.Errorf("failed to get %s: %s", object.Key, err)
+			}
+			manifest := Manifest{}
+			if err = json.Unmarshal(data, &manifest); err != nil {
+				return fmt.Errorf("failed to parse %s: %s", object.Key, err)
+			}
+			for _, file := range manifest.Files {
+				referenced[file.Key] = true
+			}
+		}
+	}
+
+	for _, key := range shared {
+		if !referenced[key] {
+			if err = store.Delete(ctx, key); err != nil {
+				return fmt.Errorf("failed to delete %s: %s", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isManifestKey returns true if key is the manifest of a node, i.e.
+// <cluster prefix><backup>/<pod>/manifest.json
+func isManifestKey(storagePrefix, cluster, key string) bool {
+	parts := strings.Split(strings.TrimPrefix(key, ClusterPrefix(storagePrefix, cluster)), "/")
+	return len(parts) == 3 && parts[2] == ManifestFile
+}
+
+func isSharedKey(storagePrefix, cluster, key string) bool {
+	return strings.HasPrefix(key, SharedPrefix(storagePrefix, cluster, "")+"/")
+}
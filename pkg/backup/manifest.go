@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"path"
+	"time"
+)
+
+// ManifestFile is the name of the object that describes the backup of a node
+const ManifestFile = "manifest.json"
+
+// Manifest lists the files that have been uploaded for the backup of one node,
+// along with what is needed to restore the node from them
+type Manifest struct {
+	Backup     string `json:"backup"`
+	Cluster    string `json:"cluster"`
+	Datacenter string `json:"datacenter"`
+	Rack       string `json:"rack"`
+	Pod        string `json:"pod"`
+
+	// Tokens are the tokens the node owned when the backup was taken
+	Tokens []string `json:"tokens,omitempty"`
+
+	// CommitLogPrefix is the prefix of the commitlog segments archived by the
+	// node, if commitlog archiving is enabled
+	CommitLogPrefix string `json:"commitLogPrefix,omitempty"`
+
+	// CommitLogSegmentID is the oldest commitlog segment of the node when the
+	// backup was taken. A point in time restore replays it and the newer
+	// segments.
+	CommitLogSegmentID int64 `json:"commitLogSegmentId,omitempty"`
+
+	Files []FileInfo `json:"files"`
+
+	// Size is the total size of the files in bytes
+	Size int64 `json:"size"`
+
+	StartTime      time.Time `json:"startTime"`
+	CompletionTime time.Time `json:"completionTime"`
+}
+
+// FileInfo is a file of a snapshot
+type FileInfo struct {
+	// Path is the path of the file relative to the data directory with the
+	// snapshot directories left out, i.e. <keyspace>/<table>-<id>/<file>
+	Path string `json:"path"`
+
+	Size int64 `json:"size"`
+
+	// Key is the object the file is stored in
+	Key string `json:"key"`
+
+	// Checksum is the SHA-256 of the content of the file in hex. It is set for
+	// the SSTables that are shared between backups, which are deduplicated by it.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// NodePrefix returns the prefix of the objects of the backup of a node
+func NodePrefix(storagePrefix, cluster, backup, pod string) string {
+	return path.Join(storagePrefix, cluster, backup, pod)
+}
+
+// SharedPrefix returns the prefix of the SSTables that the incremental backups
+// of a node share. Names of Kubernetes objects cannot start with a dot, so the
+// prefix cannot clash with the prefix of a backup.
+func SharedPrefix(storagePrefix, cluster, pod string) string {
+	return path.Join(storagePrefix, cluster, ".shared", pod)
+}
+
+// SharedFileKey returns the object a file shared between backups is stored in.
+// The key includes the checksum of the file because SSTable names are not
+// unique over the life of a node. Generations start over at 1 when a node is
+// replaced or restored, and small components like TOC.txt often have the same
+// size, so the name and size of a file do not tell whether it has been uploaded.
+func SharedFileKey(sharedPrefix string, file FileInfo) string {
+	return path.Join(sharedPrefix, "data", path.Dir(file.Path), file.Checksum, path.Base(file.Path))
+}
+
+// CommitLogPrefix returns the prefix of the commitlog segments archived by a
+// node. Like the shared prefix, it cannot clash with the prefix of a backup.
+func CommitLogPrefix(storagePrefix, cluster, pod string) string {
+	return path.Join(storagePrefix, cluster, ".commitlogs", pod)
+}
+
+// ClusterPrefix returns the prefix of all objects of the backups of a cluster
+func ClusterPrefix(storagePrefix, cluster string) string {
+	return path.Join(storagePrefix, cluster) + "/"
+}
+
+// BackupPrefix returns the prefix of the objects of a backup
+func BackupPrefix(storagePrefix, cluster, backup string) string {
+	return path.Join(storagePrefix, cluster, backup) + "/"
+}
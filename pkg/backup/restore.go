@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// restoreMarkerFile is written to the data directory once a node has been
+// restored so that restarts of the pod do not restore it again
+const restoreMarkerFile = ".restored"
+
+// RestoreNode restores the files listed in the manifest at manifestKey into
+// dataDir so that a new node starts with the data of the backed up node. Only
+// SSTables are restored, and the system keyspace is left out because it holds
+// the identity of the backed up node. The node takes over the tokens of the
+// backed up node through JVMOptions instead.
+func RestoreNode(ctx context.Context, store ObjectStore, manifestKey, dataDir string) (*Manifest, error) {
+	markerPath := filepath.Join(dataDir, restoreMarkerFile)
+	if data, err := ioutil.ReadFile(markerPath); err == nil {
+		manifest := &Manifest{}
+		if err = json.Unmarshal(data, manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", markerPath, err)
+		}
+		return manifest, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err := store.Get(ctx, manifestKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s: %s", manifestKey, err)
+	}
+	manifest := &Manifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %s", manifestKey, err)
+	}
+
+	for _, file := range manifest.Files {
+		keyspace, _, _ := SplitFilePath(file.Path)
+		if keyspace == "system" || !IsSSTableComponent(file.Path) {
+			continue
+		}
+		localPath := filepath.Join(dataDir, filepath.FromSlash(file.Path))
+		if err = os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return nil, err
+		}
+		if err = store.GetFile(ctx, file.Key, localPath); err != nil {
+			return nil, fmt.Errorf("failed to download %s: %s", file.Key, err)
+		}
+	}
+
+	if err = ioutil.WriteFile(markerPath, data, 0644); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// JVMOptions returns the options for the first start of a restored node. The
+// node takes over the tokens of the backed up node and does not bootstrap since
+// it already has its data.
+func JVMOptions(manifest *Manifest) []string {
+	if len(manifest.Tokens) == 0 {
+		return nil
+	}
+	return []string{
+		"-Dcassandra.initial_token=" + strings.Join(manifest.Tokens, ","),
+		"-Dcassandra.auto_bootstrap=false",
+	}
+}
+
+// SplitFilePath splits the path of a file of a snapshot, i.e.
+// <keyspace>/<table>-<id>/<file>, into the keyspace, the table and the file
+func SplitFilePath(filePath string) (keyspace, table, file string) {
+	parts := strings.SplitN(filePath, "/", 3)
+	if len(parts) != 3 {
+		return "", "", path.Base(filePath)
+	}
+	table = parts[1]
+	if i := strings.LastIndex(table, "-"); i > 0 {
+		table = table[:i]
+	}
+	return parts[0], table, parts[2]
+}
@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestRestoreNode(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	ctx := context.Background()
+	store := newMemoryStore()
+	manifest := Manifest{
+		Backup: "b1",
+		Pod:    "test-dc1-rack1-sts-0",
+		Tokens: []string{"-100", "100"},
+		Files: []FileInfo{
+			{Path: "ks1/t1-1234/md-1-big-Data.db", Key: "b1/data/ks1/t1-1234/md-1-big-Data.db"},
+			{Path: "ks1/t1-1234/schema.cql", Key: "b1/data/ks1/t1-1234/schema.cql"},
+			{Path: "system/local-5678/md-1-big-Data.db", Key: "b1/data/system/local-5678/md-1-big-Data.db"},
+		},
+	}
+	for _, file := range manifest.Files {
+		g.Expect(store.Put(ctx, file.Key, []byte(file.Path))).To(Succeed())
+	}
+	data, err := json.Marshal(manifest)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(store.Put(ctx, "b1/manifest.json", data)).To(Succeed())
+
+	restored, err := RestoreNode(ctx, store, "b1/manifest.json", dataDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(JVMOptions(restored)).To(Equal([]string{
+		"-Dcassandra.initial_token=-100,100",
+		"-Dcassandra.auto_bootstrap=false",
+	}))
+	g.Expect(filepath.Join(dataDir, "ks1", "t1-1234", "md-1-big-Data.db")).To(BeAnExistingFile())
+	g.Expect(filepath.Join(dataDir, "ks1", "t1-1234", "schema.cql")).ToNot(BeAnExistingFile())
+	g.Expect(filepath.Join(dataDir, "system")).ToNot(BeAnExistingFile())
+
+	// A restarted pod is not restored again
+	store.objects = make(map[string][]byte)
+	restored, err = RestoreNode(ctx, store, "b1/manifest.json", dataDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(restored.Tokens).To(Equal(manifest.Tokens))
+}
+
+func TestDownload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	ctx := context.Background()
+	store := newMemoryStore()
+	g.Expect(store.Put(ctx, "b1/data/ks1/t1-1234/md-1-big-Data.db", []byte("data"))).To(Succeed())
+
+	agent := NewAgent(filepath.Join(dataDir, "data"), store, log.NullLogger{})
+	server := httptest.NewServer(agent.Handler())
+	defer server.Close()
+
+	client := NewClient()
+	_, err = client.StartDownload(ctx, server.URL, DownloadRequest{
+		Name:  "r1",
+		Files: []DownloadFile{{Key: "b1/data/ks1/t1-1234/md-1-big-Data.db", Path: "ks1/t1/md-1-big-Data.db"}},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Eventually(func() TransferStatus {
+		download, err := client.GetDownload(ctx, server.URL, "r1")
+		g.Expect(err).ToNot(HaveOccurred())
+		return download.Status
+	}, 5*time.Second, 10*time.Millisecond).Should(Equal(TransferStatusCompleted))
+
+	downloaded := filepath.Join(dataDir, RestoreDir, "r1", "ks1", "t1", "md-1-big-Data.db")
+	g.Expect(downloaded).To(BeAnExistingFile())
+
+	g.Expect(client.DeleteDownload(ctx, server.URL, "r1")).To(Succeed())
+	g.Expect(downloaded).ToNot(BeAnExistingFile())
+	download, err := client.GetDownload(ctx, server.URL, "r1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(download).To(BeNil())
+
+	_, err = client.StartDownload(ctx, server.URL, DownloadRequest{
+		Name:  "r2",
+		Files: []DownloadFile{{Key: "b1/data/ks1/t1-1234/md-1-big-Data.db", Path: "../../etc/passwd"}},
+	})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDownloadIntoTable(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dataDir, err := ioutil.TempDir("", "data")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dataDir)
+
+	tableDir := filepath.Join(dataDir, "data", "ks1", "t1-5678")
+	g.Expect(os.MkdirAll(tableDir, 0755)).To(Succeed())
+	writeFile(g, filepath.Join(tableDir, "md-1-big-Data.db"), "live")
+	writeFile(g, filepath.Join(tableDir, "md-3-big-Data.db"), "live")
+
+	ctx := context.Background()
+	store := newMemoryStore()
+	g.Expect(store.Put(ctx, "b1/data/ks1/t1-1234/md-1-big-Data.db", []byte("data1"))).To(Succeed())
+	g.Expect(store.Put(ctx, "b1/data/ks1/t1-1234/md-1-big-TOC.txt", []byte("toc1"))).To(Succeed())
+	g.Expect(store.Put(ctx, "b1/data/ks1/t1-1234/md-2-big-Data.db", []byte("data2"))).To(Succeed())
+
+	agent := NewAgent(filepath.Join(dataDir, "data"), store, log.NullLogger{})
+	server := httptest.NewServer(agent.Handler())
+	defer server.Close()
+
+	client := NewClient()
+	_, err = client.StartDownload(ctx, server.URL, DownloadRequest{
+		Name: "r1",
+		Files: []DownloadFile{
+			{Key: "b1/data/ks1/t1-1234/md-1-big-Data.db", Path: "ks1/t1/md-1-big-Data.db"},
+			{Key: "b1/data/ks1/t1-1234/md-1-big-TOC.txt", Path: "ks1/t1/md-1-big-TOC.txt"},
+			{Key: "b1/data/ks1/t1-1234/md-2-big-Data.db", Path: "ks1/t1/md-2-big-Data.db"},
+		},
+		Tables: map[string]string{"ks1/t1": "ks1/t1-5678"},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Eventually(func() TransferStatus {
+		download, err := client.GetDownload(ctx, server.URL, "r1")
+		g.Expect(err).ToNot(HaveOccurred())
+		return download.Status
+	}, 5*time.Second, 10*time.Millisecond).Should(Equal(TransferStatusCompleted))
+
+	// The live SSTables are left alone and the restored ones are renumbered
+	// above them, with the components of an SSTable sharing a generation
+	for name, content := range map[string]string{
+		"md-1-big-Data.db":      "live",
+		"md-3-big-Data.db":      "live",
+		"md-100004-big-Data.db": "data1",
+		"md-100004-big-TOC.txt": "toc1",
+		"md-100005-big-Data.db": "data2",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(tableDir, name))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(data)).To(Equal(content))
+	}
+
+	download, err := client.GetDownload(ctx, server.URL, "r1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(download.Files).To(Equal(3))
+}
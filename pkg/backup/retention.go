@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy decides which backups are kept. A backup is kept if any of
+// the rules keeps it. A policy without rules keeps all backups.
+type RetentionPolicy struct {
+	// KeepLast keeps the most recent backups
+	KeepLast int
+
+	// KeepDaily, KeepWeekly and KeepMonthly keep the most recent backup of each
+	// of the last days, weeks and months that have a backup
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+// Retain returns which of the backups taken at times are kept. times has to be
+// sorted from the most recent to the oldest backup.
+func Retain(times []time.Time, policy RetentionPolicy) []bool {
+	keep := make([]bool, len(times))
+	if policy == (RetentionPolicy{}) {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	for i := 0; i < len(times) && i < policy.KeepLast; i++ {
+		keep[i] = true
+	}
+
+	keepPeriods(times, keep, policy.KeepDaily, func(t time.Time) string {
+		return t.UTC().Format("2006-01-02")
+	})
+	keepPeriods(times, keep, policy.KeepWeekly, func(t time.Time) string {
+		year, week := t.UTC().ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	keepPeriods(times, keep, policy.KeepMonthly, func(t time.Time) string {
+		return t.UTC().Format("2006-01")
+	})
+
+	return keep
+}
+
+// keepPeriods keeps the most recent backup of each of the last n periods
+func keepPeriods(times []time.Time, keep []bool, n int, period func(t time.Time) string) {
+	last := ""
+	for i := 0; i < len(times) && n > 0; i++ {
+		if p := period(times[i]); p != last {
+			keep[i] = true
+			last = p
+			n--
+		}
+	}
+}
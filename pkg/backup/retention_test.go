@@ -0,0 +1,41 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRetain(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Two backups a day over 60 days, most recent first
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	var times []time.Time
+	for i := 119; i >= 0; i-- {
+		times = append(times, start.Add(time.Duration(i)*12*time.Hour))
+	}
+
+	kept := func(policy RetentionPolicy) []time.Time {
+		var result []time.Time
+		for i, keep := range Retain(times, policy) {
+			if keep {
+				result = append(result, times[i])
+			}
+		}
+		return result
+	}
+
+	g.Expect(kept(RetentionPolicy{})).To(HaveLen(len(times)))
+	g.Expect(kept(RetentionPolicy{KeepLast: 3})).To(Equal(times[:3]))
+	g.Expect(kept(RetentionPolicy{KeepDaily: 2})).To(Equal([]time.Time{times[0], times[2]}))
+	g.Expect(kept(RetentionPolicy{KeepMonthly: 3})).To(Equal([]time.Time{
+		time.Date(2020, time.April, 29, 12, 0, 0, 0, time.UTC),
+		time.Date(2020, time.March, 31, 12, 0, 0, 0, time.UTC),
+	}))
+	g.Expect(kept(RetentionPolicy{KeepLast: 1, KeepWeekly: 2})).To(Equal([]time.Time{
+		time.Date(2020, time.April, 29, 12, 0, 0, 0, time.UTC),
+		time.Date(2020, time.April, 26, 12, 0, 0, 0, time.UTC),
+	}))
+}
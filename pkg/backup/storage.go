@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variables that configure the object storage of the backup agent
+const (
+	StorageEndpointEnvVar        = "BACKUP_STORAGE_ENDPOINT"
+	StorageRegionEnvVar          = "BACKUP_STORAGE_REGION"
+	StorageBucketEnvVar          = "BACKUP_STORAGE_BUCKET"
+	StorageInsecureEnvVar        = "BACKUP_STORAGE_INSECURE"
+	StorageAccessKeyIDEnvVar     = "AWS_ACCESS_KEY_ID"
+	StorageSecretAccessKeyEnvVar = "AWS_SECRET_ACCESS_KEY"
+)
+
+// ObjectInfo describes an object in the object storage
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ObjectStore is the object storage backups are stored in
+type ObjectStore interface {
+	// PutFile uploads the file at path and returns its size
+	PutFile(ctx context.Context, key, path string) (int64, error)
+
+	Put(ctx context.Context, key string, data []byte) error
+
+	// GetFile downloads the object to path
+	GetFile(ctx context.Context, key, path string) error
+
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// List returns the objects whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+
+	Delete(ctx context.Context, key string) error
+}
+
+// StorageConfig is the location of and the credentials for an S3 compatible
+// bucket
+type StorageConfig struct {
+	// Endpoint is the host and port of the object storage, e.g. s3.amazonaws.com
+	// or minio:9000
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Insecure connects over http instead of https
+	Insecure bool
+}
+
+// StorageConfigFromEnv reads the storage configuration from the environment
+// variables set on the backup agent container
+func StorageConfigFromEnv() StorageConfig {
+	insecure, _ := strconv.ParseBool(os.Getenv(StorageInsecureEnvVar))
+	return StorageConfig{
+		Endpoint:        os.Getenv(StorageEndpointEnvVar),
+		Region:          os.Getenv(StorageRegionEnvVar),
+		Bucket:          os.Getenv(StorageBucketEnvVar),
+		AccessKeyID:     os.Getenv(StorageAccessKeyIDEnvVar),
+		SecretAccessKey: os.Getenv(StorageSecretAccessKeyEnvVar),
+		Insecure:        insecure,
+	}
+}
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store returns an ObjectStore for an S3 compatible bucket such as AWS S3
+// or MinIO
+func NewS3Store(config StorageConfig) (ObjectStore, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("no bucket configured")
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+
+	client, err := minio.NewWithRegion(endpoint, config.AccessKeyID, config.SecretAccessKey, !config.Insecure, config.Region)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{client: client, bucket: config.Bucket}, nil
+}
+
+func (s *s3Store) PutFile(ctx context.Context, key, path string) (int64, error) {
+	return s.client.FPutObjectWithContext(ctx, s.bucket, key, path, minio.PutObjectOptions{})
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObjectWithContext(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	return err
+}
+
+func (s *s3Store) GetFile(ctx context.Context, key, path string) error {
+	return s.client.FGetObjectWithContext(ctx, s.bucket, key, path, minio.GetObjectOptions{})
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObjectWithContext(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return ioutil.ReadAll(object)
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var objects []ObjectInfo
+	for object := range s.client.ListObjectsV2(s.bucket, prefix, true, done) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		objects = append(objects, ObjectInfo{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+	}
+	return objects, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(s.bucket, key)
+}
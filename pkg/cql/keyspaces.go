@@ -0,0 +1,137 @@
+package cql
+
+import (
+	"fmt"
+	"github.com/gocql/gocql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	networkTopologyStrategy = "org.apache.cassandra.locator.NetworkTopologyStrategy"
+	localStrategy           = "org.apache.cassandra.locator.LocalStrategy"
+)
+
+// SystemKeyspaces are the system keyspaces whose replication has to be managed
+// by the operator
+var SystemKeyspaces = []string{"system_auth", "system_distributed", "system_traces"}
+
+// GetReplication returns the replication settings of the keyspace or nil if the
+// keyspace does not exist
+func (s *Session) GetReplication(keyspace string) (map[string]string, error) {
+	var replication map[string]string
+	iter := s.session.Query("SELECT replication FROM system_schema.keyspaces WHERE keyspace_name = ?", keyspace).Iter()
+	iter.Scan(&replication)
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return replication, nil
+}
+
+// ListReplication returns the replication settings of all keyspaces
+func (s *Session) ListReplication() (map[string]map[string]string, error) {
+	keyspaces := make(map[string]map[string]string)
+
+	var name string
+	var replication map[string]string
+	iter := s.session.Query("SELECT keyspace_name, replication FROM system_schema.keyspaces").Iter()
+	for iter.Scan(&name, &replication) {
+		keyspaces[name] = replication
+		replication = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return keyspaces, nil
+}
+
+// GetTableID returns the ID of the table as it appears in the name of the
+// directory of the table, i.e. without dashes, or an empty string if the table
+// does not exist
+func (s *Session) GetTableID(keyspace, table string) (string, error) {
+	var id gocql.UUID
+	iter := s.session.Query("SELECT id FROM system_schema.tables WHERE keyspace_name = ? AND table_name = ?", keyspace, table).Iter()
+	found := iter.Scan(&id)
+	if err := iter.Close(); err != nil {
+		return "", err
+	}
+	if !found {
+		return "", nil
+	}
+	return strings.ReplaceAll(id.String(), "-", ""), nil
+}
+
+// CreateKeyspace creates the keyspace with NetworkTopologyStrategy unless it
+// already exists
+func (s *Session) CreateKeyspace(keyspace string, replication map[string]int32) error {
+	return s.Exec("CREATE KEYSPACE IF NOT EXISTS " + QuoteIdentifier(keyspace) + " WITH replication = " + replicationCQL(replication))
+}
+
+// AlterReplication changes the replication of the keyspace to
+// NetworkTopologyStrategy with the given replication factors
+func (s *Session) AlterReplication(keyspace string, replication map[string]int32) error {
+	return s.Exec("ALTER KEYSPACE " + QuoteIdentifier(keyspace) + " WITH replication = " + replicationCQL(replication))
+}
+
+// ReplicationEquals returns true if actual, as read from system_schema, is
+// NetworkTopologyStrategy with exactly the desired replication factors
+func ReplicationEquals(actual map[string]string, desired map[string]int32) bool {
+	if actual["class"] != networkTopologyStrategy {
+		return false
+	}
+	if len(actual) != len(desired)+1 {
+		return false
+	}
+	for dc, rf := range desired {
+		if actual[dc] != strconv.Itoa(int(rf)) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsReplicationRaised returns true if desired places more replicas in any
+// datacenter than actual, as read from system_schema, does. Changing from
+// another strategy counts as raising the replication since replicas move.
+func IsReplicationRaised(actual map[string]string, desired map[string]int32) bool {
+	if actual["class"] != networkTopologyStrategy {
+		return true
+	}
+	for dc, rf := range desired {
+		if current, err := strconv.Atoi(actual[dc]); err != nil || int32(current) < rf {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplicatesTo returns true if the replication, as read from system_schema,
+// can place replicas in the datacenter. SimpleStrategy does not take
+// datacenters into account, so it may place replicas in any of them.
+func ReplicatesTo(replication map[string]string, dc string) bool {
+	switch replication["class"] {
+	case localStrategy:
+		return false
+	case networkTopologyStrategy:
+		rf, err := strconv.Atoi(replication[dc])
+		return err == nil && rf > 0
+	default:
+		return true
+	}
+}
+
+func replicationCQL(replication map[string]int32) string {
+	dcs := make([]string, 0, len(replication))
+	for dc := range replication {
+		dcs = append(dcs, dc)
+	}
+	sort.Strings(dcs)
+
+	options := []string{"'class': 'NetworkTopologyStrategy'"}
+	for _, dc := range dcs {
+		options = append(options, fmt.Sprintf("%s: %d", QuoteString(dc), replication[dc]))
+	}
+	return "{" + strings.Join(options, ", ") + "}"
+}
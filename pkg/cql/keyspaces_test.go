@@ -0,0 +1,43 @@
+package cql
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReplicationCQL(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(replicationCQL(map[string]int32{"dc2": 1, "dc1": 3})).
+		To(Equal("{'class': 'NetworkTopologyStrategy', 'dc1': 3, 'dc2': 1}"))
+}
+
+func TestReplicationEquals(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	actual := map[string]string{"class": networkTopologyStrategy, "dc1": "3"}
+	g.Expect(ReplicationEquals(actual, map[string]int32{"dc1": 3})).To(BeTrue())
+	g.Expect(ReplicationEquals(actual, map[string]int32{"dc1": 1})).To(BeFalse())
+	g.Expect(ReplicationEquals(actual, map[string]int32{"dc1": 3, "dc2": 3})).To(BeFalse())
+
+	simple := map[string]string{"class": "org.apache.cassandra.locator.SimpleStrategy", "replication_factor": "1"}
+	g.Expect(ReplicationEquals(simple, map[string]int32{"dc1": 1})).To(BeFalse())
+	g.Expect(ReplicatesTo(simple, "dc1")).To(BeTrue())
+	g.Expect(ReplicatesTo(map[string]string{"class": localStrategy}, "dc1")).To(BeFalse())
+	g.Expect(ReplicatesTo(actual, "dc1")).To(BeTrue())
+	g.Expect(ReplicatesTo(actual, "dc2")).To(BeFalse())
+}
+
+func TestIsReplicationRaised(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	actual := map[string]string{"class": networkTopologyStrategy, "dc1": "3"}
+	g.Expect(IsReplicationRaised(actual, map[string]int32{"dc1": 3})).To(BeFalse())
+	g.Expect(IsReplicationRaised(actual, map[string]int32{"dc1": 1})).To(BeFalse())
+	g.Expect(IsReplicationRaised(actual, map[string]int32{"dc1": 3, "dc2": 1})).To(BeTrue())
+	g.Expect(IsReplicationRaised(map[string]string{"class": networkTopologyStrategy, "dc1": "1"}, map[string]int32{"dc1": 3})).To(BeTrue())
+
+	simple := map[string]string{"class": "org.apache.cassandra.locator.SimpleStrategy", "replication_factor": "1"}
+	g.Expect(IsReplicationRaised(simple, map[string]int32{"dc1": 1})).To(BeTrue())
+}
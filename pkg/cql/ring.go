@@ -0,0 +1,108 @@
+package cql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// TokenRange is the range of tokens (Start, End] of the Murmur3Partitioner. A
+// range with Start >= End wraps around the end of the ring.
+type TokenRange struct {
+	Start int64
+	End   int64
+}
+
+// TokenRing returns the tokens of every node in the cluster by broadcast address
+func (s *Session) TokenRing() (map[string][]string, error) {
+	ring := make(map[string][]string)
+
+	var address string
+	var tokens []string
+	iter := s.session.Query("SELECT broadcast_address, tokens FROM system.local").Iter()
+	for iter.Scan(&address, &tokens) {
+		ring[address] = tokens
+		tokens = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	iter = s.session.Query("SELECT peer, tokens FROM system.peers").Iter()
+	for iter.Scan(&address, &tokens) {
+		ring[address] = tokens
+		tokens = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// PrimaryRanges returns the token ranges the node at address is the primary
+// replica of, each split into the given number of subranges. The ranges are
+// sorted by their end token.
+func PrimaryRanges(ring map[string][]string, address string, splits int) ([]TokenRange, error) {
+	if splits < 1 {
+		splits = 1
+	}
+
+	type token struct {
+		value   int64
+		address string
+	}
+	var tokens []token
+	for addr, values := range ring {
+		for _, value := range values {
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid token %s of %s: %s", value, addr, err)
+			}
+			tokens = append(tokens, token{value: t, address: addr})
+		}
+	}
+	if _, found := ring[address]; !found {
+		return nil, fmt.Errorf("node %s is not part of the ring", address)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].value < tokens[j].value })
+
+	var ranges []TokenRange
+	for i, t := range tokens {
+		if t.address != address {
+			continue
+		}
+		start := tokens[(i+len(tokens)-1)%len(tokens)].value
+		ranges = append(ranges, splitRange(TokenRange{Start: start, End: t.value}, splits)...)
+	}
+
+	return ranges, nil
+}
+
+// splitRange splits r into n subranges of about the same size. The arithmetic
+// relies on int64 wrapping around so that ranges crossing the end of the ring
+// are split correctly.
+func splitRange(r TokenRange, n int) []TokenRange {
+	size := uint64(r.End - r.Start)
+	if size == 0 {
+		// A single token owns the whole ring
+		size = math.MaxUint64
+	}
+	step := size / uint64(n)
+	if step == 0 {
+		return []TokenRange{r}
+	}
+
+	ranges := make([]TokenRange, 0, n)
+	start := r.Start
+	for i := 1; i <= n; i++ {
+		end := r.Start + int64(uint64(i)*step)
+		if i == n {
+			end = r.End
+		}
+		ranges = append(ranges, TokenRange{Start: start, End: end})
+		start = end
+	}
+	return ranges
+}
@@ -0,0 +1,43 @@
+package cql
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPrimaryRanges(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ring := map[string][]string{
+		"10.0.0.1": {"-100", "100"},
+		"10.0.0.2": {"0"},
+	}
+
+	ranges, err := PrimaryRanges(ring, "10.0.0.1", 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ranges).To(Equal([]TokenRange{{Start: 100, End: -100}, {Start: 0, End: 100}}))
+
+	ranges, err = PrimaryRanges(ring, "10.0.0.2", 2)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ranges).To(Equal([]TokenRange{{Start: -100, End: -50}, {Start: -50, End: 0}}))
+
+	_, err = PrimaryRanges(ring, "10.0.0.3", 1)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestSplitWrappingRange(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ranges := splitRange(TokenRange{Start: math.MaxInt64 - 9, End: math.MinInt64 + 10}, 2)
+	g.Expect(ranges).To(Equal([]TokenRange{
+		{Start: math.MaxInt64 - 9, End: math.MinInt64},
+		{Start: math.MinInt64, End: math.MinInt64 + 10},
+	}))
+
+	ranges = splitRange(TokenRange{Start: 0, End: 0}, 4)
+	g.Expect(ranges).To(HaveLen(4))
+	g.Expect(ranges[0].Start).To(Equal(int64(0)))
+	g.Expect(ranges[3].End).To(Equal(int64(0)))
+}
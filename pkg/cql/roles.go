@@ -0,0 +1,165 @@
+package cql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Role is a row of system_auth.roles
+type Role struct {
+	Name      string
+	Login     bool
+	Superuser bool
+}
+
+// RoleExists returns true if a role with the given name exists
+func (s *Session) RoleExists(name string) (bool, error) {
+	role, err := s.GetRole(name)
+	return role != nil, err
+}
+
+// GetRole returns the role with the given name or nil if it does not exist
+func (s *Session) GetRole(name string) (*Role, error) {
+	role := &Role{Name: name}
+	iter := s.session.Query("SELECT can_login, is_superuser FROM system_auth.roles WHERE role = ?", name).Iter()
+	found := iter.Scan(&role.Login, &role.Superuser)
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	return role, nil
+}
+
+// CreateRole creates the role unless it already exists. The password is only
+// set when it is not empty.
+func (s *Session) CreateRole(name, password string, login, superuser bool) error {
+	return s.Exec("CREATE ROLE IF NOT EXISTS " + QuoteIdentifier(name) + roleOptions(password, login, superuser))
+}
+
+// AlterRole updates the options of the role. The password is only changed when
+// it is not empty.
+func (s *Session) AlterRole(name, password string, login, superuser bool) error {
+	return s.Exec("ALTER ROLE " + QuoteIdentifier(name) + roleOptions(password, login, superuser))
+}
+
+// DropRole drops the role if it exists
+func (s *Session) DropRole(name string) error {
+	return s.Exec("DROP ROLE IF EXISTS " + QuoteIdentifier(name))
+}
+
+// DisableLogin prevents the role from logging in
+func (s *Session) DisableLogin(name string) error {
+	return s.Exec("ALTER ROLE " + QuoteIdentifier(name) + " WITH LOGIN = false")
+}
+
+func roleOptions(password string, login, superuser bool) string {
+	options := fmt.Sprintf(" WITH LOGIN = %t AND SUPERUSER = %t", login, superuser)
+	if password != "" {
+		options += " AND PASSWORD = " + QuoteString(password)
+	}
+	return options
+}
+
+// Resources are identified the way Cassandra stores them in
+// system_auth.role_permissions
+const allKeyspacesResource = "data"
+
+// DataResource returns the resource for a table, a keyspace when table is
+// empty, or all keyspaces when keyspace is empty as well
+func DataResource(keyspace, table string) string {
+	if keyspace == "" {
+		return allKeyspacesResource
+	}
+	if table == "" {
+		return allKeyspacesResource + "/" + keyspace
+	}
+	return allKeyspacesResource + "/" + keyspace + "/" + table
+}
+
+// resourceCQL returns the CQL syntax for a data resource
+func resourceCQL(resource string) (string, error) {
+	parts := strings.Split(resource, "/")
+	if parts[0] != allKeyspacesResource {
+		return "", fmt.Errorf("unsupported resource %s", resource)
+	}
+	switch len(parts) {
+	case 1:
+		return "ALL KEYSPACES", nil
+	case 2:
+		return "KEYSPACE " + QuoteIdentifier(parts[1]), nil
+	case 3:
+		return "TABLE " + QuoteIdentifier(parts[1]) + "." + QuoteIdentifier(parts[2]), nil
+	default:
+		return "", fmt.Errorf("unsupported resource %s", resource)
+	}
+}
+
+// ExpandPermissions replaces ALL with the permissions Cassandra grants for it on
+// the given data resource. The result is sorted and has no duplicates.
+func ExpandPermissions(permissions []string, resource string) []string {
+	set := make(map[string]bool)
+	for _, permission := range permissions {
+		if permission != "ALL" {
+			set[permission] = true
+			continue
+		}
+		set["ALTER"] = true
+		set["AUTHORIZE"] = true
+		set["DROP"] = true
+		set["MODIFY"] = true
+		set["SELECT"] = true
+		if strings.Count(resource, "/") < 2 {
+			// tables cannot be created in tables
+			set["CREATE"] = true
+		}
+	}
+
+	expanded := make([]string, 0, len(set))
+	for permission := range set {
+		expanded = append(expanded, permission)
+	}
+	sort.Strings(expanded)
+	return expanded
+}
+
+// ListPermissions returns the permissions that have been granted to the role on
+// data resources
+func (s *Session) ListPermissions(role string) (map[string][]string, error) {
+	permissions := make(map[string][]string)
+
+	var resource string
+	var granted []string
+	iter := s.session.Query("SELECT resource, permissions FROM system_auth.role_permissions WHERE role = ?", role).Iter()
+	for iter.Scan(&resource, &granted) {
+		if resource == allKeyspacesResource || strings.HasPrefix(resource, allKeyspacesResource+"/") {
+			permissions[resource] = granted
+		}
+		granted = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Grant grants permission on resource to role
+func (s *Session) Grant(permission, resource, role string) error {
+	on, err := resourceCQL(resource)
+	if err != nil {
+		return err
+	}
+	return s.Exec(fmt.Sprintf("GRANT %s ON %s TO %s", permission, on, QuoteIdentifier(role)))
+}
+
+// Revoke revokes permission on resource from role
+func (s *Session) Revoke(permission, resource, role string) error {
+	on, err := resourceCQL(resource)
+	if err != nil {
+		return err
+	}
+	return s.Exec(fmt.Sprintf("REVOKE %s ON %s FROM %s", permission, on, QuoteIdentifier(role)))
+}
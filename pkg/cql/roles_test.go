@@ -0,0 +1,37 @@
+package cql
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDataResource(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(DataResource("", "")).To(Equal("data"))
+	g.Expect(DataResource("ks", "")).To(Equal("data/ks"))
+	g.Expect(DataResource("ks", "t")).To(Equal("data/ks/t"))
+
+	on, err := resourceCQL("data")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(on).To(Equal("ALL KEYSPACES"))
+
+	on, err = resourceCQL("data/ks/t")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(on).To(Equal(`TABLE "ks"."t"`))
+
+	_, err = resourceCQL("roles/admin")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestExpandPermissions(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(ExpandPermissions([]string{"SELECT", "MODIFY", "SELECT"}, "data/ks")).
+		To(Equal([]string{"MODIFY", "SELECT"}))
+	g.Expect(ExpandPermissions([]string{"ALL"}, "data/ks")).
+		To(Equal([]string{"ALTER", "AUTHORIZE", "CREATE", "DROP", "MODIFY", "SELECT"}))
+	g.Expect(ExpandPermissions([]string{"ALL"}, "data/ks/t")).
+		To(Equal([]string{"ALTER", "AUTHORIZE", "DROP", "MODIFY", "SELECT"}))
+}
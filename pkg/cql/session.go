@@ -0,0 +1,115 @@
+package cql
+
+// Helpers for connecting to a cluster over CQL. The operator uses CQL for the
+// statements that the management API does not expose, like altering roles.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/gocql/gocql"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Credentials are used for PasswordAuthenticator
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Session wraps a gocql session
+type Session struct {
+	session *gocql.Session
+}
+
+// NewSession connects to hosts with the given credentials. tlsConfig is nil
+// for unencrypted connections.
+func NewSession(hosts []string, port int, credentials Credentials, tlsConfig *tls.Config) (*Session, error) {
+	cluster := gocql.NewCluster(hosts...)
+	cluster.Port = port
+	cluster.Timeout = defaultTimeout
+	cluster.ConnectTimeout = defaultTimeout
+	cluster.Consistency = gocql.LocalQuorum
+	cluster.Authenticator = gocql.PasswordAuthenticator{
+		Username: credentials.Username,
+		Password: credentials.Password,
+	}
+	if tlsConfig != nil {
+		// Host verification is done by tlsConfig since gocql would otherwise
+		// match the certificate against the IPs of the nodes.
+		cluster.SslOpts = &gocql.SslOptions{Config: tlsConfig}
+	}
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{session: session}, nil
+}
+
+// Exec executes a statement that does not return rows
+func (s *Session) Exec(stmt string, values ...interface{}) error {
+	return s.session.Query(stmt, values...).Exec()
+}
+
+func (s *Session) Close() {
+	s.session.Close()
+}
+
+// NewTLSConfig returns a TLS configuration that verifies the certificates of the
+// nodes against caCert. Host names are not verified because the nodes are
+// addressed by IP. The client certificate is only needed when the nodes require
+// client authentication and can be nil otherwise.
+func NewTLSConfig(caCert, clientCert, clientKey []byte) (*tls.Config, error) {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("failed to parse CA certificate")
+	}
+
+	tlsConfig := &tls.Config{
+		// The chain is verified in VerifyPeerCertificate
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, roots)
+		},
+	}
+
+	if clientCert != nil {
+		cert, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate presented")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
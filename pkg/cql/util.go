@@ -0,0 +1,13 @@
+package cql
+
+import "strings"
+
+// QuoteIdentifier returns name as a quoted CQL identifier
+func QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// QuoteString returns s as a CQL string literal
+func QuoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,142 @@
+package metrics
+
+// Metrics of the operator about the clusters it manages. They are registered
+// with the controller-runtime registry and served on the metrics endpoint of
+// the manager next to the controller-runtime metrics.
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "cassandra_operator"
+
+// Node states of the nodes gauge
+const (
+	NodeStateReady    = "Ready"
+	NodeStateNotReady = "NotReady"
+	NodeStatePending  = "Pending"
+
+	// NodeStateMissing counts the nodes of the datacenter that have no pod
+	NodeStateMissing = "Missing"
+)
+
+// NodeStates are the values of the state label of the nodes gauge
+var NodeStates = []string{NodeStateReady, NodeStateNotReady, NodeStatePending, NodeStateMissing}
+
+// Operations of the operations gauge
+const (
+	OperationRollingRestart  = "rolling_restart"
+	OperationScaling         = "scaling"
+	OperationRebuild         = "rebuild"
+	OperationDecommission    = "decommission"
+	OperationNodeReplacement = "node_replacement"
+)
+
+// Operations are the values of the operation label of the operations gauge
+var Operations = []string{OperationRollingRestart, OperationScaling, OperationRebuild, OperationDecommission, OperationNodeReplacement}
+
+var (
+	// Nodes is the number of nodes per state in each datacenter
+	Nodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "nodes",
+		Help:      "Number of Cassandra nodes per state in each datacenter",
+	}, []string{"namespace", "cluster", "datacenter", "state"})
+
+	// OperationsInProgress is the number of operations of each kind that are
+	// running in a cluster
+	OperationsInProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operations_in_progress",
+		Help:      "Number of operations of each kind in progress in a cluster",
+	}, []string{"namespace", "cluster", "operation"})
+
+	// ReconcileStepDuration is the time the steps of the reconciliation of a
+	// cluster take
+	ReconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_step_duration_seconds",
+		Help:      "Duration of the steps of the reconciliation of a CassandraCluster",
+		Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+	}, []string{"step"})
+
+	// MgmtAPIRequestDuration is the latency of the requests to the management API
+	MgmtAPIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mgmt_api_request_duration_seconds",
+		Help:      "Latency of the requests to the management API",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path"})
+
+	// MgmtAPIRequestErrors counts the requests to the management API that failed
+	// or got an unexpected status code
+	MgmtAPIRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mgmt_api_request_errors_total",
+		Help:      "Number of failed requests to the management API",
+	}, []string{"method", "path"})
+
+	// LastSuccessfulBackup is the time the last backup of a cluster completed.
+	// The time since is time() - cassandra_operator_last_successful_backup_timestamp_seconds.
+	LastSuccessfulBackup = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_backup_timestamp_seconds",
+		Help:      "Unix time the last successful CassandraBackup of a cluster completed",
+	}, []string{"namespace", "cluster"})
+
+	// LastSuccessfulRepair is the time the last repair of a cluster completed
+	LastSuccessfulRepair = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_repair_timestamp_seconds",
+		Help:      "Unix time the last successful CassandraRepair of a cluster completed",
+	}, []string{"namespace", "cluster"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		Nodes,
+		OperationsInProgress,
+		ReconcileStepDuration,
+		MgmtAPIRequestDuration,
+		MgmtAPIRequestErrors,
+		LastSuccessfulBackup,
+		LastSuccessfulRepair,
+	)
+}
+
+// SetLastSuccess records t in gauge for the cluster unless a later time has
+// already been recorded, since backups and repairs are not reconciled in the
+// order they completed in
+func SetLastSuccess(gauge *prometheus.GaugeVec, clusterNamespace, cluster string, t time.Time) {
+	g := gauge.WithLabelValues(clusterNamespace, cluster)
+	if current := getGaugeValue(g); float64(t.Unix()) > current {
+		g.Set(float64(t.Unix()))
+	}
+}
+
+// ForgetCluster removes the series of a deleted cluster
+func ForgetCluster(clusterNamespace, cluster string, datacenters []string) {
+	for _, dc := range datacenters {
+		for _, state := range NodeStates {
+			Nodes.DeleteLabelValues(clusterNamespace, cluster, dc, state)
+		}
+	}
+	for _, operation := range Operations {
+		OperationsInProgress.DeleteLabelValues(clusterNamespace, cluster, operation)
+	}
+	LastSuccessfulBackup.DeleteLabelValues(clusterNamespace, cluster)
+	LastSuccessfulRepair.DeleteLabelValues(clusterNamespace, cluster)
+}
+
+// getGaugeValue returns the current value of the gauge
+func getGaugeValue(gauge prometheus.Gauge) float64 {
+	m := &dto.Metric{}
+	if err := gauge.Write(m); err != nil {
+		return 0
+	}
+	return m.GetGauge().GetValue()
+}
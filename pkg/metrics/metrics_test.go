@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSetLastSuccess(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := "set-last-success"
+	defer ForgetCluster("default", cluster, nil)
+
+	now := time.Now()
+	SetLastSuccess(LastSuccessfulBackup, "default", cluster, now)
+	g.Expect(getGaugeValue(LastSuccessfulBackup.WithLabelValues("default", cluster))).To(Equal(float64(now.Unix())))
+
+	SetLastSuccess(LastSuccessfulBackup, "default", cluster, now.Add(-time.Hour))
+	g.Expect(getGaugeValue(LastSuccessfulBackup.WithLabelValues("default", cluster))).To(Equal(float64(now.Unix())))
+
+	later := now.Add(time.Hour)
+	SetLastSuccess(LastSuccessfulBackup, "default", cluster, later)
+	g.Expect(getGaugeValue(LastSuccessfulBackup.WithLabelValues("default", cluster))).To(Equal(float64(later.Unix())))
+}
+
+func TestForgetCluster(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := "forget-cluster"
+	defer ForgetCluster("other", cluster, nil)
+
+	now := time.Now()
+	SetLastSuccess(LastSuccessfulBackup, "default", cluster, now)
+	SetLastSuccess(LastSuccessfulBackup, "other", cluster, now.Add(-time.Hour))
+	g.Expect(getGaugeValue(LastSuccessfulBackup.WithLabelValues("other", cluster))).To(Equal(float64(now.Add(-time.Hour).Unix())))
+
+	ForgetCluster("default", cluster, nil)
+	g.Expect(LastSuccessfulBackup.DeleteLabelValues("default", cluster)).To(BeFalse())
+	g.Expect(getGaugeValue(LastSuccessfulBackup.WithLabelValues("other", cluster))).To(Equal(float64(now.Add(-time.Hour).Unix())))
+}
@@ -0,0 +1,247 @@
+package mgmtapi
+
+// Client for the management API that runs next to Cassandra in the cassandra
+// container. The API exposes node operations over HTTP so that the operator does
+// not have to exec nodetool in the pods.
+//
+// See https://github.com/datastax/management-api-for-apache-cassandra
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/jsanda/cassandra-operator/pkg/metrics"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPort is the port the management API listens on
+	DefaultPort int32 = 8080
+
+	defaultTimeout = 30 * time.Second
+)
+
+type Client struct {
+	httpClient *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// NewClientWithHTTPClient returns a Client that sends its requests with
+// httpClient, e.g. one that is configured for TLS.
+func NewClientWithHTTPClient(httpClient *http.Client) *Client {
+	return &Client{httpClient: httpClient}
+}
+
+// SetTLSConfig has the client connect to the management API over TLS with the
+// given configuration, which has to hold the client certificate
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	c.httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+}
+
+// PodEndpoint returns the base URL of the management API running in pod
+func PodEndpoint(pod *corev1.Pod, port int32) string {
+	return fmt.Sprintf("https://%s:%d", pod.Status.PodIP, port)
+}
+
+// RequestError is returned when the management API responds with an
+// unexpected status code
+type RequestError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s %s failed with status code %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// CreateRole creates a role through the node at endpoint. The node executes the
+// statement over its local socket, so this works before any role exists.
+func (c *Client) CreateRole(ctx context.Context, endpoint, username, password string, superuser, login bool) error {
+	params := url.Values{}
+	params.Set("username", username)
+	params.Set("password", password)
+	params.Set("is_superuser", strconv.FormatBool(superuser))
+	params.Set("can_login", strconv.FormatBool(login))
+
+	_, err := c.do(ctx, http.MethodPost, endpoint, "/api/v0/ops/auth/role", params, nil)
+	return err
+}
+
+// Job is an asynchronous operation running in the management API
+type Job struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Status JobStatus `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type JobStatus string
+
+const (
+	JobStatusWaiting   JobStatus = "WAITING"
+	JobStatusCompleted JobStatus = "COMPLETED"
+	JobStatusError     JobStatus = "ERROR"
+)
+
+// Rebuild starts nodetool rebuild on the node at endpoint, streaming data from
+// sourceDC. It returns the ID of the job that can be polled with GetJob.
+func (c *Client) Rebuild(ctx context.Context, endpoint, sourceDC string) (string, error) {
+	params := url.Values{}
+	params.Set("src_dc", sourceDC)
+
+	body, err := c.do(ctx, http.MethodPost, endpoint, "/api/v1/ops/node/rebuild", params, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// Decommission starts nodetool decommission on the node at endpoint. It returns
+// the ID of the job that can be polled with GetJob.
+func (c *Client) Decommission(ctx context.Context, endpoint string) (string, error) {
+	body, err := c.do(ctx, http.MethodPost, endpoint, "/api/v1/ops/node/decommission", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// RingRange is a range of tokens (Start, End]
+type RingRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// RepairRequest describes a repair of a keyspace
+type RepairRequest struct {
+	Keyspace string   `json:"keyspace_name"`
+	Tables   []string `json:"tables,omitempty"`
+	// Full runs a full repair rather than an incremental one
+	Full bool `json:"full_repair"`
+	// TokenRanges limits the repair to the given ranges. The node has to be a
+	// replica of all of them.
+	TokenRanges []RingRange `json:"associated_tokens,omitempty"`
+}
+
+// Repair starts a repair on the node at endpoint. It returns the ID of the job
+// that can be polled with GetJob.
+func (c *Client) Repair(ctx context.Context, endpoint string, request RepairRequest) (string, error) {
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := c.do(ctx, http.MethodPost, endpoint, "/api/v1/ops/node/repair", nil, reqBody)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// TakeSnapshot takes a snapshot with the given name of the keyspaces, or of all
+// keyspaces when none are given, on the node at endpoint
+func (c *Client) TakeSnapshot(ctx context.Context, endpoint, name string, keyspaces []string) error {
+	reqBody, err := json.Marshal(struct {
+		SnapshotName string   `json:"snapshot_name"`
+		Keyspaces    []string `json:"keyspaces,omitempty"`
+	}{SnapshotName: name, Keyspaces: keyspaces})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, http.MethodPost, endpoint, "/api/v0/ops/node/snapshots", nil, reqBody)
+	return err
+}
+
+// ClearSnapshot deletes the snapshot with the given name on the node at endpoint
+func (c *Client) ClearSnapshot(ctx context.Context, endpoint, name string) error {
+	params := url.Values{}
+	params.Set("snapshotNames", name)
+
+	_, err := c.do(ctx, http.MethodDelete, endpoint, "/api/v0/ops/node/snapshots", params, nil)
+	return err
+}
+
+// RefreshTable loads SSTables that have been placed in the directory of the
+// table into the table on the node at endpoint, like nodetool refresh
+func (c *Client) RefreshTable(ctx context.Context, endpoint, keyspace, table string) error {
+	params := url.Values{}
+	params.Set("keyspaceName", keyspace)
+	params.Set("table", table)
+
+	_, err := c.do(ctx, http.MethodPost, endpoint, "/api/v0/ops/keyspace/refresh", params, nil)
+	return err
+}
+
+// GetJob returns the job with the given ID
+func (c *Client) GetJob(ctx context.Context, endpoint, jobID string) (*Job, error) {
+	params := url.Values{}
+	params.Set("job_id", jobID)
+
+	body, err := c.do(ctx, http.MethodGet, endpoint, "/api/v0/ops/executor/job", params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{}
+	if err = json.Unmarshal(body, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// do sends a request to the management API and returns the response body
+func (c *Client) do(ctx context.Context, method, endpoint, path string, params url.Values, body []byte) (respBody []byte, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.MgmtAPIRequestDuration.WithLabelValues(method, path).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.MgmtAPIRequestErrors.WithLabelValues(method, path).Inc()
+		}
+	}()
+
+	u := endpoint + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &RequestError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return respBody, nil
+}
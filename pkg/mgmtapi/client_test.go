@@ -0,0 +1,153 @@
+package mgmtapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCreateRole(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var request *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	err := client.CreateRole(context.Background(), server.URL, "admin", "secret", true, true)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(request.Method).To(Equal(http.MethodPost))
+	g.Expect(request.URL.Path).To(Equal("/api/v0/ops/auth/role"))
+	g.Expect(request.URL.Query().Get("username")).To(Equal("admin"))
+	g.Expect(request.URL.Query().Get("password")).To(Equal("secret"))
+	g.Expect(request.URL.Query().Get("is_superuser")).To(Equal("true"))
+	g.Expect(request.URL.Query().Get("can_login")).To(Equal("true"))
+}
+
+func TestCreateRoleFailure(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("role already exists"))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	err := client.CreateRole(context.Background(), server.URL, "admin", "secret", true, true)
+	g.Expect(err).To(HaveOccurred())
+
+	requestErr, ok := err.(*RequestError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(requestErr.StatusCode).To(Equal(http.StatusInternalServerError))
+	g.Expect(requestErr.Body).To(Equal("role already exists"))
+}
+
+func TestRebuild(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/ops/node/rebuild":
+			g.Expect(r.Method).To(Equal(http.MethodPost))
+			g.Expect(r.URL.Query().Get("src_dc")).To(Equal("dc1"))
+			w.Write([]byte("1234"))
+		case "/api/v0/ops/executor/job":
+			g.Expect(r.URL.Query().Get("job_id")).To(Equal("1234"))
+			w.Write([]byte(`{"id": "1234", "type": "rebuild", "status": "COMPLETED"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	jobID, err := client.Rebuild(context.Background(), server.URL, "dc1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(jobID).To(Equal("1234"))
+
+	job, err := client.GetJob(context.Background(), server.URL, jobID)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(job.Status).To(Equal(JobStatusCompleted))
+}
+
+func TestRepair(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var request RepairRequest
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Method).To(Equal(http.MethodPost))
+		g.Expect(r.URL.Path).To(Equal("/api/v1/ops/node/repair"))
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(json.Unmarshal(body, &request)).To(Succeed())
+		w.Write([]byte("5678"))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	jobID, err := client.Repair(context.Background(), server.URL, RepairRequest{
+		Keyspace:    "ks1",
+		Full:        true,
+		TokenRanges: []RingRange{{Start: -100, End: 100}},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(jobID).To(Equal("5678"))
+	g.Expect(request.Keyspace).To(Equal("ks1"))
+	g.Expect(request.Full).To(BeTrue())
+	g.Expect(request.TokenRanges).To(Equal([]RingRange{{Start: -100, End: 100}}))
+	g.Expect(body).To(MatchJSON(`{"keyspace_name": "ks1", "full_repair": true, "associated_tokens": [{"start": -100, "end": 100}]}`))
+}
+
+func TestSnapshots(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var requests []*http.Request
+	var snapshot map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Method == http.MethodPost {
+			g.Expect(json.NewDecoder(r.Body).Decode(&snapshot)).To(Succeed())
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	g.Expect(client.TakeSnapshot(context.Background(), server.URL, "b1", []string{"ks1"})).To(Succeed())
+	g.Expect(snapshot).To(Equal(map[string]interface{}{"snapshot_name": "b1", "keyspaces": []interface{}{"ks1"}}))
+
+	g.Expect(client.ClearSnapshot(context.Background(), server.URL, "b1")).To(Succeed())
+	g.Expect(requests).To(HaveLen(2))
+	g.Expect(requests[1].Method).To(Equal(http.MethodDelete))
+	g.Expect(requests[1].URL.Path).To(Equal("/api/v0/ops/node/snapshots"))
+	g.Expect(requests[1].URL.Query().Get("snapshotNames")).To(Equal("b1"))
+}
+
+func TestRefreshTable(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var request *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	g.Expect(client.RefreshTable(context.Background(), server.URL, "ks1", "t1")).To(Succeed())
+	g.Expect(request.Method).To(Equal(http.MethodPost))
+	g.Expect(request.URL.Path).To(Equal("/api/v0/ops/keyspace/refresh"))
+	g.Expect(request.URL.Query().Get("keyspaceName")).To(Equal("ks1"))
+	g.Expect(request.URL.Query().Get("table")).To(Equal("t1"))
+}
@@ -0,0 +1,104 @@
+package mgmtapi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+)
+
+// Keys of the certificates and keys returned by GenerateCertificates. The
+// management API is started with the CA certificate and the server certificate
+// and only accepts clients that present a certificate signed by the CA.
+const (
+	CACertKey     = "ca.crt"
+	ServerCertKey = "tls.crt"
+	ServerKeyKey  = "tls.key"
+	ClientCertKey = "client.crt"
+	ClientKeyKey  = "client.key"
+)
+
+const certificateValidity = 10 * 365 * 24 * time.Hour
+
+// GenerateCertificates returns a self-signed CA along with a server certificate
+// for the management API and a client certificate for the operator, both
+// signed by the CA. They are PEM encoded and keyed by CACertKey etc.
+func GenerateCertificates(commonName string) (map[string]string, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := newCertificateTemplate(commonName + " CA")
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{CACertKey: encodeCertificate(caDER)}
+	for _, leaf := range []struct {
+		commonName string
+		usage      x509.ExtKeyUsage
+		certKey    string
+		keyKey     string
+	}{
+		{commonName, x509.ExtKeyUsageServerAuth, ServerCertKey, ServerKeyKey},
+		{"cassandra-operator", x509.ExtKeyUsageClientAuth, ClientCertKey, ClientKeyKey},
+	} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		template := newCertificateTemplate(leaf.commonName)
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{leaf.usage}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+		if err != nil {
+			return nil, err
+		}
+		encodedKey, err := encodePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		data[leaf.certKey] = encodeCertificate(der)
+		data[leaf.keyKey] = encodedKey
+	}
+
+	return data, nil
+}
+
+func newCertificateTemplate(commonName string) *x509.Certificate {
+	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateValidity),
+	}
+}
+
+func encodeCertificate(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// encodePrivateKey encodes key as PKCS #8, which is the format the management
+// API reads
+func encodePrivateKey(key crypto.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
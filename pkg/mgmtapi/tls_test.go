@@ -0,0 +1,59 @@
+package mgmtapi
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	. "github.com/onsi/gomega"
+)
+
+func TestGenerateCertificates(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	data, err := GenerateCertificates("test")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	serverCert, err := tls.X509KeyPair([]byte(data[ServerCertKey]), []byte(data[ServerKeyKey]))
+	g.Expect(err).ToNot(HaveOccurred())
+	clientCAs := x509.NewCertPool()
+	g.Expect(clientCAs.AppendCertsFromPEM([]byte(data[CACertKey]))).To(BeTrue())
+
+	// Configured like the management API is by docker-entrypoint.sh
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	tlsConfig, err := cql.NewTLSConfig([]byte(data[CACertKey]), []byte(data[ClientCertKey]), []byte(data[ClientKeyKey]))
+	g.Expect(err).ToNot(HaveOccurred())
+	client := NewClient()
+	client.SetTLSConfig(tlsConfig)
+	g.Expect(client.ClearSnapshot(context.Background(), server.URL, "test")).To(Succeed())
+
+	// A client without the certificate of the operator is rejected
+	tlsConfig, err = cql.NewTLSConfig([]byte(data[CACertKey]), nil, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	client = NewClient()
+	client.SetTLSConfig(tlsConfig)
+	g.Expect(client.ClearSnapshot(context.Background(), server.URL, "test")).ToNot(Succeed())
+
+	// So is a client with a certificate from another cluster
+	other, err := GenerateCertificates("other")
+	g.Expect(err).ToNot(HaveOccurred())
+	tlsConfig, err = cql.NewTLSConfig([]byte(data[CACertKey]), []byte(other[ClientCertKey]), []byte(other[ClientKeyKey]))
+	g.Expect(err).ToNot(HaveOccurred())
+	client = NewClient()
+	client.SetTLSConfig(tlsConfig)
+	g.Expect(client.ClearSnapshot(context.Background(), server.URL, "test")).ToNot(Succeed())
+}
@@ -0,0 +1,236 @@
+package reaper
+
+// Client for the REST API of Cassandra Reaper. The operator registers clusters
+// with Reaper and creates the repair schedules of their keyspaces.
+//
+// See http://cassandra-reaper.io/docs/api/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// token authenticates the requests once Login has succeeded
+	token string
+}
+
+// NewClient returns a Client for the Reaper instance at baseURL, e.g.
+// http://reaper:8080
+func NewClient(baseURL string) *Client {
+	return NewClientWithHTTPClient(baseURL, &http.Client{Timeout: defaultTimeout})
+}
+
+// NewClientWithHTTPClient returns a Client that sends its requests with
+// httpClient
+func NewClientWithHTTPClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{baseURL: baseURL, httpClient: httpClient}
+}
+
+// RequestError is returned when Reaper responds with an unexpected status code
+type RequestError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s %s failed with status code %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// IsNotFound returns true if err is a RequestError for a 404 response
+func IsNotFound(err error) bool {
+	requestErr, ok := err.(*RequestError)
+	return ok && requestErr.StatusCode == http.StatusNotFound
+}
+
+// Login authenticates with Reaper. Reaper answers the login with a session
+// cookie, which is exchanged for a JSON web token that authenticates the
+// requests that follow.
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	form := url.Values{}
+	form.Set("username", username)
+	form.Set("password", password)
+	form.Set("rememberMe", "false")
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.send(ctx, req, "/login")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	req, err = http.NewRequest(http.MethodGet, c.baseURL+"/jwt", nil)
+	if err != nil {
+		return err
+	}
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+	resp, err = c.send(ctx, req, "/jwt")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	c.token = strings.TrimSpace(string(token))
+	return nil
+}
+
+// ClusterExists returns true if the cluster is registered with Reaper
+func (c *Client) ClusterExists(ctx context.Context, clusterName string) (bool, error) {
+	_, err := c.do(ctx, http.MethodGet, "/cluster/"+url.PathEscape(clusterName), nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// AddCluster registers the cluster with Reaper. Reaper discovers the nodes of
+// the cluster by connecting to seedHost over JMX.
+func (c *Client) AddCluster(ctx context.Context, clusterName, seedHost string, jmxPort int32) error {
+	params := url.Values{}
+	params.Set("seedHost", seedHost)
+	params.Set("jmxPort", strconv.Itoa(int(jmxPort)))
+
+	_, err := c.do(ctx, http.MethodPut, "/cluster/"+url.PathEscape(clusterName), params)
+	return err
+}
+
+// DeleteCluster unregisters the cluster from Reaper along with its repair
+// schedules and runs
+func (c *Client) DeleteCluster(ctx context.Context, clusterName string) error {
+	params := url.Values{}
+	params.Set("force", "true")
+
+	_, err := c.do(ctx, http.MethodDelete, "/cluster/"+url.PathEscape(clusterName), params)
+	return err
+}
+
+// RepairSchedule is a schedule that repairs a keyspace periodically
+type RepairSchedule struct {
+	ID                  string `json:"id"`
+	Owner               string `json:"owner,omitempty"`
+	ClusterName         string `json:"cluster_name"`
+	Keyspace            string `json:"keyspace_name"`
+	State               string `json:"state,omitempty"`
+	ScheduleDaysBetween int32  `json:"scheduled_days_between,omitempty"`
+}
+
+// RepairScheduleOptions are the settings of a new repair schedule
+type RepairScheduleOptions struct {
+	ClusterName         string
+	Keyspace            string
+	Owner               string
+	ScheduleDaysBetween int32
+	// Intensity is left to the default of Reaper when empty
+	Intensity string
+	// RepairParallelism is left to the default of Reaper when empty
+	RepairParallelism string
+}
+
+// GetRepairSchedules returns the repair schedules of the cluster
+func (c *Client) GetRepairSchedules(ctx context.Context, clusterName string) ([]RepairSchedule, error) {
+	body, err := c.do(ctx, http.MethodGet, "/repair_schedule/cluster/"+url.PathEscape(clusterName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []RepairSchedule
+	if err = json.Unmarshal(body, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// CreateRepairSchedule creates a repair schedule that repairs a keyspace every
+// options.ScheduleDaysBetween days
+func (c *Client) CreateRepairSchedule(ctx context.Context, options RepairScheduleOptions) (*RepairSchedule, error) {
+	params := url.Values{}
+	params.Set("clusterName", options.ClusterName)
+	params.Set("keyspace", options.Keyspace)
+	params.Set("owner", options.Owner)
+	params.Set("scheduleDaysBetween", strconv.Itoa(int(options.ScheduleDaysBetween)))
+	if options.Intensity != "" {
+		params.Set("intensity", options.Intensity)
+	}
+	if options.RepairParallelism != "" {
+		params.Set("repairParallelism", options.RepairParallelism)
+	}
+
+	body, err := c.do(ctx, http.MethodPost, "/repair_schedule", params)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &RepairSchedule{}
+	if err = json.Unmarshal(body, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// do sends a request to Reaper and returns the response body
+func (c *Client) do(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
+	u := c.baseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.send(ctx, req, path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// send sends req and returns the response if it has a 2xx status code. The
+// caller has to close the response body.
+func (c *Client) send(ctx context.Context, req *http.Request, path string) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return nil, &RequestError{Method: req.Method, Path: path, StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return resp, nil
+}
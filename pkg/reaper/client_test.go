@@ -0,0 +1,167 @@
+package reaper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const (
+	mockUsername = "reaper"
+	mockPassword = "secret"
+	mockSession  = "session-1"
+	mockToken    = "token-1"
+)
+
+// mockReaper implements the parts of the Reaper REST API used by the operator.
+// The API requires the token that a login with the mock credentials returns.
+type mockReaper struct {
+	sync.Mutex
+	clusters  map[string]string
+	schedules []RepairSchedule
+}
+
+func newMockReaper() *mockReaper {
+	return &mockReaper{clusters: make(map[string]string)}
+}
+
+func (m *mockReaper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/login":
+		if r.URL.Query().Get("password") != "" || r.PostFormValue("username") != mockUsername || r.PostFormValue("password") != mockPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: mockSession})
+	case r.Method == http.MethodGet && r.URL.Path == "/jwt":
+		if cookie, err := r.Cookie("JSESSIONID"); err != nil || cookie.Value != mockSession {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(mockToken))
+	case r.Header.Get("Authorization") != "Bearer "+mockToken:
+		w.WriteHeader(http.StatusUnauthorized)
+	case r.Method == http.MethodGet && r.URL.Path == "/cluster/test":
+		if _, found := m.clusters["test"]; !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"name": "test"}`))
+	case r.Method == http.MethodPut && r.URL.Path == "/cluster/test":
+		m.clusters["test"] = r.URL.Query().Get("seedHost")
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && r.URL.Path == "/cluster/test":
+		if r.URL.Query().Get("force") != "true" && len(m.schedules) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		delete(m.clusters, "test")
+		m.schedules = nil
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet && r.URL.Path == "/repair_schedule/cluster/test":
+		json.NewEncoder(w).Encode(m.schedules)
+	case r.Method == http.MethodPost && r.URL.Path == "/repair_schedule":
+		if _, found := m.clusters[r.URL.Query().Get("clusterName")]; !found {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("cluster not found"))
+			return
+		}
+		schedule := RepairSchedule{
+			ID:          "schedule-" + r.URL.Query().Get("keyspace"),
+			Owner:       r.URL.Query().Get("owner"),
+			ClusterName: r.URL.Query().Get("clusterName"),
+			Keyspace:    r.URL.Query().Get("keyspace"),
+			State:       "ACTIVE",
+		}
+		m.schedules = append(m.schedules, schedule)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(schedule)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	server := httptest.NewServer(newMockReaper())
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	ctx := context.Background()
+
+	_, err := client.ClusterExists(ctx, "test")
+	g.Expect(err).To(HaveOccurred())
+
+	err = client.Login(ctx, mockUsername, "wrong")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.(*RequestError).StatusCode).To(Equal(http.StatusUnauthorized))
+
+	g.Expect(client.Login(ctx, mockUsername, mockPassword)).To(Succeed())
+	exists, err := client.ClusterExists(ctx, "test")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+}
+
+func TestRegisterCluster(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	mock := newMockReaper()
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	ctx := context.Background()
+	g.Expect(client.Login(ctx, mockUsername, mockPassword)).To(Succeed())
+
+	exists, err := client.ClusterExists(ctx, "test")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+
+	g.Expect(client.AddCluster(ctx, "test", "test-seed-service", 7199)).To(Succeed())
+	g.Expect(mock.clusters).To(HaveKeyWithValue("test", "test-seed-service"))
+
+	exists, err = client.ClusterExists(ctx, "test")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+
+	g.Expect(client.DeleteCluster(ctx, "test")).To(Succeed())
+	g.Expect(mock.clusters).To(BeEmpty())
+}
+
+func TestRepairSchedules(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	mock := newMockReaper()
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	ctx := context.Background()
+	g.Expect(client.Login(ctx, mockUsername, mockPassword)).To(Succeed())
+	options := RepairScheduleOptions{ClusterName: "test", Keyspace: "ks1", Owner: "cassandra-operator", ScheduleDaysBetween: 7}
+
+	_, err := client.CreateRepairSchedule(ctx, options)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(IsNotFound(err)).To(BeTrue())
+
+	g.Expect(client.AddCluster(ctx, "test", "test-seed-service", 7199)).To(Succeed())
+
+	schedule, err := client.CreateRepairSchedule(ctx, options)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(schedule.ID).To(Equal("schedule-ks1"))
+	g.Expect(schedule.Keyspace).To(Equal("ks1"))
+
+	schedules, err := client.GetRepairSchedules(ctx, "test")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(schedules).To(HaveLen(1))
+	g.Expect(schedules[0].Owner).To(Equal("cassandra-operator"))
+}
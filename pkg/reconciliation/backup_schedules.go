@@ -0,0 +1,339 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/backup"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sort"
+	"time"
+)
+
+type backupScheduleRequestHandler struct {
+	clusterRefHandler
+	schedule *api.CassandraBackupSchedule
+
+	// backups are the backups created by the schedule, most recent first
+	backups []api.CassandraBackup
+}
+
+func NewBackupScheduleRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger) RequestHandler {
+	return &backupScheduleRequestHandler{
+		clusterRefHandler: clusterRefHandler{request: request, Client: client, scheme: scheme, log: log},
+	}
+}
+
+func (r *backupScheduleRequestHandler) HandleRequest(ctx context.Context) (reconcile.Result, error) {
+	schedule := &api.CassandraBackupSchedule{}
+	err := r.Get(ctx, r.request.NamespacedName, schedule)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		} else {
+			return ctrl.Result{}, err
+		}
+	}
+	r.schedule = schedule
+	r.setObject(schedule, func(err string) { schedule.Status.Error = err })
+
+	if !schedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if result := r.CheckCluster(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckBackups(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckRetention(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckSchedule(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// CheckCluster looks up the cluster that is backed up
+func (r *backupScheduleRequestHandler) CheckCluster(ctx context.Context) result.ReconcileResult {
+	if res := r.checkCluster(ctx, r.schedule.Spec.ClusterRef); res.Completed() {
+		return res
+	}
+	cluster := r.cluster
+
+	if !cluster.IsBackupEnabled() {
+		r.log.Info("backups are not configured", "CassandraCluster", cluster.Name)
+		return r.failed(ctx, fmt.Errorf("CassandraCluster %s has no backup storage configured", cluster.Name))
+	}
+
+	return result.Continue()
+}
+
+// CheckBackups lists the backups created by the schedule and records the running
+// ones and the most recent successful one in the status
+func (r *backupScheduleRequestHandler) CheckBackups(ctx context.Context) result.ReconcileResult {
+	backupList := &api.CassandraBackupList{}
+	err := r.List(ctx, backupList, client.InNamespace(r.schedule.Namespace), client.MatchingLabels{api.BackupScheduleLabel: r.schedule.Name})
+	if err != nil {
+		r.log.Error(err, "failed to list backups", "CassandraBackupSchedule", r.schedule.Name)
+		return result.Error(err)
+	}
+
+	r.backups = backupList.Items
+	sort.Slice(r.backups, func(i, j int) bool {
+		return r.backups[j].CreationTimestamp.Before(&r.backups[i].CreationTimestamp)
+	})
+
+	var active []string
+	lastSuccessful := ""
+	for _, b := range r.backups {
+		if !b.IsFinished() {
+			active = append(active, b.Name)
+		} else if b.Status.Phase == api.BackupPhaseCompleted && lastSuccessful == "" {
+			lastSuccessful = b.Name
+		}
+	}
+
+	if err = r.updateStatus(ctx, func(status *api.CassandraBackupScheduleStatus) {
+		status.Active = active
+		status.LastSuccessfulBackup = lastSuccessful
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraBackupSchedule", r.schedule.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// CheckRetention deletes the completed backups that the retention policy does
+// not keep, and failed backups once a later backup has completed. Nothing is
+// deleted while any backup of the cluster is running, whether it was created by
+// this schedule or not, since the SSTables an incremental backup uploads are
+// not referenced by a manifest before it completes.
+func (r *backupScheduleRequestHandler) CheckRetention(ctx context.Context) result.ReconcileResult {
+	if len(r.schedule.Status.Active) > 0 {
+		return result.Continue()
+	}
+
+	running, err := r.findRunningBackup(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to list backups", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+	if running != "" {
+		r.log.Info("postponing retention while a backup is running", "CassandraBackup", running)
+		return result.Continue()
+	}
+
+	var completed []api.CassandraBackup
+	var times []time.Time
+	var expired []api.CassandraBackup
+	for _, b := range r.backups {
+		if b.Status.Phase == api.BackupPhaseCompleted {
+			completed = append(completed, b)
+			times = append(times, b.CreationTimestamp.Time)
+		} else if len(completed) > 0 {
+			expired = append(expired, b)
+		}
+	}
+
+	retention := r.schedule.Spec.Retention
+	keep := backup.Retain(times, backup.RetentionPolicy{
+		KeepLast:    int(retention.KeepLast),
+		KeepDaily:   int(retention.KeepDaily),
+		KeepWeekly:  int(retention.KeepWeekly),
+		KeepMonthly: int(retention.KeepMonthly),
+	})
+	for i := range completed {
+		if !keep[i] {
+			expired = append(expired, completed[i])
+		}
+	}
+
+	if len(expired) == 0 {
+		return result.Continue()
+	}
+
+	store, err := newObjectStore(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to create object store client", "CassandraCluster", r.cluster.Name)
+		return r.failed(ctx, err)
+	}
+
+	deleted := make(map[string]bool)
+	for i := range expired {
+		r.log.Info("deleting expired backup", "CassandraBackup", expired[i].Name)
+		if err = r.deleteBackup(ctx, store, &expired[i]); err != nil {
+			r.log.Error(err, "failed to delete backup", "CassandraBackup", expired[i].Name)
+			return r.failed(ctx, err)
+		}
+		deleted[expired[i].Name] = true
+	}
+
+	if r.cluster.IsCommitLogArchivingEnabled() {
+		if err = r.deleteExpiredCommitLogs(ctx, store, deleted); err != nil {
+			r.log.Error(err, "failed to delete archived commitlogs", "CassandraCluster", r.cluster.Name)
+			return r.failed(ctx, err)
+		}
+	}
+
+	return result.Continue()
+}
+
+// findRunningBackup returns the name of a backup of the cluster that has not
+// finished, or an empty string if there is none
+func (r *backupScheduleRequestHandler) findRunningBackup(ctx context.Context) (string, error) {
+	backups, err := listClusterBackups(ctx, r, r.cluster)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range backups {
+		if !b.IsFinished() {
+			return b.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// deleteExpiredCommitLogs deletes the archived commitlog segments that no
+// remaining backup of the cluster, whether scheduled or not, can replay
+func (r *backupScheduleRequestHandler) deleteExpiredCommitLogs(ctx context.Context, store backup.ObjectStore, deleted map[string]bool) error {
+	backups, err := listClusterBackups(ctx, r, r.cluster)
+	if err != nil {
+		return err
+	}
+
+	var remaining []api.CassandraBackup
+	for _, b := range backups {
+		if !deleted[b.Name] {
+			remaining = append(remaining, b)
+		}
+	}
+	return deleteUnreplayableCommitLogs(ctx, store, r.cluster, remaining)
+}
+
+// CheckSchedule creates a backup when the cron schedule is due. When several
+// schedule times have passed, e.g. while the operator was down, only one backup
+// is created for the most recent of them.
+func (r *backupScheduleRequestHandler) CheckSchedule(ctx context.Context) result.ReconcileResult {
+	schedule, err := parseSchedule(r.schedule.Spec.Schedule)
+	if err != nil {
+		r.log.Info("invalid schedule", "Schedule", r.schedule.Spec.Schedule, "Reason", err.Error())
+		// There is no point in retrying until the schedule is changed
+		r.failed(ctx, fmt.Errorf("invalid schedule: %s", err))
+		return result.Done()
+	}
+
+	if r.schedule.Spec.Suspend {
+		return result.Done()
+	}
+
+	now := time.Now()
+	last := r.schedule.CreationTimestamp.Time
+	if r.schedule.Status.LastScheduleTime != nil {
+		last = r.schedule.Status.LastScheduleTime.Time
+	}
+	next := schedule.Next(last)
+	if now.Before(next) {
+		return result.RequeueSoon(int(next.Sub(now).Seconds()) + 1)
+	}
+	for t := schedule.Next(next); !t.After(now); t = schedule.Next(t) {
+		next = t
+	}
+
+	active := r.schedule.Status.Active
+	if len(active) > 0 {
+		switch r.schedule.GetConcurrencyPolicy() {
+		case api.ForbidConcurrent:
+			r.log.Info("skipping backup since backups are running", "ScheduledTime", next, "Active", active)
+			return r.scheduled(ctx, next, schedule)
+		case api.ReplaceConcurrent:
+			// The backups are only canceled here. Their files are deleted by
+			// CheckRetention once no backup of the cluster is running anymore.
+			for i := range r.backups {
+				if b := &r.backups[i]; !b.IsFinished() && !b.Spec.Cancel {
+					r.log.Info("canceling running backup", "CassandraBackup", b.Name)
+					patch := client.MergeFrom(b.DeepCopy())
+					b.Spec.Cancel = true
+					if err = r.Patch(ctx, b, patch); err != nil {
+						r.log.Error(err, "failed to cancel backup", "CassandraBackup", b.Name)
+						return result.Error(err)
+					}
+				}
+			}
+		}
+	}
+
+	b := &api.CassandraBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.schedule.Namespace,
+			Name:      fmt.Sprintf("%s-%d", r.schedule.Name, next.Unix()),
+			Labels:    map[string]string{api.BackupScheduleLabel: r.schedule.Name},
+		},
+		Spec: api.CassandraBackupSpec{
+			ClusterRef:  r.schedule.Spec.ClusterRef,
+			Keyspaces:   r.schedule.Spec.Keyspaces,
+			Incremental: r.schedule.Spec.Incremental,
+		},
+	}
+	if err = controllerutil.SetControllerReference(r.schedule, b, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for backup", "CassandraBackup", b.Name)
+		return result.Error(err)
+	}
+
+	r.log.Info("creating backup", "CassandraBackup", b.Name, "ScheduledTime", next)
+	if err = r.Create(ctx, b); err != nil && !errors.IsAlreadyExists(err) {
+		r.log.Error(err, "failed to create backup", "CassandraBackup", b.Name)
+		return result.Error(err)
+	}
+
+	return r.scheduled(ctx, next, schedule)
+}
+
+// scheduled records scheduledTime as the last schedule time and requeues the
+// request for the next one
+func (r *backupScheduleRequestHandler) scheduled(ctx context.Context, scheduledTime time.Time, schedule cron.Schedule) result.ReconcileResult {
+	lastScheduleTime := metav1.NewTime(scheduledTime)
+	if err := r.updateStatus(ctx, func(status *api.CassandraBackupScheduleStatus) {
+		status.LastScheduleTime = &lastScheduleTime
+		status.Error = ""
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraBackupSchedule", r.schedule.Name)
+		return result.Error(err)
+	}
+
+	return result.RequeueSoon(int(time.Until(schedule.Next(scheduledTime)).Seconds()) + 1)
+}
+
+// deleteBackup deletes the files of the backup, which has finished, from the
+// object storage and then the backup itself
+func (r *backupScheduleRequestHandler) deleteBackup(ctx context.Context, store backup.ObjectStore, b *api.CassandraBackup) error {
+	if err := backup.DeleteBackup(ctx, store, r.cluster.Spec.Backup.Storage.Prefix, r.cluster.Name, b.Name); err != nil {
+		return err
+	}
+
+	if err := r.Delete(ctx, b); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// updateStatus applies mutate to the status and patches it if it has changed
+func (r *backupScheduleRequestHandler) updateStatus(ctx context.Context, mutate func(status *api.CassandraBackupScheduleStatus)) error {
+	return r.patchStatus(ctx, func() { mutate(&r.schedule.Status) })
+}
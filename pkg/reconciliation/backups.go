@@ -0,0 +1,628 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/backup"
+	"github.com/jsanda/cassandra-operator/pkg/metrics"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type backupRequestHandler struct {
+	clusterRefHandler
+	mgmtClient   *mgmtapi.Client
+	backupClient *backup.Client
+	backup       *api.CassandraBackup
+}
+
+func NewBackupRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger) RequestHandler {
+	return &backupRequestHandler{
+		clusterRefHandler: clusterRefHandler{request: request, Client: client, scheme: scheme, log: log},
+		mgmtClient:        mgmtapi.NewClient(),
+		backupClient:      backup.NewClient(),
+	}
+}
+
+func (r *backupRequestHandler) HandleRequest(ctx context.Context) (reconcile.Result, error) {
+	b := &api.CassandraBackup{}
+	err := r.Get(ctx, r.request.NamespacedName, b)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		} else {
+			return ctrl.Result{}, err
+		}
+	}
+	r.backup = b
+	r.setObject(b, func(err string) { b.Status.Error = err })
+
+	if !b.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if b.IsFinished() {
+		// Completed backups are recorded here rather than when they finish so that
+		// the metric is set again after the operator restarts
+		if b.Status.Phase == api.BackupPhaseCompleted && b.Status.CompletionTime != nil {
+			metrics.SetLastSuccess(metrics.LastSuccessfulBackup, b.Namespace, b.Spec.ClusterRef.Name, b.Status.CompletionTime.Time)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if result := r.CheckCluster(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckCancel(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckSnapshots(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckUploads(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// CheckCluster looks up the cluster that is backed up
+func (r *backupRequestHandler) CheckCluster(ctx context.Context) result.ReconcileResult {
+	if res := r.checkCluster(ctx, r.backup.Spec.ClusterRef); res.Completed() {
+		return res
+	}
+	cluster := r.cluster
+
+	if res := r.configureMgmtClient(ctx, r.mgmtClient); res.Completed() {
+		return res
+	}
+
+	if !cluster.IsBackupEnabled() {
+		r.log.Info("backups are not configured", "CassandraCluster", cluster.Name)
+		return r.failed(ctx, fmt.Errorf("CassandraCluster %s has no backup storage configured", cluster.Name))
+	}
+
+	if res := r.configureBackupClient(ctx, r.backupClient); res.Completed() {
+		return res
+	}
+
+	if r.backup.Spec.Incremental && !cluster.IsIncrementalBackupsEnabled() {
+		r.log.Info("incremental backups are not enabled", "CassandraCluster", cluster.Name)
+		return r.failed(ctx, fmt.Errorf("CassandraCluster %s does not have incrementalBackups enabled", cluster.Name))
+	}
+
+	if !cluster.Status.SuperuserCreated {
+		r.log.Info("waiting for the superuser to be created", "CassandraCluster", cluster.Name)
+		return result.RequeueSoon(10)
+	}
+
+	return result.Continue()
+}
+
+// CheckCancel stops the backup once it is canceled. The agents are asked to
+// cancel the uploads, and the backup only fails once none of them is running,
+// since the schedules do not delete backups from the object storage while a
+// backup of the cluster is running.
+func (r *backupRequestHandler) CheckCancel(ctx context.Context) result.ReconcileResult {
+	if !r.backup.Spec.Cancel {
+		return result.Continue()
+	}
+
+	pods, err := listPods(ctx, r, r.cluster.Namespace, r.cluster.GetClusterLabels())
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+
+	nodes := make([]api.NodeBackupStatus, len(r.backup.Status.Nodes))
+	copy(nodes, r.backup.Status.Nodes)
+	running := false
+
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Phase == api.NodeBackupPhaseCompleted || node.Phase == api.NodeBackupPhaseFailed {
+			continue
+		}
+
+		pod := findPod(pods, node.Pod)
+		if pod == nil || pod.Status.PodIP == "" {
+			node.Phase = api.NodeBackupPhaseFailed
+			node.Error = fmt.Sprintf("pod %s is gone", node.Pod)
+			continue
+		}
+
+		// The upload may have been started even if the status does not say so
+		upload, err := r.backupClient.CancelUpload(ctx, backup.PodEndpoint(pod), r.backup.Name)
+		if err != nil {
+			r.log.Error(err, "failed to cancel upload", "Pod", pod.Name)
+			running = true
+			continue
+		}
+		if upload != nil && upload.Status == backup.TransferStatusRunning {
+			r.log.Info("waiting for upload to be canceled", "Pod", pod.Name)
+			running = true
+			continue
+		}
+
+		if r.backup.Status.SnapshotName != "" {
+			if err = r.mgmtClient.ClearSnapshot(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), r.backup.Status.SnapshotName); err != nil {
+				r.log.Error(err, "failed to clear snapshot", "Pod", pod.Name, "Snapshot", r.backup.Status.SnapshotName)
+			}
+		}
+		node.Phase = api.NodeBackupPhaseFailed
+		node.Error = "backup canceled"
+	}
+
+	if running {
+		if err = r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+			status.Nodes = nodes
+		}); err != nil {
+			r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+			return result.Error(err)
+		}
+		return result.RequeueSoon(5)
+	}
+
+	r.log.Info("canceled backup")
+	now := metav1.Now()
+	if err = r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+		status.Nodes = nodes
+		status.Phase = api.BackupPhaseFailed
+		status.CompletionTime = &now
+		status.Error = "backup canceled"
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+		return result.Error(err)
+	}
+
+	return result.Done()
+}
+
+// CheckSnapshots takes a snapshot named after the backup on every node. The
+// snapshots are only started while the cluster is healthy so that every node
+// is part of the backup. Nodes are recorded in the status as soon as their
+// snapshot has been taken so that a failed attempt only retries the others.
+// Incremental backups upload the SSTables in the backups directories instead,
+// so no snapshot is taken for them.
+func (r *backupRequestHandler) CheckSnapshots(ctx context.Context) result.ReconcileResult {
+	if r.backup.Status.Phase != "" && r.backup.Status.Phase != api.BackupPhaseSnapshotting {
+		return result.Continue()
+	}
+
+	reason, pods, err := checkClusterHealth(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to check cluster health", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+	if reason != "" {
+		r.log.Info("waiting for the cluster to be healthy", "Reason", reason)
+		if err = r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+			status.Error = reason
+		}); err != nil {
+			r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+			return result.Error(err)
+		}
+		return result.RequeueSoon(60)
+	}
+
+	if r.backup.Status.Phase == "" {
+		var base *api.CassandraBackup
+		if r.backup.Spec.Incremental {
+			if base, err = r.findBaseBackup(ctx); err != nil {
+				r.log.Error(err, "failed to list backups", "CassandraCluster", r.cluster.Name)
+				return result.Error(err)
+			}
+			if base == nil {
+				return r.failed(ctx, fmt.Errorf("CassandraCluster %s has no completed backup for the incremental backup to build on", r.cluster.Name))
+			}
+		}
+
+		r.log.Info("starting backup", "CassandraCluster", r.cluster.Name, "Incremental", r.backup.Spec.Incremental)
+		now := metav1.Now()
+		if err = r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+			status.Phase = api.BackupPhaseSnapshotting
+			if base != nil {
+				status.BaseBackup = base.Name
+			} else {
+				status.SnapshotName = r.backup.Name
+			}
+			status.StartTime = &now
+			status.Error = ""
+		}); err != nil {
+			r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+			return result.Error(err)
+		}
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if findNodeBackup(r.backup.Status.Nodes, pod.Name) != nil {
+			continue
+		}
+
+		// The oldest segment is recorded before the snapshot is taken, since the
+		// flush of the snapshot may archive it
+		var segmentID int64
+		if r.cluster.IsCommitLogArchivingEnabled() {
+			position, err := r.backupClient.GetCommitLogPosition(ctx, backup.PodEndpoint(pod))
+			if err != nil {
+				r.log.Error(err, "failed to get commitlog position", "Pod", pod.Name)
+				return r.failed(ctx, fmt.Errorf("failed to get commitlog position of %s: %s", pod.Name, err))
+			}
+			segmentID = position.SegmentID
+		}
+
+		if !r.backup.Spec.Incremental {
+			r.log.Info("taking snapshot", "Pod", pod.Name, "Snapshot", r.backup.Status.SnapshotName)
+			err = r.mgmtClient.TakeSnapshot(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), r.backup.Status.SnapshotName, r.backup.Spec.Keyspaces)
+			if err != nil {
+				r.log.Error(err, "failed to take snapshot", "Pod", pod.Name)
+				return r.failed(ctx, fmt.Errorf("failed to take snapshot on %s: %s", pod.Name, err))
+			}
+		}
+
+		if err = r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+			status.Nodes = append(status.Nodes, api.NodeBackupStatus{
+				Pod:                pod.Name,
+				Datacenter:         pod.Labels[api.DatacenterLabel],
+				Rack:               pod.Labels[api.RackLabel],
+				Phase:              api.NodeBackupPhaseSnapshotted,
+				CommitLogSegmentID: segmentID,
+			})
+		}); err != nil {
+			r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+			return result.Error(err)
+		}
+	}
+
+	if err = r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+		status.Phase = api.BackupPhaseUploading
+		status.Error = ""
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// CheckUploads has the backup agent of every node upload its snapshot and
+// polls the uploads until all of them have finished. The snapshot of a node is
+// cleared once its upload has finished.
+func (r *backupRequestHandler) CheckUploads(ctx context.Context) result.ReconcileResult {
+	pods, err := listPods(ctx, r, r.cluster.Namespace, r.cluster.GetClusterLabels())
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+
+	var base *api.CassandraBackup
+	if r.backup.Status.BaseBackup != "" {
+		base = &api.CassandraBackup{}
+		if err = r.Get(ctx, types.NamespacedName{Namespace: r.backup.Namespace, Name: r.backup.Status.BaseBackup}, base); err != nil {
+			r.log.Error(err, "failed to get base backup", "CassandraBackup", r.backup.Status.BaseBackup)
+			if errors.IsNotFound(err) {
+				return r.failed(ctx, fmt.Errorf("base backup %s not found", r.backup.Status.BaseBackup))
+			}
+			return result.Error(err)
+		}
+	}
+
+	var ring map[string][]string
+	nodes := make([]api.NodeBackupStatus, len(r.backup.Status.Nodes))
+	copy(nodes, r.backup.Status.Nodes)
+	finished := true
+
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Phase == api.NodeBackupPhaseCompleted || node.Phase == api.NodeBackupPhaseFailed {
+			continue
+		}
+
+		pod := findPod(pods, node.Pod)
+		if pod == nil || pod.Status.PodIP == "" {
+			r.log.Info("pod is gone", "Pod", node.Pod)
+			node.Phase = api.NodeBackupPhaseFailed
+			node.Error = fmt.Sprintf("pod %s is gone", node.Pod)
+			continue
+		}
+		endpoint := backup.PodEndpoint(pod)
+
+		var upload *backup.Upload
+		if node.Phase == api.NodeBackupPhaseUploading {
+			if upload, err = r.backupClient.GetUpload(ctx, endpoint, r.backup.Name); err != nil {
+				r.log.Error(err, "failed to get upload", "Pod", pod.Name)
+				finished = false
+				continue
+			}
+		}
+
+		if upload == nil {
+			// The upload has not been started yet or the agent has been restarted
+			// and lost track of it. The snapshot is still on disk, so start over.
+			if ring == nil {
+				if ring, err = r.getTokenRing(ctx); err != nil {
+					r.log.Error(err, "failed to get token ring", "CassandraCluster", r.cluster.Name)
+					return r.failed(ctx, err)
+				}
+			}
+			request := r.newUploadRequest(node, ring[getBroadcastAddress(r.cluster, pod)])
+			if base != nil {
+				baseNode := findNodeBackup(base.Status.Nodes, node.Pod)
+				if baseNode == nil || baseNode.Phase != api.NodeBackupPhaseCompleted {
+					r.log.Info("node is not part of the base backup", "Pod", pod.Name, "CassandraBackup", base.Name)
+					node.Phase = api.NodeBackupPhaseFailed
+					node.Error = fmt.Sprintf("%s is not part of base backup %s, a full backup is required", node.Pod, base.Name)
+					continue
+				}
+				request.BaseManifestKey = baseNode.ManifestKey
+			}
+			r.log.Info("starting upload", "Pod", pod.Name)
+			upload, err = r.backupClient.StartUpload(ctx, endpoint, request)
+			if err != nil {
+				r.log.Error(err, "failed to start upload", "Pod", pod.Name)
+				node.Error = err.Error()
+				finished = false
+				continue
+			}
+			node.Phase = api.NodeBackupPhaseUploading
+		}
+
+		node.Files = int32(upload.Files)
+		node.SkippedFiles = int32(upload.Skipped)
+		node.Size = upload.Size
+		node.Error = upload.Error
+		if upload.CompletionTime != nil {
+			node.Duration = &metav1.Duration{Duration: upload.CompletionTime.Sub(upload.StartTime)}
+		}
+
+		switch upload.Status {
+		case backup.TransferStatusCompleted:
+			r.log.Info("uploaded snapshot", "Pod", pod.Name, "Files", upload.Files, "Size", upload.Size)
+			node.Phase = api.NodeBackupPhaseCompleted
+			node.ManifestKey = upload.ManifestKey
+		case backup.TransferStatusFailed:
+			r.log.Info("failed to upload snapshot", "Pod", pod.Name, "Error", upload.Error)
+			node.Phase = api.NodeBackupPhaseFailed
+		default:
+			finished = false
+			continue
+		}
+
+		if r.backup.Status.SnapshotName != "" {
+			if err = r.mgmtClient.ClearSnapshot(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), r.backup.Status.SnapshotName); err != nil {
+				r.log.Error(err, "failed to clear snapshot", "Pod", pod.Name, "Snapshot", r.backup.Status.SnapshotName)
+			}
+		}
+	}
+
+	if !finished {
+		if err = r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+			status.Nodes = nodes
+		}); err != nil {
+			r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+			return result.Error(err)
+		}
+		return result.RequeueSoon(10)
+	}
+
+	return r.finish(ctx, nodes)
+}
+
+// finish records the outcome of the backup. The backup fails if any node fails.
+func (r *backupRequestHandler) finish(ctx context.Context, nodes []api.NodeBackupStatus) result.ReconcileResult {
+	phase := api.BackupPhaseCompleted
+	var size int64
+	var failed []string
+	for _, node := range nodes {
+		size += node.Size
+		if node.Phase == api.NodeBackupPhaseFailed {
+			phase = api.BackupPhaseFailed
+			failed = append(failed, node.Pod)
+		}
+	}
+	r.log.Info("finished backup", "Phase", phase, "Size", size)
+
+	now := metav1.Now()
+	if err := r.updateStatus(ctx, func(status *api.CassandraBackupStatus) {
+		status.Nodes = nodes
+		status.Phase = phase
+		status.Size = size
+		status.CompletionTime = &now
+		status.Error = ""
+		if len(failed) > 0 {
+			status.Error = fmt.Sprintf("backup failed on %v", failed)
+		}
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraBackup", r.backup.Name)
+		return result.Error(err)
+	}
+
+	if phase == api.BackupPhaseCompleted && r.cluster.IsCommitLogArchivingEnabled() {
+		// The backup is complete either way, so the segments are left for the next
+		// backup or retention run to delete if this fails
+		if err := r.deleteExpiredCommitLogs(ctx); err != nil {
+			r.log.Error(err, "failed to delete archived commitlogs", "CassandraCluster", r.cluster.Name)
+		}
+	}
+
+	return result.Done()
+}
+
+// deleteExpiredCommitLogs deletes the archived commitlog segments that are older
+// than the ones the backup replays, unless another backup of the cluster
+// replays them
+func (r *backupRequestHandler) deleteExpiredCommitLogs(ctx context.Context) error {
+	backups, err := listClusterBackups(ctx, r, r.cluster)
+	if err != nil {
+		return err
+	}
+	for i := range backups {
+		// The listed backup may not have the status that has just been patched
+		if backups[i].Name == r.backup.Name {
+			backups[i] = *r.backup
+		}
+	}
+
+	store, err := newObjectStore(ctx, r, r.cluster)
+	if err != nil {
+		return err
+	}
+	return deleteUnreplayableCommitLogs(ctx, store, r.cluster, backups)
+}
+
+// listClusterBackups returns the backups of the cluster, whether scheduled or not
+func listClusterBackups(ctx context.Context, c client.Reader, cluster *api.CassandraCluster) ([]api.CassandraBackup, error) {
+	backups := &api.CassandraBackupList{}
+	if err := c.List(ctx, backups, client.InNamespace(cluster.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var clusterBackups []api.CassandraBackup
+	for _, b := range backups.Items {
+		if b.Spec.ClusterRef.Name == cluster.Name {
+			clusterBackups = append(clusterBackups, b)
+		}
+	}
+	return clusterBackups, nil
+}
+
+// deleteUnreplayableCommitLogs deletes the archived commitlog segments of the
+// cluster that none of backups, which are the remaining backups of the cluster,
+// replays on a restore. Each node of a completed backup replays the segments
+// from the one recorded when its snapshot was taken. Nothing is deleted while
+// any of the backups has not finished, since its segments may not be recorded
+// yet.
+func deleteUnreplayableCommitLogs(ctx context.Context, store backup.ObjectStore, cluster *api.CassandraCluster, backups []api.CassandraBackup) error {
+	oldest := make(map[string]int64)
+	for _, b := range backups {
+		if !b.IsFinished() {
+			return nil
+		}
+		if b.Status.Phase != api.BackupPhaseCompleted {
+			continue
+		}
+		for _, node := range b.Status.Nodes {
+			if node.Phase != api.NodeBackupPhaseCompleted {
+				continue
+			}
+			if id, found := oldest[node.Pod]; !found || node.CommitLogSegmentID < id {
+				oldest[node.Pod] = node.CommitLogSegmentID
+			}
+		}
+	}
+
+	return backup.DeleteCommitLogs(ctx, store, cluster.Spec.Backup.Storage.Prefix, cluster.Name, oldest)
+}
+
+func (r *backupRequestHandler) newUploadRequest(node *api.NodeBackupStatus, tokens []string) backup.UploadRequest {
+	storagePrefix := r.cluster.Spec.Backup.Storage.Prefix
+	request := backup.UploadRequest{
+		Snapshot: r.backup.Status.SnapshotName,
+		Prefix:   backup.NodePrefix(storagePrefix, r.cluster.Name, r.backup.Name, node.Pod),
+		Manifest: backup.Manifest{
+			Backup:     r.backup.Name,
+			Cluster:    r.cluster.Name,
+			Datacenter: node.Datacenter,
+			Rack:       node.Rack,
+			Pod:        node.Pod,
+			Tokens:     tokens,
+		},
+	}
+	if r.cluster.IsIncrementalBackupsEnabled() {
+		request.SharedPrefix = backup.SharedPrefix(storagePrefix, r.cluster.Name, node.Pod)
+	}
+	if r.backup.Spec.Incremental {
+		request.Incremental = true
+		request.Keyspaces = r.backup.Spec.Keyspaces
+	}
+	if r.cluster.IsCommitLogArchivingEnabled() {
+		request.Manifest.CommitLogPrefix = backup.CommitLogPrefix(storagePrefix, r.cluster.Name, node.Pod)
+		request.Manifest.CommitLogSegmentID = node.CommitLogSegmentID
+		if r.backup.Status.StartTime != nil {
+			request.Manifest.StartTime = r.backup.Status.StartTime.Time
+		}
+	}
+	return request
+}
+
+// findBaseBackup returns the most recent completed backup of the cluster, or
+// nil if there is none. Incremental backups carry over the files of the backups
+// they build on, so any completed backup can be the base.
+func (r *backupRequestHandler) findBaseBackup(ctx context.Context) (*api.CassandraBackup, error) {
+	backups := &api.CassandraBackupList{}
+	if err := r.List(ctx, backups, client.InNamespace(r.backup.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var base *api.CassandraBackup
+	for i := range backups.Items {
+		b := &backups.Items[i]
+		if b.Spec.ClusterRef.Name != r.cluster.Name || b.Status.Phase != api.BackupPhaseCompleted || b.Status.StartTime == nil {
+			continue
+		}
+		if base == nil || b.Status.StartTime.After(base.Status.StartTime.Time) {
+			base = b
+		}
+	}
+	return base, nil
+}
+
+// getTokenRing returns the tokens of the nodes by broadcast address. They are
+// stored in the manifests so that a new cluster can be restored with the same
+// token assignment.
+func (r *backupRequestHandler) getTokenRing(ctx context.Context) (map[string][]string, error) {
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return session.TokenRing()
+}
+
+// newObjectStore returns the object storage the backups of the cluster are
+// uploaded to, using the credentials from the storage secret
+func newObjectStore(ctx context.Context, c client.Client, cluster *api.CassandraCluster) (backup.ObjectStore, error) {
+	storage := cluster.Spec.Backup.Storage
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: storage.CredentialsSecretName}, secret); err != nil {
+		return nil, err
+	}
+
+	return backup.NewS3Store(backup.StorageConfig{
+		Endpoint:        storage.Endpoint,
+		Region:          storage.Region,
+		Bucket:          storage.Bucket,
+		AccessKeyID:     string(secret.Data[api.StorageAccessKeyIDKey]),
+		SecretAccessKey: string(secret.Data[api.StorageSecretAccessKeyKey]),
+		Insecure:        storage.Insecure,
+	})
+}
+
+func findNodeBackup(nodes []api.NodeBackupStatus, pod string) *api.NodeBackupStatus {
+	for i := range nodes {
+		if nodes[i].Pod == pod {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+// updateStatus applies mutate to the status and patches it if it has changed
+func (r *backupRequestHandler) updateStatus(ctx context.Context, mutate func(status *api.CassandraBackupStatus)) error {
+	return r.patchStatus(ctx, func() { mutate(&r.backup.Status) })
+}
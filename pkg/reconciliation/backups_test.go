@@ -0,0 +1,181 @@
+package reconciliation
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/backup"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// newTestHTTPClient returns a client that sends all requests to server,
+// whatever the address of the pod they are meant for
+func newTestHTTPClient(server *httptest.Server) *http.Client {
+	addr := server.Listener.Addr().String()
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		Timeout: 5 * time.Second,
+	}
+}
+
+func newTestScheme(g *WithT) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(api.AddToScheme(scheme)).To(Succeed())
+	return scheme
+}
+
+func newTestCluster() *api.CassandraCluster {
+	return &api.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: api.CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []api.Datacenter{{Name: "dc1"}},
+			Backup: &api.BackupSpec{
+				Storage: api.StorageSpec{Bucket: "backups", CredentialsSecretName: "storage"},
+			},
+		},
+	}
+}
+
+func TestCheckCancelWaitsForUploads(t *testing.T) {
+	g := NewGomegaWithT(t)
+	scheme := newTestScheme(g)
+	cluster := newTestCluster()
+
+	cancelRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Method).To(Equal(http.MethodDelete))
+		g.Expect(r.URL.Path).To(Equal("/api/v1/uploads/b1"))
+		cancelRequests++
+		status := backup.TransferStatusRunning
+		if cancelRequests > 1 {
+			status = backup.TransferStatusFailed
+		}
+		json.NewEncoder(w).Encode(backup.Upload{Backup: "b1", Status: status})
+	}))
+	defer server.Close()
+
+	b := &api.CassandraBackup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b1"},
+		Spec: api.CassandraBackupSpec{
+			ClusterRef:  corev1.LocalObjectReference{Name: "test"},
+			Incremental: true,
+			Cancel:      true,
+		},
+		Status: api.CassandraBackupStatus{
+			Phase: api.BackupPhaseUploading,
+			Nodes: []api.NodeBackupStatus{
+				{Pod: "test-dc1-rack-1-sts-0", Phase: api.NodeBackupPhaseUploading},
+				{Pod: "test-dc1-rack-1-sts-1", Phase: api.NodeBackupPhaseCompleted},
+			},
+		},
+	}
+
+	objects := []runtime.Object{cluster.DeepCopy(), b.DeepCopy()}
+	for _, name := range []string{"test-dc1-rack-1-sts-0", "test-dc1-rack-1-sts-1"} {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: cluster.GetRackLabels("dc1", "rack-1")},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.1"},
+		})
+	}
+
+	r := &backupRequestHandler{
+		clusterRefHandler: clusterRefHandler{
+			Client:  fake.NewFakeClientWithScheme(scheme, objects...),
+			scheme:  scheme,
+			log:     log.Log,
+			cluster: cluster,
+		},
+		backupClient: backup.NewClientWithHTTPClient(newTestHTTPClient(server)),
+		backup:       b,
+	}
+	r.setObject(b, func(err string) { b.Status.Error = err })
+	ctx := context.Background()
+
+	// The backup keeps running while an upload has not stopped
+	g.Expect(r.CheckCancel(ctx)).To(Equal(result.RequeueSoon(5)))
+	g.Expect(r.backup.IsFinished()).To(BeFalse())
+
+	g.Expect(r.CheckCancel(ctx)).To(Equal(result.Done()))
+	g.Expect(cancelRequests).To(Equal(2))
+
+	actual := &api.CassandraBackup{}
+	g.Expect(r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "b1"}, actual)).To(Succeed())
+	g.Expect(actual.Status.Phase).To(Equal(api.BackupPhaseFailed))
+	g.Expect(actual.Status.Nodes[0].Phase).To(Equal(api.NodeBackupPhaseFailed))
+	g.Expect(actual.Status.Nodes[1].Phase).To(Equal(api.NodeBackupPhaseCompleted))
+}
+
+func TestReplaceConcurrentCancelsRunningBackups(t *testing.T) {
+	g := NewGomegaWithT(t)
+	scheme := newTestScheme(g)
+	cluster := newTestCluster()
+
+	created := metav1.NewTime(time.Now().Add(-3 * time.Hour))
+	schedule := &api.CassandraBackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "daily", CreationTimestamp: created},
+		Spec: api.CassandraBackupScheduleSpec{
+			ClusterRef:        corev1.LocalObjectReference{Name: "test"},
+			Schedule:          "0 * * * *",
+			ConcurrencyPolicy: api.ReplaceConcurrent,
+		},
+	}
+	running := &api.CassandraBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "daily-1",
+			Labels:            map[string]string{api.BackupScheduleLabel: "daily"},
+			CreationTimestamp: created,
+		},
+		Spec:   api.CassandraBackupSpec{ClusterRef: corev1.LocalObjectReference{Name: "test"}},
+		Status: api.CassandraBackupStatus{Phase: api.BackupPhaseUploading},
+	}
+
+	r := &backupScheduleRequestHandler{
+		clusterRefHandler: clusterRefHandler{
+			Client:  fake.NewFakeClientWithScheme(scheme, cluster.DeepCopy(), schedule.DeepCopy(), running.DeepCopy()),
+			scheme:  scheme,
+			log:     log.Log,
+			cluster: cluster,
+		},
+		schedule: schedule,
+	}
+	r.setObject(schedule, func(err string) { schedule.Status.Error = err })
+	ctx := context.Background()
+
+	g.Expect(r.CheckBackups(ctx).Completed()).To(BeFalse())
+	g.Expect(r.CheckRetention(ctx).Completed()).To(BeFalse())
+	g.Expect(r.CheckSchedule(ctx).Completed()).To(BeTrue())
+
+	backups := &api.CassandraBackupList{}
+	g.Expect(r.List(ctx, backups, client.InNamespace("default"))).To(Succeed())
+	g.Expect(backups.Items).To(HaveLen(2))
+
+	// The running backup is canceled rather than deleted, which is left to
+	// CheckRetention once it has stopped
+	actual := &api.CassandraBackup{}
+	g.Expect(r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "daily-1"}, actual)).To(Succeed())
+	g.Expect(actual.Spec.Cancel).To(BeTrue())
+}
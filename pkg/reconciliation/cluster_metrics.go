@@ -0,0 +1,89 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recordClusterMetrics updates the node and operation gauges of the cluster at
+// the end of the reconciliation. The series of a cluster are removed once its
+// finalizer has been removed.
+func (r *requestHandler) recordClusterMetrics(ctx context.Context) {
+	if !r.cluster.DeletionTimestamp.IsZero() && !containsString(r.cluster.Finalizers, api.ClusterFinalizer) {
+		var dcNames []string
+		for _, dc := range r.cluster.Spec.Datacenters {
+			dcNames = append(dcNames, dc.Name)
+		}
+		for dcName := range r.cluster.Status.Datacenters {
+			dcNames = append(dcNames, dcName)
+		}
+		metrics.ForgetCluster(r.cluster.Namespace, r.cluster.Name, dcNames)
+		return
+	}
+
+	operations := make(map[string]int)
+	for i := range r.cluster.Spec.Datacenters {
+		dc := &r.cluster.Spec.Datacenters[i]
+		pods, err := r.listDatacenterPods(ctx, dc.Name)
+		if err != nil {
+			r.log.Error(err, "failed to list pods for metrics", "Datacenter", dc.Name)
+			return
+		}
+
+		states := countNodeStates(pods, dc.GetSize())
+		for _, state := range metrics.NodeStates {
+			metrics.Nodes.WithLabelValues(r.cluster.Namespace, r.cluster.Name, dc.Name, state).Set(float64(states[state]))
+		}
+		if int32(len(pods)) != dc.GetSize() {
+			operations[metrics.OperationScaling]++
+		}
+	}
+
+	for dcName, dcStatus := range r.cluster.Status.Datacenters {
+		if dcStatus.RollingRestart {
+			operations[metrics.OperationRollingRestart]++
+		}
+		if dcStatus.Rebuild != nil && dcStatus.Rebuild.Phase != api.RebuildPhaseCompleted {
+			operations[metrics.OperationRebuild]++
+		}
+		if dcStatus.Decommission != nil {
+			operations[metrics.OperationDecommission]++
+			// The datacenter is no longer in the spec, so its nodes are not counted
+			for _, state := range metrics.NodeStates {
+				metrics.Nodes.DeleteLabelValues(r.cluster.Namespace, r.cluster.Name, dcName, state)
+			}
+		}
+	}
+	for _, replacement := range r.cluster.Status.NodeReplacements {
+		if replacement.Phase == api.ReplacementPhasePending || replacement.Phase == api.ReplacementPhaseRunning {
+			operations[metrics.OperationNodeReplacement]++
+		}
+	}
+
+	for _, operation := range metrics.Operations {
+		metrics.OperationsInProgress.WithLabelValues(r.cluster.Namespace, r.cluster.Name, operation).Set(float64(operations[operation]))
+	}
+}
+
+// countNodeStates returns the number of nodes of a datacenter of the given size
+// in each state
+func countNodeStates(pods []corev1.Pod, size int32) map[string]int {
+	states := make(map[string]int)
+	for i := range pods {
+		pod := &pods[i]
+		switch {
+		case isPodReady(pod):
+			states[metrics.NodeStateReady]++
+		case pod.Status.Phase == corev1.PodPending:
+			states[metrics.NodeStatePending]++
+		default:
+			states[metrics.NodeStateNotReady]++
+		}
+	}
+	if missing := int(size) - len(pods); missing > 0 {
+		states[metrics.NodeStateMissing] = missing
+	}
+	return states
+}
@@ -0,0 +1,125 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/backup"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// clusterRefObject is a resource that references a CassandraCluster, e.g. a
+// CassandraRepair
+type clusterRefObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+// clusterRefHandler is embedded by the request handlers of the resources that
+// reference a CassandraCluster. It looks up the cluster and records errors in
+// the status of the resource.
+type clusterRefHandler struct {
+	request *reconcile.Request
+	client.Client
+	scheme  *runtime.Scheme
+	log     logr.Logger
+	cluster *api.CassandraCluster
+
+	// object is the resource that is reconciled, and setError records an error
+	// in its status. Both are set once the resource has been read.
+	object   clusterRefObject
+	setError func(err string)
+}
+
+// setObject sets the resource that is reconciled and the function that records
+// an error in its status
+func (h *clusterRefHandler) setObject(object clusterRefObject, setError func(err string)) {
+	h.object = object
+	h.setError = setError
+}
+
+func (h *clusterRefHandler) Get(ctx context.Context, key types.NamespacedName, obj runtime.Object) error {
+	requestCtx, cancel := context.WithTimeout(ctx, k8sRequestTimeout)
+	defer cancel()
+	return h.Client.Get(requestCtx, key, obj)
+}
+
+// getCluster returns the cluster that ref references, or nil if it does not
+// exist
+func (h *clusterRefHandler) getCluster(ctx context.Context, ref corev1.LocalObjectReference) (*api.CassandraCluster, error) {
+	cluster := &api.CassandraCluster{}
+	err := h.Get(ctx, types.NamespacedName{Namespace: h.object.GetNamespace(), Name: ref.Name}, cluster)
+	if err != nil && errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return cluster, err
+}
+
+// checkCluster looks up the cluster that ref references. A cluster that does
+// not exist is recorded as the error of the resource.
+func (h *clusterRefHandler) checkCluster(ctx context.Context, ref corev1.LocalObjectReference) result.ReconcileResult {
+	cluster, err := h.getCluster(ctx, ref)
+	if err != nil {
+		h.log.Error(err, "failed to get cluster", "CassandraCluster", ref.Name)
+		return result.Error(err)
+	}
+	if cluster == nil {
+		h.log.Info("waiting for cluster", "CassandraCluster", ref.Name)
+		return h.failed(ctx, fmt.Errorf("CassandraCluster %s not found", ref.Name))
+	}
+	h.cluster = cluster
+	return result.Continue()
+}
+
+// configureMgmtClient has mgmtClient present the client certificate that the
+// management API of the nodes of the cluster requires
+func (h *clusterRefHandler) configureMgmtClient(ctx context.Context, mgmtClient *mgmtapi.Client) result.ReconcileResult {
+	tlsConfig, err := getMgmtAPITLSConfig(ctx, h, h.cluster)
+	if err != nil {
+		h.log.Error(err, "failed to load management API certificates", "CassandraCluster", h.cluster.Name)
+		return result.Error(err)
+	}
+	mgmtClient.SetTLSConfig(tlsConfig)
+	return result.Continue()
+}
+
+// configureBackupClient has backupClient present the token that the backup
+// agents of the cluster require
+func (h *clusterRefHandler) configureBackupClient(ctx context.Context, backupClient *backup.Client) result.ReconcileResult {
+	token, err := getBackupAgentToken(ctx, h, h.cluster)
+	if err != nil {
+		h.log.Error(err, "failed to get backup agent token", "CassandraCluster", h.cluster.Name)
+		return result.Error(err)
+	}
+	backupClient.SetToken(token)
+	return result.Continue()
+}
+
+// failed records err in the status and requeues the request
+func (h *clusterRefHandler) failed(ctx context.Context, err error) result.ReconcileResult {
+	if statusErr := h.patchStatus(ctx, func() { h.setError(err.Error()) }); statusErr != nil {
+		h.log.Error(statusErr, "failed to update status")
+	}
+	return result.RequeueSoon(30)
+}
+
+// patchStatus applies mutate, which may only change the status of the
+// resource, and patches the status if it has changed
+func (h *clusterRefHandler) patchStatus(ctx context.Context, mutate func()) error {
+	original := h.object.DeepCopyObject()
+	mutate()
+	if equality.Semantic.DeepEqual(original, h.object) {
+		return nil
+	}
+	return h.Status().Patch(ctx, h.object, client.MergeFrom(original))
+}
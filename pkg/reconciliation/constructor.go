@@ -1,12 +1,41 @@
 package reconciliation
 
 import (
+	"fmt"
 	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/backup"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"path"
+	"strconv"
+	"strings"
 )
 
+const (
+	cqlPortName        = "native"
+	storagePortName    = "internode"
+	sslStoragePortName = "tls-internode"
+	cqlSSLPortName     = "tls-native"
+	jmxPortName        = "jmx"
+	mgmtAPIPortName    = "mgmt-api"
+	backupPortName     = "backup-agent"
+	metricsPortName    = "metrics"
+)
+
+// serverLogsDir is the directory Cassandra writes its logs to
+const serverLogsDir = "/var/log/cassandra"
+
+// jmxCredentialsDir holds the JMX password and access files when remote JMX is
+// enabled
+const jmxCredentialsDir = "/etc/cassandra-jmx"
+
+// mgmtAPITLSDir holds the certificates of the management API. The entrypoint of
+// the cassandra image only listens on the pod IP when they are present.
+const mgmtAPITLSDir = "/etc/mgmt-api-tls"
+
 // Source: http://github.com/datastax/cass-operator/blob/master/operator/pkg/reconciliation/constructor.go#L539-L539
-func buildServerConfigInitContainer(cluster *api.CassandraCluster) (*corev1.Container, error) {
+func buildServerConfigInitContainer(cluster *api.CassandraCluster, dc *api.Datacenter, rack *api.Rack) (*corev1.Container, error) {
 	serverCfg := corev1.Container{}
 	serverCfg.Name = "server-config-init"
 	serverCfg.Image = cluster.GetConfigBuilderImage()
@@ -16,13 +45,12 @@ func buildServerConfigInitContainer(cluster *api.CassandraCluster) (*corev1.Cont
 	}
 	serverCfg.VolumeMounts = []corev1.VolumeMount{serverCfgMount}
 
-	useHostIpForBroadcast := "false"
+	useHostIpForBroadcast := strconv.FormatBool(cluster.Spec.Networking.UseHostIPForBroadcast)
 
-	rackName := "rack1"
 	serverVersion := "3.11.6"
 	serverType := "cassandra"
 
-	configData, err := cluster.GetConfigAsJSON()
+	configData, err := cluster.GetConfigAsJSON(dc, rack)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +59,7 @@ func buildServerConfigInitContainer(cluster *api.CassandraCluster) (*corev1.Cont
 		{Name: "POD_IP", ValueFrom: selectorFromFieldPath("status.podIP")},
 		{Name: "HOST_IP", ValueFrom: selectorFromFieldPath("status.hostIP")},
 		{Name: "USE_HOST_IP_FOR_BROADCAST", Value: useHostIpForBroadcast},
-		{Name: "RACK_NAME", Value: rackName},
+		{Name: "RACK_NAME", Value: rack.Name},
 		{Name: "PRODUCT_VERSION", Value: serverVersion},
 		{Name: "PRODUCT_NAME", Value: serverType},
 		// TODO remove this post 1.0
@@ -41,6 +69,359 @@ func buildServerConfigInitContainer(cluster *api.CassandraCluster) (*corev1.Cont
 	return &serverCfg, nil
 }
 
+// broadcastAddressScript waits for the operator to annotate the pod with the
+// address of its per-pod service and writes it to cassandra.yaml.
+const broadcastAddressScript = `
+for i in $(seq 1 60); do
+  address=$(grep "^` + api.BroadcastRPCAddressAnnotation + `=" /pod-info/annotations | cut -d= -f2 | tr -d '"')
+  if [ -n "$address" ]; then
+    if grep -q "^broadcast_rpc_address:" /config/cassandra.yaml; then
+      sed -i "s/^broadcast_rpc_address:.*/broadcast_rpc_address: $address/" /config/cassandra.yaml
+    else
+      echo "broadcast_rpc_address: $address" >> /config/cassandra.yaml
+    fi
+    exit 0
+  fi
+  sleep 5
+done
+echo "timed out waiting for the broadcast_rpc_address annotation"
+exit 1
+`
+
+// buildBroadcastAddressInitContainer returns an init container that sets
+// broadcast_rpc_address to the external address of the per-pod service. It has
+// to run after the server-config-init container has generated cassandra.yaml.
+func buildBroadcastAddressInitContainer(cluster *api.CassandraCluster) *corev1.Container {
+	container := corev1.Container{}
+	container.Name = "broadcast-address-init"
+	container.Image = cluster.GetCassandraImage()
+	container.Command = []string{"/bin/bash", "-c", broadcastAddressScript}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "server-config", MountPath: "/config"},
+		{Name: "pod-info", MountPath: "/pod-info"},
+	}
+
+	return &container
+}
+
+// replaceAddressScript adds replace_address_first_boot to the JVM options when
+// the operator has published the address of the node the pod replaces.
+const replaceAddressScript = `
+if [ -f "/replace-addresses/$POD_NAME" ]; then
+  echo "-Dcassandra.replace_address_first_boot=$(cat /replace-addresses/$POD_NAME)" >> /config/jvm.options
+fi
+`
+
+// buildReplaceAddressInitContainer returns an init container that makes the
+// node replace a dead node when the pod is listed in Spec.ReplaceNodes. The
+// address is read from a config map rather than the pod template so that only
+// the replaced pod is affected. It has to run after the server-config-init
+// container has generated jvm.options.
+func buildReplaceAddressInitContainer(cluster *api.CassandraCluster) *corev1.Container {
+	container := corev1.Container{}
+	container.Name = "replace-address-init"
+	container.Image = cluster.GetCassandraImage()
+	container.Command = []string{"/bin/bash", "-c", replaceAddressScript}
+	container.Env = []corev1.EnvVar{
+		{Name: "POD_NAME", ValueFrom: selectorFromFieldPath("metadata.name")},
+	}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "server-config", MountPath: "/config"},
+		{Name: "replace-addresses", MountPath: "/replace-addresses", ReadOnly: true},
+	}
+
+	return &container
+}
+
+// logbackScript returns a script that sets the levels of the loggers in the
+// logback.xml generated by the server-config-init container. Loggers that are
+// already declared are removed first so that each logger is declared once. A
+// declaration that is not self-closing is removed up to its closing tag.
+func logbackScript(loggers []api.LoggerSpec) string {
+	escape := strings.NewReplacer(".", `\.`, "$", `\$`)
+	script := "set -e\n"
+	for _, logger := range loggers {
+		if logger.Name == api.RootLogger {
+			script += fmt.Sprintf("sed -i 's#<root level=\"[A-Z]*\">#<root level=\"%s\">#' /config/logback.xml\n", logger.Level)
+			continue
+		}
+		tag := fmt.Sprintf(`<logger name="%s"`, escape.Replace(logger.Name))
+		script += fmt.Sprintf("sed -i '/%s[ \\t/>]/{/%s[^>]*\\/>/d;/<\\/logger>/d;:a;N;/<\\/logger>/!ba;d}' /config/logback.xml\n",
+			tag, tag)
+		script += fmt.Sprintf("sed -i 's#</configuration>#  <logger name=\"%s\" level=\"%s\"/>\\n</configuration>#' /config/logback.xml\n",
+			logger.Name, logger.Level)
+	}
+	return script
+}
+
+// buildLogbackInitContainer returns an init container that applies the logger
+// levels of Spec.Logging to logback.xml. It has to run after the
+// server-config-init container has generated logback.xml.
+func buildLogbackInitContainer(cluster *api.CassandraCluster) *corev1.Container {
+	container := corev1.Container{}
+	container.Name = "logback-init"
+	container.Image = cluster.GetCassandraImage()
+	container.Command = []string{"/bin/bash", "-c", logbackScript(cluster.GetLoggers())}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "server-config", MountPath: "/config"},
+	}
+
+	return &container
+}
+
+// buildLogTailerContainer returns the sidecar that tails system.log to its
+// stdout. It follows the file by name so that it keeps up with log rotation and
+// waits for the file to be created when Cassandra starts.
+func buildLogTailerContainer(cluster *api.CassandraCluster) corev1.Container {
+	container := corev1.Container{}
+	container.Name = "system-log"
+	container.Image = cluster.GetLogTailerImage()
+	container.Command = []string{"tail", "-n+1", "-F", path.Join(serverLogsDir, "system.log")}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "server-logs", MountPath: serverLogsDir, ReadOnly: true},
+	}
+	container.Resources = cluster.Spec.Logging.Tailer.Resources
+
+	return container
+}
+
+// buildBackupAgentContainer returns the sidecar that uploads snapshots from the
+// data volume to the object storage configured in Spec.Backup.
+func buildBackupAgentContainer(cluster *api.CassandraCluster) corev1.Container {
+	container := corev1.Container{}
+	container.Name = "backup-agent"
+	container.Image = cluster.GetBackupAgentImage()
+	container.Args = []string{"--data-dir", "/var/lib/cassandra/data"}
+	container.Env = append(createStorageEnvVars(cluster), corev1.EnvVar{
+		Name:      backup.TokenEnvVar,
+		ValueFrom: selectorFromSecretKey(cluster.GetBackupAgentSecretName(), backupAgentTokenKey),
+	})
+	if cluster.IsCommitLogArchivingEnabled() {
+		// The prefix is expanded from the POD_NAME variable by the kubelet
+		prefix := path.Join(cluster.Spec.Backup.Storage.Prefix, cluster.Name, ".commitlogs", "$(POD_NAME)")
+		container.Args = append(container.Args, "--commitlog-dir", backup.CommitLogArchiveDir, "--commitlog-prefix", prefix)
+		container.Env = append(container.Env, corev1.EnvVar{Name: "POD_NAME", ValueFrom: selectorFromFieldPath("metadata.name")})
+	}
+	container.Ports = []corev1.ContainerPort{
+		{Name: backupPortName, ContainerPort: backup.DefaultAgentPort, Protocol: corev1.ProtocolTCP},
+	}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: pvcName, MountPath: "/var/lib/cassandra"},
+	}
+	container.Resources = cluster.Spec.Backup.AgentResources
+
+	return container
+}
+
+// buildMetricsExporterContainer returns the sidecar that reads the metrics of the
+// node over JMX and serves them to Prometheus. It shares the network namespace
+// of the cassandra container, so it reaches JMX on localhost. Remote JMX
+// requires authentication for local connections too, so the exporter gets the
+// JMX credentials when it is enabled.
+func buildMetricsExporterContainer(cluster *api.CassandraCluster) corev1.Container {
+	container := corev1.Container{}
+	container.Name = "metrics-exporter"
+	container.Image = cluster.GetMetricsExporterImage()
+	container.Env = []corev1.EnvVar{
+		{Name: "CASSANDRA_EXPORTER_CONFIG_host", Value: fmt.Sprintf("localhost:%d", cluster.GetJMXPort())},
+		{Name: "CASSANDRA_EXPORTER_CONFIG_listenPort", Value: strconv.Itoa(int(cluster.GetMetricsPort()))},
+	}
+	if cluster.Spec.Reaper != nil {
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "CASSANDRA_EXPORTER_CONFIG_user", ValueFrom: selectorFromSecretKey(cluster.GetJMXSecretName(), credentialsUsernameKey)},
+			corev1.EnvVar{Name: "CASSANDRA_EXPORTER_CONFIG_password", ValueFrom: selectorFromSecretKey(cluster.GetJMXSecretName(), credentialsPasswordKey)},
+		)
+	}
+	container.Ports = []corev1.ContainerPort{
+		{Name: metricsPortName, ContainerPort: cluster.GetMetricsPort(), Protocol: corev1.ProtocolTCP},
+	}
+	container.Resources = cluster.Spec.Metrics.ExporterResources
+
+	return container
+}
+
+// buildCommitLogArchivingInitContainer returns an init container that writes
+// commitlog_archiving.properties, which makes Cassandra link each commitlog
+// segment it is done with into the archive directory on the data volume. The
+// backup agent ships the segments from there to the object storage. It has to
+// run before the restore-init container, which adds the restore options.
+func buildCommitLogArchivingInitContainer(cluster *api.CassandraCluster) *corev1.Container {
+	script := fmt.Sprintf("set -e\nmkdir -p %s\ncat > /config/commitlog_archiving.properties <<'EOF'\n%s\nEOF\n",
+		backup.CommitLogArchiveDir, strings.Join(backup.CommitLogArchivingProperties(), "\n"))
+
+	container := corev1.Container{}
+	container.Name = "commitlog-archiving-init"
+	container.Image = cluster.GetCassandraImage()
+	container.Command = []string{"/bin/bash", "-c", script}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "server-config", MountPath: "/config"},
+		{Name: pvcName, MountPath: "/var/lib/cassandra"},
+	}
+
+	return &container
+}
+
+// buildRestoreInitContainer returns an init container that restores the data and
+// tokens of a backed up node when the cluster is restored from a backup. The
+// restore publishes the manifest of the node each pod is restored from in a
+// config map. Pods that replace a dead node are skipped. It has to run after
+// the server-config-init container has generated jvm.options.
+func buildRestoreInitContainer(cluster *api.CassandraCluster) *corev1.Container {
+	container := corev1.Container{}
+	container.Name = "restore-init"
+	container.Image = cluster.GetBackupAgentImage()
+	container.Args = []string{"restore", "--data-dir", "/var/lib/cassandra/data", "--manifests-dir", "/restore-nodes", "--jvm-options", "/config/jvm.options",
+		"--replace-addresses-dir", "/replace-addresses"}
+	container.Env = append(createStorageEnvVars(cluster), corev1.EnvVar{Name: "POD_NAME", ValueFrom: selectorFromFieldPath("metadata.name")})
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "server-config", MountPath: "/config"},
+		{Name: pvcName, MountPath: "/var/lib/cassandra"},
+		{Name: "restore-nodes", MountPath: "/restore-nodes", ReadOnly: true},
+		{Name: "replace-addresses", MountPath: "/replace-addresses", ReadOnly: true},
+	}
+
+	return &container
+}
+
+// createStorageEnvVars returns the environment variables that configure the
+// object storage of the backup agent
+func createStorageEnvVars(cluster *api.CassandraCluster) []corev1.EnvVar {
+	storage := cluster.Spec.Backup.Storage
+	return []corev1.EnvVar{
+		{Name: backup.StorageEndpointEnvVar, Value: storage.Endpoint},
+		{Name: backup.StorageRegionEnvVar, Value: storage.Region},
+		{Name: backup.StorageBucketEnvVar, Value: storage.Bucket},
+		{Name: backup.StorageInsecureEnvVar, Value: strconv.FormatBool(storage.Insecure)},
+		{Name: backup.StorageAccessKeyIDEnvVar, ValueFrom: selectorFromSecretKey(storage.CredentialsSecretName, api.StorageAccessKeyIDKey)},
+		{Name: backup.StorageSecretAccessKeyEnvVar, ValueFrom: selectorFromSecretKey(storage.CredentialsSecretName, api.StorageSecretAccessKeyKey)},
+	}
+}
+
+// keystoreCommands converts the PEM encoded certificate, key and CA in tlsDir
+// into the JKS keystore and truststore Cassandra expects.
+func keystoreCommands(tlsDir, keystoreDir string) string {
+	return fmt.Sprintf(`
+openssl pkcs12 -export -in %[1]s/tls.crt -inkey %[1]s/tls.key -name cassandra \
+  -out /tmp/keystore.p12 -passout env:KEYSTORE_PASSWORD
+mkdir -p %[2]s
+rm -f %[2]s/keystore.jks %[2]s/truststore.jks /tmp/keystore.p12
+keytool -importkeystore -noprompt -srckeystore /tmp/keystore.p12 -srcstoretype PKCS12 -srcstorepass "$KEYSTORE_PASSWORD" \
+  -destkeystore %[2]s/keystore.jks -deststoretype JKS -deststorepass "$KEYSTORE_PASSWORD"
+keytool -importcert -noprompt -alias ca -file %[1]s/ca.crt \
+  -keystore %[2]s/truststore.jks -storetype JKS -storepass "$KEYSTORE_PASSWORD"
+`, tlsDir, keystoreDir)
+}
+
+// buildKeystoreInitContainer returns an init container that builds the keystores
+// and truststores for internode and client encryption, and substitutes the
+// keystore password into cassandra.yaml. It has to run after the
+// server-config-init container has generated cassandra.yaml.
+func buildKeystoreInitContainer(cluster *api.CassandraCluster) *corev1.Container {
+	container := corev1.Container{}
+	container.Name = "keystore-init"
+	container.Image = cluster.GetCassandraImage()
+	container.Env = []corev1.EnvVar{
+		{
+			Name: "KEYSTORE_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: cluster.GetKeystorePasswordSecretName()},
+					Key:                  keystorePasswordKey,
+				},
+			},
+		},
+	}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "server-config", MountPath: "/config"},
+		{Name: "keystores", MountPath: "/keystores"},
+	}
+
+	script := "set -e\n"
+	if cluster.IsInternodeEncryptionEnabled() {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "internode-tls", MountPath: "/tls/internode", ReadOnly: true})
+		script += keystoreCommands("/tls/internode", api.InternodeKeystoreDir)
+	}
+	if cluster.IsClientEncryptionEnabled() {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "client-tls", MountPath: "/tls/client", ReadOnly: true})
+		script += keystoreCommands("/tls/client", api.ClientKeystoreDir)
+	}
+	script += fmt.Sprintf(`sed -i "s/%s/$KEYSTORE_PASSWORD/g" /config/cassandra.yaml`, api.KeystorePasswordPlaceholder)
+	container.Command = []string{"/bin/bash", "-c", script}
+
+	return &container
+}
+
+// buildJMXCredentialsInitContainer returns an init container that writes the
+// JMX password and access files from the JMX secret. The JVM only accepts a
+// password file that can be read by its owner alone, which a secret volume
+// cannot provide, so the files are written to an emptyDir instead.
+func buildJMXCredentialsInitContainer(cluster *api.CassandraCluster) *corev1.Container {
+	script := fmt.Sprintf(`set -e
+echo "$JMX_USERNAME $JMX_PASSWORD" > %[1]s/jmxremote.password
+echo "$JMX_USERNAME readwrite" > %[1]s/jmxremote.access
+if [ "$(id -u)" = "0" ]; then
+  chown cassandra:cassandra %[1]s/jmxremote.password %[1]s/jmxremote.access
+fi
+chmod 400 %[1]s/jmxremote.password
+`, jmxCredentialsDir)
+
+	container := corev1.Container{}
+	container.Name = "jmx-credentials-init"
+	container.Image = cluster.GetCassandraImage()
+	container.Env = []corev1.EnvVar{
+		{Name: "JMX_USERNAME", ValueFrom: selectorFromSecretKey(cluster.GetJMXSecretName(), credentialsUsernameKey)},
+		{Name: "JMX_PASSWORD", ValueFrom: selectorFromSecretKey(cluster.GetJMXSecretName(), credentialsPasswordKey)},
+	}
+	container.Command = []string{"/bin/bash", "-c", script}
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: "jmx-credentials", MountPath: jmxCredentialsDir},
+	}
+
+	return &container
+}
+
+func createJMXCredentialsVolume() corev1.Volume {
+	volume := corev1.Volume{}
+	volume.Name = "jmx-credentials"
+	volume.VolumeSource = corev1.VolumeSource{
+		EmptyDir: &corev1.EmptyDirVolumeSource{},
+	}
+	return volume
+}
+
+func createKeystoreVolumes(cluster *api.CassandraCluster) []corev1.Volume {
+	keystores := corev1.Volume{}
+	keystores.Name = "keystores"
+	keystores.VolumeSource = corev1.VolumeSource{
+		EmptyDir: &corev1.EmptyDirVolumeSource{},
+	}
+	volumes := []corev1.Volume{keystores}
+
+	if cluster.IsInternodeEncryptionEnabled() {
+		internodeTLS := corev1.Volume{}
+		internodeTLS.Name = "internode-tls"
+		internodeTLS.VolumeSource = corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: cluster.GetInternodeSecretName(),
+			},
+		}
+		volumes = append(volumes, internodeTLS)
+	}
+
+	if cluster.IsClientEncryptionEnabled() {
+		clientTLS := corev1.Volume{}
+		clientTLS.Name = "client-tls"
+		clientTLS.VolumeSource = corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: cluster.GetClientSecretName(),
+			},
+		}
+		volumes = append(volumes, clientTLS)
+	}
+
+	return volumes
+}
+
 // Source: http://github.com/datastax/cass-operator/blob/master/operator/pkg/reconciliation/constructor.go#L430-L430
 func selectorFromFieldPath(fieldPath string) *corev1.EnvVarSource {
 	return &corev1.EnvVarSource{
@@ -50,34 +431,210 @@ func selectorFromFieldPath(fieldPath string) *corev1.EnvVarSource {
 	}
 }
 
-func createVolumes() []corev1.Volume {
+func selectorFromSecretKey(secretName, key string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+			Key:                  key,
+		},
+	}
+}
+
+func createVolumes(cluster *api.CassandraCluster) []corev1.Volume {
 	serverConfig := corev1.Volume{}
 	serverConfig.Name = "server-config"
 	serverConfig.VolumeSource = corev1.VolumeSource{
 		EmptyDir: &corev1.EmptyDirVolumeSource{},
 	}
 
+	// The annotations are exposed through a volume rather than an environment
+	// variable because volumes pick up annotations added after the pod started.
+	podInfo := corev1.Volume{}
+	podInfo.Name = "pod-info"
+	podInfo.VolumeSource = corev1.VolumeSource{
+		DownwardAPI: &corev1.DownwardAPIVolumeSource{
+			Items: []corev1.DownwardAPIVolumeFile{
+				{
+					Path:     "annotations",
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations"},
+				},
+			},
+		},
+	}
+
+	// Cassandra writes system.log and debug.log to the logs volume, so that they
+	// survive restarts of the cassandra container
 	serverLogs := corev1.Volume{}
 	serverLogs.Name = "server-logs"
 	serverLogs.VolumeSource = corev1.VolumeSource{
 		EmptyDir: &corev1.EmptyDirVolumeSource{},
 	}
 
-	return []corev1.Volume{serverConfig, serverLogs}
+	// The replace addresses are optional since the config map only exists while
+	// nodes are being replaced
+	optional := true
+	replaceAddresses := corev1.Volume{}
+	replaceAddresses.Name = "replace-addresses"
+	replaceAddresses.VolumeSource = corev1.VolumeSource{
+		ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: cluster.GetReplaceAddressesConfigMapName()},
+			Optional:             &optional,
+		},
+	}
+
+	// The client certificate of the operator is not mounted
+	mgmtAPITLS := corev1.Volume{}
+	mgmtAPITLS.Name = "mgmt-api-tls"
+	mgmtAPITLS.VolumeSource = corev1.VolumeSource{
+		Secret: &corev1.SecretVolumeSource{
+			SecretName: cluster.GetMgmtAPISecretName(),
+			Items: []corev1.KeyToPath{
+				{Key: mgmtapi.CACertKey, Path: mgmtapi.CACertKey},
+				{Key: mgmtapi.ServerCertKey, Path: mgmtapi.ServerCertKey},
+				{Key: mgmtapi.ServerKeyKey, Path: mgmtapi.ServerKeyKey},
+			},
+		},
+	}
+
+	volumes := []corev1.Volume{serverConfig, serverLogs, podInfo, replaceAddresses, mgmtAPITLS}
+
+	// The restore config map is not optional so that pods wait for the restore
+	// to assign backed up nodes to them
+	if cluster.IsRestoredFromBackup() {
+		restoreNodes := corev1.Volume{}
+		restoreNodes.Name = "restore-nodes"
+		restoreNodes.VolumeSource = corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cluster.GetRestoreConfigMapName()},
+			},
+		}
+		volumes = append(volumes, restoreNodes)
+	}
+
+	return volumes
 }
 
-func createCassandraProbe(delay, period, timeout int32) *corev1.Probe {
+// createContainerPorts returns the ports declared by the cassandra container
+func createContainerPorts(cluster *api.CassandraCluster) []corev1.ContainerPort {
+	ports := []corev1.ContainerPort{
+		{Name: cqlPortName, ContainerPort: cluster.GetCQLPort(), Protocol: corev1.ProtocolTCP},
+		{Name: storagePortName, ContainerPort: cluster.GetStoragePort(), Protocol: corev1.ProtocolTCP},
+		{Name: jmxPortName, ContainerPort: cluster.GetJMXPort(), Protocol: corev1.ProtocolTCP},
+		{Name: mgmtAPIPortName, ContainerPort: mgmtapi.DefaultPort, Protocol: corev1.ProtocolTCP},
+	}
+
+	if cluster.IsInternodeEncryptionEnabled() {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          sslStoragePortName,
+			ContainerPort: cluster.GetSSLStoragePort(),
+			Protocol:      corev1.ProtocolTCP,
+		})
+	}
+
+	if cluster.HasSeparateCQLSSLPort() {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          cqlSSLPortName,
+			ContainerPort: cluster.GetCQLSSLPort(),
+			Protocol:      corev1.ProtocolTCP,
+		})
+	}
+
+	return ports
+}
+
+// createServicePorts returns service ports matching the container ports. The
+// management API is left out since only the operator talks to it, addressing
+// the pods directly.
+func createServicePorts(cluster *api.CassandraCluster) []corev1.ServicePort {
+	var ports []corev1.ServicePort
+	for _, containerPort := range createContainerPorts(cluster) {
+		if containerPort.Name == mgmtAPIPortName {
+			continue
+		}
+		ports = append(ports, corev1.ServicePort{
+			Name:       containerPort.Name,
+			Port:       containerPort.ContainerPort,
+			TargetPort: intstr.FromString(containerPort.Name),
+			Protocol:   containerPort.Protocol,
+		})
+	}
+	return ports
+}
+
+// createClientServicePorts returns the service ports used by CQL clients
+func createClientServicePorts(cluster *api.CassandraCluster) []corev1.ServicePort {
+	ports := []corev1.ServicePort{
+		{
+			Name:       cqlPortName,
+			Port:       cluster.GetCQLPort(),
+			TargetPort: intstr.FromString(cqlPortName),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+
+	if cluster.HasSeparateCQLSSLPort() {
+		ports = append(ports, corev1.ServicePort{
+			Name:       cqlSSLPortName,
+			Port:       cluster.GetCQLSSLPort(),
+			TargetPort: intstr.FromString(cqlSSLPortName),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+
+	return ports
+}
+
+// nodetoolCommand returns a shell command running nodetool against the
+// configured JMX port. With remote JMX the credentials are read from the JMX
+// password file.
+func nodetoolCommand(cluster *api.CassandraCluster, args string) []string {
+	nodetool := fmt.Sprintf("nodetool -p %d", cluster.GetJMXPort())
+	if cluster.Spec.Reaper != nil {
+		nodetool += fmt.Sprintf(` -u "$JMX_USERNAME" -pwf %s/jmxremote.password`, jmxCredentialsDir)
+	}
+	return []string{
+		"/bin/bash",
+		"-c",
+		fmt.Sprintf("%s %s", nodetool, args),
+	}
+}
+
+func createLivenessProbe(cluster *api.CassandraCluster) *corev1.Probe {
 	return &corev1.Probe{
-		InitialDelaySeconds: delay,
-		TimeoutSeconds:      timeout,
-		PeriodSeconds:       period,
+		InitialDelaySeconds: api.DefaultLivenessProbeInitialDelay,
+		TimeoutSeconds:      api.DefaultLivenessProbeTimeout,
+		PeriodSeconds:       api.DefaultLivenessProbePeriod,
 		Handler: corev1.Handler{
 			Exec: &corev1.ExecAction{
-				Command: []string{
-					"/bin/bash",
-					"-c",
-					"nodetool status",
-				},
+				Command: nodetoolCommand(cluster, "status"),
+			},
+		},
+	}
+}
+
+// createReadinessProbe checks the native transport port so that a node is only
+// considered ready once it accepts client connections
+func createReadinessProbe(cluster *api.CassandraCluster) *corev1.Probe {
+	return &corev1.Probe{
+		InitialDelaySeconds: api.DefaultReadinessProbeInitialDelay,
+		TimeoutSeconds:      api.DefaultReadinessProbeTimeout,
+		PeriodSeconds:       api.DefaultReadinessProbePeriod,
+		Handler: corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromString(cqlPortName),
+			},
+		},
+	}
+}
+
+// createDrainLifecycle flushes memtables and stops accepting writes before the
+// cassandra container is stopped so that a restarted node does not need to
+// replay its commit log.
+func createDrainLifecycle(cluster *api.CassandraCluster) *corev1.Lifecycle {
+	return &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: nodetoolCommand(cluster, "drain"),
 			},
 		},
 	}
@@ -0,0 +1,84 @@
+package reconciliation
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	. "github.com/onsi/gomega"
+)
+
+const testLogbackXML = `<configuration scan="true">
+  <appender name="STDOUT" class="ch.qos.logback.core.ConsoleAppender">
+    <encoder>
+      <pattern>%-5level %date{ISO8601} %F:%L - %msg%n</pattern>
+    </encoder>
+  </appender>
+  <root level="INFO">
+    <appender-ref ref="STDOUT" />
+  </root>
+  <logger name="org.apache.cassandra" level="DEBUG"/>
+  <logger name="com.thinkaurelius.thrift" level="ERROR">
+    <appender-ref ref="STDOUT" />
+  </logger>
+  <logger name="org.apache.cassandra.db" level="INFO"></logger>
+</configuration>
+`
+
+type testLogger struct {
+	Name  string `xml:"name,attr"`
+	Level string `xml:"level,attr"`
+}
+
+type testLogback struct {
+	Root struct {
+		Level string `xml:"level,attr"`
+	} `xml:"root"`
+	Loggers []testLogger `xml:"logger"`
+}
+
+func TestLogbackScript(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "logback")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logback.xml")
+	g.Expect(ioutil.WriteFile(path, []byte(testLogbackXML), 0644)).To(Succeed())
+
+	script := logbackScript([]api.LoggerSpec{
+		{Name: api.RootLogger, Level: "WARN"},
+		{Name: "org.apache.cassandra", Level: "TRACE"},
+		{Name: "com.thinkaurelius.thrift", Level: "DEBUG"},
+		{Name: "org.apache.cassandra.db", Level: "ERROR"},
+		{Name: "org.apache.cassandra.service", Level: "DEBUG"},
+	})
+	script = strings.ReplaceAll(script, "/config/logback.xml", path)
+
+	out, err := exec.Command("/bin/bash", "-c", script).CombinedOutput()
+	g.Expect(err).ToNot(HaveOccurred(), string(out))
+
+	data, err := ioutil.ReadFile(path)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	logback := testLogback{}
+	g.Expect(xml.Unmarshal(data, &logback)).To(Succeed(), string(data))
+	g.Expect(logback.Root.Level).To(Equal("WARN"))
+	g.Expect(logback.Loggers).To(ConsistOf(
+		testLogger{Name: "org.apache.cassandra", Level: "TRACE"},
+		testLogger{Name: "com.thinkaurelius.thrift", Level: "DEBUG"},
+		testLogger{Name: "org.apache.cassandra.db", Level: "ERROR"},
+		testLogger{Name: "org.apache.cassandra.service", Level: "DEBUG"},
+	))
+	g.Expect(strings.Count(string(data), "</logger>")).To(Equal(0))
+}
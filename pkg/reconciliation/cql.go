@@ -0,0 +1,93 @@
+package reconciliation
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+)
+
+// listPods returns the pods matching labels sorted by name
+func listPods(ctx context.Context, c client.Client, namespace string, labels map[string]string) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := c.List(ctx, podList, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+
+	pods := podList.Items
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+
+	return pods, nil
+}
+
+// getSuperuserCredentials reads the credentials of the superuser from its secret
+func getSuperuserCredentials(ctx context.Context, c client.Client, cluster *api.CassandraCluster) (cql.Credentials, error) {
+	secret := &corev1.Secret{}
+	nsName := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.GetSuperuserSecretName()}
+	if err := c.Get(ctx, nsName, secret); err != nil {
+		return cql.Credentials{}, err
+	}
+
+	return cql.Credentials{
+		Username: string(secret.Data[superuserUsernameKey]),
+		Password: string(secret.Data[superuserPasswordKey]),
+	}, nil
+}
+
+// newSuperuserSession connects to the ready nodes of the cluster as the superuser
+func newSuperuserSession(ctx context.Context, c client.Client, cluster *api.CassandraCluster) (*cql.Session, error) {
+	credentials, err := getSuperuserCredentials(ctx, c, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := listPods(ctx, c, cluster.Namespace, cluster.GetClusterLabels())
+	if err != nil {
+		return nil, err
+	}
+
+	return newCQLSession(ctx, c, cluster, pods, credentials)
+}
+
+// newCQLSession connects to the ready pods with the given credentials. TLS is
+// used when the CQL port only accepts encrypted connections.
+func newCQLSession(ctx context.Context, c client.Client, cluster *api.CassandraCluster, pods []corev1.Pod, credentials cql.Credentials) (*cql.Session, error) {
+	var hosts []string
+	for i := range pods {
+		if isPodReady(&pods[i]) {
+			hosts = append(hosts, pods[i].Status.PodIP)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no ready nodes")
+	}
+
+	var tlsConfig *tls.Config
+	if cluster.IsClientEncryptionEnabled() && !cluster.HasSeparateCQLSSLPort() {
+		secret := &corev1.Secret{}
+		nsName := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.GetClientSecretName()}
+		if err := c.Get(ctx, nsName, secret); err != nil {
+			return nil, err
+		}
+
+		var clientCert, clientKey []byte
+		if cluster.Spec.Security.ClientEncryption.RequireClientAuth {
+			clientCert = secret.Data[corev1.TLSCertKey]
+			clientKey = secret.Data[corev1.TLSPrivateKeyKey]
+		}
+
+		var err error
+		if tlsConfig, err = cql.NewTLSConfig(secret.Data[caCertKey], clientCert, clientKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return cql.NewSession(hosts, int(cluster.GetCQLPort()), credentials, tlsConfig)
+}
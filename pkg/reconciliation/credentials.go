@@ -0,0 +1,195 @@
+package reconciliation
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	credentialsUsernameKey    = "username"
+	credentialsPasswordKey    = "password"
+	credentialsPasswordLength = 24
+
+	jmxUsername        = "cassandra-jmx"
+	reaperAuthUsername = "reaper"
+	reaperCQLUsername  = "reaper"
+
+	backupAgentTokenKey = "token"
+)
+
+// CheckReaperCredentials generates the JMX credentials that the nodes require
+// once Reaper is deployed, the credentials of the Reaper web UI and REST API
+// and those of the role Reaper stores its state with. It has to run before
+// CheckStatefulSet since the pods read the JMX credentials from their secret.
+func (r *requestHandler) CheckReaperCredentials(ctx context.Context) result.ReconcileResult {
+	if r.cluster.Spec.Reaper == nil {
+		return result.Continue()
+	}
+
+	if res := r.checkCredentialsSecret(ctx, r.cluster.GetJMXSecretName(), jmxUsername); res.Completed() {
+		return res
+	}
+	if res := r.checkCredentialsSecret(ctx, r.cluster.GetReaperAuthSecretName(), reaperAuthUsername); res.Completed() {
+		return res
+	}
+	return r.checkCredentialsSecret(ctx, r.cluster.GetReaperCQLSecretName(), reaperCQLUsername)
+}
+
+// CheckBackupAgentCredentials generates the token that the operator has to
+// present to the backup agents. It has to run before CheckStatefulSet since the
+// agents read the token from the secret.
+func (r *requestHandler) CheckBackupAgentCredentials(ctx context.Context) result.ReconcileResult {
+	if !r.cluster.IsBackupEnabled() {
+		return result.Continue()
+	}
+
+	return r.checkGeneratedSecret(ctx, r.cluster.GetBackupAgentSecretName(), func() (map[string]string, error) {
+		token, err := generatePassword(credentialsPasswordLength)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{backupAgentTokenKey: token}, nil
+	})
+}
+
+// CheckMgmtAPICredentials generates the certificates that secure the management
+// API of the nodes and configures the client of the operator with them. It has
+// to run before CheckStatefulSet since the pods mount the secret, and before any
+// step that calls the management API.
+func (r *requestHandler) CheckMgmtAPICredentials(ctx context.Context) result.ReconcileResult {
+	if res := r.checkGeneratedSecret(ctx, r.cluster.GetMgmtAPISecretName(), func() (map[string]string, error) {
+		return mgmtapi.GenerateCertificates(r.cluster.Spec.Name)
+	}); res.Completed() {
+		return res
+	}
+
+	tlsConfig, err := getMgmtAPITLSConfig(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to load management API certificates", "Secret", r.cluster.GetMgmtAPISecretName())
+		return result.Error(err)
+	}
+	r.mgmtClient.SetTLSConfig(tlsConfig)
+
+	return result.Continue()
+}
+
+// checkCredentialsSecret creates a secret holding username and a generated
+// password unless it exists already
+func (r *requestHandler) checkCredentialsSecret(ctx context.Context, name, username string) result.ReconcileResult {
+	return r.checkGeneratedSecret(ctx, name, func() (map[string]string, error) {
+		password, err := generatePassword(credentialsPasswordLength)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{credentialsUsernameKey: username, credentialsPasswordKey: password}, nil
+	})
+}
+
+// checkGeneratedSecret creates a secret holding the data returned by generate
+// unless it exists already
+func (r *requestHandler) checkGeneratedSecret(ctx context.Context, name string, generate func() (map[string]string, error)) result.ReconcileResult {
+	secret := &corev1.Secret{}
+	nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: name}
+	err := r.Get(ctx, nsName, secret)
+	if err == nil {
+		return result.Continue()
+	} else if !errors.IsNotFound(err) {
+		r.log.Error(err, "failed to get secret", "Secret", nsName.Name)
+		return result.Error(err)
+	}
+
+	data, err := generate()
+	if err != nil {
+		r.log.Error(err, "failed to generate secret data", "Secret", nsName.Name)
+		return result.Error(err)
+	}
+
+	labels := r.cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nsName.Name,
+			Namespace: nsName.Namespace,
+			Labels:    labels,
+		},
+		StringData: data,
+	}
+	if err = controllerutil.SetControllerReference(r.cluster, secret, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for secret", "Secret", nsName.Name)
+		return result.Error(err)
+	}
+	r.log.Info("creating secret", "Secret", nsName.Name)
+	if err = r.Create(ctx, secret); err != nil {
+		r.log.Error(err, "failed to create secret", "Secret", nsName.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// deleteSecretIfExists deletes the secret unless it is already gone
+func (r *requestHandler) deleteSecretIfExists(ctx context.Context, name string) result.ReconcileResult {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: name}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		return result.Continue()
+	} else if err != nil {
+		r.log.Error(err, "failed to get secret", "Secret", name)
+		return result.Error(err)
+	}
+
+	r.log.Info("deleting secret", "Secret", name)
+	if err = r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+		r.log.Error(err, "failed to delete secret", "Secret", name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// getCredentials returns the username and password stored in a secret created
+// by checkCredentialsSecret
+func (r *requestHandler) getCredentials(ctx context.Context, name string) (string, string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: name}, secret); err != nil {
+		return "", "", err
+	}
+	return string(secret.Data[credentialsUsernameKey]), string(secret.Data[credentialsPasswordKey]), nil
+}
+
+// getBackupAgentToken returns the token that the backup agents of cluster
+// require, which CheckBackupAgentCredentials generates
+func getBackupAgentToken(ctx context.Context, c client.Reader, cluster *api.CassandraCluster) (string, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.GetBackupAgentSecretName()}, secret); err != nil {
+		return "", err
+	}
+	token := string(secret.Data[backupAgentTokenKey])
+	if token == "" {
+		return "", fmt.Errorf("secret %s has no %s", secret.Name, backupAgentTokenKey)
+	}
+	return token, nil
+}
+
+// getMgmtAPITLSConfig returns the TLS configuration, holding the client
+// certificate of the operator, for the management API of the nodes of cluster.
+// The certificates are generated by CheckMgmtAPICredentials.
+func getMgmtAPITLSConfig(ctx context.Context, c client.Reader, cluster *api.CassandraCluster) (*tls.Config, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.GetMgmtAPISecretName()}, secret); err != nil {
+		return nil, err
+	}
+	return cql.NewTLSConfig(secret.Data[mgmtapi.CACertKey], secret.Data[mgmtapi.ClientCertKey], secret.Data[mgmtapi.ClientKeyKey])
+}
@@ -0,0 +1,196 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CheckNewDatacenters records a rebuild for every datacenter that is added to a
+// running cluster. It has to run before CheckStatefulSet so that the nodes of the
+// new datacenter start with auto_bootstrap disabled. The datacenters of a new
+// cluster bootstrap normally; the cluster counts as running once the superuser
+// has been created.
+func (r *requestHandler) CheckNewDatacenters(ctx context.Context) result.ReconcileResult {
+	if !r.cluster.Status.SuperuserCreated {
+		return result.Continue()
+	}
+
+	for i := range r.cluster.Spec.Datacenters {
+		dc := &r.cluster.Spec.Datacenters[i]
+		if _, found := r.cluster.Status.Datacenters[dc.Name]; found {
+			continue
+		}
+
+		source := r.getRebuildSource(dc)
+		if source == "" {
+			r.log.Info("no datacenter to rebuild from, the datacenter will bootstrap", "Datacenter", dc.Name)
+			continue
+		}
+
+		r.log.Info("adding datacenter to running cluster", "Datacenter", dc.Name, "SourceDatacenter", source)
+		now := metav1.Now()
+		dcStatus := api.DatacenterStatus{
+			Rebuild: &api.RebuildStatus{
+				SourceDatacenter: source,
+				Phase:            api.RebuildPhaseWaitingForNodes,
+				StartTime:        &now,
+			},
+		}
+		if err := r.updateDatacenterStatus(ctx, dc.Name, dcStatus); err != nil {
+			r.log.Error(err, "failed to update status", "Datacenter", dc.Name)
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+// getRebuildSource returns the datacenter that dc streams its data from
+func (r *requestHandler) getRebuildSource(dc *api.Datacenter) string {
+	if dc.RebuildFrom != "" {
+		return dc.RebuildFrom
+	}
+	for _, other := range r.cluster.Spec.Datacenters {
+		if _, found := r.cluster.Status.Datacenters[other.Name]; found && other.Name != dc.Name && !r.cluster.IsRebuildPending(other.Name) {
+			return other.Name
+		}
+	}
+	return ""
+}
+
+// CheckRebuild streams the data of new datacenters from their source datacenter.
+// Once all nodes of a new datacenter are ready and the system keyspaces replicate
+// to it, nodetool rebuild runs on one node at a time. With the SystemKeyspaces
+// feature turned off, the rebuild starts as soon as the nodes are ready. Application keyspaces have
+// to include the new datacenter in their replication before the rebuild starts
+// in order to be streamed.
+func (r *requestHandler) CheckRebuild(ctx context.Context) result.ReconcileResult {
+	for i := range r.cluster.Spec.Datacenters {
+		dc := &r.cluster.Spec.Datacenters[i]
+		if !r.cluster.IsRebuildPending(dc.Name) {
+			continue
+		}
+		if result := r.checkDatacenterRebuild(ctx, dc); result.Completed() {
+			return result
+		}
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) checkDatacenterRebuild(ctx context.Context, dc *api.Datacenter) result.ReconcileResult {
+	dcStatus := r.cluster.Status.Datacenters[dc.Name]
+	rebuild := dcStatus.Rebuild.DeepCopy()
+	dcStatus.Rebuild = rebuild
+
+	pods, err := r.listDatacenterPods(ctx, dc.Name)
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "Datacenter", dc.Name)
+		return result.Error(err)
+	}
+
+	ready := len(pods) == int(dc.GetSize())
+	for i := range pods {
+		ready = ready && isPodReady(&pods[i])
+	}
+	if !ready {
+		r.log.Info("waiting for all nodes to join before rebuilding", "Datacenter", dc.Name)
+		return result.RequeueSoon(15)
+	}
+
+	// The replication of the system keyspaces is left to the user when the
+	// operator does not manage it, so there is nothing to wait for then.
+	if _, found := r.cluster.Status.SystemReplication[dc.Name]; !found && r.featureGates.Enabled(FeatureSystemKeyspaces) {
+		r.log.Info("waiting for system keyspaces to replicate to datacenter", "Datacenter", dc.Name)
+		return result.RequeueSoon(10)
+	}
+
+	rebuild.Phase = api.RebuildPhaseRunning
+
+	if rebuild.JobID != "" {
+		pod := findPod(pods, rebuild.CurrentNode)
+		if pod == nil {
+			rebuild.CurrentNode = ""
+			rebuild.JobID = ""
+		} else {
+			switch status, jobErr := r.getJobStatus(ctx, pod, rebuild.JobID); status {
+			case mgmtapi.JobStatusCompleted:
+				r.log.Info("finished rebuilding node", "Pod", pod.Name)
+				rebuild.RebuiltNodes = append(rebuild.RebuiltNodes, pod.Name)
+				rebuild.CurrentNode = ""
+				rebuild.JobID = ""
+				rebuild.Error = ""
+			case mgmtapi.JobStatusError:
+				r.log.Info("rebuild failed, retrying", "Pod", pod.Name, "Error", jobErr)
+				rebuild.JobID = ""
+				rebuild.Error = jobErr
+			default:
+				return r.saveDatacenterStatus(ctx, dc, dcStatus, result.RequeueSoon(30))
+			}
+		}
+	}
+
+	var nextPod *corev1.Pod
+	for i := range pods {
+		if !containsString(rebuild.RebuiltNodes, pods[i].Name) {
+			nextPod = &pods[i]
+			break
+		}
+	}
+
+	if nextPod == nil {
+		r.log.Info("finished rebuilding datacenter", "Datacenter", dc.Name)
+		now := metav1.Now()
+		rebuild.Phase = api.RebuildPhaseCompleted
+		rebuild.CompletionTime = &now
+		// Completing the rebuild removes auto_bootstrap from the configuration,
+		// which rolls the nodes of the datacenter.
+		return r.saveDatacenterStatus(ctx, dc, dcStatus, result.Continue())
+	}
+
+	r.log.Info("rebuilding node", "Pod", nextPod.Name, "SourceDatacenter", rebuild.SourceDatacenter)
+	jobID, err := r.mgmtClient.Rebuild(ctx, mgmtapi.PodEndpoint(nextPod, mgmtapi.DefaultPort), rebuild.SourceDatacenter)
+	if err != nil {
+		r.log.Error(err, "failed to start rebuild", "Pod", nextPod.Name)
+		rebuild.Error = err.Error()
+	} else {
+		rebuild.CurrentNode = nextPod.Name
+		rebuild.JobID = jobID
+	}
+
+	return r.saveDatacenterStatus(ctx, dc, dcStatus, result.RequeueSoon(30))
+}
+
+// saveDatacenterStatus persists the status of the datacenter and returns next
+func (r *requestHandler) saveDatacenterStatus(ctx context.Context, dc *api.Datacenter, dcStatus api.DatacenterStatus, next result.ReconcileResult) result.ReconcileResult {
+	if err := r.updateDatacenterStatus(ctx, dc.Name, dcStatus); err != nil {
+		r.log.Error(err, "failed to update status", "Datacenter", dc.Name)
+		return result.Error(err)
+	}
+	return next
+}
+
+// getJobStatus returns the status of a management API job running on pod along
+// with its error. A job that cannot be looked up, e.g. because the node has
+// restarted, is reported as failed so that it is started again.
+func (r *requestHandler) getJobStatus(ctx context.Context, pod *corev1.Pod, jobID string) (mgmtapi.JobStatus, string) {
+	job, err := r.mgmtClient.GetJob(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), jobID)
+	if err != nil {
+		r.log.Error(err, "failed to get job", "Pod", pod.Name, "JobID", jobID)
+		return mgmtapi.JobStatusError, err.Error()
+	}
+	return job.Status, job.Error
+}
+
+func findPod(pods []corev1.Pod, name string) *corev1.Pod {
+	for i := range pods {
+		if pods[i].Name == name {
+			return &pods[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strings"
+)
+
+// CheckRemovedDatacenters decommissions the datacenters that are still in the
+// status but have been removed from the spec. Nothing is removed while any
+// keyspace replicates to the datacenter since that would lose data. Otherwise
+// the datacenter is removed from the replication of the system keyspaces, its
+// nodes are decommissioned one at a time and finally its StatefulSets, services
+// and PVCs are deleted.
+func (r *requestHandler) CheckRemovedDatacenters(ctx context.Context) result.ReconcileResult {
+	var removed []string
+	for dcName := range r.cluster.Status.Datacenters {
+		if r.cluster.GetDatacenter(dcName) == nil {
+			removed = append(removed, dcName)
+		}
+	}
+
+	if len(removed) == 0 {
+		if condition := r.cluster.Status.GetCondition(api.ClusterConditionDatacenterRemovalBlocked); condition != nil && condition.Status == corev1.ConditionTrue {
+			if err := r.setRemovalBlockedCondition(ctx, corev1.ConditionFalse, ""); err != nil {
+				return result.Error(err)
+			}
+		}
+		return result.Continue()
+	}
+
+	if !r.cluster.Status.SuperuserCreated {
+		r.log.Info("waiting for the cluster to be up before removing datacenters")
+		return result.RequeueSoon(10)
+	}
+
+	// Datacenters are removed one at a time
+	sort.Strings(removed)
+	return r.checkDatacenterRemoval(ctx, removed[0])
+}
+
+func (r *requestHandler) checkDatacenterRemoval(ctx context.Context, dcName string) result.ReconcileResult {
+	dcStatus := r.cluster.Status.Datacenters[dcName]
+	decommission := dcStatus.Decommission.DeepCopy()
+	if decommission == nil {
+		now := metav1.Now()
+		decommission = &api.DecommissionStatus{Phase: api.DecommissionPhaseBlocked, StartTime: &now}
+	}
+	dcStatus.Decommission = decommission
+
+	switch decommission.Phase {
+	case api.DecommissionPhaseBlocked:
+		return r.checkReplicationBeforeRemoval(ctx, dcName, dcStatus)
+	case api.DecommissionPhaseRunning:
+		return r.checkDecommissionNodes(ctx, dcName, dcStatus)
+	default:
+		return r.deleteDatacenterResources(ctx, dcName)
+	}
+}
+
+// checkReplicationBeforeRemoval blocks the removal while keyspaces other than the
+// system keyspaces replicate to the datacenter. Once none do, the datacenter is
+// removed from the replication of the system keyspaces.
+func (r *requestHandler) checkReplicationBeforeRemoval(ctx context.Context, dcName string, dcStatus api.DatacenterStatus) result.ReconcileResult {
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to connect to cluster")
+		return result.RequeueSoon(10)
+	}
+	defer session.Close()
+
+	keyspaces, err := session.ListReplication()
+	if err != nil {
+		r.log.Error(err, "failed to list keyspaces")
+		return result.RequeueSoon(10)
+	}
+
+	var blocking []string
+	for keyspace, replication := range keyspaces {
+		if !containsString(cql.SystemKeyspaces, keyspace) && cql.ReplicatesTo(replication, dcName) {
+			blocking = append(blocking, keyspace)
+		}
+	}
+
+	if len(blocking) > 0 {
+		sort.Strings(blocking)
+		message := fmt.Sprintf("keyspaces %s still replicate to datacenter %s", strings.Join(blocking, ", "), dcName)
+		r.log.Info("refusing to remove datacenter", "Datacenter", dcName, "Keyspaces", blocking)
+		if err = r.setRemovalBlockedCondition(ctx, corev1.ConditionTrue, message); err != nil {
+			return result.Error(err)
+		}
+		return r.saveDatacenterStatus(ctx, &api.Datacenter{Name: dcName}, dcStatus, result.RequeueSoon(60))
+	}
+
+	if err = r.setRemovalBlockedCondition(ctx, corev1.ConditionFalse, ""); err != nil {
+		return result.Error(err)
+	}
+
+	replication := r.cluster.GetSystemReplication()
+	// Removing a datacenter only lowers the replication, so nothing is repaired
+	if _, err = updateSystemReplication(session, replication); err != nil {
+		r.log.Error(err, "failed to update replication of system keyspaces")
+		return result.RequeueSoon(10)
+	}
+	if err = r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+		status.SystemReplication = replication
+	}); err != nil {
+		r.log.Error(err, "failed to update status")
+		return result.Error(err)
+	}
+
+	r.log.Info("decommissioning datacenter", "Datacenter", dcName)
+	dcStatus.Decommission.Phase = api.DecommissionPhaseRunning
+	return r.saveDatacenterStatus(ctx, &api.Datacenter{Name: dcName}, dcStatus, result.RequeueSoon(5))
+}
+
+// checkDecommissionNodes decommissions the nodes of the datacenter one at a time
+func (r *requestHandler) checkDecommissionNodes(ctx context.Context, dcName string, dcStatus api.DatacenterStatus) result.ReconcileResult {
+	dc := &api.Datacenter{Name: dcName}
+	decommission := dcStatus.Decommission
+
+	pods, err := r.listDatacenterPods(ctx, dcName)
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "Datacenter", dcName)
+		return result.Error(err)
+	}
+
+	if decommission.JobID != "" {
+		pod := findPod(pods, decommission.CurrentNode)
+		if pod == nil {
+			decommission.CurrentNode = ""
+			decommission.JobID = ""
+		} else {
+			switch status, jobErr := r.getJobStatus(ctx, pod, decommission.JobID); status {
+			case mgmtapi.JobStatusCompleted:
+				r.log.Info("decommissioned node", "Pod", pod.Name)
+				decommission.DecommissionedNodes = append(decommission.DecommissionedNodes, pod.Name)
+				decommission.CurrentNode = ""
+				decommission.JobID = ""
+				decommission.Error = ""
+			case mgmtapi.JobStatusError:
+				r.log.Info("decommission failed, retrying", "Pod", pod.Name, "Error", jobErr)
+				decommission.JobID = ""
+				decommission.Error = jobErr
+			default:
+				return r.saveDatacenterStatus(ctx, dc, dcStatus, result.RequeueSoon(30))
+			}
+		}
+	}
+
+	var nextPod *corev1.Pod
+	for i := range pods {
+		if !containsString(decommission.DecommissionedNodes, pods[i].Name) {
+			nextPod = &pods[i]
+			break
+		}
+	}
+
+	if nextPod == nil {
+		r.log.Info("all nodes decommissioned, deleting resources", "Datacenter", dcName)
+		decommission.Phase = api.DecommissionPhaseDeletingResources
+		return r.saveDatacenterStatus(ctx, dc, dcStatus, result.RequeueSoon(5))
+	}
+
+	if !isPodReady(nextPod) {
+		// A node that is down cannot stream its data to the remaining nodes
+		decommission.Error = fmt.Sprintf("pod %s is not ready", nextPod.Name)
+		r.log.Info("waiting for node to be ready before decommissioning it", "Pod", nextPod.Name)
+		return r.saveDatacenterStatus(ctx, dc, dcStatus, result.RequeueSoon(30))
+	}
+
+	r.log.Info("decommissioning node", "Pod", nextPod.Name)
+	jobID, err := r.mgmtClient.Decommission(ctx, mgmtapi.PodEndpoint(nextPod, mgmtapi.DefaultPort))
+	if err != nil {
+		r.log.Error(err, "failed to start decommission", "Pod", nextPod.Name)
+		decommission.Error = err.Error()
+	} else {
+		decommission.CurrentNode = nextPod.Name
+		decommission.JobID = jobID
+	}
+
+	return r.saveDatacenterStatus(ctx, dc, dcStatus, result.RequeueSoon(30))
+}
+
+// deleteDatacenterResources deletes the services, PodDisruptionBudget,
+// StatefulSets and PVCs of the datacenter and then drops it from the status
+func (r *requestHandler) deleteDatacenterResources(ctx context.Context, dcName string) result.ReconcileResult {
+	labels := r.cluster.GetDatacenterLabels(dcName)
+
+	pods, err := r.listDatacenterPods(ctx, dcName)
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "Datacenter", dcName)
+		return result.Error(err)
+	}
+
+	serviceNames := []string{
+		r.cluster.GetDatacenterServiceName(dcName),
+		r.cluster.GetDatacenterExternalServiceName(dcName),
+	}
+	for _, pod := range pods {
+		serviceNames = append(serviceNames, r.cluster.GetNodeServiceName(pod.Name))
+	}
+	for _, name := range serviceNames {
+		if result := r.deleteServiceIfExists(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: name}); result.Completed() {
+			return result
+		}
+	}
+
+	pdbName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetDatacenterPodDisruptionBudgetName(dcName)}
+	if result := r.deletePodDisruptionBudgetIfExists(ctx, pdbName); result.Completed() {
+		return result
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err = r.List(ctx, statefulSets, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(labels)); err != nil {
+		r.log.Error(err, "failed to list statefulsets", "Datacenter", dcName)
+		return result.Error(err)
+	}
+	for i := range statefulSets.Items {
+		r.log.Info("deleting statefulset", "StatefulSet", statefulSets.Items[i].Name)
+		if err = r.Delete(ctx, &statefulSets.Items[i]); err != nil && !errors.IsNotFound(err) {
+			r.log.Error(err, "failed to delete statefulset", "StatefulSet", statefulSets.Items[i].Name)
+			return result.Error(err)
+		}
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err = r.List(ctx, pvcs, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(labels)); err != nil {
+		r.log.Error(err, "failed to list persistent volume claims", "Datacenter", dcName)
+		return result.Error(err)
+	}
+	for i := range pvcs.Items {
+		r.log.Info("deleting persistent volume claim", "PersistentVolumeClaim", pvcs.Items[i].Name)
+		if err = r.Delete(ctx, &pvcs.Items[i]); err != nil && !errors.IsNotFound(err) {
+			r.log.Error(err, "failed to delete persistent volume claim", "PersistentVolumeClaim", pvcs.Items[i].Name)
+			return result.Error(err)
+		}
+	}
+
+	r.log.Info("removed datacenter", "Datacenter", dcName)
+	if err = r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+		delete(status.Datacenters, dcName)
+	}); err != nil {
+		r.log.Error(err, "failed to update status")
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) setRemovalBlockedCondition(ctx context.Context, status corev1.ConditionStatus, message string) error {
+	reason := "NoReplicasInDatacenter"
+	if status == corev1.ConditionTrue {
+		reason = "KeyspacesReplicateToDatacenter"
+	}
+
+	if condition := r.cluster.Status.GetCondition(api.ClusterConditionDatacenterRemovalBlocked); condition != nil &&
+		condition.Status == status && condition.Message == message {
+		return nil
+	}
+
+	err := r.patchStatus(ctx, func(clusterStatus *api.CassandraClusterStatus) {
+		clusterStatus.SetCondition(api.ClusterCondition{
+			Type:    api.ClusterConditionDatacenterRemovalBlocked,
+			Status:  status,
+			Reason:  reason,
+			Message: message,
+		})
+	})
+	if err != nil {
+		r.log.Error(err, "failed to update status")
+	}
+	return err
+}
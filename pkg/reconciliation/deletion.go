@@ -0,0 +1,256 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/reaper"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// CheckFinalizer adds the finalizer that lets the deletion policy be applied
+// when the cluster is deleted
+func (r *requestHandler) CheckFinalizer(ctx context.Context) result.ReconcileResult {
+	if containsString(r.cluster.Finalizers, api.ClusterFinalizer) {
+		return result.Continue()
+	}
+
+	patch := client.MergeFrom(r.cluster.DeepCopy())
+	controllerutil.AddFinalizer(r.cluster, api.ClusterFinalizer)
+	if err := r.Patch(ctx, r.cluster, patch); err != nil {
+		r.log.Error(err, "failed to add finalizer", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// CheckDeletion applies the deletion policy of a deleted cluster and then
+// removes the finalizer, after which the StatefulSets and the other owned
+// objects are garbage collected. Deletion protection is enforced by the
+// validating webhook, which refuses the deletion in the first place.
+func (r *requestHandler) CheckDeletion(ctx context.Context) result.ReconcileResult {
+	if !containsString(r.cluster.Finalizers, api.ClusterFinalizer) {
+		return result.Done()
+	}
+
+	policy := r.cluster.GetDeletionPolicy()
+	r.log.Info("deleting cluster", "DeletionPolicy", policy)
+
+	switch policy {
+	case api.DeletionPolicyRetain:
+		if err := r.orphanSecrets(ctx); err != nil {
+			r.log.Error(err, "failed to retain secrets")
+			return result.Error(err)
+		}
+	case api.DeletionPolicySnapshotThenDelete:
+		if res := r.checkFinalBackup(ctx); res.Completed() {
+			return res
+		}
+		fallthrough
+	case api.DeletionPolicyDelete:
+		r.unregisterReaperCluster(ctx)
+		if err := r.deleteSecrets(ctx); err != nil {
+			r.log.Error(err, "failed to delete secrets")
+			return result.Error(err)
+		}
+		if err := r.deletePersistentVolumeClaims(ctx); err != nil {
+			r.log.Error(err, "failed to delete persistent volume claims")
+			return result.Error(err)
+		}
+	}
+
+	patch := client.MergeFrom(r.cluster.DeepCopy())
+	controllerutil.RemoveFinalizer(r.cluster, api.ClusterFinalizer)
+	if err := r.Patch(ctx, r.cluster, patch); err != nil {
+		r.log.Error(err, "failed to remove finalizer", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+	return result.Done()
+}
+
+// checkFinalBackup backs up the cluster before it is deleted. The backup is not
+// owned by the cluster so that it outlives it. Only a backup that was created
+// for this cluster after it was deleted counts as the final backup. A failed
+// backup blocks the deletion until the policy is changed.
+func (r *requestHandler) checkFinalBackup(ctx context.Context) result.ReconcileResult {
+	if !r.cluster.IsBackupEnabled() {
+		if err := r.setDeletionBlockedCondition(ctx, "BackupNotConfigured", "the Snapshot-then-Delete policy requires backups to be configured"); err != nil {
+			return result.Error(err)
+		}
+		return result.Done()
+	}
+
+	b := &api.CassandraBackup{}
+	nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetFinalBackupName()}
+	err := r.Get(ctx, nsName, b)
+	if err != nil && errors.IsNotFound(err) {
+		labels := r.cluster.GetClusterLabels()
+		api.AddManagedByLabel(labels)
+
+		b = &api.CassandraBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: nsName.Namespace,
+				Name:      nsName.Name,
+				Labels:    labels,
+				Annotations: map[string]string{
+					api.ClusterUIDAnnotation: string(r.cluster.UID),
+				},
+			},
+			Spec: api.CassandraBackupSpec{
+				ClusterRef: corev1.LocalObjectReference{Name: r.cluster.Name},
+			},
+		}
+		r.log.Info("creating final backup", "CassandraBackup", b.Name)
+		if err = r.Create(ctx, b); err != nil {
+			r.log.Error(err, "failed to create final backup", "CassandraBackup", b.Name)
+			return result.Error(err)
+		}
+		return result.RequeueSoon(15)
+	} else if err != nil {
+		r.log.Error(err, "failed to get final backup", "CassandraBackup", nsName.Name)
+		return result.Error(err)
+	}
+
+	if b.Annotations[api.ClusterUIDAnnotation] != string(r.cluster.UID) || b.CreationTimestamp.Before(r.cluster.DeletionTimestamp) {
+		message := fmt.Sprintf("CassandraBackup %s was not taken for the deletion of this cluster, delete it to take the final backup", b.Name)
+		if err = r.setDeletionBlockedCondition(ctx, "BackupConflict", message); err != nil {
+			return result.Error(err)
+		}
+		return result.Done()
+	}
+
+	switch b.Status.Phase {
+	case api.BackupPhaseCompleted:
+		return result.Continue()
+	case api.BackupPhaseFailed:
+		message := fmt.Sprintf("CassandraBackup %s failed: %s", b.Name, b.Status.Error)
+		if err = r.setDeletionBlockedCondition(ctx, "BackupFailed", message); err != nil {
+			return result.Error(err)
+		}
+		return result.Done()
+	default:
+		r.log.Info("waiting for final backup", "CassandraBackup", b.Name, "Phase", b.Status.Phase)
+		return result.RequeueSoon(15)
+	}
+}
+
+// unregisterReaperCluster removes the cluster and its repair schedules from
+// Reaper. Reaper is deleted along with the cluster, so a failure is only logged
+// rather than holding off the deletion.
+func (r *requestHandler) unregisterReaperCluster(ctx context.Context) {
+	if r.cluster.Status.Reaper == nil || !r.cluster.Status.Reaper.ClusterRegistered {
+		return
+	}
+
+	r.log.Info("unregistering cluster from Reaper")
+	client, err := r.newReaperClient(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to log in to Reaper")
+		return
+	}
+	if err = client.DeleteCluster(ctx, r.cluster.Spec.Name); err != nil && !reaper.IsNotFound(err) {
+		r.log.Error(err, "failed to unregister cluster from Reaper")
+	}
+}
+
+// listOwnedSecrets returns the secrets that the operator created for the cluster
+func (r *requestHandler) listOwnedSecrets(ctx context.Context) ([]corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(r.cluster.GetClusterLabels())); err != nil {
+		return nil, err
+	}
+
+	var owned []corev1.Secret
+	for _, secret := range secrets.Items {
+		if metav1.IsControlledBy(&secret, r.cluster) {
+			owned = append(owned, secret)
+		}
+	}
+	return owned, nil
+}
+
+// orphanSecrets removes the owner reference from the secrets created for the
+// cluster so that they are not garbage collected. A cluster recreated with the
+// same data needs the superuser and keystore passwords.
+func (r *requestHandler) orphanSecrets(ctx context.Context) error {
+	secrets, err := r.listOwnedSecrets(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range secrets {
+		secret := &secrets[i]
+		patch := client.MergeFrom(secret.DeepCopy())
+		var refs []metav1.OwnerReference
+		for _, ref := range secret.OwnerReferences {
+			if ref.UID != r.cluster.UID {
+				refs = append(refs, ref)
+			}
+		}
+		secret.OwnerReferences = refs
+		r.log.Info("retaining secret", "Secret", secret.Name)
+		if err = r.Patch(ctx, secret, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *requestHandler) deleteSecrets(ctx context.Context) error {
+	secrets, err := r.listOwnedSecrets(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range secrets {
+		r.log.Info("deleting secret", "Secret", secrets[i].Name)
+		if err = r.Delete(ctx, &secrets[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePersistentVolumeClaims deletes the data volume claims of all
+// datacenters. The claims are only removed once the pods are gone.
+func (r *requestHandler) deletePersistentVolumeClaims(ctx context.Context) error {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(r.cluster.GetClusterLabels())); err != nil {
+		return err
+	}
+
+	for i := range pvcs.Items {
+		r.log.Info("deleting persistent volume claim", "PersistentVolumeClaim", pvcs.Items[i].Name)
+		if err := r.Delete(ctx, &pvcs.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *requestHandler) setDeletionBlockedCondition(ctx context.Context, reason, message string) error {
+	if condition := r.cluster.Status.GetCondition(api.ClusterConditionDeletionBlocked); condition != nil &&
+		condition.Status == corev1.ConditionTrue && condition.Message == message {
+		return nil
+	}
+
+	err := r.patchStatus(ctx, func(clusterStatus *api.CassandraClusterStatus) {
+		clusterStatus.SetCondition(api.ClusterCondition{
+			Type:    api.ClusterConditionDeletionBlocked,
+			Status:  corev1.ConditionTrue,
+			Reason:  reason,
+			Message: message,
+		})
+	})
+	if err != nil {
+		r.log.Error(err, "failed to update status")
+	}
+	return err
+}
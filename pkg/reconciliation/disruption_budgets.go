@@ -0,0 +1,104 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// CheckPodDisruptionBudgets makes sure that each datacenter has a
+// PodDisruptionBudget so that node drains do not take down more than
+// MaxUnavailable nodes of the datacenter at once. The budget selects the pods by
+// the datacenter label, so it covers racks and nodes as they are added.
+func (r *requestHandler) CheckPodDisruptionBudgets(ctx context.Context) result.ReconcileResult {
+	for i := range r.cluster.Spec.Datacenters {
+		desired := newPodDisruptionBudgetForDatacenter(r.cluster, &r.cluster.Spec.Datacenters[i])
+		if result := r.reconcilePodDisruptionBudget(ctx, desired); result.Completed() {
+			return result
+		}
+	}
+
+	return result.Continue()
+}
+
+// reconcilePodDisruptionBudget creates desiredPdb if it does not exist yet and
+// otherwise updates it when it has drifted from the desired state.
+func (r *requestHandler) reconcilePodDisruptionBudget(ctx context.Context, desiredPdb *policyv1beta1.PodDisruptionBudget) result.ReconcileResult {
+	err := controllerutil.SetControllerReference(r.cluster, desiredPdb, r.scheme)
+	if err != nil {
+		r.log.Error(err, "could not set controller reference for pod disruption budget", "PodDisruptionBudget", desiredPdb.Name)
+		return result.Error(err)
+	}
+
+	actualPdb := &policyv1beta1.PodDisruptionBudget{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: desiredPdb.Namespace, Name: desiredPdb.Name}, actualPdb)
+	if err != nil && errors.IsNotFound(err) {
+		r.log.Info("creating pod disruption budget", "PodDisruptionBudget", desiredPdb.Name)
+		if err = r.Create(ctx, desiredPdb); err != nil {
+			r.log.Error(err, "failed to create pod disruption budget", "PodDisruptionBudget", desiredPdb.Name)
+			return result.Error(err)
+		}
+	} else if err != nil {
+		r.log.Error(err, "could not get pod disruption budget", "PodDisruptionBudget", desiredPdb.Name)
+		return result.Error(err)
+	} else if !resourcesHaveSameHash(actualPdb, desiredPdb) {
+		actualPdb.Labels = desiredPdb.Labels
+		if actualPdb.Annotations == nil {
+			actualPdb.Annotations = make(map[string]string)
+		}
+		for k, v := range desiredPdb.Annotations {
+			actualPdb.Annotations[k] = v
+		}
+		actualPdb.Spec = desiredPdb.Spec
+
+		if err = r.Update(ctx, actualPdb); err != nil {
+			r.log.Error(err, "failed to update pod disruption budget", "PodDisruptionBudget", desiredPdb.Name)
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+// deletePodDisruptionBudgetIfExists deletes the PodDisruptionBudget of a
+// datacenter that is removed from the cluster
+func (r *requestHandler) deletePodDisruptionBudgetIfExists(ctx context.Context, nsName types.NamespacedName) result.ReconcileResult {
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	err := r.Get(ctx, nsName, pdb)
+	if err != nil && errors.IsNotFound(err) {
+		return result.Continue()
+	} else if err != nil {
+		r.log.Error(err, "could not get pod disruption budget", "PodDisruptionBudget", nsName.Name)
+		return result.Error(err)
+	}
+
+	if err = r.Delete(ctx, pdb); err != nil && !errors.IsNotFound(err) {
+		r.log.Error(err, "failed to delete pod disruption budget", "PodDisruptionBudget", nsName.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+func newPodDisruptionBudgetForDatacenter(cluster *api.CassandraCluster, dc *api.Datacenter) *policyv1beta1.PodDisruptionBudget {
+	labels := cluster.GetDatacenterLabels(dc.Name)
+	api.AddManagedByLabel(labels)
+
+	maxUnavailable := cluster.GetMaxUnavailable()
+
+	var pdb policyv1beta1.PodDisruptionBudget
+	pdb.ObjectMeta.Name = cluster.GetDatacenterPodDisruptionBudgetName(dc.Name)
+	pdb.ObjectMeta.Namespace = cluster.Namespace
+	pdb.ObjectMeta.Labels = labels
+	pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: cluster.GetDatacenterLabels(dc.Name)}
+	pdb.Spec.MaxUnavailable = &maxUnavailable
+
+	addHashAnnotation(&pdb)
+
+	return &pdb
+}
@@ -0,0 +1,289 @@
+package reconciliation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"math/big"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// InternodeCertificateHashAnnotation is the pod annotation holding the hash of
+	// the internode certificate. A renewed certificate changes the pod template and
+	// therefore triggers a rolling restart.
+	InternodeCertificateHashAnnotation = "cassandra.apache.org/internode-certificate-hash"
+
+	// ClientCertificateHashAnnotation is the pod annotation holding the hash of the
+	// client certificate.
+	ClientCertificateHashAnnotation = "cassandra.apache.org/client-certificate-hash"
+
+	caCertKey = "ca.crt"
+
+	keystorePasswordKey    = "password"
+	keystorePasswordLength = 24
+)
+
+// CertificateGVK is the cert-manager Certificate kind. Certificates are managed as
+// unstructured objects so that the operator does not depend on the cert-manager API.
+var CertificateGVK = schema.GroupVersionKind{
+	Group:   "cert-manager.io",
+	Version: "v1alpha2",
+	Kind:    "Certificate",
+}
+
+// tlsSettings describes one of the certificates used for encryption
+type tlsSettings struct {
+	source          api.CertificateSource
+	certificateName string
+	secretName      string
+	dnsNames        []string
+	usages          []string
+	hashAnnotation  string
+}
+
+func getInternodeTLSSettings(cluster *api.CassandraCluster) *tlsSettings {
+	return &tlsSettings{
+		source:          cluster.Spec.Security.InternodeEncryption.CertificateSource,
+		certificateName: cluster.GetInternodeCertificateName(),
+		secretName:      cluster.GetInternodeSecretName(),
+		dnsNames:        getServiceDNSNames(cluster, "*."+cluster.GetGoverningServiceName()),
+		// nodes connect to each other, so the certificate is also a client certificate
+		usages:         []string{"server auth", "client auth"},
+		hashAnnotation: InternodeCertificateHashAnnotation,
+	}
+}
+
+func getClientTLSSettings(cluster *api.CassandraCluster) *tlsSettings {
+	dnsNames := getServiceDNSNames(cluster, "*."+cluster.GetGoverningServiceName())
+	for _, dc := range cluster.Spec.Datacenters {
+		dnsNames = append(dnsNames, getServiceDNSNames(cluster, cluster.GetDatacenterServiceName(dc.Name))...)
+	}
+
+	return &tlsSettings{
+		source:          cluster.Spec.Security.ClientEncryption.CertificateSource,
+		certificateName: cluster.GetClientCertificateName(),
+		secretName:      cluster.GetClientSecretName(),
+		dnsNames:        dnsNames,
+		// the operator presents the certificate when the nodes require client auth
+		usages:         []string{"server auth", "client auth"},
+		hashAnnotation: ClientCertificateHashAnnotation,
+	}
+}
+
+// getServiceDNSNames returns the names under which a service can be resolved
+func getServiceDNSNames(cluster *api.CassandraCluster, service string) []string {
+	return []string{
+		service,
+		fmt.Sprintf("%s.%s", service, cluster.Namespace),
+		fmt.Sprintf("%s.%s.svc", service, cluster.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", service, cluster.Namespace),
+	}
+}
+
+// CheckEncryption makes sure that the secrets needed for internode and client
+// encryption exist. When an issuer is referenced, a cert-manager Certificate is
+// created for the cluster. The hashes of the certificates are added to the pod
+// template annotations so that a renewal rolls the nodes.
+func (r *requestHandler) CheckEncryption(ctx context.Context) result.ReconcileResult {
+	if !r.cluster.IsInternodeEncryptionEnabled() && !r.cluster.IsClientEncryptionEnabled() {
+		return result.Continue()
+	}
+
+	if result := r.checkKeystorePasswordSecret(ctx); result.Completed() {
+		return result
+	}
+
+	if r.cluster.IsInternodeEncryptionEnabled() {
+		if _, result := r.checkTLSSecret(ctx, getInternodeTLSSettings(r.cluster)); result.Completed() {
+			return result
+		}
+	}
+
+	if r.cluster.IsClientEncryptionEnabled() {
+		secret, result := r.checkTLSSecret(ctx, getClientTLSSettings(r.cluster))
+		if result.Completed() {
+			return result
+		}
+		if result := r.checkClientCASecret(ctx, secret); result.Completed() {
+			return result
+		}
+	}
+
+	return result.Continue()
+}
+
+// checkTLSSecret creates the Certificate for tls if needed and returns the
+// secret holding the certificate once it is available.
+func (r *requestHandler) checkTLSSecret(ctx context.Context, tls *tlsSettings) (*corev1.Secret, result.ReconcileResult) {
+	if tls.source.IssuerRef != nil {
+		if result := r.checkCertificate(ctx, newCertificate(r.cluster, tls)); result.Completed() {
+			return nil, result
+		}
+	}
+
+	secret := &corev1.Secret{}
+	nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: tls.secretName}
+	if err := r.Get(ctx, nsName, secret); err != nil {
+		if errors.IsNotFound(err) {
+			r.log.Info("waiting for certificate secret", "Secret", nsName.Name)
+			return nil, result.RequeueSoon(10)
+		}
+		r.log.Error(err, "failed to get certificate secret", "Secret", nsName.Name)
+		return nil, result.Error(err)
+	}
+
+	r.addPodTemplateAnnotation(tls.hashAnnotation, deepHashString(secret.Data))
+
+	return secret, result.Continue()
+}
+
+// checkClientCASecret publishes the CA certificate of the client certificate in a
+// secret that applications can mount without getting access to the private key.
+func (r *requestHandler) checkClientCASecret(ctx context.Context, tlsSecret *corev1.Secret) result.ReconcileResult {
+	labels := r.cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+
+	desiredSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.cluster.GetClientCASecretName(),
+			Namespace: r.cluster.Namespace,
+			Labels:    labels,
+		},
+		Data: map[string][]byte{
+			caCertKey: tlsSecret.Data[caCertKey],
+		},
+	}
+	if err := controllerutil.SetControllerReference(r.cluster, desiredSecret, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for secret", "Secret", desiredSecret.Name)
+		return result.Error(err)
+	}
+
+	actualSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: desiredSecret.Namespace, Name: desiredSecret.Name}, actualSecret)
+	if err != nil && errors.IsNotFound(err) {
+		if err = r.Create(ctx, desiredSecret); err != nil {
+			r.log.Error(err, "failed to create client CA secret", "Secret", desiredSecret.Name)
+			return result.Error(err)
+		}
+	} else if err != nil {
+		r.log.Error(err, "failed to get client CA secret", "Secret", desiredSecret.Name)
+		return result.Error(err)
+	} else if !bytes.Equal(actualSecret.Data[caCertKey], desiredSecret.Data[caCertKey]) {
+		actualSecret.Data = desiredSecret.Data
+		if err = r.Update(ctx, actualSecret); err != nil {
+			r.log.Error(err, "failed to update client CA secret", "Secret", desiredSecret.Name)
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) checkKeystorePasswordSecret(ctx context.Context) result.ReconcileResult {
+	return r.checkGeneratedSecret(ctx, r.cluster.GetKeystorePasswordSecretName(), func() (map[string]string, error) {
+		password, err := generatePassword(keystorePasswordLength)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{keystorePasswordKey: password}, nil
+	})
+}
+
+func (r *requestHandler) checkCertificate(ctx context.Context, desiredCert *unstructured.Unstructured) result.ReconcileResult {
+	if err := controllerutil.SetControllerReference(r.cluster, desiredCert, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for certificate", "Certificate", desiredCert.GetName())
+		return result.Error(err)
+	}
+
+	actualCert := &unstructured.Unstructured{}
+	actualCert.SetGroupVersionKind(CertificateGVK)
+	err := r.Get(ctx, types.NamespacedName{Namespace: desiredCert.GetNamespace(), Name: desiredCert.GetName()}, actualCert)
+	if err != nil && errors.IsNotFound(err) {
+		if err = r.Create(ctx, desiredCert); err != nil {
+			r.log.Error(err, "failed to create certificate", "Certificate", desiredCert.GetName())
+			return result.Error(err)
+		}
+	} else if err != nil {
+		r.log.Error(err, "failed to get certificate", "Certificate", desiredCert.GetName())
+		return result.Error(err)
+	} else if !resourcesHaveSameHash(actualCert, desiredCert) {
+		actualCert.SetAnnotations(desiredCert.GetAnnotations())
+		actualCert.Object["spec"] = desiredCert.Object["spec"]
+		if err = r.Update(ctx, actualCert); err != nil {
+			r.log.Error(err, "failed to update certificate", "Certificate", desiredCert.GetName())
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+// newCertificate returns the cert-manager Certificate for tls
+func newCertificate(cluster *api.CassandraCluster, tls *tlsSettings) *unstructured.Unstructured {
+	issuerRef := tls.source.IssuerRef
+	issuerKind := issuerRef.Kind
+	if issuerKind == "" {
+		issuerKind = "Issuer"
+	}
+
+	var dnsNames []interface{}
+	for _, name := range tls.dnsNames {
+		dnsNames = append(dnsNames, name)
+	}
+	var usages []interface{}
+	for _, usage := range tls.usages {
+		usages = append(usages, usage)
+	}
+
+	labels := cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(CertificateGVK)
+	cert.SetName(tls.certificateName)
+	cert.SetNamespace(cluster.Namespace)
+	cert.SetLabels(labels)
+	cert.Object["spec"] = map[string]interface{}{
+		"secretName": tls.secretName,
+		"commonName": cluster.Spec.Name,
+		"dnsNames":   dnsNames,
+		"usages":     usages,
+		"issuerRef": map[string]interface{}{
+			"name":  issuerRef.Name,
+			"kind":  issuerKind,
+			"group": CertificateGVK.Group,
+		},
+	}
+
+	addHashAnnotation(cert)
+
+	return cert
+}
+
+const passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// generatePassword returns a random alphanumeric password. Only alphanumeric
+// characters are used so that the password can safely be substituted into
+// cassandra.yaml by sed.
+func generatePassword(length int) (string, error) {
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordChars[n.Int64()]
+	}
+	return string(password), nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/go-logr/logr"
 	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -27,14 +28,21 @@ type requestHandler struct {
 	scheme *runtime.Scheme
 	log logr.Logger
 	cluster *api.CassandraCluster
+	mgmtClient *mgmtapi.Client
+	featureGates FeatureGates
+	// podTemplateAnnotations are added to the pod templates of the StatefulSets
+	// by the steps that run before CheckStatefulSet
+	podTemplateAnnotations map[string]string
 }
 
-func NewRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger) RequestHandler {
+func NewRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger, featureGates FeatureGates) RequestHandler {
 	return &requestHandler{
 		request: request,
 		Client: client,
 		scheme: scheme,
 		log: log,
+		mgmtClient: mgmtapi.NewClient(),
+		featureGates: featureGates,
 	}
 }
 
@@ -44,6 +52,13 @@ func (r *requestHandler) Get(ctx context.Context, key types.NamespacedName, obj
 	return r.Client.Get(requestCtx, key, obj)
 }
 
+func (r *requestHandler) addPodTemplateAnnotation(key, value string) {
+	if r.podTemplateAnnotations == nil {
+		r.podTemplateAnnotations = make(map[string]string)
+	}
+	r.podTemplateAnnotations[key] = value
+}
+
 func (r *requestHandler) HandleRequest(ctx context.Context) (reconcile.Result, error) {
 	cluster := &api.CassandraCluster{}
 	err := r.Get(ctx, r.request.NamespacedName, cluster)
@@ -56,13 +71,46 @@ func (r *requestHandler) HandleRequest(ctx context.Context) (reconcile.Result, e
 	}
 	r.cluster = cluster
 
-	if result := r.CheckHeadlessServices(ctx); result.Completed() {
-		return result.Output()
-	}
+	defer r.recordClusterMetrics(ctx)
 
-	if result := r.CheckStatefulSet(ctx); result.Completed() {
+	if result := r.pipeline().Run(ctx, r.log, r.featureGates); result.Completed() {
 		return result.Output()
 	}
 
 	return reconcile.Result{}, nil
 }
+
+// pipeline returns the steps that reconcile the cluster in the order they run
+func (r *requestHandler) pipeline() Pipeline {
+	var steps Pipeline
+	if !r.cluster.DeletionTimestamp.IsZero() {
+		steps = append(steps, Step{Name: "CheckDeletion", Run: r.CheckDeletion})
+	} else {
+		steps = append(steps, Step{Name: "CheckFinalizer", Run: r.CheckFinalizer})
+	}
+
+	return append(steps,
+		Step{Name: "CheckHeadlessServices", Run: r.CheckHeadlessServices},
+		Step{Name: "CheckDatacenterServices", Run: r.CheckDatacenterServices},
+		Step{Name: "CheckMetrics", Feature: FeatureMetrics, Run: r.CheckMetrics},
+		Step{Name: "CheckPodDisruptionBudgets", Feature: FeaturePodDisruptionBudgets, Run: r.CheckPodDisruptionBudgets},
+		Step{Name: "CheckNetworkPolicy", Run: r.CheckNetworkPolicy},
+		Step{Name: "CheckEncryption", Run: r.CheckEncryption},
+		Step{Name: "CheckReaperCredentials", Run: r.CheckReaperCredentials},
+		Step{Name: "CheckBackupAgentCredentials", Run: r.CheckBackupAgentCredentials},
+		Step{Name: "CheckMgmtAPICredentials", Run: r.CheckMgmtAPICredentials},
+		Step{Name: "CheckNewDatacenters", Run: r.CheckNewDatacenters},
+		Step{Name: "CheckStatefulSet", Run: r.CheckStatefulSet},
+		// Node services have to be checked before waiting on a rolling restart
+		// since restarted pods do not start until they have been annotated with
+		// their broadcast address.
+		Step{Name: "CheckNodeServices", Run: r.CheckNodeServices},
+		Step{Name: "CheckReplaceNodes", Run: r.CheckReplaceNodes},
+		Step{Name: "CheckRollingRestart", Run: r.CheckRollingRestart},
+		Step{Name: "CheckSuperuser", Run: r.CheckSuperuser},
+		Step{Name: "CheckRemovedDatacenters", Run: r.CheckRemovedDatacenters},
+		Step{Name: "CheckSystemKeyspaces", Feature: FeatureSystemKeyspaces, Run: r.CheckSystemKeyspaces},
+		Step{Name: "CheckRebuild", Run: r.CheckRebuild},
+		Step{Name: "CheckReaper", Feature: FeatureReaper, Run: r.CheckReaper},
+	)
+}
@@ -10,7 +10,7 @@ import (
 const resourceHashAnnotationKey = "cassandra.datastax.com/resource-hash"
 
 // Source: http://github.com/datastax/cass-operator/blob/master/operator/pkg/reconciliation/hash_annotation.go#L20-L20
-func resourcesHaveSameHash(r1, r2 metav1.ObjectMeta) bool {
+func resourcesHaveSameHash(r1, r2 metav1.Object) bool {
 	a1 := r1.GetAnnotations()
 	a2 := r2.GetAnnotations()
 	if a1 == nil || a2 == nil {
@@ -20,7 +20,7 @@ func resourcesHaveSameHash(r1, r2 metav1.ObjectMeta) bool {
 }
 
 // Source: http://github.com/datastax/cass-operator/blob/master/operator/pkg/reconciliation/hash_annotation.go#L29-L29
-func addHashAnnotation(r metav1.ObjectMeta) {
+func addHashAnnotation(r metav1.Object) {
 	hash := deepHashString(r)
 	m := r.GetAnnotations()
 	if m == nil {
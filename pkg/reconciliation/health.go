@@ -0,0 +1,54 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// checkClusterHealth returns the reason why maintenance operations like repairs
+// should not run at the moment, or an empty string if the cluster is healthy.
+// The cluster is not healthy while a node is down or the topology or
+// configuration of the cluster is changing. The pods of the cluster are
+// returned sorted by name.
+func checkClusterHealth(ctx context.Context, c client.Client, cluster *api.CassandraCluster) (string, []corev1.Pod, error) {
+	pods, err := listPods(ctx, c, cluster.Namespace, cluster.GetClusterLabels())
+	if err != nil {
+		return "", nil, err
+	}
+
+	size := 0
+	for i := range cluster.Spec.Datacenters {
+		size += int(cluster.Spec.Datacenters[i].GetSize())
+	}
+	if len(pods) != size {
+		return fmt.Sprintf("%d of %d nodes exist", len(pods), size), pods, nil
+	}
+	for i := range pods {
+		if pods[i].DeletionTimestamp != nil || !isPodReady(&pods[i]) {
+			return fmt.Sprintf("node %s is not ready", pods[i].Name), pods, nil
+		}
+	}
+
+	for dcName, dcStatus := range cluster.Status.Datacenters {
+		if cluster.GetDatacenter(dcName) == nil {
+			return fmt.Sprintf("datacenter %s is being removed", dcName), pods, nil
+		}
+		if dcStatus.RollingRestart {
+			return fmt.Sprintf("datacenter %s is being restarted", dcName), pods, nil
+		}
+		if cluster.IsRebuildPending(dcName) {
+			return fmt.Sprintf("datacenter %s is being rebuilt", dcName), pods, nil
+		}
+	}
+
+	for _, replacement := range cluster.Status.NodeReplacements {
+		if replacement.Phase == api.ReplacementPhasePending || replacement.Phase == api.ReplacementPhaseRunning {
+			return fmt.Sprintf("node %s is being replaced", replacement.Pod), pods, nil
+		}
+	}
+
+	return "", pods, nil
+}
@@ -0,0 +1,124 @@
+package reconciliation
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type keyspaceRequestHandler struct {
+	clusterRefHandler
+	keyspace *api.CassandraKeyspace
+}
+
+func NewKeyspaceRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger) RequestHandler {
+	return &keyspaceRequestHandler{
+		clusterRefHandler: clusterRefHandler{request: request, Client: client, scheme: scheme, log: log},
+	}
+}
+
+func (r *keyspaceRequestHandler) HandleRequest(ctx context.Context) (reconcile.Result, error) {
+	keyspace := &api.CassandraKeyspace{}
+	err := r.Get(ctx, r.request.NamespacedName, keyspace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		} else {
+			return ctrl.Result{}, err
+		}
+	}
+	r.keyspace = keyspace
+	r.setObject(keyspace, func(err string) { keyspace.Status.Error = err })
+
+	if !keyspace.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if result := r.CheckCluster(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckKeyspace(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// CheckCluster looks up the cluster the keyspace belongs to and validates the
+// replication against its topology
+func (r *keyspaceRequestHandler) CheckCluster(ctx context.Context) result.ReconcileResult {
+	if res := r.checkCluster(ctx, r.keyspace.Spec.ClusterRef); res.Completed() {
+		return res
+	}
+	cluster := r.cluster
+
+	if err := cluster.ValidateReplication(r.keyspace.Spec.Replication); err != nil {
+		r.log.Info("invalid replication", "CassandraKeyspace", r.keyspace.Name, "Reason", err.Error())
+		// There is no point in retrying until either the keyspace or the cluster
+		// changes, both of which trigger a new request.
+		r.failed(ctx, err)
+		return result.Done()
+	}
+
+	if !cluster.Status.SuperuserCreated {
+		r.log.Info("waiting for the superuser to be created", "CassandraCluster", cluster.Name)
+		return result.RequeueSoon(10)
+	}
+
+	return result.Continue()
+}
+
+// CheckKeyspace creates the keyspace or updates its replication
+func (r *keyspaceRequestHandler) CheckKeyspace(ctx context.Context) result.ReconcileResult {
+	name := r.keyspace.GetKeyspaceName()
+	desired := r.keyspace.Spec.Replication
+
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to connect to cluster", "CassandraCluster", r.cluster.Name)
+		return r.failed(ctx, err)
+	}
+	defer session.Close()
+
+	actual, err := session.GetReplication(name)
+	if err != nil {
+		r.log.Error(err, "failed to get replication", "Keyspace", name)
+		return r.failed(ctx, err)
+	}
+
+	if actual == nil {
+		r.log.Info("creating keyspace", "Keyspace", name)
+		err = session.CreateKeyspace(name, desired)
+	} else if !cql.ReplicationEquals(actual, desired) {
+		r.log.Info("updating replication", "Keyspace", name, "Replication", desired)
+		err = session.AlterReplication(name, desired)
+	}
+	if err != nil {
+		r.log.Error(err, "failed to apply keyspace", "Keyspace", name)
+		return r.failed(ctx, err)
+	}
+
+	if err = r.updateStatus(ctx, func(status *api.CassandraKeyspaceStatus) {
+		status.Created = true
+		status.Replication = desired
+		status.Error = ""
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraKeyspace", r.keyspace.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// updateStatus applies mutate to the status and patches it if it has changed
+func (r *keyspaceRequestHandler) updateStatus(ctx context.Context, mutate func(status *api.CassandraKeyspaceStatus)) error {
+	return r.patchStatus(ctx, func() { mutate(&r.keyspace.Status) })
+}
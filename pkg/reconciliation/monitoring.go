@@ -0,0 +1,189 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"regexp"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ServiceMonitorGVK is the prometheus-operator ServiceMonitor kind. Like
+// Certificates, ServiceMonitors are managed as unstructured objects so that the
+// operator does not depend on the prometheus-operator API.
+var ServiceMonitorGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "ServiceMonitor",
+}
+
+// CheckMetrics makes sure that the metrics exporters of the nodes are exposed by
+// a headless service and scraped through a ServiceMonitor when metrics are
+// enabled, and removes both otherwise. A missing ServiceMonitor CRD is logged
+// rather than failing the reconciliation, since Prometheus can also discover
+// the service through other means.
+func (r *requestHandler) CheckMetrics(ctx context.Context) result.ReconcileResult {
+	serviceName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetMetricsServiceName()}
+	monitorName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetServiceMonitorName()}
+
+	if !r.cluster.IsMetricsEnabled() {
+		if result := r.deleteServiceIfExists(ctx, serviceName); result.Completed() {
+			return result
+		}
+		return r.deleteServiceMonitorIfExists(ctx, monitorName)
+	}
+
+	if result := r.reconcileService(ctx, newMetricsServiceForCassandraCluster(r.cluster)); result.Completed() {
+		return result
+	}
+
+	return r.reconcileServiceMonitor(ctx, newServiceMonitor(r.cluster))
+}
+
+func (r *requestHandler) reconcileServiceMonitor(ctx context.Context, desired *unstructured.Unstructured) result.ReconcileResult {
+	if err := controllerutil.SetControllerReference(r.cluster, desired, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for service monitor", "ServiceMonitor", desired.GetName())
+		return result.Error(err)
+	}
+
+	actual := &unstructured.Unstructured{}
+	actual.SetGroupVersionKind(ServiceMonitorGVK)
+	err := r.Get(ctx, types.NamespacedName{Namespace: desired.GetNamespace(), Name: desired.GetName()}, actual)
+	if meta.IsNoMatchError(err) {
+		r.log.Info("ServiceMonitor CRD is not installed, skipping service monitor", "ServiceMonitor", desired.GetName())
+		return result.Continue()
+	} else if err != nil && errors.IsNotFound(err) {
+		if err = r.Create(ctx, desired); err != nil {
+			r.log.Error(err, "failed to create service monitor", "ServiceMonitor", desired.GetName())
+			return result.Error(err)
+		}
+	} else if err != nil {
+		r.log.Error(err, "failed to get service monitor", "ServiceMonitor", desired.GetName())
+		return result.Error(err)
+	} else if !resourcesHaveSameHash(actual, desired) {
+		actual.SetLabels(desired.GetLabels())
+		actual.SetAnnotations(desired.GetAnnotations())
+		actual.Object["spec"] = desired.Object["spec"]
+		if err = r.Update(ctx, actual); err != nil {
+			r.log.Error(err, "failed to update service monitor", "ServiceMonitor", desired.GetName())
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) deleteServiceMonitorIfExists(ctx context.Context, nsName types.NamespacedName) result.ReconcileResult {
+	monitor := &unstructured.Unstructured{}
+	monitor.SetGroupVersionKind(ServiceMonitorGVK)
+	err := r.Get(ctx, nsName, monitor)
+	if meta.IsNoMatchError(err) || (err != nil && errors.IsNotFound(err)) {
+		return result.Continue()
+	} else if err != nil {
+		r.log.Error(err, "failed to get service monitor", "ServiceMonitor", nsName.Name)
+		return result.Error(err)
+	}
+
+	if err = r.Delete(ctx, monitor); err != nil && !errors.IsNotFound(err) {
+		r.log.Error(err, "failed to delete service monitor", "ServiceMonitor", nsName.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// newMetricsServiceForCassandraCluster returns the headless service that the
+// ServiceMonitor discovers the metrics endpoints of the nodes through
+func newMetricsServiceForCassandraCluster(cluster *api.CassandraCluster) *corev1.Service {
+	labels := cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+	labels[api.MetricsServiceLabel] = "true"
+
+	var service corev1.Service
+	service.ObjectMeta.Name = cluster.GetMetricsServiceName()
+	service.ObjectMeta.Namespace = cluster.Namespace
+	service.ObjectMeta.Labels = labels
+	service.Spec.Selector = cluster.GetClusterLabels()
+	service.Spec.Type = corev1.ServiceTypeClusterIP
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.Ports = []corev1.ServicePort{
+		{
+			Name:       metricsPortName,
+			Port:       cluster.GetMetricsPort(),
+			TargetPort: intstr.FromString(metricsPortName),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+
+	addHashAnnotation(&service)
+
+	return &service
+}
+
+// newServiceMonitor returns the ServiceMonitor that scrapes the metrics
+// exporters of the cluster. The cluster, datacenter and rack labels of the pods
+// are attached to the scraped metrics as cluster, dc and rack.
+func newServiceMonitor(cluster *api.CassandraCluster) *unstructured.Unstructured {
+	labels := cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+	for k, v := range cluster.Spec.Metrics.ServiceMonitorLabels {
+		labels[k] = v
+	}
+
+	selectorLabels := map[string]interface{}{}
+	for k, v := range cluster.GetClusterLabels() {
+		selectorLabels[k] = v
+	}
+	selectorLabels[api.MetricsServiceLabel] = "true"
+
+	endpoint := map[string]interface{}{
+		"port": metricsPortName,
+		"path": "/metrics",
+		"relabelings": []interface{}{
+			newPodLabelRelabeling(api.ClusterLabel, "cluster"),
+			newPodLabelRelabeling(api.DatacenterLabel, "dc"),
+			newPodLabelRelabeling(api.RackLabel, "rack"),
+		},
+	}
+	if cluster.Spec.Metrics.ScrapeInterval != "" {
+		endpoint["interval"] = cluster.Spec.Metrics.ScrapeInterval
+	}
+
+	monitor := &unstructured.Unstructured{}
+	monitor.SetGroupVersionKind(ServiceMonitorGVK)
+	monitor.SetName(cluster.GetServiceMonitorName())
+	monitor.SetNamespace(cluster.Namespace)
+	monitor.SetLabels(labels)
+	monitor.Object["spec"] = map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": selectorLabels,
+		},
+		"namespaceSelector": map[string]interface{}{
+			"matchNames": []interface{}{cluster.Namespace},
+		},
+		"endpoints": []interface{}{endpoint},
+	}
+
+	addHashAnnotation(monitor)
+
+	return monitor
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// newPodLabelRelabeling returns a relabeling that copies the pod label to the
+// target label of the scraped metrics. Prometheus exposes pod labels as meta
+// labels with the characters that are invalid in label names replaced.
+func newPodLabelRelabeling(podLabel, targetLabel string) map[string]interface{} {
+	return map[string]interface{}{
+		"sourceLabels": []interface{}{"__meta_kubernetes_pod_label_" + invalidLabelChars.ReplaceAllString(podLabel, "_")},
+		"targetLabel":  targetLabel,
+	}
+}
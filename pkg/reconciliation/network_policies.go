@@ -0,0 +1,103 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// operatorPodLabels select the pods of the operator, see config/manager. The
+// operator runs in the namespace of the clusters it manages.
+var operatorPodLabels = map[string]string{
+	"app.kubernetes.io/name": "cassandra-operator",
+}
+
+// CheckNetworkPolicy makes sure that only the operator can reach the management
+// API of the nodes. All other ports of the pods stay open, since a NetworkPolicy
+// that selects the pods denies the traffic it does not allow. Pods that use the
+// host network are not subject to NetworkPolicies and rely on the client
+// certificate required by the management API alone.
+func (r *requestHandler) CheckNetworkPolicy(ctx context.Context) result.ReconcileResult {
+	desired, err := newNetworkPolicyForCassandraCluster(r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to create network policy")
+		return result.Error(err)
+	}
+	if err = controllerutil.SetControllerReference(r.cluster, desired, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for network policy", "NetworkPolicy", desired.Name)
+		return result.Error(err)
+	}
+
+	actual := &networkingv1.NetworkPolicy{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, actual)
+	if err != nil && errors.IsNotFound(err) {
+		r.log.Info("creating network policy", "NetworkPolicy", desired.Name)
+		if err = r.Create(ctx, desired); err != nil {
+			r.log.Error(err, "failed to create network policy", "NetworkPolicy", desired.Name)
+			return result.Error(err)
+		}
+	} else if err != nil {
+		r.log.Error(err, "could not get network policy", "NetworkPolicy", desired.Name)
+		return result.Error(err)
+	} else if !resourcesHaveSameHash(actual, desired) {
+		actual.Labels = desired.Labels
+		actual.Annotations = desired.Annotations
+		actual.Spec = desired.Spec
+		if err = r.Update(ctx, actual); err != nil {
+			r.log.Error(err, "failed to update network policy", "NetworkPolicy", desired.Name)
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+func newNetworkPolicyForCassandraCluster(cluster *api.CassandraCluster) (*networkingv1.NetworkPolicy, error) {
+	labels := cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+
+	containers, err := buildContainers(cluster, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var openPorts, mgmtAPIPorts []networkingv1.NetworkPolicyPort
+	for _, container := range containers {
+		for _, port := range container.Ports {
+			protocol := port.Protocol
+			policyPort := networkingv1.NetworkPolicyPort{
+				Protocol: &protocol,
+				Port:     &intstr.IntOrString{Type: intstr.Int, IntVal: port.ContainerPort},
+			}
+			if port.Name == mgmtAPIPortName {
+				mgmtAPIPorts = append(mgmtAPIPorts, policyPort)
+			} else {
+				openPorts = append(openPorts, policyPort)
+			}
+		}
+	}
+
+	var policy networkingv1.NetworkPolicy
+	policy.ObjectMeta.Name = cluster.GetNetworkPolicyName()
+	policy.ObjectMeta.Namespace = cluster.Namespace
+	policy.ObjectMeta.Labels = labels
+	policy.Spec.PodSelector = metav1.LabelSelector{MatchLabels: cluster.GetClusterLabels()}
+	policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	policy.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{
+		{Ports: openPorts},
+		{
+			Ports: mgmtAPIPorts,
+			From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: operatorPodLabels}}},
+		},
+	}
+
+	addHashAnnotation(&policy)
+
+	return &policy, nil
+}
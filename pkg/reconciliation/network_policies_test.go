@@ -0,0 +1,42 @@
+package reconciliation
+
+import (
+	"testing"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewNetworkPolicyOnlyAdmitsOperatorToMgmtAPI(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &api.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: api.CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []api.Datacenter{{Name: "dc1"}},
+		},
+	}
+
+	policy, err := newNetworkPolicyForCassandraCluster(cluster)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(cluster.GetClusterLabels()))
+
+	for _, rule := range policy.Spec.Ingress {
+		for _, port := range rule.Ports {
+			if port.Port.IntVal == mgmtapi.DefaultPort {
+				g.Expect(rule.From).To(HaveLen(1))
+				g.Expect(rule.From[0].PodSelector.MatchLabels).To(Equal(operatorPodLabels))
+			}
+		}
+		if rule.From == nil {
+			g.Expect(rule.Ports).ToNot(BeEmpty())
+		}
+	}
+
+	for _, port := range createServicePorts(cluster) {
+		g.Expect(port.Name).ToNot(Equal(mgmtAPIPortName))
+	}
+}
@@ -0,0 +1,193 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NodeServiceLabel marks the per-pod services so that they can be found and
+// removed when node services are disabled.
+const NodeServiceLabel = "cassandra.apache.org/node-service"
+
+// CheckNodeServices creates a NodePort or LoadBalancer service for every pod when
+// Spec.Networking.NodeServices is set and annotates the pod with the address of
+// its service. The broadcast-address-init container waits for that annotation
+// and uses it for broadcast_rpc_address, so that drivers outside of Kubernetes
+// can reach every node they discover through the peers table. The services of
+// pods that have been removed by scaling down a rack or removing a datacenter
+// are deleted.
+func (r *requestHandler) CheckNodeServices(ctx context.Context) result.ReconcileResult {
+	if r.cluster.Spec.Networking.NodeServices == nil {
+		return r.deleteNodeServices(ctx)
+	}
+
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(r.cluster.GetClusterLabels())); err != nil {
+		r.log.Error(err, "failed to list pods")
+		return result.Error(err)
+	}
+
+	pending := false
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+
+		if result := r.reconcileService(ctx, newNodeServiceForPod(r.cluster, pod)); result.Completed() {
+			return result
+		}
+
+		svc := &corev1.Service{}
+		nsName := types.NamespacedName{Namespace: pod.Namespace, Name: r.cluster.GetNodeServiceName(pod.Name)}
+		if err := r.Get(ctx, nsName, svc); err != nil {
+			r.log.Error(err, "could not get node service", "Service", nsName.Name)
+			return result.Error(err)
+		}
+
+		address := getNodeServiceAddress(svc, pod)
+		if address == "" {
+			pending = true
+			continue
+		}
+
+		if pod.Annotations[api.BroadcastRPCAddressAnnotation] != address {
+			patch := client.MergeFrom(pod.DeepCopy())
+			if pod.Annotations == nil {
+				pod.Annotations = make(map[string]string)
+			}
+			pod.Annotations[api.BroadcastRPCAddressAnnotation] = address
+			if err := r.Patch(ctx, pod, patch); err != nil {
+				r.log.Error(err, "failed to annotate pod with broadcast address", "Pod", pod.Name)
+				return result.Error(err)
+			}
+		}
+	}
+
+	if result := r.deleteStaleNodeServices(ctx, podList.Items); result.Completed() {
+		return result
+	}
+
+	if pending {
+		r.log.Info("waiting for node services to be assigned an address")
+		return result.RequeueSoon(10)
+	}
+
+	return result.Continue()
+}
+
+// deleteStaleNodeServices deletes the node services whose pod does not exist
+// and is not part of the cluster anymore, i.e. its rack has been removed or its
+// ordinal is at or above the number of nodes of the rack. The service of a pod
+// that is only being recreated is kept so that the pod keeps its address.
+func (r *requestHandler) deleteStaleNodeServices(ctx context.Context, pods []corev1.Pod) result.ReconcileResult {
+	labels := r.cluster.GetClusterLabels()
+	labels[NodeServiceLabel] = "true"
+
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(labels)); err != nil {
+		r.log.Error(err, "failed to list node services")
+		return result.Error(err)
+	}
+
+	nodes := make(map[string]bool)
+	for i := range r.cluster.Spec.Datacenters {
+		dc := &r.cluster.Spec.Datacenters[i]
+		for _, rack := range dc.GetRacks() {
+			statefulSet := newNamespacedNameForStatefulSet(r.cluster, dc.Name, rack.Name)
+			for ordinal := int32(0); ordinal < dc.GetNodesPerRack(); ordinal++ {
+				nodes[fmt.Sprintf("%s-%d", statefulSet.Name, ordinal)] = true
+			}
+		}
+	}
+	for i := range pods {
+		nodes[pods[i].Name] = true
+	}
+
+	for i := range serviceList.Items {
+		svc := &serviceList.Items[i]
+		if nodes[svc.Spec.Selector[appsv1.StatefulSetPodNameLabel]] {
+			continue
+		}
+		r.log.Info("deleting node service of removed pod", "Service", svc.Name)
+		if result := r.deleteServiceIfExists(ctx, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}); result.Completed() {
+			return result
+		}
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) deleteNodeServices(ctx context.Context) result.ReconcileResult {
+	labels := r.cluster.GetClusterLabels()
+	labels[NodeServiceLabel] = "true"
+
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(labels)); err != nil {
+		r.log.Error(err, "failed to list node services")
+		return result.Error(err)
+	}
+
+	for i := range serviceList.Items {
+		nsName := types.NamespacedName{Namespace: serviceList.Items[i].Namespace, Name: serviceList.Items[i].Name}
+		if result := r.deleteServiceIfExists(ctx, nsName); result.Completed() {
+			return result
+		}
+	}
+
+	return result.Continue()
+}
+
+func newNodeServiceForPod(cluster *api.CassandraCluster, pod *corev1.Pod) *corev1.Service {
+	labels := cluster.GetClusterLabels()
+	labels[NodeServiceLabel] = "true"
+	api.AddManagedByLabel(labels)
+
+	annotations := make(map[string]string)
+	for k, v := range cluster.Spec.Networking.NodeServices.Annotations {
+		annotations[k] = v
+	}
+
+	selector := cluster.GetClusterLabels()
+	selector[appsv1.StatefulSetPodNameLabel] = pod.Name
+
+	var service corev1.Service
+	service.ObjectMeta.Name = cluster.GetNodeServiceName(pod.Name)
+	service.ObjectMeta.Namespace = cluster.Namespace
+	service.ObjectMeta.Labels = labels
+	service.ObjectMeta.Annotations = annotations
+	service.Spec.Selector = selector
+	service.Spec.Type = cluster.Spec.Networking.NodeServices.Type
+	service.Spec.Ports = createClientServicePorts(cluster)
+	// Only route to the selected pod when traffic arrives on another node
+	service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeLocal
+	service.Spec.PublishNotReadyAddresses = true
+
+	addHashAnnotation(&service)
+
+	return &service
+}
+
+// getNodeServiceAddress returns the address clients should use to reach pod
+// through svc, or an empty string if it is not known yet.
+func getNodeServiceAddress(svc *corev1.Service, pod *corev1.Pod) string {
+	switch svc.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return ingress.IP
+			}
+			if ingress.Hostname != "" {
+				return ingress.Hostname
+			}
+		}
+		return ""
+	case corev1.ServiceTypeNodePort:
+		return pod.Status.HostIP
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,66 @@
+package reconciliation
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestDeleteStaleNodeServices(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(api.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &api.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: api.CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []api.Datacenter{{Name: "dc1", NodesPerRack: 2}},
+			Networking:  api.NetworkingSpec{NodeServices: &api.NodeServicesSpec{Type: corev1.ServiceTypeLoadBalancer}},
+		},
+	}
+
+	pods := []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test-dc1-rack-1-sts-0",
+			Labels:    cluster.GetDatacenterLabels("dc1"),
+		},
+	}}
+	var objects []runtime.Object
+	// The pod of sts-1 is being recreated, sts-2 has been scaled away and dc2
+	// has been removed
+	for _, name := range []string{"test-dc1-rack-1-sts-0", "test-dc1-rack-1-sts-1", "test-dc1-rack-1-sts-2", "test-dc2-rack-1-sts-0"} {
+		objects = append(objects, newNodeServiceForPod(cluster, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+
+	r := &requestHandler{
+		Client:  fake.NewFakeClientWithScheme(scheme, objects...),
+		scheme:  scheme,
+		log:     log.Log,
+		cluster: cluster,
+	}
+
+	ctx := context.Background()
+	g.Expect(r.deleteStaleNodeServices(ctx, pods).Completed()).To(BeFalse())
+
+	services := &corev1.ServiceList{}
+	g.Expect(r.List(ctx, services, client.InNamespace("default"))).To(Succeed())
+	var remaining []string
+	for _, svc := range services.Items {
+		remaining = append(remaining, svc.Spec.Selector[appsv1.StatefulSetPodNameLabel])
+	}
+	g.Expect(remaining).To(ConsistOf("test-dc1-rack-1-sts-0", "test-dc1-rack-1-sts-1"))
+}
@@ -0,0 +1,125 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/jsanda/cassandra-operator/pkg/metrics"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Features that can be turned off with feature gates. The operator leaves the
+// resources of a disabled step as they are, it neither updates nor deletes them.
+const (
+	// FeatureMetrics reconciles the metrics service and the ServiceMonitor
+	FeatureMetrics = "Metrics"
+
+	// FeaturePodDisruptionBudgets reconciles the PodDisruptionBudgets of the
+	// datacenters
+	FeaturePodDisruptionBudgets = "PodDisruptionBudgets"
+
+	// FeatureSystemKeyspaces adjusts the replication of the system keyspaces to
+	// the datacenters of the cluster
+	FeatureSystemKeyspaces = "SystemKeyspaces"
+
+	// FeatureReaper deploys Reaper and registers the cluster with it
+	FeatureReaper = "Reaper"
+)
+
+var knownFeatures = map[string]bool{
+	FeatureMetrics:              true,
+	FeaturePodDisruptionBudgets: true,
+	FeatureSystemKeyspaces:      true,
+	FeatureReaper:               true,
+}
+
+// FeatureGates turns features of the operator on or off. Features are enabled
+// unless they are turned off.
+type FeatureGates map[string]bool
+
+// ParseFeatureGates parses a comma-separated list of feature=bool pairs, e.g.
+// Reaper=false,Metrics=true
+func ParseFeatureGates(s string) (FeatureGates, error) {
+	gates := FeatureGates{}
+	for _, gate := range strings.Split(s, ",") {
+		gate = strings.TrimSpace(gate)
+		if gate == "" {
+			continue
+		}
+		parts := strings.SplitN(gate, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid feature gate %s, expected feature=bool", gate)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !knownFeatures[name] {
+			return nil, fmt.Errorf("unknown feature %s, known features are %s", name, strings.Join(KnownFeatures(), ", "))
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for feature %s: %s", name, err)
+		}
+		gates[name] = enabled
+	}
+	return gates, nil
+}
+
+// KnownFeatures returns the names of the features that can be turned off
+func KnownFeatures() []string {
+	features := make([]string, 0, len(knownFeatures))
+	for feature := range knownFeatures {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// Enabled returns true unless the feature has been turned off
+func (g FeatureGates) Enabled(feature string) bool {
+	if enabled, found := g[feature]; found {
+		return enabled
+	}
+	return true
+}
+
+// Step is a named step of a reconciliation
+type Step struct {
+	Name string
+
+	// Feature is the feature gate that turns the step off. Steps without a
+	// feature always run.
+	Feature string
+
+	Run func(ctx context.Context) result.ReconcileResult
+}
+
+// Pipeline is an ordered list of steps. The steps run one after another until
+// a step completes the reconciliation, e.g. to requeue the request while it
+// waits for pods to start.
+type Pipeline []Step
+
+// Run runs the steps that are enabled by gates and records how long each of
+// them took. It returns the result of the step that completed the
+// reconciliation, or Continue when all the steps continued.
+func (p Pipeline) Run(ctx context.Context, log logr.Logger, gates FeatureGates) result.ReconcileResult {
+	for _, step := range p {
+		if step.Feature != "" && !gates.Enabled(step.Feature) {
+			log.V(1).Info("skipping disabled step", "Step", step.Name, "Feature", step.Feature)
+			continue
+		}
+
+		start := time.Now()
+		stepResult := step.Run(ctx)
+		duration := time.Since(start)
+		metrics.ReconcileStepDuration.WithLabelValues(step.Name).Observe(duration.Seconds())
+		log.V(1).Info("finished step", "Step", step.Name, "Duration", duration.String(), "Completed", stepResult.Completed())
+
+		if stepResult.Completed() {
+			return stepResult
+		}
+	}
+	return result.Continue()
+}
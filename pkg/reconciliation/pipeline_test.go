@@ -0,0 +1,149 @@
+package reconciliation
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestPipeline(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var ran []string
+	step := func(name string, stepResult result.ReconcileResult) func(context.Context) result.ReconcileResult {
+		return func(ctx context.Context) result.ReconcileResult {
+			ran = append(ran, name)
+			return stepResult
+		}
+	}
+
+	pipeline := Pipeline{
+		{Name: "First", Run: step("First", result.Continue())},
+		{Name: "Reaper", Feature: FeatureReaper, Run: step("Reaper", result.Continue())},
+		{Name: "Requeue", Run: step("Requeue", result.RequeueSoon(10))},
+		{Name: "Last", Run: step("Last", result.Continue())},
+	}
+
+	stepResult := pipeline.Run(context.Background(), log.Log, FeatureGates{})
+	g.Expect(stepResult.Completed()).To(BeTrue())
+	g.Expect(ran).To(Equal([]string{"First", "Reaper", "Requeue"}))
+
+	ran = nil
+	stepResult = pipeline.Run(context.Background(), log.Log, FeatureGates{FeatureReaper: false})
+	g.Expect(stepResult.Completed()).To(BeTrue())
+	g.Expect(ran).To(Equal([]string{"First", "Requeue"}))
+
+	ran = nil
+	stepResult = pipeline[:2].Run(context.Background(), log.Log, nil)
+	g.Expect(stepResult.Completed()).To(BeFalse())
+	g.Expect(ran).To(Equal([]string{"First", "Reaper"}))
+}
+
+// TestDisabledFeatureDoesNotStallPipeline runs the steps from the first one that
+// records state for a later step with each feature turned off in turn. A new
+// datacenter whose nodes have all been rebuilt has to finish its rebuild and
+// let the pipeline run to the end.
+func TestDisabledFeatureDoesNotStallPipeline(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(api.AddToScheme(scheme)).To(Succeed())
+
+	for _, feature := range KnownFeatures() {
+		cluster := &api.CassandraCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: api.CassandraClusterSpec{
+				Name: "test",
+				Datacenters: []api.Datacenter{
+					{Name: "dc1", NodesPerRack: 1},
+					{Name: "dc2", NodesPerRack: 1},
+				},
+			},
+			Status: api.CassandraClusterStatus{
+				SuperuserCreated: true,
+				Datacenters: map[string]api.DatacenterStatus{
+					"dc1": {},
+					"dc2": {
+						Rebuild: &api.RebuildStatus{
+							SourceDatacenter: "dc1",
+							Phase:            api.RebuildPhaseRunning,
+							RebuiltNodes:     []string{"test-dc2-rack1-0"},
+						},
+					},
+				},
+			},
+		}
+		if feature != FeatureSystemKeyspaces {
+			// The state that CheckSystemKeyspaces records when it is enabled
+			cluster.Status.SystemReplication = cluster.GetSystemReplication()
+		}
+
+		var objects []runtime.Object
+		for _, dc := range []string{"dc1", "dc2"} {
+			objects = append(objects, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "test-" + dc + "-rack1-0",
+					Labels:    cluster.GetDatacenterLabels(dc),
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+				},
+			})
+		}
+		objects = append(objects, cluster)
+
+		r := &requestHandler{
+			Client:       fake.NewFakeClientWithScheme(scheme, objects...),
+			scheme:       scheme,
+			log:          log.Log,
+			cluster:      cluster,
+			featureGates: FeatureGates{feature: false},
+		}
+
+		var steps Pipeline
+		for _, step := range r.pipeline() {
+			if step.Name == "CheckSystemKeyspaces" || len(steps) > 0 {
+				steps = append(steps, step)
+			}
+		}
+		g.Expect(steps).ToNot(BeEmpty())
+
+		stepResult := steps.Run(context.Background(), log.Log, r.featureGates)
+		g.Expect(stepResult.Completed()).To(BeFalse(), "pipeline stalled with %s turned off", feature)
+		g.Expect(cluster.IsRebuildPending("dc2")).To(BeFalse(), "rebuild did not finish with %s turned off", feature)
+	}
+}
+
+func TestParseFeatureGates(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gates, err := ParseFeatureGates("")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gates.Enabled(FeatureReaper)).To(BeTrue())
+
+	gates, err = ParseFeatureGates("Reaper=false, Metrics=true")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gates.Enabled(FeatureReaper)).To(BeFalse())
+	g.Expect(gates.Enabled(FeatureMetrics)).To(BeTrue())
+	g.Expect(gates.Enabled(FeaturePodDisruptionBudgets)).To(BeTrue())
+
+	_, err = ParseFeatureGates("Unknown=false")
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = ParseFeatureGates("Reaper")
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = ParseFeatureGates("Reaper=maybe")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,480 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/reaper"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	reaperAppPortName   = "app"
+	reaperAdminPortName = "admin"
+	reaperAdminPort     = 8081
+
+	// reaperScheduleOwner is the owner of the repair schedules created by the
+	// operator
+	reaperScheduleOwner = "cassandra-operator"
+)
+
+// systemKeyspaces are the keyspaces that are local to each node or managed by
+// Cassandra. They do not get a repair schedule and are not restored in place.
+var systemKeyspaces = map[string]bool{
+	"system":             true,
+	"system_schema":      true,
+	"system_auth":        true,
+	"system_distributed": true,
+	"system_traces":      true,
+}
+
+// CheckReaper deploys Reaper for the cluster, registers the cluster with it and
+// creates a repair schedule for every application keyspace. Reaper stores its
+// state in the cluster with a role that the superuser creates, so nothing
+// happens until the superuser has been created. Keyspaces that are created
+// later get a schedule the next time the cluster is reconciled. Reaper is
+// removed again once Spec.Reaper is unset.
+func (r *requestHandler) CheckReaper(ctx context.Context) result.ReconcileResult {
+	if r.cluster.Spec.Reaper == nil {
+		return r.removeReaper(ctx)
+	}
+
+	if !r.cluster.Status.SuperuserCreated {
+		return result.Continue()
+	}
+
+	if r.cluster.IsClientEncryptionEnabled() {
+		r.log.Info("Reaper is not supported with client encryption yet")
+		return result.Continue()
+	}
+
+	status := &api.ReaperStatus{}
+	if r.cluster.Status.Reaper != nil {
+		status = r.cluster.Status.Reaper.DeepCopy()
+	}
+
+	if !status.KeyspaceCreated {
+		if err := r.createReaperKeyspace(ctx); err != nil {
+			r.log.Error(err, "failed to create Reaper keyspace", "Keyspace", r.cluster.GetReaperKeyspace())
+			return result.RequeueSoon(10)
+		}
+		status.KeyspaceCreated = true
+		if err := r.updateReaperStatus(ctx, status); err != nil {
+			return result.Error(err)
+		}
+	}
+
+	if !status.RoleCreated {
+		if err := r.createReaperRole(ctx); err != nil {
+			r.log.Error(err, "failed to create Reaper role")
+			return result.RequeueSoon(10)
+		}
+		status.RoleCreated = true
+		if err := r.updateReaperStatus(ctx, status); err != nil {
+			return result.Error(err)
+		}
+	}
+
+	if res := r.reconcileReaperDeployment(ctx); res.Completed() {
+		return res
+	}
+
+	if res := r.reconcileService(ctx, newReaperService(r.cluster)); res.Completed() {
+		return res
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetReaperName()}, deployment); err != nil {
+		r.log.Error(err, "failed to get deployment", "Deployment", r.cluster.GetReaperName())
+		return result.Error(err)
+	}
+	if deployment.Status.ReadyReplicas < 1 {
+		r.log.Info("waiting for Reaper to be ready", "Deployment", deployment.Name)
+		return result.RequeueSoon(15)
+	}
+
+	client, err := r.newReaperClient(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to log in to Reaper")
+		return result.RequeueSoon(30)
+	}
+
+	if !status.ClusterRegistered {
+		if err := r.registerReaperCluster(ctx, client); err != nil {
+			r.log.Error(err, "failed to register cluster with Reaper")
+			return result.RequeueSoon(30)
+		}
+		status.ClusterRegistered = true
+		if err := r.updateReaperStatus(ctx, status); err != nil {
+			return result.Error(err)
+		}
+	}
+
+	if err := r.checkRepairSchedules(ctx, client, status); err != nil {
+		r.log.Error(err, "failed to create repair schedules")
+		return result.RequeueSoon(30)
+	}
+	if err := r.updateReaperStatus(ctx, status); err != nil {
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) createReaperKeyspace(ctx context.Context) error {
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return session.CreateKeyspace(r.cluster.GetReaperKeyspace(), r.cluster.GetSystemReplication())
+}
+
+// createReaperRole creates the role Reaper logs in to Cassandra with and grants
+// it access to the Reaper keyspace only
+func (r *requestHandler) createReaperRole(ctx context.Context) error {
+	username, password, err := r.getCredentials(ctx, r.cluster.GetReaperCQLSecretName())
+	if err != nil {
+		return err
+	}
+
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	r.log.Info("creating Reaper role", "Role", username)
+	if err = session.CreateRole(username, password, true, false); err != nil {
+		return err
+	}
+	return session.Grant("ALL", cql.DataResource(r.cluster.GetReaperKeyspace(), ""), username)
+}
+
+// removeReaper unregisters the cluster from Reaper and deletes Reaper along with
+// its role and credentials once Spec.Reaper has been unset. The Reaper keyspace
+// is kept, so that the repair history is still there if Reaper is deployed
+// again.
+func (r *requestHandler) removeReaper(ctx context.Context) result.ReconcileResult {
+	status := r.cluster.Status.Reaper
+	if status != nil {
+		r.unregisterReaperCluster(ctx)
+
+		if status.RoleCreated {
+			if err := r.dropReaperRole(ctx); err != nil {
+				r.log.Error(err, "failed to drop Reaper role")
+				return result.RequeueSoon(10)
+			}
+		}
+	}
+
+	if res := r.deleteDeploymentIfExists(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetReaperName()}); res.Completed() {
+		return res
+	}
+	if res := r.deleteServiceIfExists(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetReaperName()}); res.Completed() {
+		return res
+	}
+	// CheckStatefulSet has already removed the JMX secret from the pod
+	// templates, so the pods that are restarted next do not need it
+	for _, name := range []string{r.cluster.GetJMXSecretName(), r.cluster.GetReaperAuthSecretName(), r.cluster.GetReaperCQLSecretName()} {
+		if res := r.deleteSecretIfExists(ctx, name); res.Completed() {
+			return res
+		}
+	}
+
+	if status != nil {
+		if err := r.patchStatus(ctx, func(clusterStatus *api.CassandraClusterStatus) {
+			clusterStatus.Reaper = nil
+		}); err != nil {
+			r.log.Error(err, "failed to update status")
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+// dropReaperRole drops the role Reaper logged in to Cassandra with
+func (r *requestHandler) dropReaperRole(ctx context.Context) error {
+	username, _, err := r.getCredentials(ctx, r.cluster.GetReaperCQLSecretName())
+	if errors.IsNotFound(err) {
+		username = reaperCQLUsername
+	} else if err != nil {
+		return err
+	}
+
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	r.log.Info("dropping Reaper role", "Role", username)
+	return session.DropRole(username)
+}
+
+func (r *requestHandler) registerReaperCluster(ctx context.Context, client *reaper.Client) error {
+	clusterName := r.cluster.Spec.Name
+	exists, err := client.ClusterExists(ctx, clusterName)
+	if err != nil || exists {
+		return err
+	}
+
+	r.log.Info("registering cluster with Reaper")
+	seedHost := fmt.Sprintf("%s.%s", r.cluster.GetAllPodsServiceName(), r.cluster.Namespace)
+	return client.AddCluster(ctx, clusterName, seedHost, r.cluster.GetJMXPort())
+}
+
+// checkRepairSchedules creates a repair schedule for each application keyspace
+// that does not have one yet and records the schedules in status
+func (r *requestHandler) checkRepairSchedules(ctx context.Context, client *reaper.Client, status *api.ReaperStatus) error {
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	keyspaces, err := session.ListReplication()
+	if err != nil {
+		return err
+	}
+
+	schedules, err := client.GetRepairSchedules(ctx, r.cluster.Spec.Name)
+	if err != nil {
+		return err
+	}
+
+	scheduleIDs := make(map[string]string)
+	for _, schedule := range schedules {
+		scheduleIDs[schedule.Keyspace] = schedule.ID
+	}
+
+	for keyspace := range keyspaces {
+		if systemKeyspaces[keyspace] || keyspace == r.cluster.GetReaperKeyspace() {
+			continue
+		}
+		if _, found := scheduleIDs[keyspace]; found {
+			continue
+		}
+
+		r.log.Info("creating repair schedule", "Keyspace", keyspace)
+		schedule, err := client.CreateRepairSchedule(ctx, reaper.RepairScheduleOptions{
+			ClusterName:         r.cluster.Spec.Name,
+			Keyspace:            keyspace,
+			Owner:               reaperScheduleOwner,
+			ScheduleDaysBetween: r.cluster.GetRepairScheduleDaysBetween(),
+			Intensity:           r.cluster.Spec.Reaper.Intensity,
+		})
+		if err != nil {
+			return err
+		}
+		scheduleIDs[keyspace] = schedule.ID
+	}
+
+	status.Schedules = make(map[string]string)
+	for keyspace, id := range scheduleIDs {
+		if _, found := keyspaces[keyspace]; found {
+			status.Schedules[keyspace] = id
+		}
+	}
+
+	return nil
+}
+
+func (r *requestHandler) updateReaperStatus(ctx context.Context, status *api.ReaperStatus) error {
+	if r.cluster.Status.Reaper != nil && equality.Semantic.DeepEqual(*r.cluster.Status.Reaper, *status) {
+		return nil
+	}
+
+	err := r.patchStatus(ctx, func(clusterStatus *api.CassandraClusterStatus) {
+		clusterStatus.Reaper = status.DeepCopy()
+	})
+	if err != nil {
+		r.log.Error(err, "failed to update status")
+	}
+	return err
+}
+
+func (r *requestHandler) reconcileReaperDeployment(ctx context.Context) result.ReconcileResult {
+	desired := newReaperDeployment(r.cluster)
+	if err := controllerutil.SetControllerReference(r.cluster, desired, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for deployment", "Deployment", desired.Name)
+		return result.Error(err)
+	}
+
+	actual := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, actual)
+	if err != nil && errors.IsNotFound(err) {
+		r.log.Info("creating Reaper deployment", "Deployment", desired.Name)
+		if err = r.Create(ctx, desired); err != nil {
+			r.log.Error(err, "failed to create deployment", "Deployment", desired.Name)
+			return result.Error(err)
+		}
+	} else if err != nil {
+		r.log.Error(err, "failed to get deployment", "Deployment", desired.Name)
+		return result.Error(err)
+	} else if !resourcesHaveSameHash(actual, desired) {
+		r.log.Info("updating Reaper deployment", "Deployment", desired.Name)
+		actual.Labels = desired.Labels
+		actual.Annotations = desired.Annotations
+		actual.Spec.Template = desired.Spec.Template
+		if err = r.Update(ctx, actual); err != nil {
+			r.log.Error(err, "failed to update deployment", "Deployment", desired.Name)
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) deleteDeploymentIfExists(ctx context.Context, nsName types.NamespacedName) result.ReconcileResult {
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, nsName, deployment)
+	if err != nil && errors.IsNotFound(err) {
+		return result.Continue()
+	} else if err != nil {
+		r.log.Error(err, "failed to get deployment", "Deployment", nsName.Name)
+		return result.Error(err)
+	}
+
+	r.log.Info("deleting deployment", "Deployment", nsName.Name)
+	if err = r.Delete(ctx, deployment); err != nil && !errors.IsNotFound(err) {
+		r.log.Error(err, "failed to delete deployment", "Deployment", nsName.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// getReaperURL returns the URL of the REST API of the Reaper instance
+func getReaperURL(cluster *api.CassandraCluster) string {
+	return fmt.Sprintf("http://%s.%s:%d", cluster.GetReaperName(), cluster.Namespace, api.DefaultReaperPort)
+}
+
+// newReaperClient returns a client for the Reaper instance of the cluster that
+// has logged in with the credentials from the Reaper auth secret
+func (r *requestHandler) newReaperClient(ctx context.Context) (*reaper.Client, error) {
+	username, password, err := r.getCredentials(ctx, r.cluster.GetReaperAuthSecretName())
+	if err != nil {
+		return nil, err
+	}
+	client := reaper.NewClient(getReaperURL(r.cluster))
+	if err = client.Login(ctx, username, password); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func newReaperService(cluster *api.CassandraCluster) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetReaperName(),
+			Namespace: cluster.Namespace,
+			Labels:    cluster.GetReaperLabels(),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: cluster.GetReaperLabels(),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       reaperAppPortName,
+					Port:       api.DefaultReaperPort,
+					TargetPort: intstr.FromString(reaperAppPortName),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	addHashAnnotation(service)
+
+	return service
+}
+
+func newReaperDeployment(cluster *api.CassandraCluster) *appsv1.Deployment {
+	labels := cluster.GetReaperLabels()
+	api.AddManagedByLabel(labels)
+	replicas := int32(1)
+
+	var contactPoints []string
+	for _, dc := range cluster.Spec.Datacenters {
+		contactPoints = append(contactPoints, cluster.GetDatacenterServiceName(dc.Name))
+	}
+
+	container := corev1.Container{
+		Name:            "reaper",
+		Image:           cluster.GetReaperImage(),
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Ports: []corev1.ContainerPort{
+			{Name: reaperAppPortName, ContainerPort: api.DefaultReaperPort, Protocol: corev1.ProtocolTCP},
+			{Name: reaperAdminPortName, ContainerPort: reaperAdminPort, Protocol: corev1.ProtocolTCP},
+		},
+		Env: []corev1.EnvVar{
+			{Name: "REAPER_STORAGE_TYPE", Value: "cassandra"},
+			{Name: "REAPER_CASS_CLUSTER_NAME", Value: cluster.Spec.Name},
+			{Name: "REAPER_CASS_CONTACT_POINTS", Value: "[" + strings.Join(contactPoints, ", ") + "]"},
+			{Name: "REAPER_CASS_PORT", Value: strconv.Itoa(int(cluster.GetCQLPort()))},
+			{Name: "REAPER_CASS_KEYSPACE", Value: cluster.GetReaperKeyspace()},
+			{Name: "REAPER_CASS_AUTH_ENABLED", Value: "true"},
+			{Name: "REAPER_CASS_AUTH_USERNAME", ValueFrom: selectorFromSecretKey(cluster.GetReaperCQLSecretName(), credentialsUsernameKey)},
+			{Name: "REAPER_CASS_AUTH_PASSWORD", ValueFrom: selectorFromSecretKey(cluster.GetReaperCQLSecretName(), credentialsPasswordKey)},
+			{Name: "REAPER_JMX_AUTH_USERNAME", ValueFrom: selectorFromSecretKey(cluster.GetJMXSecretName(), credentialsUsernameKey)},
+			{Name: "REAPER_JMX_AUTH_PASSWORD", ValueFrom: selectorFromSecretKey(cluster.GetJMXSecretName(), credentialsPasswordKey)},
+			{Name: "REAPER_AUTH_ENABLED", Value: "true"},
+			{Name: "REAPER_AUTH_USER", ValueFrom: selectorFromSecretKey(cluster.GetReaperAuthSecretName(), credentialsUsernameKey)},
+			{Name: "REAPER_AUTH_PASSWORD", ValueFrom: selectorFromSecretKey(cluster.GetReaperAuthSecretName(), credentialsPasswordKey)},
+		},
+		ReadinessProbe: &corev1.Probe{
+			InitialDelaySeconds: 30,
+			PeriodSeconds:       10,
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path: "/healthcheck",
+					Port: intstr.FromString(reaperAdminPortName),
+				},
+			},
+		},
+		Resources: cluster.Spec.Reaper.Resources,
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.GetReaperName(),
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: cluster.GetReaperLabels(),
+			},
+			// Reaper holds leader locks in its keyspace, so two instances must
+			// not run at the same time
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{container},
+				},
+			},
+		},
+	}
+
+	addHashAnnotation(deployment)
+
+	return deployment
+}
@@ -0,0 +1,96 @@
+package reconciliation
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestNewReaperDeploymentUsesReaperRole(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	cluster := &api.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: api.CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []api.Datacenter{{Name: "dc1"}},
+			Reaper:      &api.ReaperSpec{},
+		},
+	}
+
+	env := newReaperDeployment(cluster).Spec.Template.Spec.Containers[0].Env
+	for _, name := range []string{"REAPER_CASS_AUTH_USERNAME", "REAPER_CASS_AUTH_PASSWORD"} {
+		var secret string
+		for _, e := range env {
+			if e.Name == name {
+				secret = e.ValueFrom.SecretKeyRef.Name
+			}
+		}
+		g.Expect(secret).To(Equal(cluster.GetReaperCQLSecretName()), name)
+	}
+}
+
+func TestCheckReaperRemovesReaper(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(api.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &api.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: api.CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []api.Datacenter{{Name: "dc1"}},
+		},
+		Status: api.CassandraClusterStatus{
+			SuperuserCreated: true,
+			Reaper:           &api.ReaperStatus{KeyspaceCreated: true},
+		},
+	}
+
+	objects := []runtime.Object{
+		cluster.DeepCopy(),
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: cluster.GetReaperName()}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: cluster.GetReaperName()}},
+	}
+	secrets := []string{cluster.GetJMXSecretName(), cluster.GetReaperAuthSecretName(), cluster.GetReaperCQLSecretName()}
+	for _, name := range secrets {
+		objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}})
+	}
+
+	r := &requestHandler{
+		Client:  fake.NewFakeClientWithScheme(scheme, objects...),
+		scheme:  scheme,
+		log:     log.Log,
+		cluster: cluster,
+	}
+
+	ctx := context.Background()
+	g.Expect(r.CheckReaper(ctx).Completed()).To(BeFalse())
+
+	nsName := types.NamespacedName{Namespace: "default", Name: cluster.GetReaperName()}
+	g.Expect(errors.IsNotFound(r.Get(ctx, nsName, &appsv1.Deployment{}))).To(BeTrue())
+	g.Expect(errors.IsNotFound(r.Get(ctx, nsName, &corev1.Service{}))).To(BeTrue())
+	for _, name := range secrets {
+		g.Expect(errors.IsNotFound(r.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &corev1.Secret{}))).To(BeTrue(), name)
+	}
+
+	actual := &api.CassandraCluster{}
+	g.Expect(r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test"}, actual)).To(Succeed())
+	g.Expect(actual.Status.Reaper).To(BeNil())
+
+	// Nothing is left to remove
+	g.Expect(r.CheckReaper(ctx).Completed()).To(BeFalse())
+}
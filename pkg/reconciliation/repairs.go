@@ -0,0 +1,400 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/metrics"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"net/http"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sort"
+	"strings"
+	"time"
+)
+
+type repairRequestHandler struct {
+	clusterRefHandler
+	mgmtClient *mgmtapi.Client
+	repair     *api.CassandraRepair
+
+	// tokenRing returns the tokens of the nodes by broadcast address
+	tokenRing func(ctx context.Context) (map[string][]string, error)
+}
+
+func NewRepairRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger) RequestHandler {
+	r := &repairRequestHandler{
+		clusterRefHandler: clusterRefHandler{request: request, Client: client, scheme: scheme, log: log},
+		mgmtClient:        mgmtapi.NewClient(),
+	}
+	r.tokenRing = r.getTokenRing
+	return r
+}
+
+func (r *repairRequestHandler) HandleRequest(ctx context.Context) (reconcile.Result, error) {
+	repair := &api.CassandraRepair{}
+	err := r.Get(ctx, r.request.NamespacedName, repair)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		} else {
+			return ctrl.Result{}, err
+		}
+	}
+	r.repair = repair
+	r.setObject(repair, func(err string) { repair.Status.Error = err })
+
+	if !repair.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	// Runs are recorded from the history so that the metric is set again after
+	// the operator restarts
+	for _, run := range repair.Status.History {
+		if run.Phase == api.RepairRunPhaseCompleted && run.CompletionTime != nil {
+			metrics.SetLastSuccess(metrics.LastSuccessfulRepair, repair.Namespace, repair.Spec.ClusterRef.Name, run.CompletionTime.Time)
+			break
+		}
+	}
+
+	if result := r.CheckCluster(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckSchedule(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckRun(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// CheckCluster looks up the cluster that is repaired
+func (r *repairRequestHandler) CheckCluster(ctx context.Context) result.ReconcileResult {
+	if res := r.checkCluster(ctx, r.repair.Spec.ClusterRef); res.Completed() {
+		return res
+	}
+	cluster := r.cluster
+
+	if res := r.configureMgmtClient(ctx, r.mgmtClient); res.Completed() {
+		return res
+	}
+
+	if !cluster.Status.SuperuserCreated {
+		r.log.Info("waiting for the superuser to be created", "CassandraCluster", cluster.Name)
+		return result.RequeueSoon(10)
+	}
+
+	return result.Continue()
+}
+
+// CheckSchedule starts a new run when the cron schedule is due and no run is in
+// progress. Schedule times that pass while a run is in progress are skipped.
+func (r *repairRequestHandler) CheckSchedule(ctx context.Context) result.ReconcileResult {
+	schedule, err := parseSchedule(r.repair.Spec.Schedule)
+	if err != nil {
+		r.log.Info("invalid schedule", "Schedule", r.repair.Spec.Schedule, "Reason", err.Error())
+		// There is no point in retrying until the schedule is changed
+		r.failed(ctx, fmt.Errorf("invalid schedule: %s", err))
+		return result.Done()
+	}
+
+	if r.repair.Status.CurrentRun != nil {
+		return result.Continue()
+	}
+
+	if r.repair.Spec.Suspend {
+		return result.Done()
+	}
+
+	now := time.Now()
+	next := r.getNextScheduleTime(schedule)
+	if now.Before(next) {
+		return result.RequeueSoon(int(next.Sub(now).Seconds()) + 1)
+	}
+
+	keyspaces, err := r.getKeyspaces(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to list keyspaces")
+		return r.failed(ctx, err)
+	}
+
+	r.log.Info("starting repair run", "ScheduledTime", next, "Keyspaces", keyspaces)
+	scheduledTime := metav1.NewTime(next)
+	startTime := metav1.NewTime(now)
+	if err = r.updateStatus(ctx, func(status *api.CassandraRepairStatus) {
+		status.CurrentRun = &api.RepairRun{
+			Phase:         api.RepairRunPhaseRunning,
+			ScheduledTime: &scheduledTime,
+			StartTime:     &startTime,
+			Keyspaces:     keyspaces,
+		}
+		status.LastScheduleTime = &scheduledTime
+		status.Error = ""
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRepair", r.repair.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// parseSchedule parses a standard cron expression. The expression is evaluated
+// in UTC rather than in the local time of the operator unless it sets a time
+// zone with CRON_TZ.
+func parseSchedule(spec string) (cron.Schedule, error) {
+	if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=UTC " + spec
+	}
+	return cron.ParseStandard(spec)
+}
+
+// getNextScheduleTime returns the first schedule time after both the last
+// schedule time and the completion of the last run
+func (r *repairRequestHandler) getNextScheduleTime(schedule cron.Schedule) time.Time {
+	last := r.repair.CreationTimestamp.Time
+	if r.repair.Status.LastScheduleTime != nil {
+		last = r.repair.Status.LastScheduleTime.Time
+	}
+	if len(r.repair.Status.History) > 0 {
+		if completion := r.repair.Status.History[0].CompletionTime; completion != nil && completion.After(last) {
+			last = completion.Time
+		}
+	}
+	return schedule.Next(last)
+}
+
+// getKeyspaces returns the keyspaces to repair in the order they are repaired
+func (r *repairRequestHandler) getKeyspaces(ctx context.Context) ([]string, error) {
+	if len(r.repair.Spec.Keyspaces) > 0 {
+		return r.repair.Spec.Keyspaces, nil
+	}
+
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	replication, err := session.ListReplication()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyspaces []string
+	for keyspace := range replication {
+		if !systemKeyspaces[keyspace] {
+			keyspaces = append(keyspaces, keyspace)
+		}
+	}
+	sort.Strings(keyspaces)
+
+	return keyspaces, nil
+}
+
+// CheckRun repairs the segments of the current run one at a time. For every
+// keyspace, the primary ranges of each node are split into subranges and
+// repaired through the management API of that node. Segments are not started
+// while the run is suspended or the cluster is not healthy.
+func (r *repairRequestHandler) CheckRun(ctx context.Context) result.ReconcileResult {
+	if r.repair.Status.CurrentRun == nil {
+		return result.Continue()
+	}
+	run := r.repair.Status.CurrentRun.DeepCopy()
+
+	reason, pods, err := checkClusterHealth(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to check cluster health", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+
+	if run.JobID != "" {
+		status, jobErr := mgmtapi.JobStatusError, fmt.Sprintf("pod %s is gone", run.CurrentNode)
+		if pod := findPod(pods, run.CurrentNode); pod != nil {
+			if status, jobErr, err = r.getJobStatus(ctx, pod, run.JobID); err != nil {
+				// The job keeps running while the node cannot be reached
+				r.log.Error(err, "failed to get job", "Pod", pod.Name, "JobID", run.JobID)
+				return r.saveRun(ctx, run, result.RequeueSoon(10))
+			}
+		}
+
+		switch status {
+		case mgmtapi.JobStatusCompleted:
+			run.RepairedSegments++
+		case mgmtapi.JobStatusError:
+			r.log.Info("failed to repair segment", "Pod", run.CurrentNode, "Keyspace", run.Keyspaces[run.KeyspaceIndex], "Error", jobErr)
+			run.FailedSegments++
+			run.Message = jobErr
+		default:
+			return r.saveRun(ctx, run, result.RequeueSoon(10))
+		}
+
+		now := time.Now()
+		if intensity := r.repair.GetIntensity(); intensity < 1 && run.SegmentStartTime != nil {
+			elapsed := now.Sub(run.SegmentStartTime.Time)
+			next := metav1.NewTime(now.Add(time.Duration(float64(elapsed) * (1/intensity - 1))))
+			run.NextSegmentTime = &next
+		}
+		run.SegmentIndex++
+		run.JobID = ""
+		run.SegmentStartTime = nil
+	}
+
+	if r.repair.Spec.Suspend {
+		r.log.Info("repair run is suspended")
+		run.Phase = api.RepairRunPhasePaused
+		return r.saveRun(ctx, run, result.Done())
+	}
+
+	if reason != "" {
+		r.log.Info("waiting for the cluster to be healthy", "Reason", reason)
+		run.Phase = api.RepairRunPhaseWaiting
+		run.Message = reason
+		return r.saveRun(ctx, run, result.RequeueSoon(60))
+	}
+	if run.Phase != api.RepairRunPhaseRunning {
+		run.Phase = api.RepairRunPhaseRunning
+		run.Message = ""
+	}
+
+	if run.NextSegmentTime != nil && time.Now().Before(run.NextSegmentTime.Time) {
+		return r.saveRun(ctx, run, result.RequeueSoon(int(time.Until(run.NextSegmentTime.Time).Seconds())+1))
+	}
+
+	return r.startNextSegment(ctx, run, pods)
+}
+
+// startNextSegment starts the repair of the segment at the position of the run,
+// moving on to the next node or keyspace when the current one is done
+func (r *repairRequestHandler) startNextSegment(ctx context.Context, run *api.RepairRun, pods []corev1.Pod) result.ReconcileResult {
+	ring, err := r.tokenRing(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to get token ring", "CassandraCluster", r.cluster.Name)
+		return result.RequeueSoon(30)
+	}
+
+	for int(run.KeyspaceIndex) < len(run.Keyspaces) {
+		if int(run.NodeIndex) >= len(pods) {
+			run.KeyspaceIndex++
+			run.NodeIndex = 0
+			run.SegmentIndex = 0
+			continue
+		}
+
+		pod := &pods[run.NodeIndex]
+		ranges, err := cql.PrimaryRanges(ring, getBroadcastAddress(r.cluster, pod), r.repair.GetSubranges())
+		if err != nil {
+			r.log.Error(err, "failed to compute primary ranges", "Pod", pod.Name)
+			run.Message = err.Error()
+			return r.saveRun(ctx, run, result.RequeueSoon(30))
+		}
+		if int(run.SegmentIndex) >= len(ranges) {
+			run.NodeIndex++
+			run.SegmentIndex = 0
+			continue
+		}
+
+		keyspace := run.Keyspaces[run.KeyspaceIndex]
+		tokenRange := ranges[run.SegmentIndex]
+		r.log.Info("repairing segment", "Pod", pod.Name, "Keyspace", keyspace, "Start", tokenRange.Start, "End", tokenRange.End)
+		jobID, err := r.mgmtClient.Repair(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), mgmtapi.RepairRequest{
+			Keyspace:    keyspace,
+			Full:        !r.repair.Spec.Incremental,
+			TokenRanges: []mgmtapi.RingRange{{Start: tokenRange.Start, End: tokenRange.End}},
+		})
+		if err != nil {
+			r.log.Error(err, "failed to start repair", "Pod", pod.Name, "Keyspace", keyspace)
+			run.Message = err.Error()
+			return r.saveRun(ctx, run, result.RequeueSoon(30))
+		}
+
+		now := metav1.Now()
+		run.CurrentNode = pod.Name
+		run.JobID = jobID
+		run.SegmentStartTime = &now
+		return r.saveRun(ctx, run, result.RequeueSoon(10))
+	}
+
+	return r.finishRun(ctx, run)
+}
+
+// finishRun moves the run to the history. The request is requeued so that the
+// next run gets scheduled.
+func (r *repairRequestHandler) finishRun(ctx context.Context, run *api.RepairRun) result.ReconcileResult {
+	now := metav1.Now()
+	run.CompletionTime = &now
+	run.CurrentNode = ""
+	run.NextSegmentTime = nil
+	run.Phase = api.RepairRunPhaseCompleted
+	if run.FailedSegments > 0 {
+		run.Phase = api.RepairRunPhaseFailed
+	}
+	r.log.Info("finished repair run", "Phase", run.Phase, "RepairedSegments", run.RepairedSegments, "FailedSegments", run.FailedSegments)
+
+	if err := r.updateStatus(ctx, func(status *api.CassandraRepairStatus) {
+		status.CurrentRun = nil
+		status.History = append([]api.RepairRun{*run}, status.History...)
+		if limit := r.repair.GetHistoryLimit(); len(status.History) > limit {
+			status.History = status.History[:limit]
+		}
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRepair", r.repair.Name)
+		return result.Error(err)
+	}
+
+	return result.RequeueSoon(1)
+}
+
+// getTokenRing returns the tokens of the nodes by broadcast address
+func (r *repairRequestHandler) getTokenRing(ctx context.Context) (map[string][]string, error) {
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return session.TokenRing()
+}
+
+// getJobStatus returns the status of the repair job running on pod along with
+// its error. A job that the node does not know, because it has restarted since
+// the job was started, is reported as failed. Any other error is returned so
+// that the job is polled again.
+func (r *repairRequestHandler) getJobStatus(ctx context.Context, pod *corev1.Pod, jobID string) (mgmtapi.JobStatus, string, error) {
+	job, err := r.mgmtClient.GetJob(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), jobID)
+	if requestErr, ok := err.(*mgmtapi.RequestError); ok && requestErr.StatusCode == http.StatusNotFound {
+		return mgmtapi.JobStatusError, fmt.Sprintf("job %s not found on %s", jobID, pod.Name), nil
+	} else if err != nil {
+		return "", "", err
+	}
+	return job.Status, job.Error, nil
+}
+
+// saveRun stores run as the current run and returns next
+func (r *repairRequestHandler) saveRun(ctx context.Context, run *api.RepairRun, next result.ReconcileResult) result.ReconcileResult {
+	if err := r.updateStatus(ctx, func(status *api.CassandraRepairStatus) {
+		status.CurrentRun = run
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRepair", r.repair.Name)
+		return result.Error(err)
+	}
+	return next
+}
+
+// updateStatus applies mutate to the status and patches it if it has changed
+func (r *repairRequestHandler) updateStatus(ctx context.Context, mutate func(status *api.CassandraRepairStatus)) error {
+	return r.patchStatus(ctx, func() { mutate(&r.repair.Status) })
+}
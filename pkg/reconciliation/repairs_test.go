@@ -0,0 +1,311 @@
+package reconciliation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestParseSchedule(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// The operator must not depend on the time zone it runs in
+	local := time.FixedZone("UTC+2", 2*60*60)
+	defer func(l *time.Location) { time.Local = l }(time.Local)
+	time.Local = local
+
+	last := time.Date(2020, 6, 1, 12, 0, 0, 0, local)
+
+	schedule, err := parseSchedule("0 2 * * *")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(schedule.Next(last).UTC()).To(Equal(time.Date(2020, 6, 2, 2, 0, 0, 0, time.UTC)))
+
+	schedule, err = parseSchedule("CRON_TZ=Etc/GMT-2 0 2 * * *")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(schedule.Next(last).UTC()).To(Equal(time.Date(2020, 6, 2, 0, 0, 0, 0, time.UTC)))
+
+	_, err = parseSchedule("not a schedule")
+	g.Expect(err).To(HaveOccurred())
+}
+
+// fakeRepairAPI is the management API of all nodes. It records the repairs
+// that are started and answers job lookups with jobStatusCode and jobStatus.
+type fakeRepairAPI struct {
+	sync.Mutex
+
+	// repairs are the address of the node and the keyspace of every repair
+	repairs []string
+
+	jobStatusCode int
+	jobStatus     mgmtapi.JobStatus
+}
+
+func (f *fakeRepairAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch r.URL.Path {
+	case "/api/v1/ops/node/repair":
+		request := mgmtapi.RepairRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		host, _, _ := net.SplitHostPort(r.Host)
+		f.repairs = append(f.repairs, host+" "+request.Keyspace)
+		fmt.Fprintf(w, "job-%d", len(f.repairs))
+	case "/api/v0/ops/executor/job":
+		if f.jobStatusCode != http.StatusOK {
+			http.Error(w, "job lookup failed", f.jobStatusCode)
+			return
+		}
+		json.NewEncoder(w).Encode(mgmtapi.Job{ID: r.URL.Query().Get("job_id"), Status: f.jobStatus})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeRepairAPI) getRepairs() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.repairs...)
+}
+
+func (f *fakeRepairAPI) setJobStatus(statusCode int, status mgmtapi.JobStatus) {
+	f.Lock()
+	defer f.Unlock()
+	f.jobStatusCode = statusCode
+	f.jobStatus = status
+}
+
+// newRepairTestHandler returns a handler for a repair of a cluster with a node
+// per entry of ready, which tells whether the node is ready. The nodes own a
+// token each and their management API is served by fakeAPI.
+func newRepairTestHandler(g *WithT, fakeAPI *fakeRepairAPI, repair *api.CassandraRepair, ready ...bool) (*repairRequestHandler, func()) {
+	scheme := newTestScheme(g)
+	cluster := newTestCluster()
+	cluster.Spec.Datacenters[0].NodesPerRack = int32(len(ready))
+
+	ring := make(map[string][]string)
+	objects := []runtime.Object{cluster.DeepCopy(), repair.DeepCopy()}
+	for i := range ready {
+		address := fmt.Sprintf("10.0.0.%d", i+1)
+		ring[address] = []string{fmt.Sprint(i * 1000)}
+		status := corev1.ConditionTrue
+		if !ready[i] {
+			status = corev1.ConditionFalse
+		}
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      fmt.Sprintf("test-dc1-rack-1-sts-%d", i),
+				Labels:    cluster.GetRackLabels("dc1", "rack-1"),
+			},
+			Status: corev1.PodStatus{
+				PodIP:      address,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		})
+	}
+
+	server := httptest.NewTLSServer(fakeAPI)
+	r := &repairRequestHandler{
+		clusterRefHandler: clusterRefHandler{
+			Client:  fake.NewFakeClientWithScheme(scheme, objects...),
+			scheme:  scheme,
+			log:     log.Log,
+			cluster: cluster,
+		},
+		mgmtClient: mgmtapi.NewClientWithHTTPClient(newTestHTTPClient(server)),
+		repair:     repair,
+		tokenRing: func(ctx context.Context) (map[string][]string, error) {
+			return ring, nil
+		},
+	}
+	r.setObject(repair, func(err string) { repair.Status.Error = err })
+	return r, server.Close
+}
+
+func newTestRepair(run *api.RepairRun) *api.CassandraRepair {
+	return &api.CassandraRepair{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "repair"},
+		Spec: api.CassandraRepairSpec{
+			ClusterRef: corev1.LocalObjectReference{Name: "test"},
+			Schedule:   "0 2 * * *",
+			Subranges:  2,
+		},
+		Status: api.CassandraRepairStatus{CurrentRun: run},
+	}
+}
+
+func TestCheckRunRepairsAllSegments(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fakeAPI := &fakeRepairAPI{jobStatusCode: http.StatusOK, jobStatus: mgmtapi.JobStatusCompleted}
+	repair := newTestRepair(&api.RepairRun{Phase: api.RepairRunPhaseRunning, Keyspaces: []string{"ks1", "ks2"}})
+	r, closeServer := newRepairTestHandler(g, fakeAPI, repair, true, true)
+	defer closeServer()
+
+	ctx := context.Background()
+	for i := 0; i < 20 && r.repair.Status.CurrentRun != nil; i++ {
+		g.Expect(r.CheckRun(ctx).Completed()).To(BeTrue())
+	}
+	g.Expect(r.repair.Status.CurrentRun).To(BeNil())
+
+	// Both segments of a node are repaired before moving on to the next node,
+	// and all nodes before moving on to the next keyspace
+	g.Expect(fakeAPI.getRepairs()).To(Equal([]string{
+		"10.0.0.1 ks1", "10.0.0.1 ks1", "10.0.0.2 ks1", "10.0.0.2 ks1",
+		"10.0.0.1 ks2", "10.0.0.1 ks2", "10.0.0.2 ks2", "10.0.0.2 ks2",
+	}))
+	g.Expect(r.repair.Status.History).To(HaveLen(1))
+	g.Expect(r.repair.Status.History[0].Phase).To(Equal(api.RepairRunPhaseCompleted))
+	g.Expect(r.repair.Status.History[0].RepairedSegments).To(Equal(int32(8)))
+}
+
+func TestCheckRunPollsJobThatCannotBeLookedUp(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fakeAPI := &fakeRepairAPI{jobStatusCode: http.StatusServiceUnavailable}
+	repair := newTestRepair(&api.RepairRun{
+		Phase:       api.RepairRunPhaseRunning,
+		Keyspaces:   []string{"ks1"},
+		CurrentNode: "test-dc1-rack-1-sts-0",
+		JobID:       "job-0",
+	})
+	r, closeServer := newRepairTestHandler(g, fakeAPI, repair, true, true)
+	defer closeServer()
+
+	ctx := context.Background()
+	g.Expect(r.CheckRun(ctx)).To(Equal(result.RequeueSoon(10)))
+	run := r.repair.Status.CurrentRun
+	g.Expect(run.JobID).To(Equal("job-0"))
+	g.Expect(run.FailedSegments).To(BeZero())
+	g.Expect(fakeAPI.getRepairs()).To(BeEmpty())
+
+	// The node no longer knows the job once it has restarted
+	fakeAPI.setJobStatus(http.StatusNotFound, "")
+	g.Expect(r.CheckRun(ctx)).To(Equal(result.RequeueSoon(10)))
+	run = r.repair.Status.CurrentRun
+	g.Expect(run.FailedSegments).To(Equal(int32(1)))
+	g.Expect(run.SegmentIndex).To(Equal(int32(1)))
+	g.Expect(run.JobID).To(Equal("job-1"))
+}
+
+func TestCheckRunFailsSegmentOfGonePod(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fakeAPI := &fakeRepairAPI{jobStatusCode: http.StatusOK, jobStatus: mgmtapi.JobStatusCompleted}
+	repair := newTestRepair(&api.RepairRun{
+		Phase:       api.RepairRunPhaseRunning,
+		Keyspaces:   []string{"ks1"},
+		CurrentNode: "test-dc1-rack-1-sts-5",
+		JobID:       "job-0",
+	})
+	r, closeServer := newRepairTestHandler(g, fakeAPI, repair, true, true)
+	defer closeServer()
+
+	g.Expect(r.CheckRun(context.Background()).Completed()).To(BeTrue())
+	run := r.repair.Status.CurrentRun
+	g.Expect(run.FailedSegments).To(Equal(int32(1)))
+	g.Expect(run.Message).To(ContainSubstring("is gone"))
+}
+
+func TestCheckRunSuspend(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fakeAPI := &fakeRepairAPI{jobStatusCode: http.StatusOK, jobStatus: mgmtapi.JobStatusCompleted}
+	repair := newTestRepair(&api.RepairRun{
+		Phase:       api.RepairRunPhaseRunning,
+		Keyspaces:   []string{"ks1"},
+		CurrentNode: "test-dc1-rack-1-sts-0",
+		JobID:       "job-0",
+	})
+	repair.Spec.Suspend = true
+	r, closeServer := newRepairTestHandler(g, fakeAPI, repair, true, true)
+	defer closeServer()
+
+	// The running segment is finished, but no other one is started
+	ctx := context.Background()
+	g.Expect(r.CheckRun(ctx)).To(Equal(result.Done()))
+	run := r.repair.Status.CurrentRun
+	g.Expect(run.Phase).To(Equal(api.RepairRunPhasePaused))
+	g.Expect(run.RepairedSegments).To(Equal(int32(1)))
+	g.Expect(run.JobID).To(BeEmpty())
+	g.Expect(fakeAPI.getRepairs()).To(BeEmpty())
+
+	// The run resumes from the next segment
+	r.repair.Spec.Suspend = false
+	g.Expect(r.CheckRun(ctx)).To(Equal(result.RequeueSoon(10)))
+	run = r.repair.Status.CurrentRun
+	g.Expect(run.Phase).To(Equal(api.RepairRunPhaseRunning))
+	g.Expect(run.SegmentIndex).To(Equal(int32(1)))
+	g.Expect(fakeAPI.getRepairs()).To(Equal([]string{"10.0.0.1 ks1"}))
+}
+
+func TestCheckRunIntensity(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fakeAPI := &fakeRepairAPI{jobStatusCode: http.StatusOK, jobStatus: mgmtapi.JobStatusCompleted}
+	segmentStartTime := metav1.NewTime(time.Now().Add(-time.Minute))
+	repair := newTestRepair(&api.RepairRun{
+		Phase:            api.RepairRunPhaseRunning,
+		Keyspaces:        []string{"ks1"},
+		CurrentNode:      "test-dc1-rack-1-sts-0",
+		JobID:            "job-0",
+		SegmentStartTime: &segmentStartTime,
+	})
+	repair.Spec.Intensity = "0.5"
+	r, closeServer := newRepairTestHandler(g, fakeAPI, repair, true, true)
+	defer closeServer()
+
+	// The segment took a minute, so the next one is started a minute later
+	res := r.CheckRun(context.Background())
+	g.Expect(res.Completed()).To(BeTrue())
+	g.Expect(fakeAPI.getRepairs()).To(BeEmpty())
+	run := r.repair.Status.CurrentRun
+	g.Expect(run.NextSegmentTime).ToNot(BeNil())
+	g.Expect(run.NextSegmentTime.Time).To(BeTemporally("~", time.Now().Add(time.Minute), 5*time.Second))
+	output, err := res.Output()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(output.RequeueAfter).To(BeNumerically("~", time.Minute, 5*time.Second))
+}
+
+func TestCheckRunWaitsForHealthyCluster(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fakeAPI := &fakeRepairAPI{jobStatusCode: http.StatusOK, jobStatus: mgmtapi.JobStatusCompleted}
+	repair := newTestRepair(&api.RepairRun{
+		Phase:       api.RepairRunPhaseRunning,
+		Keyspaces:   []string{"ks1"},
+		CurrentNode: "test-dc1-rack-1-sts-0",
+		JobID:       "job-0",
+	})
+	r, closeServer := newRepairTestHandler(g, fakeAPI, repair, true, false)
+	defer closeServer()
+
+	// The running segment is recorded, but the next one waits for the node
+	ctx := context.Background()
+	g.Expect(r.CheckRun(ctx)).To(Equal(result.RequeueSoon(60)))
+	run := r.repair.Status.CurrentRun
+	g.Expect(run.Phase).To(Equal(api.RepairRunPhaseWaiting))
+	g.Expect(run.Message).To(ContainSubstring("test-dc1-rack-1-sts-1 is not ready"))
+	g.Expect(run.RepairedSegments).To(Equal(int32(1)))
+	g.Expect(fakeAPI.getRepairs()).To(BeEmpty())
+}
@@ -0,0 +1,270 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// CheckReplaceNodes replaces the dead nodes of the pods listed in
+// Spec.ReplaceNodes, one at a time. The data volume of the pod is deleted and
+// the recreated pod starts with replace_address_first_boot set to the address
+// the dead node had, so that it takes over the tokens of the dead node and
+// streams its data from the replicas. The addresses of all ready nodes are
+// recorded in the status beforehand since the address of a dead pod is gone.
+func (r *requestHandler) CheckReplaceNodes(ctx context.Context) result.ReconcileResult {
+	replacing := make(map[string]bool)
+	for _, replacement := range r.cluster.Status.NodeReplacements {
+		if replacement.Phase == api.ReplacementPhasePending || replacement.Phase == api.ReplacementPhaseRunning {
+			replacing[replacement.Pod] = true
+		}
+	}
+
+	for i := range r.cluster.Spec.Datacenters {
+		if err := r.recordNodeAddresses(ctx, &r.cluster.Spec.Datacenters[i], replacing); err != nil {
+			r.log.Error(err, "failed to record node addresses", "Datacenter", r.cluster.Spec.Datacenters[i].Name)
+			return result.Error(err)
+		}
+	}
+
+	if len(r.cluster.Spec.ReplaceNodes) == 0 && len(r.cluster.Status.NodeReplacements) == 0 {
+		return result.Continue()
+	}
+
+	previous := make(map[string]api.NodeReplacementStatus)
+	for _, replacement := range r.cluster.Status.NodeReplacements {
+		previous[replacement.Pod] = replacement
+	}
+
+	var replacements []api.NodeReplacementStatus
+	running := false
+	for _, podName := range r.cluster.Spec.ReplaceNodes {
+		replacement, found := previous[podName]
+		// A replacement that failed because the address of the node was not
+		// known is retried, since the address may have been recorded since
+		if !found || replacement.Phase == api.ReplacementPhaseFailed {
+			replacement = api.NodeReplacementStatus{Pod: podName, Phase: api.ReplacementPhasePending}
+			if replacement.Address = r.getNodeAddress(podName); replacement.Address == "" {
+				replacement.Phase = api.ReplacementPhaseFailed
+				replacement.Message = "the address of the node is not known"
+			}
+		}
+		running = running || replacement.Phase == api.ReplacementPhaseRunning
+		replacements = append(replacements, replacement)
+	}
+
+	var err error
+	for i := range replacements {
+		replacement := &replacements[i]
+		switch replacement.Phase {
+		case api.ReplacementPhasePending:
+			if running {
+				continue
+			}
+			err = r.startNodeReplacement(ctx, replacement)
+			running = true
+		case api.ReplacementPhaseRunning:
+			err = r.checkNodeReplacement(ctx, replacement)
+		}
+		if err != nil {
+			r.log.Error(err, "failed to replace node", "Pod", replacement.Pod)
+			break
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(replacements, r.cluster.Status.NodeReplacements) {
+		if patchErr := r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+			status.NodeReplacements = replacements
+		}); patchErr != nil {
+			r.log.Error(patchErr, "failed to update status")
+			return result.Error(patchErr)
+		}
+	}
+
+	if err != nil {
+		return result.Error(err)
+	}
+	if running {
+		return result.RequeueSoon(15)
+	}
+	return result.Continue()
+}
+
+// recordNodeAddresses stores the broadcast addresses of the ready pods of dc in
+// its status. Pods that are being replaced keep the address of the dead node.
+func (r *requestHandler) recordNodeAddresses(ctx context.Context, dc *api.Datacenter, replacing map[string]bool) error {
+	dcStatus, found := r.cluster.Status.Datacenters[dc.Name]
+	if !found {
+		return nil
+	}
+
+	pods, err := r.listDatacenterPods(ctx, dc.Name)
+	if err != nil {
+		return err
+	}
+
+	addresses := make(map[string]string)
+	for k, v := range dcStatus.NodeAddresses {
+		addresses[k] = v
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if replacing[pod.Name] || !isPodReady(pod) {
+			continue
+		}
+		if address := getBroadcastAddress(r.cluster, pod); address != "" {
+			addresses[pod.Name] = address
+		}
+	}
+
+	dcStatus.NodeAddresses = addresses
+	return r.updateDatacenterStatus(ctx, dc.Name, dcStatus)
+}
+
+// getBroadcastAddress returns the address the node in pod advertises to the
+// other nodes
+func getBroadcastAddress(cluster *api.CassandraCluster, pod *corev1.Pod) string {
+	if cluster.Spec.Networking.UseHostIPForBroadcast {
+		return pod.Status.HostIP
+	}
+	return pod.Status.PodIP
+}
+
+// getNodeAddress returns the last known broadcast address of the pod
+func (r *requestHandler) getNodeAddress(podName string) string {
+	for _, dcStatus := range r.cluster.Status.Datacenters {
+		if address, found := dcStatus.NodeAddresses[podName]; found {
+			return address
+		}
+	}
+	return ""
+}
+
+// startNodeReplacement publishes the address of the dead node for the pod and
+// deletes the pod along with its data volume
+func (r *requestHandler) startNodeReplacement(ctx context.Context, replacement *api.NodeReplacementStatus) error {
+	r.log.Info("replacing node", "Pod", replacement.Pod, "Address", replacement.Address)
+
+	if err := r.setReplaceAddress(ctx, replacement.Pod, replacement.Address); err != nil {
+		return err
+	}
+
+	if err := r.deletePodData(ctx, replacement.Pod); err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	replacement.Phase = api.ReplacementPhaseRunning
+	replacement.StartTime = &now
+	replacement.Message = ""
+	return nil
+}
+
+// checkNodeReplacement completes the replacement once the recreated pod is ready.
+// Cassandra only reports the node as ready after it has streamed the data of the
+// dead node.
+func (r *requestHandler) checkNodeReplacement(ctx context.Context, replacement *api.NodeReplacementStatus) error {
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: replacement.Pod}, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if replacement.StartTime != nil && pod.CreationTimestamp.Before(replacement.StartTime) {
+		// The old pod is still shutting down
+		return nil
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: pvcName + "-" + replacement.Pod}, pvc)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && pvc.DeletionTimestamp != nil {
+		// The StatefulSet controller recreated the pod before the old volume claim
+		// was removed. The pod cannot start with it, so it is deleted again to get
+		// a new volume claim.
+		r.log.Info("pod was recreated with the old volume claim, deleting it again", "Pod", pod.Name)
+		return r.Delete(ctx, pod)
+	}
+
+	if !isPodReady(pod) {
+		return nil
+	}
+
+	r.log.Info("finished replacing node", "Pod", replacement.Pod)
+	if err := r.setReplaceAddress(ctx, replacement.Pod, ""); err != nil {
+		return err
+	}
+	now := metav1.Now()
+	replacement.Phase = api.ReplacementPhaseCompleted
+	replacement.CompletionTime = &now
+	return nil
+}
+
+// deletePodData deletes the volume claim of the pod and then the pod, so that the
+// StatefulSet recreates it with an empty data volume
+func (r *requestHandler) deletePodData(ctx context.Context, podName string) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	pvc.Namespace = r.cluster.Namespace
+	pvc.Name = pvcName + "-" + podName
+	if err := r.Delete(ctx, pvc); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	pod := &corev1.Pod{}
+	pod.Namespace = r.cluster.Namespace
+	pod.Name = podName
+	if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// setReplaceAddress sets the address of the node the pod replaces in the config
+// map read by the replace-address-init container. An empty address removes the
+// entry.
+func (r *requestHandler) setReplaceAddress(ctx context.Context, podName, address string) error {
+	configMap := &corev1.ConfigMap{}
+	nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetReplaceAddressesConfigMapName()}
+	err := r.Get(ctx, nsName, configMap)
+	if errors.IsNotFound(err) {
+		if address == "" {
+			return nil
+		}
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: nsName.Namespace,
+				Name:      nsName.Name,
+				Labels:    r.cluster.GetClusterLabels(),
+			},
+			Data: map[string]string{podName: address},
+		}
+		if err = controllerutil.SetControllerReference(r.cluster, configMap, r.scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, configMap)
+	} else if err != nil {
+		return err
+	}
+
+	if configMap.Data[podName] == address {
+		return nil
+	}
+	if address == "" {
+		delete(configMap.Data, podName)
+	} else {
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[podName] = address
+	}
+	return r.Update(ctx, configMap)
+}
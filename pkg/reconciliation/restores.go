@@ -0,0 +1,677 @@
+package reconciliation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/backup"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type restoreRequestHandler struct {
+	clusterRefHandler
+	mgmtClient   *mgmtapi.Client
+	backupClient *backup.Client
+	restore      *api.CassandraRestore
+	backup       *api.CassandraBackup
+}
+
+func NewRestoreRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger) RequestHandler {
+	return &restoreRequestHandler{
+		clusterRefHandler: clusterRefHandler{request: request, Client: client, scheme: scheme, log: log},
+		mgmtClient:        mgmtapi.NewClient(),
+		backupClient:      backup.NewClient(),
+	}
+}
+
+func (r *restoreRequestHandler) HandleRequest(ctx context.Context) (reconcile.Result, error) {
+	restore := &api.CassandraRestore{}
+	err := r.Get(ctx, r.request.NamespacedName, restore)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		} else {
+			return ctrl.Result{}, err
+		}
+	}
+	r.restore = restore
+	r.setObject(restore, func(err string) { restore.Status.Error = err })
+
+	if !restore.DeletionTimestamp.IsZero() || restore.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	if result := r.CheckBackup(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckCluster(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckNodes(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if restore.Spec.InPlace {
+		if result := r.CheckTruncate(ctx); result.Completed() {
+			return result.Output()
+		}
+
+		if result := r.CheckInPlaceRestore(ctx); result.Completed() {
+			return result.Output()
+		}
+	} else {
+		if result := r.CheckNewClusterRestore(ctx); result.Completed() {
+			return result.Output()
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// CheckBackup looks up the backup that is restored, which has to have completed
+func (r *restoreRequestHandler) CheckBackup(ctx context.Context) result.ReconcileResult {
+	b := &api.CassandraBackup{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: r.restore.Namespace, Name: r.restore.Spec.Backup}, b)
+	if err != nil && errors.IsNotFound(err) {
+		r.log.Info("backup not found", "CassandraBackup", r.restore.Spec.Backup)
+		return r.failed(ctx, fmt.Errorf("CassandraBackup %s not found", r.restore.Spec.Backup))
+	} else if err != nil {
+		r.log.Error(err, "failed to get backup", "CassandraBackup", r.restore.Spec.Backup)
+		return result.Error(err)
+	}
+	r.backup = b
+
+	if b.Status.Phase != api.BackupPhaseCompleted {
+		r.log.Info("backup has not completed", "CassandraBackup", b.Name, "Phase", b.Status.Phase)
+		return r.failed(ctx, fmt.Errorf("CassandraBackup %s has not completed", b.Name))
+	}
+
+	if pointInTime := r.restore.Spec.RestorePointInTime; pointInTime != nil && b.Status.StartTime != nil && pointInTime.Before(b.Status.StartTime) {
+		return r.failed(ctx, fmt.Errorf("restorePointInTime is before CassandraBackup %s started", b.Name))
+	}
+
+	return result.Continue()
+}
+
+// CheckCluster looks up the cluster that is restored into. A new cluster has to
+// reference the restore so that its pods wait for their backed up nodes.
+func (r *restoreRequestHandler) CheckCluster(ctx context.Context) result.ReconcileResult {
+	if res := r.checkCluster(ctx, r.restore.Spec.ClusterRef); res.Completed() {
+		return res
+	}
+	cluster := r.cluster
+
+	if res := r.configureMgmtClient(ctx, r.mgmtClient); res.Completed() {
+		return res
+	}
+
+	if !cluster.IsBackupEnabled() {
+		r.log.Info("backups are not configured", "CassandraCluster", cluster.Name)
+		return r.failed(ctx, fmt.Errorf("CassandraCluster %s has no backup storage configured", cluster.Name))
+	}
+
+	if res := r.configureBackupClient(ctx, r.backupClient); res.Completed() {
+		return res
+	}
+
+	if r.restore.Spec.InPlace {
+		if r.restore.Spec.RestorePointInTime != nil {
+			return r.failed(ctx, fmt.Errorf("restorePointInTime is only supported when restoring into a new cluster"))
+		}
+		if !cluster.Status.SuperuserCreated {
+			r.log.Info("waiting for the superuser to be created", "CassandraCluster", cluster.Name)
+			return result.RequeueSoon(10)
+		}
+		return result.Continue()
+	}
+
+	if cluster.Spec.RestoreFrom == nil || cluster.Spec.RestoreFrom.Name != r.restore.Name {
+		return r.failed(ctx, fmt.Errorf("CassandraCluster %s does not reference CassandraRestore %s in restoreFrom", cluster.Name, r.restore.Name))
+	}
+	if r.restore.Status.Phase == "" && cluster.Status.SuperuserCreated {
+		return r.failed(ctx, fmt.Errorf("CassandraCluster %s is already running, restore it in place instead", cluster.Name))
+	}
+
+	return result.Continue()
+}
+
+// CheckNodes assigns a backed up node to the nodes of the cluster that are
+// restored. Nodes are matched by datacenter, rack and ordinal. Every backed up
+// node has to have a match, while nodes of the cluster without a backed up node
+// are left alone.
+func (r *restoreRequestHandler) CheckNodes(ctx context.Context) result.ReconcileResult {
+	if r.restore.Status.Phase != "" {
+		return result.Continue()
+	}
+
+	if r.restore.Spec.InPlace {
+		reason, _, err := checkClusterHealth(ctx, r, r.cluster)
+		if err != nil {
+			r.log.Error(err, "failed to check cluster health", "CassandraCluster", r.cluster.Name)
+			return result.Error(err)
+		}
+		if reason != "" {
+			r.log.Info("waiting for the cluster to be healthy", "Reason", reason)
+			return r.failed(ctx, fmt.Errorf("cluster is not healthy: %s", reason))
+		}
+	}
+
+	nodes, err := mapBackupNodes(r.cluster, r.backup)
+	if err != nil {
+		r.log.Info("cannot restore backup", "CassandraBackup", r.backup.Name, "Reason", err.Error())
+		return r.failed(ctx, err)
+	}
+
+	if !r.restore.Spec.InPlace {
+		if err = r.publishManifests(ctx, nodes); err != nil {
+			r.log.Error(err, "failed to publish manifests", "ConfigMap", r.cluster.GetRestoreConfigMapName())
+			return result.Error(err)
+		}
+		for i := range nodes {
+			nodes[i].Phase = api.NodeRestorePhaseDownloading
+		}
+	}
+
+	r.log.Info("starting restore", "CassandraBackup", r.backup.Name, "CassandraCluster", r.cluster.Name, "InPlace", r.restore.Spec.InPlace)
+	now := metav1.Now()
+	if err = r.updateStatus(ctx, func(status *api.CassandraRestoreStatus) {
+		status.Phase = api.RestorePhaseRunning
+		status.StartTime = &now
+		status.Nodes = nodes
+		status.Error = ""
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRestore", r.restore.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// mapBackupNodes matches the nodes of the backup with the pods of the cluster
+// that are in the same datacenter and rack and have the same ordinal
+func mapBackupNodes(cluster *api.CassandraCluster, b *api.CassandraBackup) ([]api.NodeRestoreStatus, error) {
+	var nodes []api.NodeRestoreStatus
+	for _, node := range b.Status.Nodes {
+		if node.Phase != api.NodeBackupPhaseCompleted {
+			continue
+		}
+		ordinal, err := strconv.Atoi(node.Pod[strings.LastIndex(node.Pod, "-")+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine ordinal of %s", node.Pod)
+		}
+
+		pod := ""
+		for _, dc := range cluster.Spec.Datacenters {
+			if dc.Name != node.Datacenter || int32(ordinal) >= dc.GetNodesPerRack() {
+				continue
+			}
+			for _, rack := range dc.GetRacks() {
+				if rack.Name == node.Rack {
+					pod = fmt.Sprintf("%s-%d", newNamespacedNameForStatefulSet(cluster, dc.Name, rack.Name).Name, ordinal)
+				}
+			}
+		}
+		if pod == "" {
+			return nil, fmt.Errorf("CassandraCluster %s has no node for %s in datacenter %s and rack %s", cluster.Name, node.Pod, node.Datacenter, node.Rack)
+		}
+
+		nodes = append(nodes, api.NodeRestoreStatus{
+			Pod:         pod,
+			SourcePod:   node.Pod,
+			ManifestKey: node.ManifestKey,
+			Phase:       api.NodeRestorePhasePending,
+		})
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Pod < nodes[j].Pod })
+	return nodes, nil
+}
+
+// publishManifests writes the manifest key of each restored node to the config
+// map read by the restore-init containers of the new cluster, along with the
+// point in time the archived commitlogs are replayed to
+func (r *restoreRequestHandler) publishManifests(ctx context.Context, nodes []api.NodeRestoreStatus) error {
+	data := make(map[string]string)
+	for _, node := range nodes {
+		data[node.Pod] = node.ManifestKey
+	}
+	if pointInTime := r.restore.Spec.RestorePointInTime; pointInTime != nil {
+		data[backup.RestorePointInTimeKey] = pointInTime.UTC().Format(backup.RestorePointInTimeFormat)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetRestoreConfigMapName()}
+	err := r.Get(ctx, nsName, configMap)
+	if errors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: nsName.Namespace,
+				Name:      nsName.Name,
+				Labels:    r.cluster.GetClusterLabels(),
+			},
+			Data: data,
+		}
+		if err = controllerutil.SetControllerReference(r.cluster, configMap, r.scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, configMap)
+	} else if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(configMap.Data, data) {
+		return nil
+	}
+	configMap.Data = data
+	return r.Update(ctx, configMap)
+}
+
+// CheckNewClusterRestore waits for the restore-init containers to restore the
+// nodes of the new cluster. A node is restored once its pod is ready. Its
+// manifest is then withdrawn from the config map so that a pod that later
+// starts with an empty data volume, e.g. to replace the node, is not restored
+// again.
+func (r *restoreRequestHandler) CheckNewClusterRestore(ctx context.Context) result.ReconcileResult {
+	pods, err := listPods(ctx, r, r.cluster.Namespace, r.cluster.GetClusterLabels())
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+
+	nodes := make([]api.NodeRestoreStatus, len(r.restore.Status.Nodes))
+	copy(nodes, r.restore.Status.Nodes)
+	finished := true
+	var restored []string
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Phase == api.NodeRestorePhaseCompleted {
+			restored = append(restored, node.Pod)
+			continue
+		}
+		pod := findPod(pods, node.Pod)
+		if pod != nil && isPodReady(pod) {
+			r.log.Info("node restored", "Pod", node.Pod, "SourcePod", node.SourcePod)
+			node.Phase = api.NodeRestorePhaseCompleted
+			node.Error = ""
+			restored = append(restored, node.Pod)
+			continue
+		}
+		finished = false
+		if pod != nil {
+			node.Error = getRestoreInitError(pod)
+		}
+	}
+
+	if err = r.withdrawManifests(ctx, restored); err != nil {
+		r.log.Error(err, "failed to withdraw manifests", "ConfigMap", r.cluster.GetRestoreConfigMapName())
+		return result.Error(err)
+	}
+
+	if !finished {
+		if err = r.updateStatus(ctx, func(status *api.CassandraRestoreStatus) {
+			status.Nodes = nodes
+		}); err != nil {
+			r.log.Error(err, "failed to update status", "CassandraRestore", r.restore.Name)
+			return result.Error(err)
+		}
+		return result.RequeueSoon(10)
+	}
+
+	return r.finish(ctx, nodes)
+}
+
+// withdrawManifests removes the manifest keys of the restored pods from the
+// config map read by the restore-init containers
+func (r *restoreRequestHandler) withdrawManifests(ctx context.Context, pods []string) error {
+	configMap := &corev1.ConfigMap{}
+	nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetRestoreConfigMapName()}
+	if err := r.Get(ctx, nsName, configMap); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	changed := false
+	for _, pod := range pods {
+		if _, found := configMap.Data[pod]; found {
+			delete(configMap.Data, pod)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.Update(ctx, configMap)
+}
+
+// getRestoreInitError returns why the restore-init container of the pod last
+// failed, if it did
+func getRestoreInitError(pod *corev1.Pod) string {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != "restore-init" {
+			continue
+		}
+		for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+			if state.Terminated != nil && state.Terminated.ExitCode != 0 {
+				return fmt.Sprintf("restore-init failed with exit code %d: %s", state.Terminated.ExitCode, state.Terminated.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// CheckTruncate truncates the tables that are restored in place
+func (r *restoreRequestHandler) CheckTruncate(ctx context.Context) result.ReconcileResult {
+	if !r.restore.Spec.Truncate || r.restore.Status.Truncated {
+		return result.Continue()
+	}
+
+	store, err := newObjectStore(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to create object store client", "CassandraCluster", r.cluster.Name)
+		return r.failed(ctx, err)
+	}
+
+	tables := make(map[string]bool)
+	for _, node := range r.restore.Status.Nodes {
+		manifest, err := getManifest(ctx, store, node.ManifestKey)
+		if err != nil {
+			r.log.Error(err, "failed to get manifest", "Key", node.ManifestKey)
+			return r.failed(ctx, err)
+		}
+		for _, file := range r.selectFiles(manifest) {
+			keyspace, table, _ := backup.SplitFilePath(file.Path)
+			tables[keyspace+"."+table] = true
+		}
+	}
+
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to connect to cluster", "CassandraCluster", r.cluster.Name)
+		return result.RequeueSoon(30)
+	}
+	defer session.Close()
+
+	for table := range tables {
+		parts := strings.SplitN(table, ".", 2)
+		r.log.Info("truncating table", "Keyspace", parts[0], "Table", parts[1])
+		if err = session.Exec(fmt.Sprintf(`TRUNCATE "%s"."%s"`, parts[0], parts[1])); err != nil {
+			r.log.Error(err, "failed to truncate table", "Keyspace", parts[0], "Table", parts[1])
+			return r.failed(ctx, err)
+		}
+	}
+
+	if err = r.updateStatus(ctx, func(status *api.CassandraRestoreStatus) {
+		status.Truncated = true
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRestore", r.restore.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// CheckInPlaceRestore has the backup agent of every node download the selected
+// SSTables of its backed up node into the directories of their tables and loads
+// them with nodetool refresh through the management API. The nodes are restored
+// concurrently.
+func (r *restoreRequestHandler) CheckInPlaceRestore(ctx context.Context) result.ReconcileResult {
+	pods, err := listPods(ctx, r, r.cluster.Namespace, r.cluster.GetClusterLabels())
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "CassandraCluster", r.cluster.Name)
+		return result.Error(err)
+	}
+
+	// The session is only opened when a download is started, which needs the IDs
+	// of the tables for their directories
+	var session *cql.Session
+	defer func() {
+		if session != nil {
+			session.Close()
+		}
+	}()
+
+	store, err := newObjectStore(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to create object store client", "CassandraCluster", r.cluster.Name)
+		return r.failed(ctx, err)
+	}
+
+	nodes := make([]api.NodeRestoreStatus, len(r.restore.Status.Nodes))
+	copy(nodes, r.restore.Status.Nodes)
+	finished := true
+
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Phase == api.NodeRestorePhaseCompleted || node.Phase == api.NodeRestorePhaseFailed {
+			continue
+		}
+
+		pod := findPod(pods, node.Pod)
+		if pod == nil || !isPodReady(pod) {
+			r.log.Info("waiting for pod to be ready", "Pod", node.Pod)
+			finished = false
+			continue
+		}
+		endpoint := backup.PodEndpoint(pod)
+
+		var download *backup.Download
+		if node.Phase == api.NodeRestorePhaseDownloading {
+			if download, err = r.backupClient.GetDownload(ctx, endpoint, r.restore.Name); err != nil {
+				r.log.Error(err, "failed to get download", "Pod", pod.Name)
+				finished = false
+				continue
+			}
+		}
+
+		if download == nil {
+			// The download has not been started yet or the agent has been
+			// restarted and lost track of it
+			if session == nil {
+				if session, err = newSuperuserSession(ctx, r, r.cluster); err != nil {
+					r.log.Error(err, "failed to connect to cluster", "CassandraCluster", r.cluster.Name)
+					return result.RequeueSoon(30)
+				}
+			}
+			request, err := r.newDownloadRequest(ctx, store, session, node)
+			if err != nil {
+				r.log.Error(err, "failed to create download request", "Pod", pod.Name)
+				return r.failed(ctx, err)
+			}
+			r.log.Info("starting download", "Pod", pod.Name, "Files", len(request.Files))
+			if download, err = r.backupClient.StartDownload(ctx, endpoint, request); err != nil {
+				r.log.Error(err, "failed to start download", "Pod", pod.Name)
+				node.Error = err.Error()
+				finished = false
+				continue
+			}
+			node.Phase = api.NodeRestorePhaseDownloading
+		}
+
+		node.Files = int32(download.Files)
+		node.Error = download.Error
+
+		switch download.Status {
+		case backup.TransferStatusCompleted:
+			if err = r.refreshTables(ctx, store, pod, node); err != nil {
+				r.log.Error(err, "failed to load SSTables", "Pod", pod.Name)
+				node.Phase = api.NodeRestorePhaseFailed
+				node.Error = err.Error()
+			} else {
+				r.log.Info("node restored", "Pod", pod.Name, "Files", download.Files)
+				node.Phase = api.NodeRestorePhaseCompleted
+			}
+		case backup.TransferStatusFailed:
+			r.log.Info("failed to download files", "Pod", pod.Name, "Error", download.Error)
+			node.Phase = api.NodeRestorePhaseFailed
+		default:
+			finished = false
+			continue
+		}
+
+		if err = r.backupClient.DeleteDownload(ctx, endpoint, r.restore.Name); err != nil {
+			r.log.Error(err, "failed to delete download", "Pod", pod.Name)
+		}
+	}
+
+	if !finished {
+		if err = r.updateStatus(ctx, func(status *api.CassandraRestoreStatus) {
+			status.Nodes = nodes
+		}); err != nil {
+			r.log.Error(err, "failed to update status", "CassandraRestore", r.restore.Name)
+			return result.Error(err)
+		}
+		return result.RequeueSoon(10)
+	}
+
+	return r.finish(ctx, nodes)
+}
+
+// newDownloadRequest returns the request for downloading the selected SSTables
+// of the backed up node into <restore>/<keyspace>/<table> of the restore
+// directory, from where the agent moves them into the directories of their
+// tables. The directories are named after the IDs of the tables in the cluster,
+// which differ from those of the backed up cluster when tables are recreated.
+func (r *restoreRequestHandler) newDownloadRequest(ctx context.Context, store backup.ObjectStore, session *cql.Session, node *api.NodeRestoreStatus) (backup.DownloadRequest, error) {
+	request := backup.DownloadRequest{Name: r.restore.Name, Tables: make(map[string]string)}
+	manifest, err := getManifest(ctx, store, node.ManifestKey)
+	if err != nil {
+		return request, err
+	}
+	for _, file := range r.selectFiles(manifest) {
+		keyspace, table, name := backup.SplitFilePath(file.Path)
+		dir := keyspace + "/" + table
+		if _, found := request.Tables[dir]; !found {
+			id, err := session.GetTableID(keyspace, table)
+			if err != nil {
+				return request, err
+			}
+			if id == "" {
+				return request, fmt.Errorf("table %s.%s does not exist", keyspace, table)
+			}
+			request.Tables[dir] = fmt.Sprintf("%s/%s-%s", keyspace, table, id)
+		}
+		request.Files = append(request.Files, backup.DownloadFile{
+			Key:  file.Key,
+			Path: dir + "/" + name,
+		})
+	}
+	return request, nil
+}
+
+// refreshTables loads the SSTables that have been moved into the directories of
+// the tables on the pod with nodetool refresh. Unlike nodetool import, which
+// needs Cassandra 4.0, refresh is available in 3.11.
+func (r *restoreRequestHandler) refreshTables(ctx context.Context, store backup.ObjectStore, pod *corev1.Pod, node *api.NodeRestoreStatus) error {
+	manifest, err := getManifest(ctx, store, node.ManifestKey)
+	if err != nil {
+		return err
+	}
+
+	refreshed := make(map[string]bool)
+	for _, file := range r.selectFiles(manifest) {
+		keyspace, table, _ := backup.SplitFilePath(file.Path)
+		if refreshed[keyspace+"."+table] {
+			continue
+		}
+		refreshed[keyspace+"."+table] = true
+
+		r.log.Info("refreshing table", "Pod", pod.Name, "Keyspace", keyspace, "Table", table)
+		if err = r.mgmtClient.RefreshTable(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), keyspace, table); err != nil {
+			return fmt.Errorf("failed to refresh %s.%s: %s", keyspace, table, err)
+		}
+	}
+	return nil
+}
+
+// selectFiles returns the SSTables of the manifest that belong to the tables
+// that are restored in place
+func (r *restoreRequestHandler) selectFiles(manifest *backup.Manifest) []backup.FileInfo {
+	keyspaces := make(map[string]bool)
+	for _, keyspace := range r.restore.Spec.Keyspaces {
+		keyspaces[keyspace] = true
+	}
+	tables := make(map[string]bool)
+	for _, table := range r.restore.Spec.Tables {
+		tables[table] = true
+	}
+	all := len(keyspaces) == 0 && len(tables) == 0
+
+	var files []backup.FileInfo
+	for _, file := range manifest.Files {
+		if !backup.IsSSTableComponent(file.Path) {
+			continue
+		}
+		keyspace, table, _ := backup.SplitFilePath(file.Path)
+		if (all && !systemKeyspaces[keyspace]) || keyspaces[keyspace] || tables[keyspace+"."+table] {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func getManifest(ctx context.Context, store backup.ObjectStore, key string) (*backup.Manifest, error) {
+	data, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &backup.Manifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %s", key, err)
+	}
+	return manifest, nil
+}
+
+// finish records the outcome of the restore. The restore fails if any node fails.
+func (r *restoreRequestHandler) finish(ctx context.Context, nodes []api.NodeRestoreStatus) result.ReconcileResult {
+	phase := api.RestorePhaseCompleted
+	var failed []string
+	for _, node := range nodes {
+		if node.Phase == api.NodeRestorePhaseFailed {
+			phase = api.RestorePhaseFailed
+			failed = append(failed, node.Pod)
+		}
+	}
+	r.log.Info("finished restore", "Phase", phase)
+
+	now := metav1.Now()
+	if err := r.updateStatus(ctx, func(status *api.CassandraRestoreStatus) {
+		status.Nodes = nodes
+		status.Phase = phase
+		status.CompletionTime = &now
+		status.Error = ""
+		if len(failed) > 0 {
+			status.Error = fmt.Sprintf("restore failed on %v", failed)
+		}
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRestore", r.restore.Name)
+		return result.Error(err)
+	}
+
+	return result.Done()
+}
+
+// updateStatus applies mutate to the status and patches it if it has changed
+func (r *restoreRequestHandler) updateStatus(ctx context.Context, mutate func(status *api.CassandraRestoreStatus)) error {
+	return r.patchStatus(ctx, func() { mutate(&r.restore.Status) })
+}
@@ -0,0 +1,273 @@
+package reconciliation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type roleRequestHandler struct {
+	clusterRefHandler
+	role *api.CassandraRole
+}
+
+func NewRoleRequestHandler(request *reconcile.Request, client client.Client, scheme *runtime.Scheme, log logr.Logger) RequestHandler {
+	return &roleRequestHandler{
+		clusterRefHandler: clusterRefHandler{request: request, Client: client, scheme: scheme, log: log},
+	}
+}
+
+func (r *roleRequestHandler) HandleRequest(ctx context.Context) (reconcile.Result, error) {
+	role := &api.CassandraRole{}
+	err := r.Get(ctx, r.request.NamespacedName, role)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		} else {
+			return ctrl.Result{}, err
+		}
+	}
+	r.role = role
+	r.setObject(role, func(err string) { role.Status.Error = err })
+
+	if result := r.CheckCluster(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if !role.DeletionTimestamp.IsZero() {
+		return r.CheckRoleDeletion(ctx).Output()
+	}
+
+	if result := r.CheckFinalizer(ctx); result.Completed() {
+		return result.Output()
+	}
+
+	if !r.cluster.Status.SuperuserCreated {
+		r.log.Info("waiting for the superuser to be created", "CassandraCluster", r.cluster.Name)
+		return result.RequeueSoon(10).Output()
+	}
+
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to connect to cluster", "CassandraCluster", r.cluster.Name)
+		return r.failed(ctx, err).Output()
+	}
+	defer session.Close()
+
+	if result := r.CheckRole(ctx, session); result.Completed() {
+		return result.Output()
+	}
+
+	if result := r.CheckPermissions(ctx, session); result.Completed() {
+		return result.Output()
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// CheckCluster looks up the cluster the role belongs to. A role whose cluster
+// is gone can be deleted without dropping it.
+func (r *roleRequestHandler) CheckCluster(ctx context.Context) result.ReconcileResult {
+	if !r.role.DeletionTimestamp.IsZero() {
+		if cluster, err := r.getCluster(ctx, r.role.Spec.ClusterRef); err == nil && cluster == nil {
+			return r.removeFinalizer(ctx)
+		}
+	}
+	return r.checkCluster(ctx, r.role.Spec.ClusterRef)
+}
+
+func (r *roleRequestHandler) CheckFinalizer(ctx context.Context) result.ReconcileResult {
+	if containsString(r.role.Finalizers, api.RoleFinalizer) {
+		return result.Continue()
+	}
+
+	patch := client.MergeFrom(r.role.DeepCopy())
+	controllerutil.AddFinalizer(r.role, api.RoleFinalizer)
+	if err := r.Patch(ctx, r.role, patch); err != nil {
+		r.log.Error(err, "failed to add finalizer", "CassandraRole", r.role.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// CheckRoleDeletion drops the role before the finalizer is removed
+func (r *roleRequestHandler) CheckRoleDeletion(ctx context.Context) result.ReconcileResult {
+	if !containsString(r.role.Finalizers, api.RoleFinalizer) {
+		return result.Done()
+	}
+
+	if r.role.Status.Created {
+		session, err := newSuperuserSession(ctx, r, r.cluster)
+		if err != nil {
+			r.log.Error(err, "failed to connect to cluster", "CassandraCluster", r.cluster.Name)
+			return result.RequeueSoon(10)
+		}
+		defer session.Close()
+
+		r.log.Info("dropping role", "Role", r.role.GetRoleName())
+		if err = session.DropRole(r.role.GetRoleName()); err != nil {
+			r.log.Error(err, "failed to drop role", "Role", r.role.GetRoleName())
+			return result.RequeueSoon(10)
+		}
+	}
+
+	return r.removeFinalizer(ctx)
+}
+
+func (r *roleRequestHandler) removeFinalizer(ctx context.Context) result.ReconcileResult {
+	patch := client.MergeFrom(r.role.DeepCopy())
+	controllerutil.RemoveFinalizer(r.role, api.RoleFinalizer)
+	if err := r.Patch(ctx, r.role, patch); err != nil {
+		r.log.Error(err, "failed to remove finalizer", "CassandraRole", r.role.Name)
+		return result.Error(err)
+	}
+	return result.Done()
+}
+
+// CheckRole creates the role or updates its options and password
+func (r *roleRequestHandler) CheckRole(ctx context.Context, session *cql.Session) result.ReconcileResult {
+	name := r.role.GetRoleName()
+	spec := r.role.Spec
+
+	password, secretVersion, err := r.getPassword(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to get password", "CassandraRole", r.role.Name)
+		return r.failed(ctx, err)
+	}
+
+	actual, err := session.GetRole(name)
+	if err != nil {
+		r.log.Error(err, "failed to look up role", "Role", name)
+		return r.failed(ctx, err)
+	}
+
+	if actual == nil {
+		r.log.Info("creating role", "Role", name)
+		err = session.CreateRole(name, password, spec.Login, spec.Superuser)
+	} else if actual.Login != spec.Login || actual.Superuser != spec.Superuser ||
+		secretVersion != r.role.Status.PasswordSecretVersion {
+		r.log.Info("updating role", "Role", name)
+		err = session.AlterRole(name, password, spec.Login, spec.Superuser)
+	}
+	if err != nil {
+		r.log.Error(err, "failed to apply role", "Role", name)
+		return r.failed(ctx, err)
+	}
+
+	if err = r.updateStatus(ctx, func(status *api.CassandraRoleStatus) {
+		status.Created = true
+		status.PasswordSecretVersion = secretVersion
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRole", r.role.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// getPassword returns the password of the role and the resource version of the
+// secret it is read from
+func (r *roleRequestHandler) getPassword(ctx context.Context) (string, string, error) {
+	ref := r.role.Spec.PasswordSecretRef
+	if ref == nil {
+		return "", "", nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.role.Namespace, Name: ref.Name}, secret); err != nil {
+		return "", "", err
+	}
+	password, found := secret.Data[ref.Key]
+	if !found {
+		return "", "", fmt.Errorf("key %s not found in secret %s", ref.Key, ref.Name)
+	}
+
+	return string(password), secret.ResourceVersion, nil
+}
+
+// CheckPermissions grants the permissions of the spec and revokes any other
+// permissions on data resources
+func (r *roleRequestHandler) CheckPermissions(ctx context.Context, session *cql.Session) result.ReconcileResult {
+	name := r.role.GetRoleName()
+
+	desired := make(map[string][]string)
+	for _, p := range r.role.Spec.Permissions {
+		resource := cql.DataResource(p.Keyspace, p.Table)
+		permissions := desired[resource]
+		for _, permission := range p.Permissions {
+			permissions = append(permissions, string(permission))
+		}
+		desired[resource] = permissions
+	}
+	for resource, permissions := range desired {
+		desired[resource] = cql.ExpandPermissions(permissions, resource)
+	}
+
+	actual, err := session.ListPermissions(name)
+	if err != nil {
+		r.log.Error(err, "failed to list permissions", "Role", name)
+		return r.failed(ctx, err)
+	}
+
+	for resource, permissions := range desired {
+		for _, permission := range permissions {
+			if containsString(actual[resource], permission) {
+				continue
+			}
+			r.log.Info("granting permission", "Role", name, "Permission", permission, "Resource", resource)
+			if err = session.Grant(permission, resource, name); err != nil {
+				r.log.Error(err, "failed to grant permission", "Role", name, "Permission", permission, "Resource", resource)
+				return r.failed(ctx, err)
+			}
+		}
+	}
+
+	for resource, permissions := range actual {
+		for _, permission := range permissions {
+			if containsString(desired[resource], permission) {
+				continue
+			}
+			r.log.Info("revoking permission", "Role", name, "Permission", permission, "Resource", resource)
+			if err = session.Revoke(permission, resource, name); err != nil {
+				r.log.Error(err, "failed to revoke permission", "Role", name, "Permission", permission, "Resource", resource)
+				return r.failed(ctx, err)
+			}
+		}
+	}
+
+	if err = r.updateStatus(ctx, func(status *api.CassandraRoleStatus) {
+		status.Permissions = r.role.Spec.Permissions
+		status.Error = ""
+	}); err != nil {
+		r.log.Error(err, "failed to update status", "CassandraRole", r.role.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// updateStatus applies mutate to the status and patches it if it has changed
+func (r *roleRequestHandler) updateStatus(ctx context.Context, mutate func(status *api.CassandraRoleStatus)) error {
+	return r.patchStatus(ctx, func() { mutate(&r.role.Status) })
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
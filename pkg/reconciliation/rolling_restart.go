@@ -0,0 +1,164 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CheckRollingRestart replaces, one at a time, the pods that are not running the
+// current revision of their StatefulSet. The StatefulSets use the OnDelete update
+// strategy, so without this step a configuration change would only be picked up
+// when a pod happens to be rescheduled. Pods are drained by their preStop hook
+// before they are stopped.
+func (r *requestHandler) CheckRollingRestart(ctx context.Context) result.ReconcileResult {
+	for i := range r.cluster.Spec.Datacenters {
+		if result := r.checkDatacenterRollingRestart(ctx, &r.cluster.Spec.Datacenters[i]); result.Completed() {
+			return result
+		}
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) checkDatacenterRollingRestart(ctx context.Context, dc *api.Datacenter) result.ReconcileResult {
+	configHash, err := getDatacenterConfigHash(r.cluster, dc)
+	if err != nil {
+		r.log.Error(err, "failed to compute config hash", "Datacenter", dc.Name)
+		return result.Error(err)
+	}
+
+	updateRevisions := make(map[string]string)
+	expectedPods := int32(0)
+	for _, rack := range dc.GetRacks() {
+		statefulSet := &appsv1.StatefulSet{}
+		nsName := newNamespacedNameForStatefulSet(r.cluster, dc.Name, rack.Name)
+		if err := r.Get(ctx, nsName, statefulSet); err != nil {
+			r.log.Error(err, "failed to get statefulset", "StatefulSet", nsName.Name)
+			return result.Error(err)
+		}
+		if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+			// The StatefulSet controller has not computed the revision for the
+			// latest pod template yet.
+			return result.RequeueSoon(5)
+		}
+		updateRevisions[rack.Name] = statefulSet.Status.UpdateRevision
+		expectedPods += *statefulSet.Spec.Replicas
+	}
+
+	pods, err := r.listDatacenterPods(ctx, dc.Name)
+	if err != nil {
+		r.log.Error(err, "failed to list pods", "Datacenter", dc.Name)
+		return result.Error(err)
+	}
+
+	// A pod that is not ready but outdated, e.g. one that crash-loops with a
+	// configuration that has since been fixed, does not block the rolling
+	// restart. It is restarted first instead, since it would otherwise never
+	// become ready.
+	var updated, outdated []string
+	var nextPod, notReadyOutdatedPod *corev1.Pod
+	blocked := int32(len(pods)) < expectedPods
+	for i := range pods {
+		pod := &pods[i]
+		isOutdated := pod.Labels[appsv1.StatefulSetRevisionLabel] != updateRevisions[pod.Labels[api.RackLabel]]
+		if pod.DeletionTimestamp != nil {
+			blocked = true
+		} else if !isPodReady(pod) {
+			if !isOutdated {
+				blocked = true
+			} else if notReadyOutdatedPod == nil {
+				notReadyOutdatedPod = pod
+			}
+		}
+		if isOutdated {
+			outdated = append(outdated, pod.Name)
+			if nextPod == nil {
+				nextPod = pod
+			}
+		} else {
+			updated = append(updated, pod.Name)
+		}
+	}
+	if notReadyOutdatedPod != nil {
+		nextPod = notReadyOutdatedPod
+	}
+
+	dcStatus := r.cluster.Status.Datacenters[dc.Name]
+	dcStatus.UpdatedNodes = updated
+	dcStatus.OutdatedNodes = outdated
+	dcStatus.RollingRestart = len(outdated) > 0
+	if len(outdated) == 0 {
+		dcStatus.ConfigHash = configHash
+	}
+	if err := r.updateDatacenterStatus(ctx, dc.Name, dcStatus); err != nil {
+		r.log.Error(err, "failed to update status", "Datacenter", dc.Name)
+		return result.Error(err)
+	}
+
+	if nextPod == nil {
+		return result.Continue()
+	}
+
+	if blocked {
+		r.log.Info("waiting for all nodes to be ready before restarting the next one", "Datacenter", dc.Name)
+		return result.RequeueSoon(10)
+	}
+
+	r.log.Info("restarting node to apply configuration changes", "Datacenter", dc.Name, "Pod", nextPod.Name)
+	if err := r.Delete(ctx, nextPod); err != nil {
+		r.log.Error(err, "failed to delete pod", "Pod", nextPod.Name)
+		return result.Error(err)
+	}
+
+	return result.RequeueSoon(10)
+}
+
+func (r *requestHandler) listDatacenterPods(ctx context.Context, dcName string) ([]corev1.Pod, error) {
+	return listPods(ctx, r, r.cluster.Namespace, r.cluster.GetDatacenterLabels(dcName))
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// getConfigHash returns the hash of the configuration rendered for the nodes of
+// a rack.
+func getConfigHash(cluster *api.CassandraCluster, dc *api.Datacenter, rack *api.Rack) (string, error) {
+	config, err := cluster.GetConfigAsJSON(dc, rack)
+	if err != nil {
+		return "", err
+	}
+	return deepHashString(withLoggers(cluster, config)), nil
+}
+
+// getDatacenterConfigHash returns the hash of the configuration rendered for all
+// racks of a datacenter.
+func getDatacenterConfigHash(cluster *api.CassandraCluster, dc *api.Datacenter) (string, error) {
+	var configs []string
+	for _, rack := range dc.GetRacks() {
+		config, err := cluster.GetConfigAsJSON(dc, &rack)
+		if err != nil {
+			return "", err
+		}
+		configs = append(configs, config)
+	}
+	return deepHashString(withLoggers(cluster, configs)), nil
+}
+
+// withLoggers adds the logger levels, which are applied to logback.xml by the
+// logback-init container, to the configuration that is hashed. They are only
+// added when they are set so that the hash of other clusters does not change.
+func withLoggers(cluster *api.CassandraCluster, config interface{}) interface{} {
+	if loggers := cluster.GetLoggers(); len(loggers) > 0 {
+		return []interface{}{config, loggers}
+	}
+	return config
+}
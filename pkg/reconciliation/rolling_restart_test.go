@@ -0,0 +1,116 @@
+package reconciliation
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestCheckDatacenterRollingRestart(t *testing.T) {
+	type testPod struct {
+		revision string
+		ready    bool
+	}
+
+	tests := []struct {
+		name      string
+		pods      []testPod
+		restarted string
+	}{
+		{
+			name:      "restarts the first outdated pod once all pods are ready",
+			pods:      []testPod{{"new", true}, {"old", true}, {"old", true}},
+			restarted: "test-dc1-rack-1-sts-1",
+		},
+		{
+			name: "waits for an updated pod to be ready",
+			pods: []testPod{{"new", false}, {"old", true}, {"old", true}},
+		},
+		{
+			name:      "restarts an outdated pod that is not ready first",
+			pods:      []testPod{{"new", true}, {"old", true}, {"old", false}},
+			restarted: "test-dc1-rack-1-sts-2",
+		},
+		{
+			name: "waits for an updated pod to be ready before restarting an outdated pod that is not ready",
+			pods: []testPod{{"new", false}, {"old", true}, {"old", false}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			scheme := runtime.NewScheme()
+			g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			g.Expect(api.AddToScheme(scheme)).To(Succeed())
+
+			cluster := &api.CassandraCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+				Spec: api.CassandraClusterSpec{
+					Name:        "test",
+					Datacenters: []api.Datacenter{{Name: "dc1", NodesPerRack: int32(len(tc.pods))}},
+				},
+			}
+			dc := &cluster.Spec.Datacenters[0]
+
+			statefulSet, err := newStatefulSet(cluster, dc, &dc.GetRacks()[0], nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			statefulSet.Status.UpdateRevision = "new"
+
+			objects := []runtime.Object{cluster.DeepCopy(), statefulSet}
+			for i, p := range tc.pods {
+				labels := cluster.GetRackLabels("dc1", "rack-1")
+				labels[appsv1.StatefulSetRevisionLabel] = p.revision
+				status := corev1.ConditionFalse
+				if p.ready {
+					status = corev1.ConditionTrue
+				}
+				objects = append(objects, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      statefulSet.Name + "-" + strconv.Itoa(i),
+						Labels:    labels,
+					},
+					Status: corev1.PodStatus{
+						Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+					},
+				})
+			}
+
+			r := &requestHandler{
+				Client:  fake.NewFakeClientWithScheme(scheme, objects...),
+				scheme:  scheme,
+				log:     log.Log,
+				cluster: cluster,
+			}
+
+			ctx := context.Background()
+			g.Expect(r.checkDatacenterRollingRestart(ctx, dc).Completed()).To(BeTrue())
+
+			pods := &corev1.PodList{}
+			g.Expect(r.List(ctx, pods, client.InNamespace("default"))).To(Succeed())
+			var remaining []string
+			for _, pod := range pods.Items {
+				remaining = append(remaining, pod.Name)
+			}
+			if tc.restarted == "" {
+				g.Expect(remaining).To(HaveLen(len(tc.pods)))
+			} else {
+				g.Expect(remaining).To(HaveLen(len(tc.pods) - 1))
+				g.Expect(remaining).ToNot(ContainElement(tc.restarted))
+			}
+		})
+	}
+}
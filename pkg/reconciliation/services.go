@@ -17,39 +17,117 @@ func (r *requestHandler) CheckHeadlessServices(ctx context.Context) result.Recon
 	services := []*corev1.Service{seedsService, allPodsService}
 
 	for idx := range services {
-		desiredSvc := services[idx]
+		if result := r.reconcileService(ctx, services[idx]); result.Completed() {
+			return result
+		}
+	}
+
+	return result.Continue()
+}
+
+// CheckDatacenterServices makes sure that each datacenter has a ClusterIP service
+// for CQL clients, and an external service when the datacenter is exposed.
+func (r *requestHandler) CheckDatacenterServices(ctx context.Context) result.ReconcileResult {
+	for i := range r.cluster.Spec.Datacenters {
+		dc := &r.cluster.Spec.Datacenters[i]
+
+		if result := r.reconcileService(ctx, newDatacenterServiceForCassandraCluster(r.cluster, dc)); result.Completed() {
+			return result
+		}
+
+		if dc.Expose != nil {
+			if result := r.reconcileService(ctx, newDatacenterExternalServiceForCassandraCluster(r.cluster, dc)); result.Completed() {
+				return result
+			}
+		} else {
+			nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetDatacenterExternalServiceName(dc.Name)}
+			if result := r.deleteServiceIfExists(ctx, nsName); result.Completed() {
+				return result
+			}
+		}
+	}
 
-		err := controllerutil.SetControllerReference(r.cluster, desiredSvc, r.scheme)
-		if err != nil {
-			r.log.Error(err, "could not set controller reference for headless desiredSvc", "Service", desiredSvc.Name)
+	return result.Continue()
+}
+
+// reconcileService creates desiredSvc if it does not exist yet and otherwise
+// updates it when it has drifted from the desired state.
+func (r *requestHandler) reconcileService(ctx context.Context, desiredSvc *corev1.Service) result.ReconcileResult {
+	err := controllerutil.SetControllerReference(r.cluster, desiredSvc, r.scheme)
+	if err != nil {
+		r.log.Error(err, "could not set controller reference for service", "Service", desiredSvc.Name)
+		return result.Error(err)
+	}
+
+	actualSvc := &corev1.Service{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: desiredSvc.Namespace, Name: desiredSvc.Name}, actualSvc)
+	if err != nil && errors.IsNotFound(err) {
+		if err = r.Create(ctx, desiredSvc); err != nil {
+			r.log.Error(err, "failed to create service", "Service", desiredSvc.Name)
 			return result.Error(err)
 		}
+	} else if err != nil {
+		r.log.Error(err, "could not get service", "Service", desiredSvc.Name)
+		return result.Error(err)
+	} else if !resourcesHaveSameHash(actualSvc, desiredSvc) {
+		// ClusterIP is immutable and node ports are allocated by the api server, so
+		// they are carried over from the existing service.
+		clusterIP := actualSvc.Spec.ClusterIP
+		nodePorts := make(map[string]int32)
+		for _, port := range actualSvc.Spec.Ports {
+			nodePorts[port.Name] = port.NodePort
+		}
 
-		actualSvc := &corev1.Service{}
-		err = r.Get(ctx, types.NamespacedName{Namespace: desiredSvc.Namespace, Name: desiredSvc.Name}, actualSvc)
-		if err != nil && errors.IsNotFound(err) {
-			if err = r.Create(context.TODO(), desiredSvc); err != nil {
-				r.log.Error(err, "failed to create headless service", "Service", desiredSvc.Name)
-				return result.Error(err)
+		actualSvc.Labels = desiredSvc.Labels
+		if actualSvc.Annotations == nil {
+			actualSvc.Annotations = make(map[string]string)
+		}
+		for k, v := range desiredSvc.Annotations {
+			actualSvc.Annotations[k] = v
+		}
+		actualSvc.Spec = desiredSvc.Spec
+		actualSvc.Spec.ClusterIP = clusterIP
+		if actualSvc.Spec.Type != corev1.ServiceTypeClusterIP {
+			for i := range actualSvc.Spec.Ports {
+				if actualSvc.Spec.Ports[i].NodePort == 0 {
+					actualSvc.Spec.Ports[i].NodePort = nodePorts[actualSvc.Spec.Ports[i].Name]
+				}
 			}
-		} else if err != nil {
-			r.log.Error(err, "could not get headless service", "Service", desiredSvc.Name)
+		}
+
+		if err = r.Update(ctx, actualSvc); err != nil {
+			r.log.Error(err, "failed to update service", "Service", desiredSvc.Name)
 			return result.Error(err)
-		} else {
-			// TODO Check to see if the service needs to be updated
-			return result.Continue()
 		}
 	}
 
 	return result.Continue()
 }
 
+func (r *requestHandler) deleteServiceIfExists(ctx context.Context, nsName types.NamespacedName) result.ReconcileResult {
+	svc := &corev1.Service{}
+	err := r.Get(ctx, nsName, svc)
+	if err != nil && errors.IsNotFound(err) {
+		return result.Continue()
+	} else if err != nil {
+		r.log.Error(err, "could not get service", "Service", nsName.Name)
+		return result.Error(err)
+	}
+
+	if err = r.Delete(ctx, svc); err != nil && !errors.IsNotFound(err) {
+		r.log.Error(err, "failed to delete service", "Service", nsName.Name)
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
 func newAllPodsServiceForCassandraCluster(cluster *api.CassandraCluster) *corev1.Service {
 	service := makeGenericHeadlessService(cluster)
 	service.ObjectMeta.Name = cluster.GetAllPodsServiceName()
 	service.Spec.PublishNotReadyAddresses = true
 
-	addHashAnnotation(service.ObjectMeta)
+	addHashAnnotation(service)
 
 	return service
 }
@@ -68,11 +146,58 @@ func newSeedsServiceForCassandraCluster(cluster *api.CassandraCluster) *corev1.S
 	//service.Spec.Selector = buildLabelSelectorForSeedService(cluster)
 	service.Spec.PublishNotReadyAddresses = true
 
-	addHashAnnotation(service.ObjectMeta)
+	addHashAnnotation(service)
 
 	return service
 }
 
+// newDatacenterServiceForCassandraCluster returns a ClusterIP service that load
+// balances CQL connections across the ready nodes of the datacenter.
+func newDatacenterServiceForCassandraCluster(cluster *api.CassandraCluster, dc *api.Datacenter) *corev1.Service {
+	labels := cluster.GetDatacenterLabels(dc.Name)
+	api.AddManagedByLabel(labels)
+
+	var service corev1.Service
+	service.ObjectMeta.Name = cluster.GetDatacenterServiceName(dc.Name)
+	service.ObjectMeta.Namespace = cluster.Namespace
+	service.ObjectMeta.Labels = labels
+	service.Spec.Selector = cluster.GetDatacenterLabels(dc.Name)
+	service.Spec.Type = corev1.ServiceTypeClusterIP
+	service.Spec.Ports = createClientServicePorts(cluster)
+
+	addHashAnnotation(&service)
+
+	return &service
+}
+
+// newDatacenterExternalServiceForCassandraCluster returns a NodePort or
+// LoadBalancer service exposing the native transport port of the datacenter to
+// clients outside of the Kubernetes cluster.
+func newDatacenterExternalServiceForCassandraCluster(cluster *api.CassandraCluster, dc *api.Datacenter) *corev1.Service {
+	labels := cluster.GetDatacenterLabels(dc.Name)
+	api.AddManagedByLabel(labels)
+
+	annotations := make(map[string]string)
+	for k, v := range dc.Expose.Annotations {
+		annotations[k] = v
+	}
+
+	var service corev1.Service
+	service.ObjectMeta.Name = cluster.GetDatacenterExternalServiceName(dc.Name)
+	service.ObjectMeta.Namespace = cluster.Namespace
+	service.ObjectMeta.Labels = labels
+	service.ObjectMeta.Annotations = annotations
+	service.Spec.Selector = cluster.GetDatacenterLabels(dc.Name)
+	service.Spec.Type = dc.Expose.Type
+	service.Spec.Ports = createClientServicePorts(cluster)
+	service.Spec.ExternalTrafficPolicy = dc.Expose.ExternalTrafficPolicy
+	service.Spec.LoadBalancerSourceRanges = dc.Expose.LoadBalancerSourceRanges
+
+	addHashAnnotation(&service)
+
+	return &service
+}
+
 // makeGenericHeadlessService returns a fresh k8s headless (aka ClusterIP equals "None") Service
 // struct that has the same namespace as the CassandraDatacenter argument, and proper labels for the DC.
 // The caller needs to fill in the ObjectMeta.Name value, at a minimum, before it can be created
@@ -89,6 +214,7 @@ func makeGenericHeadlessService(cluster *api.CassandraCluster) *corev1.Service {
 	service.Spec.Selector = cluster.GetClusterLabels()
 	service.Spec.Type = "ClusterIP"
 	service.Spec.ClusterIP = "None"
+	service.Spec.Ports = createServicePorts(cluster)
 
 	return &service
 }
@@ -2,6 +2,8 @@ package reconciliation
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
 	"github.com/jsanda/cassandra-operator/pkg/result"
 	appsv1 "k8s.io/api/apps/v1"
@@ -10,6 +12,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 const (
@@ -17,21 +21,38 @@ pvcName = "server-data"
 )
 
 func (r *requestHandler) CheckStatefulSet(ctx context.Context) result.ReconcileResult {
+	for i := range r.cluster.Spec.Datacenters {
+		dc := &r.cluster.Spec.Datacenters[i]
+		racks := dc.GetRacks()
+		for j := range racks {
+			if result := r.checkRackStatefulSet(ctx, dc, &racks[j]); result.Completed() {
+				return result
+			}
+		}
+	}
+
+	return result.Continue()
+}
+
+func (r *requestHandler) checkRackStatefulSet(ctx context.Context, dc *api.Datacenter, rack *api.Rack) result.ReconcileResult {
 	actualStatefulSet := &appsv1.StatefulSet{}
-	dcName := "dc1"
-	rackName := "rack-1"
-	nsName := newNamespacedNameForStatefulSet(r.cluster, dcName, rackName)
+	nsName := newNamespacedNameForStatefulSet(r.cluster, dc.Name, rack.Name)
+
+	desiredStatefulSet, err := newStatefulSet(r.cluster, dc, rack, r.podTemplateAnnotations)
+	if err != nil {
+		r.log.Error(err, "failed to create new statefulset", "StatefulSet", nsName.Name)
+		return result.Error(err)
+	}
+	if err = controllerutil.SetControllerReference(r.cluster, desiredStatefulSet, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for statefulset", "StatefulSet", nsName.Name)
+		return result.Error(err)
+	}
 
-	err := r.Get(ctx, nsName, actualStatefulSet)
+	err = r.Get(ctx, nsName, actualStatefulSet)
 
 	if err != nil && errors.IsNotFound(err) {
 		// create the statefulset
-		statefulSet, err := newStatefulSet(r.cluster, rackName)
-		if err != nil {
-			r.log.Error(err, "failed to create new statefulset", "StatefulSet", nsName.Name)
-			return result.Error(err)
-		}
-		if err = r.Create(ctx, statefulSet); err != nil {
+		if err = r.Create(ctx, desiredStatefulSet); err != nil {
 			r.log.Error(err, "failed to persist new statefulset", "StatefulSet", nsName.Name)
 			return result.Error(err)
 		}
@@ -39,11 +60,121 @@ func (r *requestHandler) CheckStatefulSet(ctx context.Context) result.ReconcileR
 	} else if err != nil {
 		r.log.Error(err, "failed to get statefulset", "StatefulSet", nsName.Name)
 		return result.Error(err)
-	} else {
-		result.Continue()
 	}
 
-	return result.Done()
+	if isLegacyStatefulSet(actualStatefulSet) {
+		if result := r.adoptLegacyStatefulSet(ctx, actualStatefulSet, dc, rack); result.Completed() {
+			return result
+		}
+		// The nodes of the legacy StatefulSet would be removed without being
+		// decommissioned, so it is not scaled down
+		if *desiredStatefulSet.Spec.Replicas < *actualStatefulSet.Spec.Replicas {
+			r.log.Info("not scaling down statefulset created by a previous version, set nodesPerRack to its number of replicas",
+				"StatefulSet", nsName.Name, "Replicas", *actualStatefulSet.Spec.Replicas)
+			desiredStatefulSet.Spec.Replicas = actualStatefulSet.Spec.Replicas
+		}
+	}
+
+	if !resourcesHaveSameHash(actualStatefulSet, desiredStatefulSet) {
+		// The selector, service name and volume claim templates are immutable
+		// so only the mutable parts of the spec are carried over. Pods are not
+		// touched here since the update strategy is OnDelete; CheckRollingRestart
+		// replaces them one at a time.
+		r.log.Info("updating statefulset", "StatefulSet", nsName.Name)
+		actualStatefulSet.Labels = desiredStatefulSet.Labels
+		actualStatefulSet.Annotations = desiredStatefulSet.Annotations
+		actualStatefulSet.Spec.Replicas = desiredStatefulSet.Spec.Replicas
+		actualStatefulSet.Spec.Template = desiredStatefulSet.Spec.Template
+		actualStatefulSet.Spec.UpdateStrategy = desiredStatefulSet.Spec.UpdateStrategy
+		if err = r.Update(ctx, actualStatefulSet); err != nil {
+			r.log.Error(err, "failed to update statefulset", "StatefulSet", nsName.Name)
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+// isLegacyStatefulSet returns true for the StatefulSets created before the
+// operator supported datacenters and racks. They select their pods by the
+// cluster label only, and their selector cannot be changed.
+func isLegacyStatefulSet(statefulSet *appsv1.StatefulSet) bool {
+	if statefulSet.Spec.Selector == nil {
+		return false
+	}
+	_, ok := statefulSet.Spec.Selector.MatchLabels[api.DatacenterLabel]
+	return !ok
+}
+
+// adoptLegacyStatefulSet adds the datacenter and rack labels to the pods and
+// PVCs of a legacy StatefulSet so that the steps that look them up by those
+// labels, e.g. the rolling restart and the decommission, find them. The pods
+// that the StatefulSet creates from then on get the labels from the template.
+func (r *requestHandler) adoptLegacyStatefulSet(ctx context.Context, statefulSet *appsv1.StatefulSet, dc *api.Datacenter, rack *api.Rack) result.ReconcileResult {
+	labels := r.cluster.GetRackLabels(dc.Name, rack.Name)
+	selector := client.MatchingLabels(statefulSet.Spec.Selector.MatchLabels)
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(statefulSet.Namespace), selector); err != nil {
+		r.log.Error(err, "failed to list pods of statefulset", "StatefulSet", statefulSet.Name)
+		return result.Error(err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !metav1.IsControlledBy(pod, statefulSet) || hasLabels(pod.Labels, labels) {
+			continue
+		}
+		r.log.Info("adding rack labels to pod of statefulset created by a previous version", "Pod", pod.Name)
+		patch := client.MergeFrom(pod.DeepCopy())
+		pod.Labels = mergeLabels(pod.Labels, labels)
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			r.log.Error(err, "failed to add rack labels to pod", "Pod", pod.Name)
+			return result.Error(err)
+		}
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, client.InNamespace(statefulSet.Namespace), selector); err != nil {
+		r.log.Error(err, "failed to list PVCs of statefulset", "StatefulSet", statefulSet.Name)
+		return result.Error(err)
+	}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if !strings.HasPrefix(pvc.Name, pvcName+"-"+statefulSet.Name+"-") || hasLabels(pvc.Labels, labels) {
+			continue
+		}
+		r.log.Info("adding rack labels to PVC of statefulset created by a previous version", "PersistentVolumeClaim", pvc.Name)
+		patch := client.MergeFrom(pvc.DeepCopy())
+		pvc.Labels = mergeLabels(pvc.Labels, labels)
+		if err := r.Patch(ctx, pvc, patch); err != nil {
+			r.log.Error(err, "failed to add rack labels to PVC", "PersistentVolumeClaim", pvc.Name)
+			return result.Error(err)
+		}
+	}
+
+	return result.Continue()
+}
+
+// hasLabels returns true if labels contains all of expected
+func hasLabels(labels, expected map[string]string) bool {
+	for k, v := range expected {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLabels returns labels with added set on top of them
+func mergeLabels(labels, added map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range added {
+		merged[k] = v
+	}
+	return merged
 }
 
 // Source: http://github.com/jsanda/cass-operator/blob/master/operator/pkg/reconciliation/constructor.go#L192-L192
@@ -55,64 +186,123 @@ func newNamespacedNameForStatefulSet(cluster *api.CassandraCluster, dcName strin
 }
 
 // Source: http://github.com/datastax/cass-operator/blob/master/operator/pkg/reconciliation/constructor.go#L238-L238
-func newStatefulSet(cluster *api.CassandraCluster, rackName string) (*appsv1.StatefulSet, error) {
-	pvcLabels := cluster.GetClusterLabels()
-	selectorLabels := cluster.GetClusterLabels()
+func newStatefulSet(cluster *api.CassandraCluster, dc *api.Datacenter, rack *api.Rack, podAnnotations map[string]string) (*appsv1.StatefulSet, error) {
+	pvcLabels := cluster.GetRackLabels(dc.Name, rack.Name)
+	selectorLabels := cluster.GetRackLabels(dc.Name, rack.Name)
 	volumeClaimTemplates := []corev1.PersistentVolumeClaim{newDataVolumeClaimTemplate(pvcLabels)}
-	nsName := newNamespacedNameForStatefulSet(cluster, "dc1", rackName)
-	replicas := int32(3)
+	nsName := newNamespacedNameForStatefulSet(cluster, dc.Name, rack.Name)
+	replicas := dc.GetNodesPerRack()
 
-	podTemplateSpec, err := buildPodTemplateSpec(cluster, rackName)
+	podTemplateSpec, err := buildPodTemplateSpec(cluster, dc, rack)
 	if err != nil {
 		return nil, err
 	}
+	for k, v := range podAnnotations {
+		podTemplateSpec.Annotations[k] = v
+	}
 
 	statefulSet := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: nsName.Name,
 			Namespace: nsName.Namespace,
-			Labels: cluster.GetClusterLabels(),
+			Labels: cluster.GetRackLabels(dc.Name, rack.Name),
 		},
 		Spec: appsv1.StatefulSetSpec{
 			Selector: &metav1.LabelSelector{
 				MatchLabels: selectorLabels,
 			},
 			Replicas: &replicas,
-			ServiceName: cluster.GetClusterName(),
+			// The service name is immutable, so StatefulSets created before it was
+			// set keep the one they were created with
+			ServiceName: cluster.GetGoverningServiceName(),
 			Template: *podTemplateSpec,
 			VolumeClaimTemplates: volumeClaimTemplates,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.OnDeleteStatefulSetStrategyType,
+			},
 		},
 	}
 
+	addHashAnnotation(statefulSet)
+
 	return statefulSet, nil
 }
 
 // Source: http://github.com/datastax/cass-operator/blob/master/operator/pkg/reconciliation/constructor.go#L575-L575
-func buildPodTemplateSpec(cluster *api.CassandraCluster, rackName string) (*corev1.PodTemplateSpec, error) {
+func buildPodTemplateSpec(cluster *api.CassandraCluster, dc *api.Datacenter, rack *api.Rack) (*corev1.PodTemplateSpec, error) {
 	template := &corev1.PodTemplateSpec{}
 
-	podLabels := cluster.GetClusterLabels()
+	podLabels := cluster.GetRackLabels(dc.Name, rack.Name)
 	api.AddManagedByLabel(podLabels)
 
 	template.Labels = podLabels
 
+	configHash, err := getConfigHash(cluster, dc, rack)
+	if err != nil {
+		return nil, err
+	}
+	template.Annotations = map[string]string{
+		api.ConfigHashAnnotation: configHash,
+	}
+
 	affinity := &corev1.Affinity{}
 	affinity.PodAntiAffinity = calculatePodAntiAffinity()
 
 	template.Spec.ServiceAccountName = "default"
 
-	template.Spec.Volumes = createVolumes()
+	if cluster.Spec.Networking.HostNetwork {
+		template.Spec.HostNetwork = true
+		template.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+
+	terminationGracePeriod := api.DefaultTerminationGracePeriod
+	template.Spec.TerminationGracePeriodSeconds = &terminationGracePeriod
+
+	template.Spec.Volumes = createVolumes(cluster)
 
-	serverConfigInitContainer, err := buildServerConfigInitContainer(cluster)
+	serverConfigInitContainer, err := buildServerConfigInitContainer(cluster, dc, rack)
 	if err != nil {
 		return nil, err
 	}
 
-	template.Spec.InitContainers = []corev1.Container {*serverConfigInitContainer}
+	template.Spec.InitContainers = []corev1.Container {*serverConfigInitContainer, *buildReplaceAddressInitContainer(cluster)}
+
+	if len(cluster.GetLoggers()) > 0 {
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *buildLogbackInitContainer(cluster))
+	}
+
+	if cluster.IsInternodeEncryptionEnabled() || cluster.IsClientEncryptionEnabled() {
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *buildKeystoreInitContainer(cluster))
+		template.Spec.Volumes = append(template.Spec.Volumes, createKeystoreVolumes(cluster)...)
+	}
+
+	if cluster.Spec.Reaper != nil {
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *buildJMXCredentialsInitContainer(cluster))
+		template.Spec.Volumes = append(template.Spec.Volumes, createJMXCredentialsVolume())
+	}
+
+	if cluster.Spec.Networking.NodeServices != nil {
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *buildBroadcastAddressInitContainer(cluster))
+	}
+
+	if cluster.IsCommitLogArchivingEnabled() {
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *buildCommitLogArchivingInitContainer(cluster))
+	}
+
+	if cluster.IsRestoredFromBackup() {
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *buildRestoreInitContainer(cluster))
+	}
 
 	var serverVolumeMounts []corev1.VolumeMount
+	// The data volume is mounted by buildContainers
+	mounted := map[string]bool{pvcName: true}
 	for _, c := range template.Spec.InitContainers {
-		serverVolumeMounts = append(serverVolumeMounts, c.VolumeMounts...)
+		for _, mount := range c.VolumeMounts {
+			if !mounted[mount.Name] {
+				mounted[mount.Name] = true
+				serverVolumeMounts = append(serverVolumeMounts, mount)
+			}
+		}
 	}
 
 	containers, err := buildContainers(cluster, serverVolumeMounts)
@@ -129,7 +319,7 @@ func buildContainers(cluster *api.CassandraCluster, serverVolumeMounts []corev1.
 	cassandraContainer := corev1.Container{}
 	cassandraContainer.Name = "cassandra"
 	//cassandraContainer.Image = "cassandra:3.11.6"
-	cassandraContainer.Image = "jsanda/cassandra:operator-3.11.6-latest"
+	cassandraContainer.Image = cluster.GetCassandraImage()
 	cassandraContainer.ImagePullPolicy = corev1.PullAlways
 	//cassandraContainer.Resources = corev1.ResourceRequirements{
 	//	Limits: corev1.ResourceList{
@@ -147,16 +337,53 @@ func buildContainers(cluster *api.CassandraCluster, serverVolumeMounts []corev1.
 			Value: "512M",
 		},
 	}
+	if cluster.Spec.Reaper != nil {
+		// Reaper connects to the nodes over JMX. JVM_EXTRA_OPTS is appended after
+		// the options set by cassandra-env.sh for remote JMX, so it points the
+		// authentication at the files written by the jmx-credentials-init
+		// container. JMX_USERNAME is used by nodetool in the probes.
+		cassandraContainer.Env = append(cassandraContainer.Env,
+			corev1.EnvVar{Name: "LOCAL_JMX", Value: "no"},
+			corev1.EnvVar{Name: "JVM_EXTRA_OPTS", Value: fmt.Sprintf(
+				"-Dcom.sun.management.jmxremote.authenticate=true -Dcom.sun.management.jmxremote.password.file=%[1]s/jmxremote.password -Dcom.sun.management.jmxremote.access.file=%[1]s/jmxremote.access",
+				jmxCredentialsDir)},
+			corev1.EnvVar{Name: "JMX_USERNAME", ValueFrom: selectorFromSecretKey(cluster.GetJMXSecretName(), credentialsUsernameKey)},
+		)
+	}
+
+	// The logs directory is set explicitly rather than relying on the image to
+	// link it to /var/log/cassandra
+	cassandraContainer.Env = append(cassandraContainer.Env, corev1.EnvVar{Name: "CASSANDRA_LOG_DIR", Value: serverLogsDir})
 
 	serverVolumeMounts = append(serverVolumeMounts, corev1.VolumeMount{
 		Name:      pvcName,
 		MountPath: "/var/lib/cassandra",
+	}, corev1.VolumeMount{
+		Name:      "server-logs",
+		MountPath: serverLogsDir,
+	}, corev1.VolumeMount{
+		Name:      "mgmt-api-tls",
+		MountPath: mgmtAPITLSDir,
+		ReadOnly:  true,
 	})
 	cassandraContainer.VolumeMounts = serverVolumeMounts
-	cassandraContainer.LivenessProbe = createCassandraProbe(api.DefaultLivenessProbeInitialDelay, api.DefaultLivenessProbePeriod, api.DefaultLivenessProbeTimeout)
-	cassandraContainer.ReadinessProbe = createCassandraProbe(api.DefaultReadinessProbeInitialDelay, api.DefaultReadinessProbePeriod, api.DefaultReadinessProbeTimeout)
+	cassandraContainer.Ports = createContainerPorts(cluster)
+	cassandraContainer.LivenessProbe = createLivenessProbe(cluster)
+	cassandraContainer.ReadinessProbe = createReadinessProbe(cluster)
+	cassandraContainer.Lifecycle = createDrainLifecycle(cluster)
+
+	containers := []corev1.Container{cassandraContainer}
+	if cluster.IsBackupEnabled() {
+		containers = append(containers, buildBackupAgentContainer(cluster))
+	}
+	if cluster.IsMetricsEnabled() {
+		containers = append(containers, buildMetricsExporterContainer(cluster))
+	}
+	if cluster.IsLogTailerEnabled() {
+		containers = append(containers, buildLogTailerContainer(cluster))
+	}
 
-	return []corev1.Container{cassandraContainer}, nil
+	return containers, nil
 }
 
 func newDataVolumeClaimTemplate(pvcLabels map[string]string) corev1.PersistentVolumeClaim {
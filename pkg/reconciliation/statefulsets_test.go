@@ -0,0 +1,102 @@
+package reconciliation
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestCheckRackStatefulSetAdoptsLegacyStatefulSet(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(api.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &api.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: api.CassandraClusterSpec{
+			Name:        "test",
+			Datacenters: []api.Datacenter{{Name: "dc1"}},
+		},
+	}
+
+	// The StatefulSet and its pods and PVCs as created before datacenters and
+	// racks were supported
+	replicas := int32(3)
+	legacy := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test-dc1-rack-1-sts",
+			Labels:    cluster.GetClusterLabels(),
+			UID:       "legacy",
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: cluster.GetClusterLabels()},
+			Replicas: &replicas,
+		},
+	}
+	isController := true
+	objects := []runtime.Object{legacy}
+	for _, name := range []string{"test-dc1-rack-1-sts-0", "test-dc1-rack-1-sts-1", "test-dc1-rack-1-sts-2"} {
+		objects = append(objects,
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    cluster.GetClusterLabels(),
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1",
+					Kind:       "StatefulSet",
+					Name:       legacy.Name,
+					UID:        legacy.UID,
+					Controller: &isController,
+				}},
+			}},
+			&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      pvcName + "-" + name,
+				Labels:    cluster.GetClusterLabels(),
+			}},
+		)
+	}
+
+	r := &requestHandler{
+		Client:  fake.NewFakeClientWithScheme(scheme, objects...),
+		scheme:  scheme,
+		log:     log.Log,
+		cluster: cluster,
+	}
+
+	ctx := context.Background()
+	dc := &cluster.Spec.Datacenters[0]
+	g.Expect(r.checkRackStatefulSet(ctx, dc, &dc.GetRacks()[0]).Completed()).To(BeFalse())
+
+	statefulSets := &appsv1.StatefulSetList{}
+	g.Expect(r.List(ctx, statefulSets)).To(Succeed())
+	g.Expect(statefulSets.Items).To(HaveLen(1))
+	statefulSet := statefulSets.Items[0]
+	g.Expect(statefulSet.Name).To(Equal(legacy.Name))
+	g.Expect(*statefulSet.Spec.Replicas).To(Equal(int32(3)))
+	g.Expect(statefulSet.Spec.Template.Labels).To(HaveKeyWithValue(api.RackLabel, "rack-1"))
+
+	pods, err := r.listDatacenterPods(ctx, "dc1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pods).To(HaveLen(3))
+	for _, pod := range pods {
+		g.Expect(pod.Labels).To(HaveKeyWithValue(api.RackLabel, "rack-1"))
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	g.Expect(r.Get(ctx, types.NamespacedName{Namespace: "default", Name: pvcName + "-test-dc1-rack-1-sts-0"}, pvc)).To(Succeed())
+	g.Expect(pvc.Labels).To(Equal(cluster.GetRackLabels("dc1", "rack-1")))
+}
@@ -0,0 +1,30 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// updateDatacenterStatus patches the status of the CassandraCluster with the
+// given datacenter status. No request is made if the status has not changed.
+func (r *requestHandler) updateDatacenterStatus(ctx context.Context, dcName string, dcStatus api.DatacenterStatus) error {
+	if current, found := r.cluster.Status.Datacenters[dcName]; found && equality.Semantic.DeepEqual(current, dcStatus) {
+		return nil
+	}
+
+	return r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+		if status.Datacenters == nil {
+			status.Datacenters = make(map[string]api.DatacenterStatus)
+		}
+		status.Datacenters[dcName] = dcStatus
+	})
+}
+
+// patchStatus applies mutate to the status of the CassandraCluster and patches it
+func (r *requestHandler) patchStatus(ctx context.Context, mutate func(status *api.CassandraClusterStatus)) error {
+	patch := client.MergeFrom(r.cluster.DeepCopy())
+	mutate(&r.cluster.Status)
+	return r.Status().Patch(ctx, r.cluster, patch)
+}
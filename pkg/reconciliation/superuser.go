@@ -0,0 +1,262 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	superuserUsernameKey    = "username"
+	superuserPasswordKey    = "password"
+	superuserPasswordLength = 32
+
+	defaultSuperuser = "cassandra"
+)
+
+// CheckSuperuser creates the superuser once all nodes are ready and disables
+// login for the default cassandra role. The role is created through the
+// management API since no credentials are known before it exists. When the
+// superuser secret changes later on, the new credentials are applied by logging
+// in with the ones that were applied before.
+func (r *requestHandler) CheckSuperuser(ctx context.Context) result.ReconcileResult {
+	credentials, secretResult := r.checkSuperuserSecret(ctx)
+	if secretResult.Completed() {
+		return secretResult
+	}
+
+	hash := deepHashString(credentials)
+	if r.cluster.Status.SuperuserCreated && r.cluster.Status.SuperuserCredentialsHash == hash {
+		return result.Continue()
+	}
+
+	ready, pods, err := r.isClusterReady(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to list pods")
+		return result.Error(err)
+	}
+	if !ready {
+		r.log.Info("waiting for all nodes to be ready before applying the superuser")
+		return result.RequeueSoon(10)
+	}
+
+	applied, err := r.getAppliedSuperuserCredentials(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to get applied superuser credentials")
+		return result.Error(err)
+	}
+
+	session, err := newCQLSession(ctx, r, r.cluster, pods, credentials)
+	if err != nil {
+		if !r.cluster.Status.SuperuserCreated {
+			r.log.Info("creating superuser", "Role", credentials.Username)
+			endpoint := mgmtapi.PodEndpoint(&pods[0], mgmtapi.DefaultPort)
+			if err = r.mgmtClient.CreateRole(ctx, endpoint, credentials.Username, credentials.Password, true, true); err != nil {
+				r.log.Error(err, "failed to create superuser", "Role", credentials.Username)
+				return result.RequeueSoon(10)
+			}
+		} else {
+			if applied == nil {
+				r.log.Info("cannot apply the superuser secret since the credentials applied before are not known")
+				return result.RequeueSoon(60)
+			}
+			if err = r.updateSuperuser(ctx, pods, *applied, credentials); err != nil {
+				r.log.Error(err, "failed to update superuser", "Role", credentials.Username)
+				return result.RequeueSoon(10)
+			}
+		}
+		if session, err = newCQLSession(ctx, r, r.cluster, pods, credentials); err != nil {
+			r.log.Error(err, "failed to connect as superuser", "Role", credentials.Username)
+			return result.RequeueSoon(10)
+		}
+	}
+	defer session.Close()
+
+	// The superuser that has been replaced is not needed to log in anymore
+	disable := []string{defaultSuperuser}
+	if applied != nil {
+		disable = append(disable, applied.Username)
+	}
+	for _, role := range disable {
+		if role == credentials.Username {
+			continue
+		}
+		exists, err := session.RoleExists(role)
+		if err != nil {
+			r.log.Error(err, "failed to look up role", "Role", role)
+			return result.RequeueSoon(10)
+		}
+		if exists {
+			if err = session.DisableLogin(role); err != nil {
+				r.log.Error(err, "failed to disable login", "Role", role)
+				return result.RequeueSoon(10)
+			}
+		}
+	}
+
+	if err = r.saveAppliedSuperuserCredentials(ctx, credentials); err != nil {
+		r.log.Error(err, "failed to save applied superuser credentials")
+		return result.Error(err)
+	}
+
+	err = r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+		status.SuperuserCreated = true
+		status.SuperuserCredentialsHash = hash
+	})
+	if err != nil {
+		r.log.Error(err, "failed to update status")
+		return result.Error(err)
+	}
+
+	return result.Continue()
+}
+
+// updateSuperuser logs in with the applied credentials and changes the password
+// of the superuser, or creates it when the username has changed
+func (r *requestHandler) updateSuperuser(ctx context.Context, pods []corev1.Pod, applied, credentials cql.Credentials) error {
+	session, err := newCQLSession(ctx, r, r.cluster, pods, applied)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	exists, err := session.RoleExists(credentials.Username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		r.log.Info("changing password of superuser", "Role", credentials.Username)
+		return session.AlterRole(credentials.Username, credentials.Password, true, true)
+	}
+	r.log.Info("creating superuser", "Role", credentials.Username)
+	return session.CreateRole(credentials.Username, credentials.Password, true, true)
+}
+
+// getAppliedSuperuserCredentials returns the superuser credentials that have
+// been applied to the cluster, or nil if they are not known
+func (r *requestHandler) getAppliedSuperuserCredentials(ctx context.Context) (*cql.Credentials, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetAppliedSuperuserSecretName()}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cql.Credentials{
+		Username: string(secret.Data[superuserUsernameKey]),
+		Password: string(secret.Data[superuserPasswordKey]),
+	}, nil
+}
+
+// saveAppliedSuperuserCredentials keeps the credentials that have been applied
+// to the cluster so that they can be used to apply the next change
+func (r *requestHandler) saveAppliedSuperuserCredentials(ctx context.Context, credentials cql.Credentials) error {
+	labels := r.cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+
+	desiredSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.cluster.GetAppliedSuperuserSecretName(),
+			Namespace: r.cluster.Namespace,
+			Labels:    labels,
+		},
+		Data: map[string][]byte{
+			superuserUsernameKey: []byte(credentials.Username),
+			superuserPasswordKey: []byte(credentials.Password),
+		},
+	}
+	if err := controllerutil.SetControllerReference(r.cluster, desiredSecret, r.scheme); err != nil {
+		return err
+	}
+
+	actualSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: desiredSecret.Namespace, Name: desiredSecret.Name}, actualSecret)
+	if err != nil && errors.IsNotFound(err) {
+		return r.Create(ctx, desiredSecret)
+	} else if err != nil {
+		return err
+	}
+	actualSecret.Data = desiredSecret.Data
+	return r.Update(ctx, actualSecret)
+}
+
+// checkSuperuserSecret returns the credentials of the superuser. The secret is
+// generated unless the spec references an existing one.
+func (r *requestHandler) checkSuperuserSecret(ctx context.Context) (cql.Credentials, result.ReconcileResult) {
+	nsName := types.NamespacedName{Namespace: r.cluster.Namespace, Name: r.cluster.GetSuperuserSecretName()}
+	credentials, err := getSuperuserCredentials(ctx, r, r.cluster)
+	if err == nil {
+		return credentials, result.Continue()
+	} else if !errors.IsNotFound(err) {
+		r.log.Error(err, "failed to get superuser secret", "Secret", nsName.Name)
+		return cql.Credentials{}, result.Error(err)
+	}
+
+	if r.cluster.Spec.Security.Authentication.SuperuserSecretName != "" {
+		r.log.Info("waiting for superuser secret", "Secret", nsName.Name)
+		return cql.Credentials{}, result.RequeueSoon(10)
+	}
+
+	password, err := generatePassword(superuserPasswordLength)
+	if err != nil {
+		r.log.Error(err, "failed to generate superuser password")
+		return cql.Credentials{}, result.Error(err)
+	}
+
+	labels := r.cluster.GetClusterLabels()
+	api.AddManagedByLabel(labels)
+
+	credentials = cql.Credentials{Username: nsName.Name, Password: password}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nsName.Name,
+			Namespace: nsName.Namespace,
+			Labels:    labels,
+		},
+		StringData: map[string]string{
+			superuserUsernameKey: credentials.Username,
+			superuserPasswordKey: credentials.Password,
+		},
+	}
+	if err = controllerutil.SetControllerReference(r.cluster, secret, r.scheme); err != nil {
+		r.log.Error(err, "could not set controller reference for secret", "Secret", nsName.Name)
+		return cql.Credentials{}, result.Error(err)
+	}
+	if err = r.Create(ctx, secret); err != nil {
+		r.log.Error(err, "failed to create superuser secret", "Secret", nsName.Name)
+		return cql.Credentials{}, result.Error(err)
+	}
+
+	return credentials, result.Continue()
+}
+
+// isClusterReady returns true when every node of every datacenter is ready. The
+// pods of the cluster are returned as well.
+func (r *requestHandler) isClusterReady(ctx context.Context) (bool, []corev1.Pod, error) {
+	var clusterPods []corev1.Pod
+	ready := true
+	for _, dc := range r.cluster.Spec.Datacenters {
+		pods, err := r.listDatacenterPods(ctx, dc.Name)
+		if err != nil {
+			return false, nil, err
+		}
+		if len(pods) != int(dc.GetSize()) {
+			ready = false
+		}
+		for i := range pods {
+			if !isPodReady(&pods[i]) {
+				ready = false
+			}
+		}
+		clusterPods = append(clusterPods, pods...)
+	}
+
+	return ready && len(clusterPods) > 0, clusterPods, nil
+}
@@ -0,0 +1,195 @@
+package reconciliation
+
+import (
+	"context"
+	api "github.com/jsanda/cassandra-operator/api/v1alpha1"
+	"github.com/jsanda/cassandra-operator/pkg/cql"
+	"github.com/jsanda/cassandra-operator/pkg/mgmtapi"
+	"github.com/jsanda/cassandra-operator/pkg/result"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CheckSystemKeyspaces keeps the replication of system_auth, system_distributed
+// and system_traces in line with the datacenters of the cluster. The applied
+// replication is recorded in the status so that the cluster is only contacted
+// when the topology changes. A new datacenter is only added to the replication
+// once all of its nodes have joined. The keyspaces whose replication is raised
+// are repaired afterwards, since the new replicas do not have their data yet.
+func (r *requestHandler) CheckSystemKeyspaces(ctx context.Context) result.ReconcileResult {
+	desired := r.cluster.GetSystemReplication()
+	if equality.Semantic.DeepEqual(r.cluster.Status.SystemReplication, desired) {
+		return r.checkSystemKeyspacesRepair(ctx)
+	}
+
+	ready, _, err := r.isClusterReady(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to list pods")
+		return result.Error(err)
+	}
+	if !ready {
+		return result.Continue()
+	}
+
+	session, err := newSuperuserSession(ctx, r, r.cluster)
+	if err != nil {
+		r.log.Error(err, "failed to connect to cluster")
+		return result.RequeueSoon(10)
+	}
+	defer session.Close()
+
+	raised, err := updateSystemReplication(session, desired)
+	if err != nil {
+		r.log.Error(err, "failed to update replication of system keyspaces")
+		return result.RequeueSoon(10)
+	}
+	r.log.Info("updated replication of system keyspaces", "Replication", desired)
+
+	if err = r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+		status.SystemReplication = desired
+		if len(raised) == 0 {
+			return
+		}
+		// A repair that is still running starts over, since the nodes it has
+		// repaired do not have the data of the new replicas either
+		keyspaces := raised
+		if status.SystemKeyspacesRepair != nil {
+			for _, keyspace := range status.SystemKeyspacesRepair.Keyspaces {
+				if !containsString(keyspaces, keyspace) {
+					keyspaces = append(keyspaces, keyspace)
+				}
+			}
+		}
+		now := metav1.Now()
+		status.SystemKeyspacesRepair = &api.SystemKeyspacesRepairStatus{Keyspaces: keyspaces, StartTime: &now}
+	}); err != nil {
+		r.log.Error(err, "failed to update status")
+		return result.Error(err)
+	}
+
+	return r.checkSystemKeyspacesRepair(ctx)
+}
+
+// checkSystemKeyspacesRepair has every node repair the system keyspaces whose
+// replication has been raised, one node and keyspace at a time
+func (r *requestHandler) checkSystemKeyspacesRepair(ctx context.Context) result.ReconcileResult {
+	if r.cluster.Status.SystemKeyspacesRepair == nil {
+		return result.Continue()
+	}
+	repair := r.cluster.Status.SystemKeyspacesRepair.DeepCopy()
+
+	ready, pods, err := r.isClusterReady(ctx)
+	if err != nil {
+		r.log.Error(err, "failed to list pods")
+		return result.Error(err)
+	}
+	if !ready {
+		r.log.Info("waiting for the cluster to be ready to repair system keyspaces")
+		return result.Continue()
+	}
+
+	if repair.CurrentNode != "" && findPod(pods, repair.CurrentNode) == nil {
+		repair.CurrentNode = ""
+		repair.CurrentKeyspace = ""
+		repair.JobID = ""
+	}
+
+	if repair.JobID != "" {
+		pod := findPod(pods, repair.CurrentNode)
+		switch status, jobErr := r.getJobStatus(ctx, pod, repair.JobID); status {
+		case mgmtapi.JobStatusCompleted:
+			r.log.Info("finished repairing system keyspace", "Pod", pod.Name, "Keyspace", repair.CurrentKeyspace)
+			repair.JobID = ""
+			repair.Error = ""
+			if next := nextString(repair.Keyspaces, repair.CurrentKeyspace); next != "" {
+				repair.CurrentKeyspace = next
+			} else {
+				repair.RepairedNodes = append(repair.RepairedNodes, pod.Name)
+				repair.CurrentNode = ""
+				repair.CurrentKeyspace = ""
+			}
+		case mgmtapi.JobStatusError:
+			r.log.Info("repair of system keyspace failed, retrying", "Pod", pod.Name, "Keyspace", repair.CurrentKeyspace, "Error", jobErr)
+			repair.JobID = ""
+			repair.Error = jobErr
+		default:
+			return result.RequeueSoon(30)
+		}
+	}
+
+	if repair.CurrentNode == "" {
+		for i := range pods {
+			if !containsString(repair.RepairedNodes, pods[i].Name) {
+				repair.CurrentNode = pods[i].Name
+				repair.CurrentKeyspace = repair.Keyspaces[0]
+				break
+			}
+		}
+	}
+
+	if repair.CurrentNode == "" {
+		r.log.Info("finished repairing system keyspaces", "Keyspaces", repair.Keyspaces)
+		if err = r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+			status.SystemKeyspacesRepair = nil
+		}); err != nil {
+			r.log.Error(err, "failed to update status")
+			return result.Error(err)
+		}
+		return result.Continue()
+	}
+
+	pod := findPod(pods, repair.CurrentNode)
+	r.log.Info("repairing system keyspace", "Pod", pod.Name, "Keyspace", repair.CurrentKeyspace)
+	jobID, err := r.mgmtClient.Repair(ctx, mgmtapi.PodEndpoint(pod, mgmtapi.DefaultPort), mgmtapi.RepairRequest{
+		Keyspace: repair.CurrentKeyspace,
+		Full:     true,
+	})
+	if err != nil {
+		r.log.Error(err, "failed to start repair", "Pod", pod.Name, "Keyspace", repair.CurrentKeyspace)
+		repair.Error = err.Error()
+	} else {
+		repair.JobID = jobID
+	}
+
+	if err = r.patchStatus(ctx, func(status *api.CassandraClusterStatus) {
+		status.SystemKeyspacesRepair = repair
+	}); err != nil {
+		r.log.Error(err, "failed to update status")
+		return result.Error(err)
+	}
+	return result.RequeueSoon(30)
+}
+
+// updateSystemReplication alters the system keyspaces whose replication differs
+// from replication. It returns the keyspaces that now have more replicas in any
+// datacenter than before.
+func updateSystemReplication(session *cql.Session, replication map[string]int32) ([]string, error) {
+	var raised []string
+	for _, keyspace := range cql.SystemKeyspaces {
+		actual, err := session.GetReplication(keyspace)
+		if err != nil {
+			return nil, err
+		}
+		if cql.ReplicationEquals(actual, replication) {
+			continue
+		}
+		if err = session.AlterReplication(keyspace, replication); err != nil {
+			return nil, err
+		}
+		if cql.IsReplicationRaised(actual, replication) {
+			raised = append(raised, keyspace)
+		}
+	}
+	return raised, nil
+}
+
+// nextString returns the value that follows s in values, or an empty string if
+// s is the last one
+func nextString(values []string, s string) string {
+	for i := range values {
+		if values[i] == s && i+1 < len(values) {
+			return values[i+1]
+		}
+	}
+	return ""
+}
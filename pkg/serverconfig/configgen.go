@@ -20,7 +20,8 @@ func GetModelValues(
 	cqlPort int,
 	cqlSSLPort int,
 	broadcastPort int,
-	broadcastSSLPort int) NodeConfig {
+	broadcastSSLPort int,
+	jmxPort int) NodeConfig {
 
 	seedsString := strings.Join(seeds, ",")
 
@@ -39,16 +40,29 @@ func GetModelValues(
 		"cassandra-yaml": NodeConfig{},
 	}
 
+	// When client encryption is enabled and native_transport_port_ssl differs from
+	// native_transport_port, Cassandra accepts unencrypted connections on the
+	// latter, so both have to be set.
+	if cqlPort != 0 {
+		modelValues["cassandra-yaml"].(NodeConfig)["native_transport_port"] = cqlPort
+	}
 	if cqlSSLPort != 0 {
 		modelValues["cassandra-yaml"].(NodeConfig)["native_transport_port_ssl"] = cqlSSLPort
-	} else if cqlPort != 0 {
-		modelValues["cassandra-yaml"].(NodeConfig)["native_transport_port"] = cqlPort
 	}
 
+	// Likewise, storage_port is used for internode connections to and from nodes
+	// that do not encrypt them, so it has to be set along with ssl_storage_port.
+	if broadcastPort != 0 {
+		modelValues["cassandra-yaml"].(NodeConfig)["storage_port"] = broadcastPort
+	}
 	if broadcastSSLPort != 0 {
 		modelValues["cassandra-yaml"].(NodeConfig)["ssl_storage_port"] = broadcastSSLPort
-	} else if broadcastPort != 0 {
-		modelValues["cassandra-yaml"].(NodeConfig)["storage_port"] = broadcastPort
+	}
+
+	if jmxPort != 0 {
+		modelValues["cassandra-env-sh"] = NodeConfig{
+			"jmx-port": jmxPort,
+		}
 	}
 
 	return modelValues